@@ -16,6 +16,42 @@ type Config struct {
 	AllowedOrigins   string
 	UploadPath       string
 	MaxUploadSize    int64
+	AppBaseURL       string
+	MailDriver       string
+	MailFrom         string
+	MailLogPath      string
+	SMTPHost         string
+	SMTPPort         string
+	SMTPUser         string
+	SMTPPassword     string
+	PasswordMinLen   int
+	ResetTokenMins   int
+	VerifyTokenHrs   int
+	LoginMaxFails    int
+	LoginWindowMin   int
+	LockoutBaseMin   int
+	LockoutMaxMin    int
+	IPMaxFails       int
+	AlertAccounts    int
+	AlertEmail       string
+	MFARoles         string
+	MFAIssuer        string
+	AreaTolerance    int
+	YieldAlertPct    int
+	AgeingInterval   int
+	CompanyName      string
+	CompanyAddress   string
+	ReportInterval   int
+	QualityFlagMin   int
+	QualityFlagPct   int
+	DashboardTTL     int
+	AuditSealSecs    int
+	CheckpointMin    int
+	CheckpointDir    string
+	AuditKeyFile     string
+	LogRetention     int
+	ArchivePath      string
+	ArchiveMin       int
 }
 
 var AppConfig Config
@@ -34,6 +70,42 @@ func LoadConfig() {
 		AllowedOrigins: getEnv("ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:5173"),
 		UploadPath:     getEnv("UPLOAD_PATH", "./uploads"),
 		MaxUploadSize:  getEnvAsInt64("MAX_UPLOAD_SIZE", 10485760),
+		AppBaseURL:     getEnv("APP_BASE_URL", "http://localhost:5173"),
+		MailDriver:     getEnv("MAIL_DRIVER", "file"),
+		MailFrom:       getEnv("MAIL_FROM", "no-reply@sawit.com"),
+		MailLogPath:    getEnv("MAIL_LOG_PATH", "./mail"),
+		SMTPHost:       getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:       getEnv("SMTP_PORT", "1025"),
+		SMTPUser:       getEnv("SMTP_USER", ""),
+		SMTPPassword:   getEnv("SMTP_PASSWORD", ""),
+		PasswordMinLen: getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+		ResetTokenMins: getEnvAsInt("RESET_TOKEN_MINUTES", 30),
+		VerifyTokenHrs: getEnvAsInt("VERIFY_TOKEN_HOURS", 48),
+		LoginMaxFails:  getEnvAsInt("LOGIN_MAX_FAILS", 5),
+		LoginWindowMin: getEnvAsInt("LOGIN_WINDOW_MINUTES", 15),
+		LockoutBaseMin: getEnvAsInt("LOCKOUT_BASE_MINUTES", 5),
+		LockoutMaxMin:  getEnvAsInt("LOCKOUT_MAX_MINUTES", 1440),
+		IPMaxFails:     getEnvAsInt("LOGIN_IP_MAX_FAILS", 20),
+		AlertAccounts:  getEnvAsInt("LOGIN_ALERT_ACCOUNTS", 10),
+		AlertEmail:     getEnv("SECURITY_ALERT_EMAIL", ""),
+		MFARoles:       getEnv("MFA_REQUIRED_ROLES", "admin"),
+		MFAIssuer:      getEnv("MFA_ISSUER", "Sawit"),
+		AreaTolerance:  getEnvAsInt("AREA_TOLERANCE_PERCENT", 5),
+		YieldAlertPct:  getEnvAsInt("YIELD_ALERT_PERCENT", 80),
+		AgeingInterval: getEnvAsInt("STOK_AGEING_INTERVAL_MINUTES", 60),
+		CompanyName:    getEnv("COMPANY_NAME", "Perkebunan Kelapa Sawit"),
+		CompanyAddress: getEnv("COMPANY_ADDRESS", ""),
+		ReportInterval: getEnvAsInt("REPORT_SCHEDULER_INTERVAL_SECONDS", 60),
+		QualityFlagMin: getEnvAsInt("QUALITY_FLAG_MIN_DOWNGRADES", 3),
+		QualityFlagPct: getEnvAsInt("QUALITY_FLAG_PERCENT", 20),
+		DashboardTTL:   getEnvAsInt("DASHBOARD_CACHE_SECONDS", 60),
+		AuditSealSecs:  getEnvAsInt("AUDIT_SEAL_INTERVAL_SECONDS", 10),
+		CheckpointMin:  getEnvAsInt("AUDIT_CHECKPOINT_INTERVAL_MINUTES", 1440),
+		CheckpointDir:  getEnv("AUDIT_CHECKPOINT_DIR", "./audit-checkpoints"),
+		AuditKeyFile:   getEnv("AUDIT_SIGNING_KEY_FILE", "./audit-signing.key"),
+		LogRetention:   getEnvAsInt("LOG_RETENTION_DAYS", 365),
+		ArchivePath:    getEnv("LOG_ARCHIVE_PATH", "./log-archive"),
+		ArchiveMin:     getEnvAsInt("LOG_ARCHIVE_INTERVAL_MINUTES", 1440),
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -43,6 +44,25 @@ func InitDB() {
 	log.Println("Database connected successfully")
 }
 
+// CreateDatabase creates the configured database when it does not exist yet, so a
+// fresh server only needs `migrate up`
+func CreateDatabase() {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/",
+		getEnv("DB_USER", "root"), getEnv("DB_PASSWORD", ""), getEnv("DB_HOST", "localhost"), getEnv("DB_PORT", "3306"))
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+	defer db.Close()
+
+	name := strings.ReplaceAll(getEnv("DB_NAME", "sawit_db"), "`", "``")
+	_, err = db.Exec("CREATE DATABASE IF NOT EXISTS `" + name + "` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci")
+	if err != nil {
+		log.Fatal("Error creating database: ", err)
+	}
+}
+
 // CloseDB closes database connection
 func CloseDB() {
 	if DB != nil {
@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/mailer"
+	"sawit-backend/models"
+	"sawit-backend/repository"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenPasswordReset = "password_reset"
+	tokenEmailVerify   = "email_verify"
+)
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+// ForgotPassword sends a password reset link to the user's email
+func (h *UserHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Always answer the same way so the endpoint can't be used to probe emails
+	response := gin.H{"message": "If the email is registered, a reset link has been sent"}
+
+	user, err := h.store.Users().FindByEmail(req.Email)
+	if err == repository.ErrNotFound || (err == nil && user.Status != "active") {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	ttl := time.Duration(config.AppConfig.ResetTokenMins) * time.Minute
+	token, err := issueAuthToken(h.store.Auth(), user.ID, tokenPasswordReset, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reset token"})
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.AppConfig.AppBaseURL, token)
+	err = mailer.Client.Send(mailer.Message{
+		To:      []string{req.Email},
+		Subject: "Reset Password - Sistem Informasi Perkebunan Sawit",
+		Body: fmt.Sprintf("Halo %s,\n\nKami menerima permintaan reset password untuk akun Anda.\n"+
+			"Buka tautan berikut dalam %d menit untuk membuat password baru:\n\n%s\n\n"+
+			"Abaikan email ini jika Anda tidak meminta reset password.\n",
+			user.Username, config.AppConfig.ResetTokenMins, link),
+	})
+	if err != nil {
+		log.Printf("ForgotPassword - Failed to send mail: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send reset email"})
+		return
+	}
+
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "request_password_reset", Modul: "auth", UserID: &user.ID,
+		Aktivitas: "Meminta reset password",
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password using a reset token
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The token is only looked up here and used once the new password is accepted,
+	// so a password rejected by the policy does not cost the user their link
+	tokenID, userID, err := h.store.Auth().FindToken(hashToken(req.Token), tokenPasswordReset)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	user, err := h.store.Users().FindByID(userID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err := validatePassword(req.Password, user.Username, user.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	err = h.store.WithTx(func(tx repository.Store) error {
+		// A concurrent reset with the same link loses here
+		used, err := tx.Auth().UseToken(tokenID)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errInvalidToken
+		}
+
+		logs := tx.Logs()
+		before := snapshotOf(logs, "user", int64(userID))
+
+		// Receiving the reset link also proves ownership of the email
+		if err := tx.Users().SetPassword(userID, string(hashedPassword)); err != nil {
+			return err
+		}
+
+		// Invalidate any other outstanding reset links
+		if err := tx.Auth().UseTokens(userID, tokenPasswordReset); err != nil {
+			return err
+		}
+
+		recordAuditTo(logs, c, auditEvent{
+			Aksi: "reset_password", Modul: "auth", Entitas: "user", ID: int64(userID), Sebelum: before, UserID: &userID,
+			Aktivitas: "Reset password",
+		})
+		return nil
+	})
+	if err == errInvalidToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully"})
+}
+
+// VerifyEmail marks the user's email as verified
+func (h *UserHandler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := consumeAuthToken(h.store.Auth(), req.Token, tokenEmailVerify)
+	if err == errInvalidToken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	logs := h.store.Logs()
+	before := snapshotOf(logs, "user", int64(userID))
+
+	if err := h.store.Users().VerifyEmail(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	recordAuditTo(logs, c, auditEvent{
+		Aksi: "verify_email", Modul: "auth", Entitas: "user", ID: int64(userID), Sebelum: before, UserID: &userID,
+		Aktivitas: "Verifikasi email",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification sends a new verification email
+func (h *UserHandler) ResendVerification(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"message": "If the email is registered and unverified, a verification link has been sent"}
+
+	user, err := h.store.Users().FindByEmail(req.Email)
+	if err == repository.ErrNotFound || (err == nil && user.EmailVerifiedAt != nil) {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := sendVerificationEmail(h.store.Auth(), user.ID, user.Username, req.Email); err != nil {
+		log.Printf("ResendVerification - Failed to send mail: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// sendVerificationEmail issues a verification token and mails the link
+func sendVerificationEmail(auth repository.AuthRepository, userID int, username, email string) error {
+	ttl := time.Duration(config.AppConfig.VerifyTokenHrs) * time.Hour
+	token, err := issueAuthToken(auth, userID, tokenEmailVerify, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.AppConfig.AppBaseURL, token)
+	return mailer.Client.Send(mailer.Message{
+		To:      []string{email},
+		Subject: "Verifikasi Email - Sistem Informasi Perkebunan Sawit",
+		Body: fmt.Sprintf("Halo %s,\n\nTerima kasih telah mendaftar.\n"+
+			"Buka tautan berikut dalam %d jam untuk memverifikasi email Anda:\n\n%s\n",
+			username, config.AppConfig.VerifyTokenHrs, link),
+	})
+}
+
+// issueAuthToken creates a random single-use token and stores only its hash
+func issueAuthToken(auth repository.AuthRepository, userID int, purpose string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := auth.CreateToken(userID, purpose, hashToken(token), time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeAuthToken marks a valid token as used and returns its owner
+func consumeAuthToken(auth repository.AuthRepository, token, purpose string) (int, error) {
+	tokenID, userID, err := auth.FindToken(hashToken(token), purpose)
+	if err == repository.ErrNotFound {
+		return 0, errInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// The used_at guard makes concurrent redemptions of the same token fail
+	used, err := auth.UseToken(tokenID)
+	if err != nil {
+		return 0, err
+	}
+	if !used {
+		return 0, errInvalidToken
+	}
+	return userID, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// validatePassword enforces the password policy
+func validatePassword(password, username, email string) error {
+	if len(password) < config.AppConfig.PasswordMinLen {
+		return fmt.Errorf("Password must be at least %d characters", config.AppConfig.PasswordMinLen)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("Password must contain both letters and numbers")
+	}
+
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		return errors.New("Password must not contain the username")
+	}
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok && len(local) >= 3 && strings.Contains(lower, local) {
+		return errors.New("Password must not contain the email address")
+	}
+	return nil
+}
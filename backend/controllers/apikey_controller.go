@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/middleware"
+	"sawit-backend/models"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// GetServiceAccounts returns all service accounts (admin only)
+func GetServiceAccounts(c *gin.Context) {
+	rows, err := config.DB.Query(`
+		SELECT u.id, u.username, u.email, u.company_name, u.status, u.created_at,
+		       COUNT(k.id) AS active_keys
+		FROM users u
+		LEFT JOIN api_keys k ON k.user_id = u.id AND k.revoked_at IS NULL
+		WHERE u.role = 'service'
+		GROUP BY u.id, u.username, u.email, u.company_name, u.status, u.created_at
+		ORDER BY u.username
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service accounts"})
+		return
+	}
+	defer rows.Close()
+
+	accounts := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		var id, activeKeys int
+		var username, email, status string
+		var companyName sql.NullString
+		var createdAt time.Time
+		if err := rows.Scan(&id, &username, &email, &companyName, &status, &createdAt, &activeKeys); err != nil {
+			continue
+		}
+		accounts = append(accounts, map[string]interface{}{
+			"id":           id,
+			"username":     username,
+			"email":        email,
+			"company_name": companyName.String,
+			"status":       status,
+			"active_keys":  activeKeys,
+			"created_at":   createdAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// CreateServiceAccount creates a non-interactive account for integrations (admin only)
+func CreateServiceAccount(c *gin.Context) {
+	var req models.CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists int
+	config.DB.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? OR username = ?",
+		req.Email, req.Username).Scan(&exists)
+	if exists > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email or username already exists"})
+		return
+	}
+
+	// Service accounts never log in with a password; store an unusable random hash
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(buf)), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO users (username, email, password, role, company_name, status, email_verified_at)
+		VALUES (?, ?, ?, 'service', ?, 'active', NOW())
+	`, req.Username, req.Email, string(hashedPassword), req.CompanyName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	accountID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Modul: "apikey", Entitas: "user", ID: accountID,
+		Aktivitas: "Membuat service account " + req.Username,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":            "Service account created successfully",
+		"service_account_id": accountID,
+	})
+}
+
+// GetAPIKeys returns API keys without their secrets (admin only)
+func GetAPIKeys(c *gin.Context) {
+	query := `
+		SELECT k.id, k.user_id, k.name, k.key_prefix, k.permissions, k.ip_allowlist,
+		       k.expires_at, k.last_used_at, k.last_used_ip, k.revoked_at, k.created_by,
+		       k.created_at, u.username
+		FROM api_keys k
+		JOIN users u ON k.user_id = u.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if accountID := c.Query("service_account_id"); accountID != "" {
+		query += " AND k.user_id = ?"
+		args = append(args, accountID)
+	}
+
+	query += " ORDER BY k.created_at DESC"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		var key models.APIKey
+		var permissions string
+		var allowlist, lastUsedIP sql.NullString
+		err := rows.Scan(
+			&key.ID, &key.UserID, &key.Name, &key.KeyPrefix, &permissions, &allowlist,
+			&key.ExpiresAt, &key.LastUsedAt, &lastUsedIP, &key.RevokedAt, &key.CreatedBy,
+			&key.CreatedAt, &key.ServiceAccount,
+		)
+		if err != nil {
+			continue
+		}
+		json.Unmarshal([]byte(permissions), &key.Permissions)
+		key.IPAllowlist = allowlist.String
+		key.LastUsedIP = lastUsedIP.String
+		keys = append(keys, key)
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// CreateAPIKey issues a new API key for a service account (admin only).
+// The plain key is returned once and only its hash is stored.
+func CreateAPIKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role, status string
+	err := config.DB.QueryRow("SELECT role, status FROM users WHERE id = ?", req.ServiceAccountID).Scan(&role, &status)
+	if err == sql.ErrNoRows || role != "service" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+	if status != "active" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service account is inactive"})
+		return
+	}
+
+	for _, permission := range req.Permissions {
+		if !middleware.GrantableToAPIKey(permission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Permission not allowed for API keys: " + permission})
+			return
+		}
+	}
+
+	for _, entry := range req.IPAllowlist {
+		entry = strings.TrimSpace(entry)
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP or CIDR in allowlist: " + entry})
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			t, err = time.ParseInLocation("2006-01-02", req.ExpiresAt, time.Local)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		if t.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+			return
+		}
+		expiresAt = &t
+	}
+
+	prefixBytes := make([]byte, 4)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	prefix := middleware.APIKeyPrefix + hex.EncodeToString(prefixBytes)
+	plainKey := prefix + "_" + hex.EncodeToString(secretBytes)
+
+	permissions, _ := json.Marshal(req.Permissions)
+	result, err := config.DB.Exec(`
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, permissions, ip_allowlist, expires_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, req.ServiceAccountID, req.Name, prefix, middleware.HashAPIKey(plainKey), string(permissions),
+		strings.Join(req.IPAllowlist, ","), expiresAt, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	keyID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Modul: "apikey", Entitas: "api_key", ID: keyID,
+		Aktivitas: fmt.Sprintf("Membuat API key %s (%s)", req.Name, prefix),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "API key created. Store it now, it will not be shown again",
+		"api_key_id": keyID,
+		"api_key":    plainKey,
+		"key_prefix": prefix,
+	})
+}
+
+// RevokeAPIKey revokes an API key immediately (admin only)
+func RevokeAPIKey(c *gin.Context) {
+	keyID := c.Param("id")
+
+	before := auditSnapshot(config.DB, "api_key", paramID(c))
+
+	result, err := config.DB.Exec(`
+		UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL
+	`, keyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "revoke", Modul: "apikey", Entitas: "api_key", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mencabut API key",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
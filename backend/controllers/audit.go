@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"log"
+	"sawit-backend/repository"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditDB is satisfied by both *sql.DB and *sql.Tx, so an audit entry can be
+// written in the same transaction as the change it describes
+type auditDB interface {
+	repository.DBTX
+}
+
+// auditEntities maps the entity names used in the audit trail to their tables
+var auditEntities = map[string]string{
+	"user":            "users",
+	"api_key":         "api_keys",
+	"kebun":           "kebun",
+	"afdeling":        "afdeling",
+	"blok":            "blok",
+	"stok":            "stok_tbs",
+	"stok_adjustment": "stok_adjustments",
+	"ageing_rule":     "stok_ageing_rules",
+	"tim_panen":       "tim_panen",
+	"pemanen":         "pemanen",
+	"premi_rule":      "premi_rules",
+	"panen":           "panen",
+	"payroll":         "payroll_periods",
+	"po":              "purchase_orders",
+	"jadwal":          "jadwal_pengambilan",
+	"kendaraan":       "kendaraan",
+	"timbangan":       "timbangan",
+	"dokumen":         "dokumen_penjualan",
+	"pembayaran":      "pembayaran",
+	"report_schedule": "report_schedules",
+}
+
+// auditEvent describes one audited action
+type auditEvent struct {
+	Aksi      string                 // create, update, delete or a domain verb such as approve
+	Modul     string                 // Module shown in the activity log, defaults to Entitas
+	Entitas   string                 // Key of auditEntities, empty when no single record changed
+	ID        int64                  // ID of the record, also stored as reference_id
+	Aktivitas string                 // Human readable description
+	Sebelum   map[string]interface{} // Taken with auditSnapshot before the change
+	Sesudah   map[string]interface{} // Replaces the automatic after snapshot, e.g. for child rows
+	UserID    *int                   // Actor when nobody is authenticated, e.g. on login
+}
+
+// auditSnapshot reads the current row of an entity. It returns nil when the entity
+// has no table or the row does not exist.
+func auditSnapshot(db auditDB, entitas string, id int64) map[string]interface{} {
+	return snapshotOf(repository.NewLogRepository(db), entitas, id)
+}
+
+// snapshotOf is auditSnapshot for handlers that get their repositories injected
+func snapshotOf(logs repository.LogRepository, entitas string, id int64) map[string]interface{} {
+	table, ok := auditEntities[entitas]
+	if !ok || id == 0 {
+		return nil
+	}
+	snapshot, err := logs.Snapshot(table, id)
+	if err != nil {
+		log.Printf("Audit snapshot %s %d: %v", entitas, id, err)
+	}
+	return snapshot
+}
+
+// recordAudit writes an entry to log_aktivitas. The after snapshot is read through db,
+// so an entry written inside a transaction sees that transaction's changes. c is nil
+// for background jobs. Errors are only logged; auditing never fails the request.
+func recordAudit(db auditDB, c *gin.Context, e auditEvent) {
+	recordAuditTo(repository.NewLogRepository(db), c, e)
+}
+
+// recordAuditTo is recordAudit for handlers that get their repositories injected
+func recordAuditTo(logs repository.LogRepository, c *gin.Context, e auditEvent) {
+	entry := repository.LogEntry{
+		UserID: e.UserID, Aksi: e.Aksi, Modul: e.Entitas, Entitas: e.Entitas,
+		ReferenceID: e.ID, Aktivitas: e.Aktivitas, DataSebelum: e.Sebelum, DataSesudah: e.Sesudah,
+	}
+	if e.Modul != "" {
+		entry.Modul = e.Modul
+	}
+	if c != nil {
+		if entry.UserID == nil {
+			if id, ok := c.Get("user_id"); ok {
+				if userID, ok := id.(int); ok {
+					entry.UserID = &userID
+				}
+			}
+		}
+		entry.IPAddress = c.ClientIP()
+		entry.UserAgent = c.Request.UserAgent()
+		entry.RequestID = c.GetString("request_id")
+	}
+
+	if entry.DataSesudah == nil && e.Aksi != "delete" {
+		entry.DataSesudah = snapshotOf(logs, e.Entitas, e.ID)
+	}
+
+	if err := logs.Record(entry); err != nil {
+		log.Printf("Audit %s %s %d: %v", e.Aksi, e.Entitas, e.ID, err)
+		return
+	}
+	requestAuditSeal()
+}
+
+// paramID returns the numeric :id route parameter, or 0 when it is not a number
+func paramID(c *gin.Context) int64 {
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	return id
+}
@@ -0,0 +1,703 @@
+package controllers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sawit-backend/config"
+)
+
+// auditSealBatch is the number of entries sealed or verified per query
+const auditSealBatch = 1000
+
+// auditDriftEntities are tables whose current rows must still match their last audit snapshot
+var auditDriftEntities = []string{"timbangan"}
+
+// auditChainGenesis is the prev_hash of the first entry, as seeded in audit_chain_state
+var auditChainGenesis = strings.Repeat("0", 64)
+
+// auditSealSignal wakes the sealer after an entry was written
+var auditSealSignal = make(chan struct{}, 1)
+
+// auditChainEntry holds the columns of log_aktivitas covered by the hash, in hashing order
+type auditChainEntry struct {
+	ID          int64   `json:"id"`
+	ChainSeq    int64   `json:"chain_seq"`
+	PrevHash    string  `json:"prev_hash"`
+	UserID      *int64  `json:"user_id"`
+	Aktivitas   string  `json:"aktivitas"`
+	Modul       *string `json:"modul"`
+	ReferenceID *int64  `json:"reference_id"`
+	Aksi        *string `json:"aksi"`
+	Entitas     *string `json:"entitas"`
+	DataSebelum *string `json:"data_sebelum"`
+	DataSesudah *string `json:"data_sesudah"`
+	RequestID   *string `json:"request_id"`
+	IPAddress   *string `json:"ip_address"`
+	UserAgent   *string `json:"user_agent"`
+	CreatedAt   int64   `json:"created_at"`
+}
+
+// auditChainColumns selects the hashed columns in the order scanAuditChainEntry expects
+const auditChainColumns = `id, user_id, aktivitas, modul, reference_id, aksi, entitas,
+	CAST(data_sebelum AS CHAR), CAST(data_sesudah AS CHAR), request_id, ip_address, user_agent, created_at`
+
+func scanAuditChainEntry(rows *sql.Rows, extra ...interface{}) (auditChainEntry, error) {
+	var e auditChainEntry
+	var userID, referenceID sql.NullInt64
+	var modul, aksi, entitas, before, after, requestID, ip, userAgent sql.NullString
+	var createdAt time.Time
+	dest := append([]interface{}{&e.ID, &userID, &e.Aktivitas, &modul, &referenceID, &aksi, &entitas,
+		&before, &after, &requestID, &ip, &userAgent, &createdAt}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return e, err
+	}
+	e.UserID = nullInt64Ptr(userID)
+	e.ReferenceID = nullInt64Ptr(referenceID)
+	e.Modul = nullStringPtr(modul)
+	e.Aksi = nullStringPtr(aksi)
+	e.Entitas = nullStringPtr(entitas)
+	e.DataSebelum = nullStringPtr(before)
+	e.DataSesudah = nullStringPtr(after)
+	e.RequestID = nullStringPtr(requestID)
+	e.IPAddress = nullStringPtr(ip)
+	e.UserAgent = nullStringPtr(userAgent)
+	// Unix seconds keep the hash independent of the server's time zone
+	e.CreatedAt = createdAt.Unix()
+	return e, nil
+}
+
+// hash returns the SHA-256 of the entry's canonical JSON encoding, which includes prev_hash
+func (e auditChainEntry) hash() string {
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// StartAuditChainJob seals new audit entries into the hash chain and writes signed
+// checkpoints on their configured intervals
+func StartAuditChainJob() {
+	if interval := config.AppConfig.AuditSealSecs; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(interval) * time.Second)
+			defer ticker.Stop()
+			for {
+				if _, err := SealAuditChain(); err != nil {
+					log.Printf("Audit chain sealing failed: %v", err)
+				}
+				select {
+				case <-ticker.C:
+				case <-auditSealSignal:
+				}
+			}
+		}()
+	} else {
+		log.Println("Audit chain sealing disabled")
+	}
+
+	if interval := config.AppConfig.CheckpointMin; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+			defer ticker.Stop()
+			for range ticker.C {
+				if _, err := SealAuditChain(); err != nil {
+					log.Printf("Audit chain sealing failed: %v", err)
+				}
+				checkpoint, err := CreateAuditCheckpoint()
+				if err != nil {
+					log.Printf("Audit checkpoint failed: %v", err)
+				} else {
+					log.Printf("Audit checkpoint chain_seq %d ditulis ke %s", checkpoint.ChainSeq, checkpoint.File)
+				}
+			}
+		}()
+	}
+}
+
+// requestAuditSeal wakes the sealer without blocking the request
+func requestAuditSeal() {
+	select {
+	case auditSealSignal <- struct{}{}:
+	default:
+	}
+}
+
+// SealAuditChain appends every unsealed log entry to the hash chain in id order and
+// returns how many were sealed. Entries from transactions that have not committed
+// yet are picked up by a later run, which is why the chain follows chain_seq, not id.
+func SealAuditChain() (int, error) {
+	sealed := 0
+	for {
+		n, err := sealAuditBatch()
+		sealed += n
+		if err != nil || n < auditSealBatch {
+			return sealed, err
+		}
+	}
+}
+
+func sealAuditBatch() (int, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The single state row serializes sealers across goroutines and server instances
+	var lastSeq int64
+	var lastHash string
+	err = tx.QueryRow(`
+		SELECT last_seq, last_hash FROM audit_chain_state WHERE id = 1 FOR UPDATE
+	`).Scan(&lastSeq, &lastHash)
+	if err != nil {
+		return 0, fmt.Errorf("read chain state: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT `+auditChainColumns+`
+		FROM log_aktivitas
+		WHERE chain_seq IS NULL
+		ORDER BY id
+		LIMIT ?
+	`, auditSealBatch)
+	if err != nil {
+		return 0, err
+	}
+	entries := []auditChainEntry{}
+	for rows.Next() {
+		e, err := scanAuditChainEntry(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	for _, e := range entries {
+		lastSeq++
+		e.ChainSeq = lastSeq
+		e.PrevHash = lastHash
+		lastHash = e.hash()
+		_, err := tx.Exec(`
+			UPDATE log_aktivitas SET chain_seq = ?, prev_hash = ?, hash = ? WHERE id = ?
+		`, e.ChainSeq, e.PrevHash, lastHash, e.ID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE audit_chain_state SET last_seq = ?, last_hash = ? WHERE id = 1
+	`, lastSeq, lastHash)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// AuditChainBreak is the first point where the stored chain does not add up
+type AuditChainBreak struct {
+	ChainSeq int64  `json:"chain_seq"`
+	LogID    int64  `json:"log_id"`
+	Alasan   string `json:"alasan"`
+}
+
+// AuditDrift is a record whose current row differs from its last audit snapshot
+type AuditDrift struct {
+	Entitas   string        `json:"entitas"`
+	ID        int64         `json:"id"`
+	LogID     int64         `json:"log_id"`
+	Perubahan []AuditChange `json:"perubahan"`
+}
+
+// AuditCheckpointCheck is the result of comparing one checkpoint with the chain
+type AuditCheckpointCheck struct {
+	Sumber   string `json:"sumber"`
+	ChainSeq int64  `json:"chain_seq"`
+	Valid    bool   `json:"valid"`
+	Alasan   string `json:"alasan,omitempty"`
+}
+
+// AuditVerification is the outcome of walking the hash chain
+type AuditVerification struct {
+	Valid            bool                   `json:"valid"`
+	Diperiksa        int64                  `json:"diperiksa"`
+	ChainSeq         int64                  `json:"chain_seq_terakhir"`
+	Hash             string                 `json:"hash_terakhir"`
+	BelumDisegel     int64                  `json:"belum_disegel"`
+	Putus            *AuditChainBreak       `json:"putus"`
+	Checkpoints      []AuditCheckpointCheck `json:"checkpoints"`
+	RecordBerubah    []AuditDrift           `json:"record_berubah"`
+	TanpaAudit       map[string]int64       `json:"record_tanpa_audit"`
+	DiverifikasiPada time.Time              `json:"diverifikasi_pada"`
+}
+
+// auditVerifyMu keeps two verifications from competing for the same rows
+var auditVerifyMu sync.Mutex
+
+// VerifyAuditChain recomputes every hash in chain order and reports the first break.
+// It then checks stored checkpoints, any offline checkpoint files given, and whether
+// the rows of auditDriftEntities were changed without an audit entry.
+func VerifyAuditChain(checkpointFiles ...string) (AuditVerification, error) {
+	auditVerifyMu.Lock()
+	defer auditVerifyMu.Unlock()
+
+	result := AuditVerification{
+		Valid:            true,
+		Checkpoints:      []AuditCheckpointCheck{},
+		RecordBerubah:    []AuditDrift{},
+		TanpaAudit:       map[string]int64{},
+		DiverifikasiPada: time.Now(),
+	}
+	fail := func(seq, id int64, reason string) {
+		if result.Putus == nil {
+			result.Putus = &AuditChainBreak{ChainSeq: seq, LogID: id, Alasan: reason}
+		}
+		result.Valid = false
+	}
+
+	// Only the hashes a checkpoint refers to are kept while walking the chain
+	checkpoints, err := loadAuditCheckpointDocs(checkpointFiles)
+	if err != nil {
+		return result, err
+	}
+	hashes := map[int64]string{}
+	for _, cp := range checkpoints {
+		hashes[cp.doc.Checkpoint.ChainSeq] = ""
+	}
+
+	// Archived entries are no longer stored; the walk starts after the archived head
+	var lastSeq, archivedSeq int64
+	var lastHash, archivedHash string
+	err = config.DB.QueryRow(`
+		SELECT last_seq, last_hash, archived_seq, archived_hash FROM audit_chain_state WHERE id = 1
+	`).Scan(&lastSeq, &lastHash, &archivedSeq, &archivedHash)
+	if err != nil {
+		return result, fmt.Errorf("read chain state: %w", err)
+	}
+	config.DB.QueryRow("SELECT COUNT(*) FROM log_aktivitas WHERE chain_seq IS NULL").Scan(&result.BelumDisegel)
+
+	expectedSeq := archivedSeq + 1
+	prevHash := archivedHash
+
+	for result.Putus == nil {
+		rows, err := config.DB.Query(`
+			SELECT `+auditChainColumns+`, chain_seq, prev_hash, hash
+			FROM log_aktivitas
+			WHERE chain_seq >= ?
+			ORDER BY chain_seq
+			LIMIT ?
+		`, expectedSeq, auditSealBatch)
+		if err != nil {
+			return result, err
+		}
+		n := 0
+		for rows.Next() {
+			var seq int64
+			var prev, stored string
+			e, err := scanAuditChainEntry(rows, &seq, &prev, &stored)
+			if err != nil {
+				rows.Close()
+				return result, err
+			}
+			n++
+			result.Diperiksa++
+
+			switch {
+			case seq != expectedSeq:
+				fail(expectedSeq, e.ID, fmt.Sprintf("Entri chain_seq %d sampai %d hilang", expectedSeq, seq-1))
+			case prev != prevHash:
+				fail(seq, e.ID, "prev_hash tidak cocok dengan hash entri sebelumnya")
+			}
+			e.ChainSeq = seq
+			e.PrevHash = prev
+			if e.hash() != stored {
+				fail(seq, e.ID, "Isi entri tidak cocok dengan hash-nya (entri diubah)")
+			}
+			if result.Putus != nil {
+				break
+			}
+
+			if _, ok := hashes[seq]; ok {
+				hashes[seq] = stored
+			}
+			prevHash = stored
+			expectedSeq = seq + 1
+			result.ChainSeq = seq
+			result.Hash = stored
+		}
+		rows.Close()
+		if n < auditSealBatch {
+			break
+		}
+	}
+
+	// Deleting the newest entries leaves a valid but shorter chain; the state row catches that
+	if result.Putus == nil {
+		if result.ChainSeq == 0 {
+			result.ChainSeq, result.Hash = archivedSeq, archivedHash
+		}
+		if lastSeq != result.ChainSeq || lastHash != result.Hash {
+			fail(result.ChainSeq+1, 0, fmt.Sprintf("Ujung rantai di chain_seq %d tidak cocok dengan ujung tercatat di chain_seq %d (entri terbaru dihapus atau diganti)", result.ChainSeq, lastSeq))
+		}
+	}
+
+	for _, cp := range checkpoints {
+		check := AuditCheckpointCheck{Sumber: cp.source, Alasan: cp.err}
+		if cp.err == "" {
+			check = checkAuditCheckpoint(cp.source, cp.doc, hashes, archivedSeq)
+		}
+		if !check.Valid {
+			result.Valid = false
+		}
+		result.Checkpoints = append(result.Checkpoints, check)
+	}
+
+	for _, entitas := range auditDriftEntities {
+		drifts, missing, err := auditDrift(entitas)
+		if err != nil {
+			return result, err
+		}
+		if len(drifts) > 0 {
+			result.Valid = false
+		}
+		result.RecordBerubah = append(result.RecordBerubah, drifts...)
+		result.TanpaAudit[entitas] = missing
+	}
+
+	return result, nil
+}
+
+// auditDrift compares every row of an entity with the after snapshot of its last audit
+// entry. Rows without any audit entry (created before the audit trail) are only counted.
+func auditDrift(entitas string) ([]AuditDrift, int64, error) {
+	table := auditEntities[entitas]
+	rows, err := config.DB.Query(`
+		SELECT t.id, la.id, CAST(la.data_sesudah AS CHAR)
+		FROM `+table+` t
+		LEFT JOIN log_aktivitas la ON la.id = (
+			SELECT MAX(l2.id) FROM log_aktivitas l2
+			WHERE l2.entitas = ? AND l2.reference_id = t.id AND l2.data_sesudah IS NOT NULL
+		)
+		ORDER BY t.id
+	`, entitas)
+	if err != nil {
+		return nil, 0, err
+	}
+	type lastAudit struct {
+		id, logID int64
+		snapshot  string
+	}
+	audited := []lastAudit{}
+	var missing int64
+	for rows.Next() {
+		var id int64
+		var logID sql.NullInt64
+		var snapshot sql.NullString
+		if err := rows.Scan(&id, &logID, &snapshot); err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+		if !logID.Valid {
+			missing++
+			continue
+		}
+		audited = append(audited, lastAudit{id, logID.Int64, snapshot.String})
+	}
+	rows.Close()
+
+	drifts := []AuditDrift{}
+	for _, a := range audited {
+		var recorded map[string]interface{}
+		json.Unmarshal([]byte(a.snapshot), &recorded)
+		// A JSON round trip gives the current row the same types as the stored snapshot
+		var current map[string]interface{}
+		data, _ := json.Marshal(auditSnapshot(config.DB, entitas, a.id))
+		json.Unmarshal(data, &current)
+		if changes := auditDiff(recorded, current); len(changes) > 0 {
+			drifts = append(drifts, AuditDrift{Entitas: entitas, ID: a.id, LogID: a.logID, Perubahan: changes})
+		}
+	}
+	return drifts, missing, nil
+}
+
+// AuditCheckpointPayload is the signed part of a checkpoint
+type AuditCheckpointPayload struct {
+	Versi       int    `json:"versi"`
+	ChainSeq    int64  `json:"chain_seq"`
+	Hash        string `json:"hash"`
+	JumlahEntri int64  `json:"jumlah_entri"`
+	DibuatPada  string `json:"dibuat_pada"`
+}
+
+// AuditCheckpointFile is the document written for offline storage
+type AuditCheckpointFile struct {
+	Checkpoint AuditCheckpointPayload `json:"checkpoint"`
+	PublicKey  string                 `json:"public_key"`
+	Signature  string                 `json:"signature"`
+}
+
+// AuditCheckpoint is a stored checkpoint
+type AuditCheckpoint struct {
+	ID          int       `json:"id"`
+	ChainSeq    int64     `json:"chain_seq"`
+	Hash        string    `json:"hash"`
+	JumlahEntri int64     `json:"jumlah_entri"`
+	PublicKey   string    `json:"public_key"`
+	Signature   string    `json:"signature"`
+	File        string    `json:"file"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// file rebuilds the signed document of a stored checkpoint
+func (cp AuditCheckpoint) file() AuditCheckpointFile {
+	return AuditCheckpointFile{
+		Checkpoint: AuditCheckpointPayload{
+			Versi:       1,
+			ChainSeq:    cp.ChainSeq,
+			Hash:        cp.Hash,
+			JumlahEntri: cp.JumlahEntri,
+			DibuatPada:  cp.CreatedAt.UTC().Format(time.RFC3339),
+		},
+		PublicKey: cp.PublicKey,
+		Signature: cp.Signature,
+	}
+}
+
+var (
+	auditKeyOnce sync.Once
+	auditKey     ed25519.PrivateKey
+	auditKeyErr  error
+)
+
+// auditSigningKey loads the Ed25519 checkpoint key, creating it on first use. Auditors
+// keep a copy of the public key to check checkpoints independently of this server.
+func auditSigningKey() (ed25519.PrivateKey, error) {
+	auditKeyOnce.Do(func() {
+		path := config.AppConfig.AuditKeyFile
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			seed := make([]byte, ed25519.SeedSize)
+			if _, err := rand.Read(seed); err != nil {
+				auditKeyErr = err
+				return
+			}
+			os.MkdirAll(filepath.Dir(path), 0700)
+			if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(seed)+"\n"), 0600); err != nil {
+				auditKeyErr = fmt.Errorf("write signing key: %w", err)
+				return
+			}
+			log.Printf("Audit signing key dibuat di %s", path)
+			data = []byte(base64.StdEncoding.EncodeToString(seed))
+		} else if err != nil {
+			auditKeyErr = fmt.Errorf("read signing key: %w", err)
+			return
+		}
+
+		seed, err := base64.StdEncoding.DecodeString(string(trimNewline(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			auditKeyErr = fmt.Errorf("signing key %s must be a base64 encoded %d byte seed", path, ed25519.SeedSize)
+			return
+		}
+		auditKey = ed25519.NewKeyFromSeed(seed)
+	})
+	return auditKey, auditKeyErr
+}
+
+func trimNewline(data []byte) []byte {
+	for len(data) > 0 && (data[len(data)-1] == '\n' || data[len(data)-1] == '\r') {
+		data = data[:len(data)-1]
+	}
+	return data
+}
+
+// auditPublicKey returns the base64 public key checkpoints are verified against
+func auditPublicKey() (string, error) {
+	key, err := auditSigningKey()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)), nil
+}
+
+// CreateAuditCheckpoint signs the current head of the chain, stores it and writes it
+// to the checkpoint directory so it can be copied offline
+func CreateAuditCheckpoint() (AuditCheckpoint, error) {
+	var cp AuditCheckpoint
+	key, err := auditSigningKey()
+	if err != nil {
+		return cp, err
+	}
+
+	err = config.DB.QueryRow("SELECT last_seq, last_hash FROM audit_chain_state WHERE id = 1").Scan(&cp.ChainSeq, &cp.Hash)
+	if err != nil {
+		return cp, fmt.Errorf("read chain state: %w", err)
+	}
+	if cp.ChainSeq == 0 {
+		return cp, errors.New("the audit chain is empty")
+	}
+	cp.JumlahEntri = cp.ChainSeq
+	cp.CreatedAt = time.Now().Truncate(time.Second)
+	cp.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	doc := cp.file()
+	payload, _ := json.Marshal(doc.Checkpoint)
+	cp.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	doc.Signature = cp.Signature
+
+	dir := config.AppConfig.CheckpointDir
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return cp, err
+	}
+	cp.File = filepath.Join(dir, fmt.Sprintf("audit-checkpoint-%s-%d.json", cp.CreatedAt.Format("20060102-150405"), cp.ChainSeq))
+	data, _ := json.MarshalIndent(doc, "", "  ")
+	if err := os.WriteFile(cp.File, data, 0640); err != nil {
+		return cp, fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO audit_checkpoints (chain_seq, hash, jumlah_entri, public_key, signature, file_path, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, cp.ChainSeq, cp.Hash, cp.JumlahEntri, cp.PublicKey, cp.Signature, cp.File, cp.CreatedAt)
+	if err != nil {
+		return cp, err
+	}
+	id, _ := result.LastInsertId()
+	cp.ID = int(id)
+	return cp, nil
+}
+
+// checkAuditCheckpoint validates the signature of a checkpoint against the configured
+// key and compares its hash with the chain. Entries up to archivedSeq are no longer stored.
+func checkAuditCheckpoint(source string, doc AuditCheckpointFile, hashes map[int64]string, archivedSeq int64) AuditCheckpointCheck {
+	check := AuditCheckpointCheck{Sumber: source, ChainSeq: doc.Checkpoint.ChainSeq}
+
+	publicKey, err := auditPublicKey()
+	if err != nil {
+		check.Alasan = err.Error()
+		return check
+	}
+	if doc.PublicKey != publicKey {
+		check.Alasan = "Ditandatangani dengan kunci lain"
+		return check
+	}
+	key, _ := base64.StdEncoding.DecodeString(doc.PublicKey)
+	signature, _ := base64.StdEncoding.DecodeString(doc.Signature)
+	payload, _ := json.Marshal(doc.Checkpoint)
+	if !ed25519.Verify(ed25519.PublicKey(key), payload, signature) {
+		check.Alasan = "Tanda tangan tidak valid"
+		return check
+	}
+
+	hash := hashes[doc.Checkpoint.ChainSeq]
+	ok := hash != ""
+	switch {
+	case ok && hash == doc.Checkpoint.Hash:
+		check.Valid = true
+	case ok:
+		check.Alasan = "Hash entri berbeda dari checkpoint (rantai ditulis ulang)"
+	case doc.Checkpoint.ChainSeq <= archivedSeq:
+		// The entry was archived; the checkpoint itself is still authentic
+		check.Valid = true
+		check.Alasan = "Entri sudah diarsipkan"
+	default:
+		check.Alasan = "Entri checkpoint tidak ada di rantai"
+	}
+	return check
+}
+
+type auditCheckpointDoc struct {
+	source string
+	doc    AuditCheckpointFile
+	err    string
+}
+
+// loadAuditCheckpointDocs collects the stored checkpoints and any offline checkpoint files
+func loadAuditCheckpointDocs(files []string) ([]auditCheckpointDoc, error) {
+	stored, err := listAuditCheckpoints(0)
+	if err != nil {
+		return nil, err
+	}
+	docs := []auditCheckpointDoc{}
+	for _, cp := range stored {
+		docs = append(docs, auditCheckpointDoc{source: fmt.Sprintf("checkpoint #%d", cp.ID), doc: cp.file()})
+	}
+	for _, path := range files {
+		var doc AuditCheckpointFile
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &doc)
+		}
+		if err != nil || doc.Signature == "" {
+			docs = append(docs, auditCheckpointDoc{source: path, err: "File checkpoint tidak dapat dibaca"})
+			continue
+		}
+		docs = append(docs, auditCheckpointDoc{source: path, doc: doc})
+	}
+	return docs, nil
+}
+
+// auditCheckpointColumns selects a stored checkpoint in the order queryAuditCheckpoints scans
+const auditCheckpointColumns = `SELECT id, chain_seq, hash, jumlah_entri, public_key, signature,
+	COALESCE(file_path, ''), created_at FROM audit_checkpoints`
+
+// listAuditCheckpoints returns stored checkpoints, newest first; limit 0 returns all
+func listAuditCheckpoints(limit int) ([]AuditCheckpoint, error) {
+	if limit > 0 {
+		return queryAuditCheckpoints(auditCheckpointColumns+" ORDER BY id DESC LIMIT ?", limit)
+	}
+	return queryAuditCheckpoints(auditCheckpointColumns + " ORDER BY id DESC")
+}
+
+func queryAuditCheckpoints(query string, args ...interface{}) ([]AuditCheckpoint, error) {
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checkpoints := []AuditCheckpoint{}
+	for rows.Next() {
+		var cp AuditCheckpoint
+		if err := rows.Scan(&cp.ID, &cp.ChainSeq, &cp.Hash, &cp.JumlahEntri, &cp.PublicKey,
+			&cp.Signature, &cp.File, &cp.CreatedAt); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, nil
+}
+
+func nullInt64Ptr(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
+func nullStringPtr(v sql.NullString) *string {
+	if !v.Valid {
+		return nil
+	}
+	return &v.String
+}
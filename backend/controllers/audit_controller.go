@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"sawit-backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditTimelineLimit caps the entries returned for one record
+const auditTimelineLimit = 500
+
+// auditIgnoredFields change on every write and are left out of the field diff
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// AuditChange is one changed field between the before and after snapshot
+type AuditChange struct {
+	Field   string      `json:"field"`
+	Sebelum interface{} `json:"sebelum"`
+	Sesudah interface{} `json:"sesudah"`
+}
+
+// AuditEntry is one step in the history of a record
+type AuditEntry struct {
+	ID          int                    `json:"id"`
+	UserID      *int                   `json:"user_id"`
+	Username    string                 `json:"username"`
+	Role        string                 `json:"role"`
+	Aksi        string                 `json:"aksi"`
+	Aktivitas   string                 `json:"aktivitas"`
+	RequestID   string                 `json:"request_id"`
+	IPAddress   string                 `json:"ip_address"`
+	UserAgent   string                 `json:"user_agent"`
+	DataSebelum map[string]interface{} `json:"data_sebelum"`
+	DataSesudah map[string]interface{} `json:"data_sesudah"`
+	Perubahan   []AuditChange          `json:"perubahan"`
+	Waktu       time.Time              `json:"waktu"`
+}
+
+// GetAuditTimeline returns who changed a record, when, from where and what changed
+func GetAuditTimeline(c *gin.Context) {
+	entitas := c.Param("entity")
+	if _, ok := auditEntities[entitas]; !ok {
+		entities := make([]string, 0, len(auditEntities))
+		for name := range auditEntities {
+			entities = append(entities, name)
+		}
+		sort.Strings(entities)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown entity", "entities": entities})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT la.id, la.user_id, COALESCE(u.username, 'System'), COALESCE(u.role, 'system'),
+			COALESCE(la.aksi, ''), COALESCE(la.aktivitas, ''), COALESCE(la.request_id, ''),
+			COALESCE(la.ip_address, ''), COALESCE(la.user_agent, ''),
+			la.data_sebelum, la.data_sesudah, la.created_at
+		FROM log_aktivitas la
+		LEFT JOIN users u ON la.user_id = u.id
+		WHERE la.entitas = ? AND la.reference_id = ?
+		ORDER BY la.created_at, la.id
+		LIMIT ?
+	`, entitas, id, auditTimelineLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit trail"})
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var userID sql.NullInt64
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &userID, &e.Username, &e.Role, &e.Aksi, &e.Aktivitas, &e.RequestID,
+			&e.IPAddress, &e.UserAgent, &before, &after, &e.Waktu); err != nil {
+			continue
+		}
+		if userID.Valid {
+			uid := int(userID.Int64)
+			e.UserID = &uid
+		}
+		json.Unmarshal(before, &e.DataSebelum)
+		json.Unmarshal(after, &e.DataSesudah)
+		e.Perubahan = auditDiff(e.DataSebelum, e.DataSesudah)
+		entries = append(entries, e)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entitas": entitas,
+		"id":      id,
+		"total":   len(entries),
+		"data":    entries,
+	})
+}
+
+// auditDiff lists the fields that differ between two snapshots. A create has every
+// field in sesudah, a delete every field in sebelum.
+func auditDiff(before, after map[string]interface{}) []AuditChange {
+	fields := map[string]bool{}
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		if !auditIgnoredFields[field] {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []AuditChange{}
+	for _, field := range names {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes = append(changes, AuditChange{Field: field, Sebelum: before[field], Sesudah: after[field]})
+		}
+	}
+	return changes
+}
+
+// VerifyAuditLog walks the hash chain and reports the first break, invalid checkpoints
+// and weighing records changed outside the application
+func VerifyAuditLog(c *gin.Context) {
+	if _, err := SealAuditChain(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to seal audit log: " + err.Error()})
+		return
+	}
+	result, err := VerifyAuditChain()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit log: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetAuditCheckpoints lists the latest signed checkpoints and the key they are signed with
+func GetAuditCheckpoints(c *gin.Context) {
+	checkpoints, err := listAuditCheckpoints(100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checkpoints"})
+		return
+	}
+	publicKey, err := auditPublicKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load signing key: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"public_key": publicKey, "data": checkpoints})
+}
+
+// CreateAuditCheckpointNow seals pending entries and signs the head of the chain
+func CreateAuditCheckpointNow(c *gin.Context) {
+	if _, err := SealAuditChain(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to seal audit log: " + err.Error()})
+		return
+	}
+	checkpoint, err := CreateAuditCheckpoint()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create checkpoint: " + err.Error()})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "checkpoint", Modul: "audit",
+		Aktivitas: fmt.Sprintf("Membuat checkpoint audit di chain_seq %d", checkpoint.ChainSeq),
+	})
+
+	c.JSON(http.StatusCreated, checkpoint)
+}
+
+// DownloadAuditCheckpoint returns a signed checkpoint document for offline storage
+func DownloadAuditCheckpoint(c *gin.Context) {
+	checkpoints, err := queryAuditCheckpoints(auditCheckpointColumns+" WHERE id = ?", paramID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch checkpoint"})
+		return
+	}
+	if len(checkpoints) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checkpoint not found"})
+		return
+	}
+
+	cp := checkpoints[0]
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit-checkpoint-%d.json", cp.ChainSeq))
+	c.IndentedJSON(http.StatusOK, cp.file())
+}
@@ -1,18 +1,33 @@
 package controllers
 
 import (
-	"database/sql"
+	"fmt"
+	"log"
 	"net/http"
-	"sawit-backend/config"
 	"sawit-backend/middleware"
 	"sawit-backend/models"
+	"sawit-backend/repository"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// UserHandler serves registration, login with its guards and 2FA steps, password
+// and email tokens, and the signed-in user's own account from injected repositories
+type UserHandler struct {
+	store repository.Store
+}
+
+// NewUserHandler returns a UserHandler backed by store
+func NewUserHandler(store repository.Store) *UserHandler {
+	return &UserHandler{store: store}
+}
+
 // Register handles user registration
-func Register(c *gin.Context) {
+func (h *UserHandler) Register(c *gin.Context) {
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -20,18 +35,21 @@ func Register(c *gin.Context) {
 	}
 
 	// Check if user already exists
-	var exists int
-	err := config.DB.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? OR username = ?", 
-		req.Email, req.Username).Scan(&exists)
+	exists, err := h.store.Users().Exists(req.Email, req.Username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-	if exists > 0 {
+	if exists {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email or username already exists"})
 		return
 	}
 
+	if err := validatePassword(req.Password, req.Username, req.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -40,58 +58,103 @@ func Register(c *gin.Context) {
 	}
 
 	// Insert user
-	result, err := config.DB.Exec(`
-		INSERT INTO users (username, email, password, role, company_name, address, nib, phone, status)
-		VALUES (?, ?, ?, 'buyer', ?, ?, ?, ?, 'active')
-	`, req.Username, req.Email, string(hashedPassword), req.CompanyName, req.Address, req.NIB, req.Phone)
-
+	userID, err := h.store.Users().Create(repository.NewUser{
+		Username: req.Username, Email: req.Email, PasswordHash: string(hashedPassword), Role: "buyer",
+		CompanyName: req.CompanyName, Address: req.Address, NIB: req.NIB, Phone: req.Phone,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	userID, _ := result.LastInsertId()
+	actorID := int(userID)
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "create", Modul: "auth", Entitas: "user", ID: userID, UserID: &actorID,
+		Aktivitas: "Registrasi akun buyer: " + req.Username,
+	})
+
+	// Send verification email; the user can request another one if this fails
+	if err := sendVerificationEmail(h.store.Auth(), int(userID), req.Username, req.Email); err != nil {
+		log.Printf("Register - Failed to send verification mail: %v", err)
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
+		"message": "User registered successfully. Please check your email to verify your account",
 		"user_id": userID,
 	})
 }
 
+// CreateAdmin adds an active admin with a verified email, for `create-admin` on a
+// fresh install where no one can log in yet
+func CreateAdmin(store repository.Store, username, email, password string) (int, error) {
+	exists, err := store.Users().Exists(email, username)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, fmt.Errorf("email or username already exists")
+	}
+
+	if err := validatePassword(password, username, email); err != nil {
+		return 0, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := store.Users().Create(repository.NewUser{
+		Username: username, Email: email, PasswordHash: string(hashedPassword), Role: "admin", Verified: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	recordAuditTo(store.Logs(), nil, auditEvent{
+		Aksi: "create", Modul: "auth", Entitas: "user", ID: userID,
+		Aktivitas: "Akun admin dibuat lewat create-admin: " + username,
+	})
+	return int(userID), nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// dummyPasswordHash returns a bcrypt hash of the default cost to check unknown emails against
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("unknown-account"), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
 // Login handles user authentication
-func Login(c *gin.Context) {
+func (h *UserHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get user from database
-	var user models.User
-	var companyName, address, nib, phone sql.NullString
-	err := config.DB.QueryRow(`
-		SELECT id, username, email, password, role, company_name, address, nib, phone, status
-		FROM users WHERE email = ?
-	`, req.Email).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password, &user.Role,
-		&companyName, &address, &nib, &phone, &user.Status,
-	)
-
-	// Convert sql.NullString to *string
-	if companyName.Valid {
-		user.CompanyName = &companyName.String
-	}
-	if address.Valid {
-		user.Address = &address.String
-	}
-	if nib.Valid {
-		user.NIB = &nib.String
-	}
-	if phone.Valid {
-		user.Phone = &phone.String
+	// Throttle clients with too many recent failures
+	if until := ipBlockedUntil(h.store.Auth(), c.ClientIP()); time.Now().Before(until) {
+		retryAfter := int(time.Until(until).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed login attempts. Please try again later",
+			"retry_after": retryAfter,
+		})
+		return
 	}
 
-	if err == sql.ErrNoRows {
+	// Get user from database
+	user, err := h.store.Users().FindForLogin(req.Email)
+	if err == repository.ErrNotFound {
+		// Spend the same bcrypt time as a wrong password so unknown emails do not stand out
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(req.Password))
+		h.recordLoginAttempt(c, req.Email, nil, false, "unknown email")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
@@ -100,66 +163,82 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Check if user is active
-	if user.Status != "active" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Account is inactive"})
+	// Check if account is temporarily locked
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		h.recordLoginAttempt(c, req.Email, &user.ID, false, "account locked")
+		retryAfter := int(time.Until(*user.LockedUntil).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusLocked, gin.H{
+			"error":        "Account is temporarily locked due to too many failed login attempts",
+			"locked_until": *user.LockedUntil,
+			"retry_after":  retryAfter,
+		})
 		return
 	}
 
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
 	if err != nil {
+		h.registerAccountFailure(user.ID)
+		h.recordLoginAttempt(c, req.Email, &user.ID, false, "wrong password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Generate JWT token
-	token, err := middleware.GenerateToken(user.ID, user.Email, user.Role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+	// Checked after the password so the response does not reveal which accounts are inactive
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is inactive"})
 		return
 	}
 
-	// Log aktivitas
-	config.DB.Exec(`
-		INSERT INTO log_aktivitas (user_id, aktivitas, modul, ip_address)
-		VALUES (?, 'Login', 'auth', ?)
-	`, user.ID, c.ClientIP())
-
-	c.JSON(http.StatusOK, models.LoginResponse{
-		Token: token,
-		User:  user,
-	})
-}
-
-// GetProfile returns current user profile
-func GetProfile(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
-	var user models.User
-	var companyName, address, nib, phone sql.NullString
-	err := config.DB.QueryRow(`
-		SELECT id, username, email, role, company_name, address, nib, phone, status, created_at, updated_at
-		FROM users WHERE id = ?
-	`, userID).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Role, &companyName,
-		&address, &nib, &phone, &user.Status, &user.CreatedAt, &user.UpdatedAt,
-	)
-
-	// Convert sql.NullString to *string
-	if companyName.Valid {
-		user.CompanyName = &companyName.String
+	// Service accounts authenticate with API keys only. Checked after the password so
+	// the response does not reveal which emails belong to service accounts.
+	if user.Role == "service" {
+		h.recordLoginAttempt(c, req.Email, &user.ID, false, "service account")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Service accounts must use an API key"})
+		return
 	}
-	if address.Valid {
-		user.Address = &address.String
+
+	// Check if email is verified
+	if user.EmailVerifiedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email not verified", "code": "email_not_verified"})
+		return
 	}
-	if nib.Valid {
-		user.NIB = &nib.String
+
+	// Second step: the full token is only issued after the TOTP code is verified
+	if user.TOTPEnabled {
+		mfaToken, err := middleware.GenerateMFAToken(user.ID, user.Email, user.Role, middleware.PurposeMFAVerify)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+		return
 	}
-	if phone.Valid {
-		user.Phone = &phone.String
+
+	// Roles with mandatory 2FA must enroll before getting a full token
+	if mfaRequiredForRole(user.Role) {
+		mfaToken, err := middleware.GenerateMFAToken(user.ID, user.Email, user.Role, middleware.PurposeMFAEnroll)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_enrollment_required": true,
+			"mfa_token":               mfaToken,
+		})
+		return
 	}
 
+	h.completeLogin(c, user.ID, "Login")
+}
+
+// GetProfile returns current user profile
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	user, err := h.store.Users().FindByID(c.GetInt("user_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get profile"})
 		return
@@ -169,8 +248,8 @@ func GetProfile(c *gin.Context) {
 }
 
 // UpdateProfile updates user profile
-func UpdateProfile(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	userID := c.GetInt("user_id")
 
 	var req struct {
 		CompanyName string `json:"company_name"`
@@ -183,15 +262,18 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	_, err := config.DB.Exec(`
-		UPDATE users SET company_name = ?, address = ?, phone = ?
-		WHERE id = ?
-	`, req.CompanyName, req.Address, req.Phone, userID)
+	logs := h.store.Logs()
+	before := snapshotOf(logs, "user", int64(userID))
 
-	if err != nil {
+	if err := h.store.Users().UpdateProfile(userID, req.CompanyName, req.Address, req.Phone); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
+	recordAuditTo(logs, c, auditEvent{
+		Aksi: "update", Modul: "auth", Entitas: "user", ID: int64(userID), Sebelum: before,
+		Aktivitas: "Memperbarui profil",
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully"})
 }
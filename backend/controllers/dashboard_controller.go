@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/middleware"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardCache keeps computed dashboards until a PO, weighing, payment or
+// stock event invalidates them, or DashboardTTL seconds pass. The TTL also
+// covers changes made by other instances, which this cache cannot see.
+var dashboardCache = struct {
+	sync.Mutex
+	generation uint64
+	entries    map[string]dashboardEntry
+}{entries: make(map[string]dashboardEntry)}
+
+type dashboardEntry struct {
+	data    gin.H
+	expires time.Time
+}
+
+// invalidateDashboard drops every cached dashboard. Called after writes that change the numbers.
+func invalidateDashboard() {
+	dashboardCache.Lock()
+	dashboardCache.generation++
+	dashboardCache.entries = make(map[string]dashboardEntry)
+	dashboardCache.Unlock()
+}
+
+// dashboardWindow holds the calendar windows of one day
+type dashboardWindow struct {
+	today, monthStart, prevMonthStart, yearStart time.Time
+}
+
+func newDashboardWindow(now time.Time) dashboardWindow {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := today.AddDate(0, 0, 1-today.Day())
+	return dashboardWindow{
+		today:          today,
+		monthStart:     monthStart,
+		prevMonthStart: monthStart.AddDate(0, -1, 0),
+		yearStart:      time.Date(today.Year(), 1, 1, 0, 0, 0, 0, today.Location()),
+	}
+}
+
+// dashboardWidgets picks the widgets a user may see from their permissions.
+// Buyers (own-scope only) get their own orders and invoices.
+func dashboardWidgets(c *gin.Context) (widgets []string, own bool) {
+	own = !middleware.HasPermission(c, middleware.PermPORead) && middleware.HasPermission(c, middleware.PermPOReadOwn)
+	if middleware.HasPermission(c, middleware.PermStokRead) {
+		widgets = append(widgets, "stok")
+	}
+	if own {
+		widgets = append(widgets, "pesanan")
+		if middleware.HasPermission(c, middleware.PermPembayaranReadOwn) {
+			widgets = append(widgets, "tagihan")
+		}
+		return widgets, own
+	}
+	if middleware.HasPermission(c, middleware.PermPORead) {
+		widgets = append(widgets, "po", "master")
+	}
+	if middleware.HasPermission(c, middleware.PermReportSales) {
+		widgets = append(widgets, "penjualan", "piutang")
+	}
+	if middleware.HasPermission(c, middleware.PermTimbanganRead) {
+		widgets = append(widgets, "timbangan")
+	}
+	return widgets, own
+}
+
+func dashboardStok() (gin.H, error) {
+	var batch, restan int
+	var kg, nilai float64
+	err := config.DB.QueryRow(`
+		SELECT COALESCE(SUM(status = 'available'), 0), COALESCE(SUM(status = 'restan'), 0),
+		       COALESCE(SUM(jumlah_tersedia), 0), COALESCE(SUM(jumlah_tersedia * harga_per_kg), 0)
+		FROM stok_tbs
+		WHERE status IN ('available', 'restan') AND jumlah_tersedia > 0
+	`).Scan(&batch, &restan, &kg, &nilai)
+	return gin.H{
+		"batch_tersedia": batch,
+		"batch_restan":   restan,
+		"tersedia_kg":    round2(kg),
+		"nilai_tersedia": round2(nilai),
+	}, err
+}
+
+func dashboardPO(w dashboardWindow) (gin.H, error) {
+	var pending, approved, loading, bulanIni int
+	err := config.DB.QueryRow(`
+		SELECT COALESCE(SUM(status = 'pending'), 0), COALESCE(SUM(status = 'approved'), 0),
+		       COALESCE(SUM(status = 'loading'), 0), COALESCE(SUM(created_at >= ?), 0)
+		FROM purchase_orders
+		WHERE status IN ('pending', 'approved', 'loading') OR created_at >= ?
+	`, w.monthStart, w.monthStart).Scan(&pending, &approved, &loading, &bulanIni)
+	return gin.H{
+		"pending":          pending,
+		"approved":         approved,
+		"loading":          loading,
+		"dibuat_bulan_ini": bulanIni,
+	}, err
+}
+
+func dashboardMaster() (gin.H, error) {
+	var kebun, buyer int
+	err := config.DB.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM kebun WHERE status = 'active'),
+		       (SELECT COUNT(*) FROM users WHERE role = 'buyer' AND status = 'active')
+	`).Scan(&kebun, &buyer)
+	return gin.H{"kebun_aktif": kebun, "buyer_aktif": buyer}, err
+}
+
+// dashboardPenjualan sums invoiced sales for today, month to date, the whole
+// previous month and year to date in one pass
+func dashboardPenjualan(w dashboardWindow) (gin.H, error) {
+	from := w.prevMonthStart
+	if w.yearStart.Before(from) {
+		from = w.yearStart
+	}
+	windows := []struct {
+		name       string
+		start, end time.Time
+	}{
+		{"hari_ini", w.today, w.today},
+		{"bulan_ini", w.monthStart, w.today},
+		{"bulan_lalu", w.prevMonthStart, w.monthStart.AddDate(0, 0, -1)},
+		{"tahun_ini", w.yearStart, w.today},
+	}
+
+	var selects []string
+	var args []interface{}
+	for _, win := range windows {
+		cond := "tanggal_dokumen BETWEEN ? AND ?"
+		selects = append(selects,
+			"COALESCE(SUM(CASE WHEN "+cond+" THEN 1 ELSE 0 END), 0)",
+			"COALESCE(SUM(CASE WHEN "+cond+" THEN jumlah_kg ELSE 0 END), 0)",
+			"COALESCE(SUM(CASE WHEN "+cond+" THEN total_akhir ELSE 0 END), 0)")
+		for i := 0; i < 3; i++ {
+			args = append(args, win.start.Format("2006-01-02"), win.end.Format("2006-01-02"))
+		}
+	}
+	args = append(args, from.Format("2006-01-02"))
+
+	values := make([]float64, len(windows)*3)
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err := config.DB.QueryRow(`
+		SELECT `+strings.Join(selects, ", ")+`
+		FROM dokumen_penjualan
+		WHERE tanggal_dokumen >= ?
+	`, args...).Scan(dest...)
+
+	result := gin.H{}
+	for i, win := range windows {
+		result[win.name] = gin.H{
+			"start_date":       win.start.Format("2006-01-02"),
+			"end_date":         win.end.Format("2006-01-02"),
+			"jumlah_transaksi": int(values[i*3]),
+			"berat_bersih_kg":  round2(values[i*3+1]),
+			"pendapatan":       round2(values[i*3+2]),
+		}
+	}
+	return result, err
+}
+
+// dashboardPiutang totals unpaid invoices, for one buyer when buyerID is set
+func dashboardPiutang(buyerID interface{}) (gin.H, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(sisa), 0), COALESCE(SUM(CASE WHEN umur > 30 THEN sisa ELSE 0 END), 0)
+		FROM (
+			SELECT dp.total_akhir - COALESCE(paid.total, 0) AS sisa, DATEDIFF(CURDATE(), dp.tanggal_dokumen) AS umur
+			FROM dokumen_penjualan dp
+			JOIN purchase_orders po ON dp.po_id = po.id
+			LEFT JOIN (
+				SELECT dokumen_id, SUM(jumlah_bayar) as total
+				FROM pembayaran
+				WHERE status IN ('verified', 'completed')
+				GROUP BY dokumen_id
+			) paid ON paid.dokumen_id = dp.id
+			WHERE dp.total_akhir - COALESCE(paid.total, 0) > 0
+	`
+	args := []interface{}{}
+	if buyerID != nil {
+		query += " AND po.buyer_id = ?"
+		args = append(args, buyerID)
+	}
+	query += ") outstanding"
+
+	var invoices int
+	var sisa, lewat30 float64
+	err := config.DB.QueryRow(query, args...).Scan(&invoices, &sisa, &lewat30)
+	return gin.H{
+		"invoice_belum_lunas": invoices,
+		"total_sisa":          round2(sisa),
+		"sisa_lebih_30_hari":  round2(lewat30),
+	}, err
+}
+
+func dashboardTimbangan(w dashboardWindow) (gin.H, error) {
+	var scheduled, inProgress, completed, diLokasi int
+	err := config.DB.QueryRow(`
+		SELECT COALESCE(SUM(status = 'scheduled'), 0), COALESCE(SUM(status = 'in_progress'), 0),
+		       COALESCE(SUM(status = 'completed'), 0),
+		       (SELECT COUNT(*) FROM timbangan WHERE status = 'loading')
+		FROM jadwal_pengambilan
+		WHERE waktu_loading >= ? AND waktu_loading < ? AND status <> 'cancelled'
+	`, w.today, w.today.AddDate(0, 0, 1)).Scan(&scheduled, &inProgress, &completed, &diLokasi)
+	return gin.H{
+		"jadwal_hari_ini": scheduled + inProgress + completed,
+		"belum_datang":    scheduled,
+		"sedang_dimuat":   inProgress,
+		"selesai":         completed,
+		"truk_di_lokasi":  diLokasi,
+	}, err
+}
+
+func dashboardPesanan(buyerID interface{}) (gin.H, error) {
+	var total, pending, approved, completed int
+	var spent float64
+	err := config.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(status = 'pending'), 0), COALESCE(SUM(status = 'approved'), 0),
+		       COALESCE(SUM(status = 'completed'), 0),
+		       COALESCE(SUM(CASE WHEN status = 'completed' THEN total_harga ELSE 0 END), 0)
+		FROM purchase_orders
+		WHERE buyer_id = ?
+	`, buyerID).Scan(&total, &pending, &approved, &completed, &spent)
+	return gin.H{
+		"total":           total,
+		"pending":         pending,
+		"approved":        approved,
+		"completed":       completed,
+		"total_pembelian": round2(spent),
+	}, err
+}
+
+// buildDashboard computes the requested widgets and the flat fields older clients read
+func buildDashboard(widgets []string, own bool, userID interface{}, now time.Time) (gin.H, error) {
+	w := newDashboardWindow(now)
+	data := gin.H{}
+	for _, name := range widgets {
+		var widget gin.H
+		var err error
+		switch name {
+		case "stok":
+			widget, err = dashboardStok()
+		case "po":
+			widget, err = dashboardPO(w)
+		case "master":
+			widget, err = dashboardMaster()
+		case "penjualan":
+			widget, err = dashboardPenjualan(w)
+		case "piutang":
+			widget, err = dashboardPiutang(nil)
+		case "timbangan":
+			widget, err = dashboardTimbangan(w)
+		case "pesanan":
+			widget, err = dashboardPesanan(userID)
+		case "tagihan":
+			widget, err = dashboardPiutang(userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		data[name] = widget
+	}
+
+	stats := gin.H{"widgets": data, "generated_at": now}
+	if own {
+		if p, ok := data["pesanan"].(gin.H); ok {
+			stats["total_po"] = p["total"]
+			stats["pending_po"] = p["pending"]
+			stats["approved_po"] = p["approved"]
+			stats["completed_po"] = p["completed"]
+			stats["total_spent"] = p["total_pembelian"]
+		}
+		return stats, nil
+	}
+	if s, ok := data["stok"].(gin.H); ok {
+		stats["total_stok"] = s["batch_tersedia"]
+	}
+	if m, ok := data["master"].(gin.H); ok {
+		stats["total_kebun"] = m["kebun_aktif"]
+		stats["total_buyer"] = m["buyer_aktif"]
+	}
+	if p, ok := data["po"].(gin.H); ok {
+		stats["pending_po"] = p["pending"]
+	}
+	if p, ok := data["penjualan"].(gin.H); ok {
+		stats["revenue_month"] = p["bulan_ini"].(gin.H)["pendapatan"]
+	}
+	return stats, nil
+}
+
+// GetDashboardStats returns the dashboard widgets for the current user.
+// Results are cached per widget set (and per buyer) until invalidated.
+func GetDashboardStats(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	widgets, own := dashboardWidgets(c)
+	now := time.Now()
+
+	key := now.Format("2006-01-02") + "|" + strings.Join(widgets, ",")
+	if own {
+		key += "|" + strconv.Itoa(userID.(int))
+	}
+	ttl := time.Duration(config.AppConfig.DashboardTTL) * time.Second
+
+	dashboardCache.Lock()
+	entry, hit := dashboardCache.entries[key]
+	generation := dashboardCache.generation
+	dashboardCache.Unlock()
+	if hit && now.Before(entry.expires) {
+		c.JSON(http.StatusOK, entry.data)
+		return
+	}
+
+	stats, err := buildDashboard(widgets, own, userID, now)
+	if err != nil {
+		log.Printf("GetDashboardStats - %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dashboard statistics"})
+		return
+	}
+
+	// Skip caching if an event invalidated the cache while we were computing
+	if ttl > 0 {
+		dashboardCache.Lock()
+		if dashboardCache.generation == generation {
+			for k, e := range dashboardCache.entries {
+				if !now.Before(e.expires) {
+					delete(dashboardCache.entries, k)
+				}
+			}
+			dashboardCache.entries[key] = dashboardEntry{data: stats, expires: now.Add(ttl)}
+		}
+		dashboardCache.Unlock()
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
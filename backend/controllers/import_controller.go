@@ -0,0 +1,613 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sawit-backend/config"
+	"sawit-backend/mailer"
+	"sawit-backend/middleware"
+	"sawit-backend/models"
+	"sawit-backend/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/xuri/excelize/v2"
+)
+
+// importMaxRows caps one upload; larger sheets should be split per day or per kebun
+const importMaxRows = 5000
+
+// importedPassword is never a valid bcrypt hash, so imported buyers cannot log in
+// until they set a password through the invitation link
+const importedPassword = "!imported"
+
+type importRow struct {
+	Line   int // Spreadsheet line number; the header is line 1
+	Values map[string]string
+}
+
+func (r importRow) get(column string) string {
+	return strings.TrimSpace(r.Values[column])
+}
+
+type importError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// importer describes one importable entity. insert validates a row with the same
+// rules as the API and, when it is valid, writes it inside the import transaction.
+type importer struct {
+	permission  string
+	columns     []string
+	required    []string // "a|b" means either column is accepted
+	example     []string
+	insert      func(tx *sql.Tx, row importRow) (int64, []importError)
+	afterCommit func(ids []int64)
+}
+
+var importers = map[string]importer{
+	"stok": {
+		permission: middleware.PermStokCreate,
+		columns:    []string{"nama_kebun", "kode_blok", "tanggal_panen", "jumlah_kg", "grade", "kadar_minyak", "harga_per_kg", "keterangan"},
+		required:   []string{"kebun_id|nama_kebun", "tanggal_panen", "jumlah_kg", "grade", "harga_per_kg"},
+		example:    []string{"Kebun Sawit A", "A01", "2025-12-01", "7380", "A", "22.5", "1850", "Rotasi 2"},
+		insert:     importStok,
+	},
+	"kebun": {
+		permission: middleware.PermKebunManage,
+		columns:    []string{"nama_kebun", "lokasi", "luas_hektar", "koordinat", "status"},
+		required:   []string{"nama_kebun", "lokasi", "luas_hektar"},
+		example:    []string{"Kebun Sawit D", "Jambi, Muaro Jambi", "120.5", "-1.610000,103.610000", "active"},
+		insert:     importKebun,
+	},
+	"kendaraan": {
+		permission: middleware.PermJadwalCreate,
+		columns:    []string{"plat_nomor", "jenis", "kapasitas_kg", "nama_sopir", "buyer_email"},
+		required:   []string{"plat_nomor"},
+		example:    []string{"BM 8123 TU", "Dump truck", "8000", "Joko", "buyer@example.com"},
+		insert:     importKendaraan,
+	},
+	"buyers": {
+		permission:  middleware.PermUserManage,
+		columns:     []string{"username", "email", "company_name", "address", "nib", "phone"},
+		required:    []string{"username", "email", "company_name"},
+		example:     []string{"ptsawitjaya", "pembelian@sawitjaya.co.id", "PT Sawit Jaya", "Jl. Sudirman 10, Pekanbaru", "9120001234567", "0761123456"},
+		insert:      importBuyer,
+		afterCommit: inviteImportedBuyers,
+	},
+}
+
+// ImportData imports an XLSX or CSV file. By default it is a dry run that only
+// reports per-row errors; with dry_run=false all rows are written, or none if any row fails.
+// The import opens its own transaction on config.DB because kebun and kendaraan rows
+// go through the insert helpers of those modules; stok and buyer rows are written
+// through repositories on the same transaction.
+func ImportData(c *gin.Context) {
+	entity := c.Param("entity")
+	imp, ok := importers[entity]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown import type"})
+		return
+	}
+	if !middleware.HasPermission(c, imp.permission) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+	dryRun := c.DefaultQuery("dry_run", "true") != "false"
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+	if header.Size > config.AppConfig.MaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+		return
+	}
+
+	rows, columns, err := readImportFile(file, header.Filename, c.Query("sheet"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if missing := missingColumns(columns, imp.required); len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing column(s): " + strings.Join(missing, ", ")})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File has no data rows"})
+		return
+	}
+	if len(rows) > importMaxRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File has %d rows; at most %d rows per import", len(rows), importMaxRows)})
+		return
+	}
+
+	// Valid rows are written even on a dry run so database constraints are checked too;
+	// the transaction is only committed when nothing failed and dry_run=false
+	tx, err := config.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	importErrors := make([]importError, 0)
+	ids := make([]int64, 0, len(rows))
+	errorRows := 0
+	for _, row := range rows {
+		id, rowErrors := imp.insert(tx, row)
+		if len(rowErrors) > 0 {
+			importErrors = append(importErrors, rowErrors...)
+			errorRows++
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	report := gin.H{
+		"entity":     entity,
+		"dry_run":    dryRun,
+		"total_rows": len(rows),
+		"valid_rows": len(rows) - errorRows,
+		"error_rows": errorRows,
+		"errors":     importErrors,
+		"committed":  false,
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	if errorRows > 0 {
+		c.JSON(http.StatusUnprocessableEntity, report)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save imported rows"})
+		return
+	}
+	report["committed"] = true
+
+	if imp.afterCommit != nil {
+		go imp.afterCommit(ids)
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "import", Modul: "import",
+		Aktivitas: fmt.Sprintf("Import %s: %d baris dari %s", entity, len(rows), header.Filename),
+	})
+
+	invalidateDashboard()
+	c.JSON(http.StatusCreated, report)
+}
+
+// GetImportTemplate downloads an empty import sheet with one example row
+func GetImportTemplate(c *gin.Context) {
+	entity := c.Param("entity")
+	imp, ok := importers[entity]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown import type"})
+		return
+	}
+	if !middleware.HasPermission(c, imp.permission) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "xlsx")
+	filename := "import-" + entity + "." + format
+
+	switch format {
+	case "csv":
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write(imp.columns)
+		w.Write(imp.example)
+		w.Flush()
+	case "xlsx":
+		f := excelize.NewFile()
+		defer f.Close()
+		sheet := "Sheet1"
+		for i := range imp.columns {
+			header, _ := excelize.CoordinatesToCellName(i+1, 1)
+			example, _ := excelize.CoordinatesToCellName(i+1, 2)
+			f.SetCellValue(sheet, header, imp.columns[i])
+			f.SetCellValue(sheet, example, imp.example[i])
+		}
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		f.Write(c.Writer)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+	}
+}
+
+// readImportFile returns the data rows keyed by normalized header name
+func readImportFile(file io.Reader, filename, sheet string) ([]importRow, map[string]bool, error) {
+	var records [][]string
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+		// Spreadsheets saved with an Indonesian locale separate fields with ';'
+		firstLine := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			firstLine = data[:i]
+		}
+		r := csv.NewReader(bytes.NewReader(data))
+		if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+			r.Comma = ';'
+		}
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		records, err = r.ReadAll()
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+	case ".xlsx":
+		f, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, nil, errors.New("invalid XLSX file")
+		}
+		defer f.Close()
+		if sheet == "" {
+			sheet = f.GetSheetName(0)
+		}
+		// Raw values keep dates as serial numbers instead of locale-formatted text
+		records, err = f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, nil, fmt.Errorf("sheet %q not found", sheet)
+		}
+	default:
+		return nil, nil, errors.New("file must be .xlsx or .csv")
+	}
+
+	if len(records) == 0 {
+		return nil, nil, errors.New("file is empty")
+	}
+
+	header := make([]string, len(records[0]))
+	columns := make(map[string]bool)
+	for i, name := range records[0] {
+		header[i] = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		columns[header[i]] = true
+	}
+
+	rows := make([]importRow, 0, len(records)-1)
+	for i, record := range records[1:] {
+		row := importRow{Line: i + 2, Values: make(map[string]string)}
+		blank := true
+		for j, value := range record {
+			if j < len(header) && header[j] != "" {
+				row.Values[header[j]] = value
+				if strings.TrimSpace(value) != "" {
+					blank = false
+				}
+			}
+		}
+		if !blank {
+			rows = append(rows, row)
+		}
+	}
+	return rows, columns, nil
+}
+
+func missingColumns(columns map[string]bool, required []string) []string {
+	missing := make([]string, 0)
+	for _, req := range required {
+		found := false
+		for _, alt := range strings.Split(req, "|") {
+			if columns[alt] {
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, strings.ReplaceAll(req, "|", " or "))
+		}
+	}
+	return missing
+}
+
+// parseImportNumber accepts both "1850.5" and the Indonesian "1.850,5"
+func parseImportNumber(value string) (float64, error) {
+	value = strings.ReplaceAll(value, " ", "")
+	if value == "" {
+		return 0, nil
+	}
+	dot, comma := strings.LastIndex(value, "."), strings.LastIndex(value, ",")
+	switch {
+	case dot >= 0 && comma >= 0 && comma > dot:
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.Replace(value, ",", ".", 1)
+	case dot >= 0 && comma >= 0:
+		value = strings.ReplaceAll(value, ",", "")
+	case comma >= 0:
+		value = strings.Replace(value, ",", ".", 1)
+	case strings.Count(value, ".") > 1:
+		value = strings.ReplaceAll(value, ".", "")
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// parseImportDate accepts ISO dates, day-first dates and Excel date serials
+func parseImportDate(value string) (string, error) {
+	for _, layout := range []string{"2006-01-02", "02/01/2006", "2/1/2006", "02-01-2006", "2-1-2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil {
+		if t, err := excelize.ExcelDateToTime(serial, false); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", errors.New("invalid date")
+}
+
+// readNumber parses a numeric column and records an error for the row when it is not a number
+func readNumber(row importRow, column string, errs *[]importError) float64 {
+	n, err := parseImportNumber(row.get(column))
+	if err != nil {
+		*errs = append(*errs, importError{Row: row.Line, Column: column, Message: "must be a number"})
+	}
+	return n
+}
+
+// validateImportStruct runs the API binding rules and names failing fields by their JSON key
+func validateImportStruct(row importRow, req interface{}) []importError {
+	err := binding.Validator.ValidateStruct(req)
+	if err == nil {
+		return nil
+	}
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return []importError{{Row: row.Line, Message: err.Error()}}
+	}
+
+	t := reflect.TypeOf(req).Elem()
+	result := make([]importError, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		column := fe.Field()
+		if field, ok := t.FieldByName(fe.StructField()); ok {
+			column = strings.Split(field.Tag.Get("json"), ",")[0]
+		}
+
+		message := "failed " + fe.Tag() + " rule"
+		switch fe.Tag() {
+		case "required":
+			message = "is required"
+		case "gt":
+			message = "must be greater than " + fe.Param()
+		case "gte":
+			message = "must be at least " + fe.Param()
+		case "lte":
+			message = "must be at most " + fe.Param()
+		case "max":
+			message = "must be at most " + fe.Param() + " characters"
+		case "oneof":
+			message = "must be one of: " + fe.Param()
+		case "email":
+			message = "must be a valid email address"
+		}
+		result = append(result, importError{Row: row.Line, Column: column, Message: message})
+	}
+	return result
+}
+
+func importStok(tx *sql.Tx, row importRow) (int64, []importError) {
+	errs := make([]importError, 0)
+	var req models.CreateStokRequest
+
+	// Sheets from the field offices name the kebun and blok instead of using IDs
+	if kebunID := row.get("kebun_id"); kebunID != "" {
+		req.KebunID, _ = strconv.Atoi(kebunID)
+	} else if nama := row.get("nama_kebun"); nama != "" {
+		err := tx.QueryRow("SELECT id FROM kebun WHERE nama_kebun = ?", nama).Scan(&req.KebunID)
+		if err == sql.ErrNoRows {
+			errs = append(errs, importError{Row: row.Line, Column: "nama_kebun", Message: "unknown kebun " + nama})
+		} else if err != nil {
+			return 0, []importError{{Row: row.Line, Message: "Failed to look up kebun"}}
+		}
+	}
+	if kodeBlok := row.get("kode_blok"); kodeBlok != "" && req.KebunID != 0 {
+		var blokID int
+		err := tx.QueryRow(`
+			SELECT b.id FROM blok b
+			JOIN afdeling a ON b.afdeling_id = a.id
+			WHERE a.kebun_id = ? AND b.kode_blok = ?
+		`, req.KebunID, kodeBlok).Scan(&blokID)
+		if err == sql.ErrNoRows {
+			errs = append(errs, importError{Row: row.Line, Column: "kode_blok", Message: "unknown blok " + kodeBlok + " in this kebun"})
+		} else if err != nil {
+			return 0, []importError{{Row: row.Line, Message: "Failed to look up blok"}}
+		} else {
+			req.BlokID = &blokID
+		}
+	}
+
+	if tanggal := row.get("tanggal_panen"); tanggal != "" {
+		parsed, err := parseImportDate(tanggal)
+		if err != nil {
+			errs = append(errs, importError{Row: row.Line, Column: "tanggal_panen", Message: "must be a date (YYYY-MM-DD or DD/MM/YYYY)"})
+		}
+		req.TanggalPanen = parsed
+	}
+	req.JumlahKg = readNumber(row, "jumlah_kg", &errs)
+	req.Grade = strings.ToUpper(row.get("grade"))
+	req.KadarMinyak = readNumber(row, "kadar_minyak", &errs)
+	req.HargaPerKg = readNumber(row, "harga_per_kg", &errs)
+	req.Keterangan = row.get("keterangan")
+
+	if len(errs) > 0 {
+		return 0, errs
+	}
+	if errs = validateImportStruct(row, &req); len(errs) > 0 {
+		return 0, errs
+	}
+	stok := repository.NewStokRepository(tx)
+	if msg := validateStok(stok, &req); msg != "" {
+		return 0, []importError{{Row: row.Line, Message: msg}}
+	}
+
+	id, err := stok.Create(req)
+	if err != nil {
+		return 0, []importError{{Row: row.Line, Message: "Failed to create stock"}}
+	}
+	return id, nil
+}
+
+func importKebun(tx *sql.Tx, row importRow) (int64, []importError) {
+	errs := make([]importError, 0)
+	req := models.KebunRequest{
+		NamaKebun: row.get("nama_kebun"),
+		Lokasi:    row.get("lokasi"),
+		Koordinat: row.get("koordinat"),
+		Status:    strings.ToLower(row.get("status")),
+	}
+	req.LuasHektar = readNumber(row, "luas_hektar", &errs)
+
+	if len(errs) > 0 {
+		return 0, errs
+	}
+	if errs = validateImportStruct(row, &req); len(errs) > 0 {
+		return 0, errs
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	result, err := insertKebun(tx, &req)
+	if err != nil {
+		return 0, []importError{{Row: row.Line, Message: "Failed to create kebun"}}
+	}
+	id, _ := result.LastInsertId()
+	return id, nil
+}
+
+func importKendaraan(tx *sql.Tx, row importRow) (int64, []importError) {
+	errs := make([]importError, 0)
+	req := models.KendaraanRequest{
+		PlatNomor: row.get("plat_nomor"),
+		Jenis:     row.get("jenis"),
+		NamaSopir: row.get("nama_sopir"),
+	}
+	req.KapasitasKg = readNumber(row, "kapasitas_kg", &errs)
+	if email := row.get("buyer_email"); email != "" {
+		buyer, err := repository.NewUserRepository(tx).FindByEmail(email)
+		if err == repository.ErrNotFound || (err == nil && buyer.Role != "buyer") {
+			errs = append(errs, importError{Row: row.Line, Column: "buyer_email", Message: "unknown buyer " + email})
+		} else if err != nil {
+			return 0, []importError{{Row: row.Line, Message: "Failed to look up buyer"}}
+		} else {
+			req.BuyerID = &buyer.ID
+		}
+	}
+
+	if len(errs) > 0 {
+		return 0, errs
+	}
+	if errs = validateImportStruct(row, &req); len(errs) > 0 {
+		return 0, errs
+	}
+	if msg := validateKendaraan(tx, &req); msg != "" {
+		return 0, []importError{{Row: row.Line, Column: "plat_nomor", Message: msg}}
+	}
+
+	result, err := insertKendaraan(tx, &req)
+	if isDuplicateEntry(err) {
+		return 0, []importError{{Row: row.Line, Column: "plat_nomor", Message: "duplicate plat nomor in file"}}
+	}
+	if err != nil {
+		return 0, []importError{{Row: row.Line, Message: "Failed to create vehicle"}}
+	}
+	id, _ := result.LastInsertId()
+	return id, nil
+}
+
+func importBuyer(tx *sql.Tx, row importRow) (int64, []importError) {
+	req := models.ImportBuyerRequest{
+		Username:    row.get("username"),
+		Email:       strings.ToLower(row.get("email")),
+		CompanyName: row.get("company_name"),
+		Address:     row.get("address"),
+		NIB:         row.get("nib"),
+		Phone:       row.get("phone"),
+	}
+	if errs := validateImportStruct(row, &req); len(errs) > 0 {
+		return 0, errs
+	}
+
+	// Runs on tx, so buyers inserted by earlier rows of the same file count too
+	users := repository.NewUserRepository(tx)
+	exists, err := users.Exists(req.Email, req.Username)
+	if err != nil {
+		return 0, []importError{{Row: row.Line, Message: "Failed to check existing users"}}
+	}
+	if exists {
+		return 0, []importError{{Row: row.Line, Message: "Email or username already exists"}}
+	}
+
+	id, err := users.Create(repository.NewUser{
+		Username: req.Username, Email: req.Email, PasswordHash: importedPassword, Role: "buyer",
+		CompanyName: req.CompanyName, Address: req.Address, NIB: req.NIB, Phone: req.Phone,
+	})
+	if isDuplicateEntry(err) {
+		return 0, []importError{{Row: row.Line, Message: "duplicate email or username in file"}}
+	}
+	if err != nil {
+		return 0, []importError{{Row: row.Line, Message: "Failed to create user"}}
+	}
+	return id, nil
+}
+
+// inviteImportedBuyers mails each imported buyer a link to set their password,
+// which also verifies their email
+func inviteImportedBuyers(ids []int64) {
+	store := repository.NewStore(config.DB)
+	ttl := time.Duration(config.AppConfig.VerifyTokenHrs) * time.Hour
+	for _, id := range ids {
+		buyer, err := store.Users().FindByID(int(id))
+		if err != nil {
+			continue
+		}
+		token, err := issueAuthToken(store.Auth(), buyer.ID, tokenPasswordReset, ttl)
+		if err != nil {
+			log.Printf("Import - Failed to create invitation for %s: %v", buyer.Email, err)
+			continue
+		}
+
+		link := fmt.Sprintf("%s/reset-password?token=%s", config.AppConfig.AppBaseURL, token)
+		err = mailer.Client.Send(mailer.Message{
+			To:      []string{buyer.Email},
+			Subject: "Akun Pembeli - Sistem Informasi Perkebunan Sawit",
+			Body: fmt.Sprintf("Halo %s,\n\nAkun pembeli Anda telah dibuat oleh admin.\n"+
+				"Buka tautan berikut dalam %d jam untuk membuat password:\n\n%s\n",
+				buyer.Username, config.AppConfig.VerifyTokenHrs, link),
+		})
+		if err != nil {
+			log.Printf("Import - Failed to send invitation to %s: %v", buyer.Email, err)
+		}
+	}
+}
@@ -0,0 +1,613 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+)
+
+const blokSelect = `
+	SELECT b.id, b.afdeling_id, a.kebun_id, b.kode_blok, b.tahun_tanam, b.varietas,
+	       b.luas_hektar, b.jumlah_pokok, b.area_hektar, b.status, b.created_at, b.updated_at, a.kode_afdeling
+	FROM blok b
+	JOIN afdeling a ON b.afdeling_id = a.id
+`
+
+// scanBlok scans a row selected with blokSelect
+func scanBlok(scanner interface{ Scan(...interface{}) error }) (models.Blok, error) {
+	var blok models.Blok
+	var varietas sql.NullString
+	var jumlahPokok sql.NullInt64
+	var areaHektar sql.NullFloat64
+	err := scanner.Scan(
+		&blok.ID, &blok.AfdelingID, &blok.KebunID, &blok.KodeBlok, &blok.TahunTanam, &varietas,
+		&blok.LuasHektar, &jumlahPokok, &areaHektar, &blok.Status, &blok.CreatedAt, &blok.UpdatedAt, &blok.KodeAfdeling,
+	)
+	blok.Varietas = varietas.String
+	if areaHektar.Valid {
+		blok.AreaHektar = &areaHektar.Float64
+	}
+	if jumlahPokok.Valid {
+		n := int(jumlahPokok.Int64)
+		blok.JumlahPokok = &n
+	}
+	return blok, err
+}
+
+// isDuplicateEntry reports whether err is a MySQL unique key violation
+func isDuplicateEntry(err error) bool {
+	mysqlErr, ok := err.(*mysqlDriver.MySQLError)
+	return ok && mysqlErr.Number == 1062
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// GetKebunList returns list of kebun, active only unless ?status= is given
+func GetKebunList(c *gin.Context) {
+	query := `
+		SELECT id, nama_kebun, lokasi, luas_hektar, koordinat, area_hektar, status, created_at, updated_at
+		FROM kebun
+	`
+	args := []interface{}{}
+
+	if status := c.DefaultQuery("status", "active"); status != "all" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+
+	query += " ORDER BY nama_kebun"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch kebun"})
+		return
+	}
+	defer rows.Close()
+
+	kebunList := make([]models.Kebun, 0)
+	for rows.Next() {
+		var kebun models.Kebun
+		var koordinat sql.NullString
+		var areaHektar sql.NullFloat64
+		err := rows.Scan(
+			&kebun.ID, &kebun.NamaKebun, &kebun.Lokasi, &kebun.LuasHektar,
+			&koordinat, &areaHektar, &kebun.Status, &kebun.CreatedAt, &kebun.UpdatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		kebun.Koordinat = koordinat.String
+		if areaHektar.Valid {
+			kebun.AreaHektar = &areaHektar.Float64
+		}
+		kebunList = append(kebunList, kebun)
+	}
+
+	c.JSON(http.StatusOK, kebunList)
+}
+
+// GetKebunDetail returns a kebun with its afdeling and blok hierarchy
+func GetKebunDetail(c *gin.Context) {
+	kebunID := c.Param("id")
+
+	var kebun models.Kebun
+	var koordinat sql.NullString
+	var areaHektar sql.NullFloat64
+	err := config.DB.QueryRow(`
+		SELECT id, nama_kebun, lokasi, luas_hektar, koordinat, area_hektar, status, created_at, updated_at
+		FROM kebun WHERE id = ?
+	`, kebunID).Scan(
+		&kebun.ID, &kebun.NamaKebun, &kebun.Lokasi, &kebun.LuasHektar,
+		&koordinat, &areaHektar, &kebun.Status, &kebun.CreatedAt, &kebun.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kebun not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch kebun"})
+		return
+	}
+	kebun.Koordinat = koordinat.String
+	if areaHektar.Valid {
+		kebun.AreaHektar = &areaHektar.Float64
+	}
+
+	afdelingList, err := fetchAfdeling(kebun.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch afdeling"})
+		return
+	}
+
+	rows, err := config.DB.Query(blokSelect+" WHERE a.kebun_id = ? ORDER BY b.kode_blok", kebun.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blok"})
+		return
+	}
+	defer rows.Close()
+
+	blokByAfdeling := make(map[int][]models.Blok)
+	for rows.Next() {
+		blok, err := scanBlok(rows)
+		if err != nil {
+			continue
+		}
+		blokByAfdeling[blok.AfdelingID] = append(blokByAfdeling[blok.AfdelingID], blok)
+	}
+
+	for i := range afdelingList {
+		afdelingList[i].Blok = blokByAfdeling[afdelingList[i].ID]
+	}
+	kebun.Afdeling = afdelingList
+
+	c.JSON(http.StatusOK, kebun)
+}
+
+// CreateKebun creates a new kebun
+func CreateKebun(c *gin.Context) {
+	var req models.KebunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	result, err := insertKebun(config.DB, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create kebun"})
+		return
+	}
+
+	kebunID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Entitas: "kebun", ID: kebunID,
+		Aktivitas: "Menambah kebun",
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Kebun created successfully",
+		"kebun_id": kebunID,
+	})
+}
+
+func insertKebun(db sqlExecer, req *models.KebunRequest) (sql.Result, error) {
+	return db.Exec(`
+		INSERT INTO kebun (nama_kebun, lokasi, luas_hektar, koordinat, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, req.NamaKebun, req.Lokasi, req.LuasHektar, req.Koordinat, req.Status)
+}
+
+// UpdateKebun updates an existing kebun
+func UpdateKebun(c *gin.Context) {
+	kebunID := c.Param("id")
+
+	var req models.KebunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	before := auditSnapshot(config.DB, "kebun", paramID(c))
+
+	result, err := config.DB.Exec(`
+		UPDATE kebun SET nama_kebun = ?, lokasi = ?, luas_hektar = ?, koordinat = ?, status = ?
+		WHERE id = ?
+	`, req.NamaKebun, req.Lokasi, req.LuasHektar, req.Koordinat, req.Status, kebunID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update kebun"})
+		return
+	}
+	if !recordExists(result, "SELECT COUNT(*) FROM kebun WHERE id = ?", kebunID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kebun not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "update", Entitas: "kebun", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mengupdate kebun",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kebun updated successfully"})
+}
+
+// DeleteKebun deletes a kebun that has no stock or orders; otherwise deactivate it instead
+func DeleteKebun(c *gin.Context) {
+	kebunID := c.Param("id")
+
+	var usage int
+	config.DB.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM stok_tbs WHERE kebun_id = ?) +
+		       (SELECT COUNT(*) FROM purchase_orders WHERE kebun_id = ?)
+	`, kebunID, kebunID).Scan(&usage)
+	if usage > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kebun has stock or purchase orders; set its status to inactive instead"})
+		return
+	}
+
+	before := auditSnapshot(config.DB, "kebun", paramID(c))
+
+	result, err := config.DB.Exec("DELETE FROM kebun WHERE id = ?", kebunID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete kebun"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kebun not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "delete", Entitas: "kebun", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Menghapus kebun",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kebun deleted successfully"})
+}
+
+// GetAfdelingList returns afdeling of a kebun
+func GetAfdelingList(c *gin.Context) {
+	var kebunID int
+	fmt.Sscan(c.Param("id"), &kebunID)
+
+	afdelingList, err := fetchAfdeling(kebunID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch afdeling"})
+		return
+	}
+
+	c.JSON(http.StatusOK, afdelingList)
+}
+
+// CreateAfdeling creates an afdeling under a kebun
+func CreateAfdeling(c *gin.Context) {
+	kebunID := c.Param("id")
+
+	var req models.AfdelingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	var exists int
+	config.DB.QueryRow("SELECT COUNT(*) FROM kebun WHERE id = ?", kebunID).Scan(&exists)
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kebun not found"})
+		return
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO afdeling (kebun_id, kode_afdeling, nama_afdeling, luas_hektar, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, kebunID, req.KodeAfdeling, req.NamaAfdeling, req.LuasHektar, req.Status)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode afdeling already exists in this kebun"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create afdeling"})
+		return
+	}
+
+	afdelingID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Modul: "kebun", Entitas: "afdeling", ID: afdelingID,
+		Aktivitas: "Menambah afdeling",
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Afdeling created successfully",
+		"afdeling_id": afdelingID,
+	})
+}
+
+// UpdateAfdeling updates an afdeling
+func UpdateAfdeling(c *gin.Context) {
+	afdelingID := c.Param("id")
+
+	var req models.AfdelingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	before := auditSnapshot(config.DB, "afdeling", paramID(c))
+
+	result, err := config.DB.Exec(`
+		UPDATE afdeling SET kode_afdeling = ?, nama_afdeling = ?, luas_hektar = ?, status = ?
+		WHERE id = ?
+	`, req.KodeAfdeling, req.NamaAfdeling, req.LuasHektar, req.Status, afdelingID)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode afdeling already exists in this kebun"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update afdeling"})
+		return
+	}
+	if !recordExists(result, "SELECT COUNT(*) FROM afdeling WHERE id = ?", afdelingID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Afdeling not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "update", Modul: "kebun", Entitas: "afdeling", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mengupdate afdeling",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Afdeling updated successfully"})
+}
+
+// DeleteAfdeling deletes an afdeling without blok
+func DeleteAfdeling(c *gin.Context) {
+	afdelingID := c.Param("id")
+
+	var blokCount int
+	config.DB.QueryRow("SELECT COUNT(*) FROM blok WHERE afdeling_id = ?", afdelingID).Scan(&blokCount)
+	if blokCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Afdeling still has blok; delete or move them first"})
+		return
+	}
+
+	before := auditSnapshot(config.DB, "afdeling", paramID(c))
+
+	result, err := config.DB.Exec("DELETE FROM afdeling WHERE id = ?", afdelingID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete afdeling"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Afdeling not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "delete", Modul: "kebun", Entitas: "afdeling", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Menghapus afdeling",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Afdeling deleted successfully"})
+}
+
+// GetBlokList returns blok filtered by kebun, afdeling or status
+func GetBlokList(c *gin.Context) {
+	query := blokSelect + " WHERE 1=1"
+	args := []interface{}{}
+
+	afdelingID := c.Param("id")
+	if afdelingID == "" {
+		afdelingID = c.Query("afdeling_id")
+	}
+	if afdelingID != "" {
+		query += " AND b.afdeling_id = ?"
+		args = append(args, afdelingID)
+	}
+	if kebunID := c.Query("kebun_id"); kebunID != "" {
+		query += " AND a.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	if status := c.Query("status"); status != "" {
+		query += " AND b.status = ?"
+		args = append(args, status)
+	}
+
+	query += " ORDER BY a.kebun_id, a.kode_afdeling, b.kode_blok"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blok"})
+		return
+	}
+	defer rows.Close()
+
+	blokList := make([]models.Blok, 0)
+	for rows.Next() {
+		blok, err := scanBlok(rows)
+		if err != nil {
+			continue
+		}
+		blokList = append(blokList, blok)
+	}
+
+	c.JSON(http.StatusOK, blokList)
+}
+
+// GetBlokDetail returns a single blok
+func GetBlokDetail(c *gin.Context) {
+	blok, err := scanBlok(config.DB.QueryRow(blokSelect+" WHERE b.id = ?", c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blok not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blok"})
+		return
+	}
+
+	c.JSON(http.StatusOK, blok)
+}
+
+// CreateBlok creates a blok under an afdeling
+func CreateBlok(c *gin.Context) {
+	afdelingID := c.Param("id")
+
+	var req models.BlokRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TahunTanam > time.Now().Year()+1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tahun_tanam cannot be in the future"})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	var exists int
+	config.DB.QueryRow("SELECT COUNT(*) FROM afdeling WHERE id = ?", afdelingID).Scan(&exists)
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Afdeling not found"})
+		return
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO blok (afdeling_id, kode_blok, tahun_tanam, varietas, luas_hektar, jumlah_pokok, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, afdelingID, req.KodeBlok, req.TahunTanam, req.Varietas, req.LuasHektar, req.JumlahPokok, req.Status)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode blok already exists in this afdeling"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create blok"})
+		return
+	}
+
+	blokID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Modul: "kebun", Entitas: "blok", ID: blokID,
+		Aktivitas: "Menambah blok",
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Blok created successfully",
+		"blok_id": blokID,
+	})
+}
+
+// UpdateBlok updates a blok
+func UpdateBlok(c *gin.Context) {
+	blokID := c.Param("id")
+
+	var req models.BlokRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.TahunTanam > time.Now().Year()+1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tahun_tanam cannot be in the future"})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	before := auditSnapshot(config.DB, "blok", paramID(c))
+
+	result, err := config.DB.Exec(`
+		UPDATE blok SET kode_blok = ?, tahun_tanam = ?, varietas = ?, luas_hektar = ?,
+		       jumlah_pokok = ?, status = ?
+		WHERE id = ?
+	`, req.KodeBlok, req.TahunTanam, req.Varietas, req.LuasHektar, req.JumlahPokok, req.Status, blokID)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode blok already exists in this afdeling"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update blok"})
+		return
+	}
+	if !recordExists(result, "SELECT COUNT(*) FROM blok WHERE id = ?", blokID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blok not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "update", Modul: "kebun", Entitas: "blok", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mengupdate blok",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Blok updated successfully"})
+}
+
+// DeleteBlok deletes a blok that has no recorded stock
+func DeleteBlok(c *gin.Context) {
+	blokID := c.Param("id")
+
+	var stokCount int
+	config.DB.QueryRow("SELECT COUNT(*) FROM stok_tbs WHERE blok_id = ?", blokID).Scan(&stokCount)
+	if stokCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Blok has recorded stock; set its status to inactive instead"})
+		return
+	}
+
+	before := auditSnapshot(config.DB, "blok", paramID(c))
+
+	result, err := config.DB.Exec("DELETE FROM blok WHERE id = ?", blokID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete blok"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blok not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "delete", Modul: "kebun", Entitas: "blok", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Menghapus blok",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Blok deleted successfully"})
+}
+
+// fetchAfdeling returns the afdeling of a kebun ordered by code
+func fetchAfdeling(kebunID int) ([]models.Afdeling, error) {
+	rows, err := config.DB.Query(`
+		SELECT id, kebun_id, kode_afdeling, nama_afdeling, luas_hektar, status, created_at, updated_at
+		FROM afdeling WHERE kebun_id = ?
+		ORDER BY kode_afdeling
+	`, kebunID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	afdelingList := make([]models.Afdeling, 0)
+	for rows.Next() {
+		var a models.Afdeling
+		err := rows.Scan(
+			&a.ID, &a.KebunID, &a.KodeAfdeling, &a.NamaAfdeling, &a.LuasHektar,
+			&a.Status, &a.CreatedAt, &a.UpdatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		afdelingList = append(afdelingList, a)
+	}
+	return afdelingList, rows.Err()
+}
+
+// recordExists tells "no rows changed" apart from "row not found" after an UPDATE,
+// since MySQL reports zero affected rows when the values are unchanged
+func recordExists(result sql.Result, countQuery string, id interface{}) bool {
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return true
+	}
+	var count int
+	config.DB.QueryRow(countQuery, id).Scan(&count)
+	return count > 0
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/models"
+	"sawit-backend/repository"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// normalizePlat writes plates the way the weighbridge records them, e.g. "BM 1234 AB"
+func normalizePlat(plat string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(plat), " "))
+}
+
+// validateKendaraan normalizes the plate and checks the owning buyer. db is the
+// import transaction when called for an imported row.
+func validateKendaraan(db repository.DBTX, req *models.KendaraanRequest) string {
+	req.PlatNomor = normalizePlat(req.PlatNomor)
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM kendaraan WHERE plat_nomor = ?", req.PlatNomor).Scan(&exists); err != nil {
+		return "Failed to check plat nomor"
+	}
+	if exists > 0 {
+		return "Plat nomor " + req.PlatNomor + " already registered"
+	}
+
+	if req.BuyerID != nil {
+		var role string
+		err := db.QueryRow("SELECT role FROM users WHERE id = ?", *req.BuyerID).Scan(&role)
+		if err != nil || role != "buyer" {
+			return "Buyer not found"
+		}
+	}
+	return ""
+}
+
+func insertKendaraan(db sqlExecer, req *models.KendaraanRequest) (sql.Result, error) {
+	return db.Exec(`
+		INSERT INTO kendaraan (plat_nomor, jenis, kapasitas_kg, nama_sopir, buyer_id)
+		VALUES (?, ?, ?, ?, ?)
+	`, req.PlatNomor, req.Jenis, req.KapasitasKg, req.NamaSopir, req.BuyerID)
+}
+
+// GetKendaraanList returns registered vehicles
+func GetKendaraanList(c *gin.Context) {
+	query := `
+		SELECT v.id, v.plat_nomor, v.jenis, v.kapasitas_kg, v.nama_sopir, v.buyer_id, v.status,
+		       v.created_at, u.company_name
+		FROM kendaraan v
+		LEFT JOIN users u ON v.buyer_id = u.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if buyerID := c.Query("buyer_id"); buyerID != "" {
+		query += " AND v.buyer_id = ?"
+		args = append(args, buyerID)
+	}
+	if search := c.Query("search"); search != "" {
+		query += " AND v.plat_nomor LIKE ?"
+		args = append(args, "%"+normalizePlat(search)+"%")
+	}
+
+	query += " ORDER BY v.plat_nomor"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch vehicles"})
+		return
+	}
+	defer rows.Close()
+
+	vehicles := make([]models.Kendaraan, 0)
+	for rows.Next() {
+		var v models.Kendaraan
+		var jenis, namaSopir, company sql.NullString
+		var buyerID sql.NullInt64
+		err := rows.Scan(&v.ID, &v.PlatNomor, &jenis, &v.KapasitasKg, &namaSopir, &buyerID, &v.Status,
+			&v.CreatedAt, &company)
+		if err != nil {
+			continue
+		}
+		v.Jenis = jenis.String
+		v.NamaSopir = namaSopir.String
+		v.BuyerCompany = company.String
+		if buyerID.Valid {
+			id := int(buyerID.Int64)
+			v.BuyerID = &id
+		}
+		vehicles = append(vehicles, v)
+	}
+
+	c.JSON(http.StatusOK, vehicles)
+}
+
+// CreateKendaraan registers a vehicle
+func CreateKendaraan(c *gin.Context) {
+	var req models.KendaraanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateKendaraan(config.DB, &req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	result, err := insertKendaraan(config.DB, &req)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Plat nomor already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vehicle"})
+		return
+	}
+
+	kendaraanID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Entitas: "kendaraan", ID: kendaraanID,
+		Aktivitas: "Menambah kendaraan " + req.PlatNomor,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Vehicle created successfully",
+		"kendaraan_id": kendaraanID,
+	})
+}
@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"sawit-backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logArchiveBatch is the maximum number of entries written to one archive file
+const logArchiveBatch = 10000
+
+// logArchiveMu keeps archive runs in one process from overlapping
+var logArchiveMu sync.Mutex
+
+// auditArchiveEntry is one line of an archive file: the hashed fields plus the hash,
+// so the archived part of the chain can be verified without the database
+type auditArchiveEntry struct {
+	auditChainEntry
+	Hash  string `json:"hash"`
+	Waktu string `json:"waktu"`
+}
+
+// LogArchive describes one archive file
+type LogArchive struct {
+	ID            int       `json:"id"`
+	File          string    `json:"file"`
+	ChainSeqAwal  int64     `json:"chain_seq_awal"`
+	ChainSeqAkhir int64     `json:"chain_seq_akhir"`
+	JumlahEntri   int       `json:"jumlah_entri"`
+	WaktuAwal     time.Time `json:"waktu_awal"`
+	WaktuAkhir    time.Time `json:"waktu_akhir"`
+	UkuranByte    int64     `json:"ukuran_byte"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// StartLogArchiveJob moves log entries past the retention period to archive files
+func StartLogArchiveJob() {
+	interval := config.AppConfig.ArchiveMin
+	if interval <= 0 || config.AppConfig.LogRetention <= 0 {
+		log.Println("Log archiving disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			archives, err := ArchiveLogAktivitas()
+			if err != nil {
+				log.Printf("Log archiving failed: %v", err)
+			}
+			for _, a := range archives {
+				log.Printf("Log archive: %d entri ke %s", a.JumlahEntri, a.File)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// ArchiveLogAktivitas writes sealed entries older than the retention period to gzip
+// JSONL files and removes them from log_aktivitas. Entries leave in chain order, so
+// the hot table always holds an unbroken tail of the chain starting after archived_seq.
+func ArchiveLogAktivitas() ([]LogArchive, error) {
+	logArchiveMu.Lock()
+	defer logArchiveMu.Unlock()
+
+	if config.AppConfig.LogRetention <= 0 {
+		return nil, errors.New("log retention is disabled")
+	}
+	cutoff := time.Now().AddDate(0, 0, -config.AppConfig.LogRetention)
+
+	archives := []LogArchive{}
+	for {
+		archive, err := archiveLogBatch(cutoff)
+		if err != nil || archive == nil {
+			return archives, err
+		}
+		archives = append(archives, *archive)
+		if archive.JumlahEntri < logArchiveBatch {
+			return archives, nil
+		}
+	}
+}
+
+// archiveLogBatch archives up to logArchiveBatch entries and returns nil when none are due
+func archiveLogBatch(cutoff time.Time) (*LogArchive, error) {
+	var archivedSeq int64
+	err := config.DB.QueryRow("SELECT archived_seq FROM audit_chain_state WHERE id = 1").Scan(&archivedSeq)
+	if err != nil {
+		return nil, fmt.Errorf("read chain state: %w", err)
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT `+auditChainColumns+`, chain_seq, prev_hash, hash
+		FROM log_aktivitas
+		WHERE chain_seq > ?
+		ORDER BY chain_seq
+		LIMIT ?
+	`, archivedSeq, logArchiveBatch)
+	if err != nil {
+		return nil, err
+	}
+	entries := []auditArchiveEntry{}
+	for rows.Next() {
+		var e auditArchiveEntry
+		var seq int64
+		var prevHash string
+		e.auditChainEntry, err = scanAuditChainEntry(rows, &seq, &prevHash, &e.Hash)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.ChainSeq, e.PrevHash = seq, prevHash
+		createdAt := time.Unix(e.CreatedAt, 0)
+		// Stop at the first entry still within retention to keep the archive contiguous
+		if !createdAt.Before(cutoff) {
+			break
+		}
+		if e.ChainSeq != archivedSeq+int64(len(entries))+1 {
+			rows.Close()
+			return nil, fmt.Errorf("chain_seq %d is missing; run audit verify", archivedSeq+int64(len(entries))+1)
+		}
+		e.Waktu = createdAt.Format(time.RFC3339)
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	first, last := entries[0], entries[len(entries)-1]
+	archive := LogArchive{
+		ChainSeqAwal:  first.ChainSeq,
+		ChainSeqAkhir: last.ChainSeq,
+		JumlahEntri:   len(entries),
+		WaktuAwal:     time.Unix(first.CreatedAt, 0),
+		WaktuAkhir:    time.Unix(last.CreatedAt, 0),
+	}
+	archive.File, archive.UkuranByte, err = writeLogArchive(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Another server may have archived the same entries in the meantime
+	var current int64
+	if err := tx.QueryRow("SELECT archived_seq FROM audit_chain_state WHERE id = 1 FOR UPDATE").Scan(&current); err != nil {
+		return nil, err
+	}
+	if current != archivedSeq {
+		os.Remove(archive.File)
+		return nil, nil
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM log_aktivitas WHERE chain_seq BETWEEN ? AND ?
+	`, archive.ChainSeqAwal, archive.ChainSeqAkhir)
+	if err != nil {
+		return nil, err
+	}
+	if deleted, _ := result.RowsAffected(); deleted != int64(len(entries)) {
+		return nil, fmt.Errorf("expected to archive %d entries, found %d", len(entries), deleted)
+	}
+	_, err = tx.Exec(`
+		UPDATE audit_chain_state SET archived_seq = ?, archived_hash = ? WHERE id = 1
+	`, last.ChainSeq, last.Hash)
+	if err != nil {
+		return nil, err
+	}
+	result, err = tx.Exec(`
+		INSERT INTO log_archives (file_path, chain_seq_awal, chain_seq_akhir, jumlah_entri, waktu_awal, waktu_akhir, ukuran_byte)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, archive.File, archive.ChainSeqAwal, archive.ChainSeqAkhir, archive.JumlahEntri,
+		archive.WaktuAwal, archive.WaktuAkhir, archive.UkuranByte)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	archive.ID = int(id)
+
+	recordAudit(tx, nil, auditEvent{
+		Aksi: "archive", Modul: "audit",
+		Aktivitas: fmt.Sprintf("Mengarsipkan %d entri log (chain_seq %d-%d) ke %s",
+			archive.JumlahEntri, archive.ChainSeqAwal, archive.ChainSeqAkhir, filepath.Base(archive.File)),
+	})
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	archive.CreatedAt = time.Now()
+	return &archive, nil
+}
+
+// writeLogArchive writes entries to a new gzip JSONL file and returns its path and size.
+// The file is synced before the entries are deleted from the database.
+func writeLogArchive(entries []auditArchiveEntry) (string, int64, error) {
+	dir := config.AppConfig.ArchivePath
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", 0, err
+	}
+	first, last := entries[0], entries[len(entries)-1]
+	path := filepath.Join(dir, fmt.Sprintf("log-aktivitas-%s-%d-%d.jsonl.gz",
+		time.Unix(first.CreatedAt, 0).Format("20060102"), first.ChainSeq, last.ChainSeq))
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return "", 0, err
+	}
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			os.Remove(path)
+			return "", 0, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", 0, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", 0, err
+	}
+	info, _ := f.Stat()
+	if err := f.Close(); err != nil {
+		return "", 0, err
+	}
+	return path, info.Size(), nil
+}
+
+// ArchiveVerification is the outcome of checking archive files
+type ArchiveVerification struct {
+	Valid     bool             `json:"valid"`
+	File      int              `json:"file"`
+	Diperiksa int64            `json:"diperiksa"`
+	ChainSeq  int64            `json:"chain_seq_terakhir"`
+	Hash      string           `json:"hash_terakhir"`
+	Putus     *AuditChainBreak `json:"putus"`
+	PutusFile string           `json:"putus_file,omitempty"`
+	// CocokDatabase tells whether the last archived entry is the one the database
+	// continues from; nil when the files do not end at archived_seq
+	CocokDatabase *bool `json:"cocok_dengan_database"`
+}
+
+// VerifyLogArchives recomputes the chain across archive files, ordered by their first
+// entry. Passing every file from the first archive on verifies from the genesis hash.
+func VerifyLogArchives(paths []string) (ArchiveVerification, error) {
+	result := ArchiveVerification{Valid: true, File: len(paths)}
+
+	type archiveFile struct {
+		path    string
+		entries []auditArchiveEntry
+	}
+	files := []archiveFile{}
+	for _, path := range paths {
+		entries, err := readLogArchive(path)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(entries) > 0 {
+			files = append(files, archiveFile{path, entries})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].entries[0].ChainSeq < files[j].entries[0].ChainSeq
+	})
+
+	var prevHash string
+	var expectedSeq int64
+	for _, f := range files {
+		for _, e := range f.entries {
+			var reason string
+			switch {
+			case expectedSeq == 0 && e.ChainSeq == 1 && e.PrevHash != auditChainGenesis:
+				reason = "Entri pertama tidak dimulai dari hash awal"
+			case expectedSeq != 0 && e.ChainSeq != expectedSeq:
+				reason = fmt.Sprintf("Entri chain_seq %d sampai %d tidak ada di arsip", expectedSeq, e.ChainSeq-1)
+			case expectedSeq != 0 && e.PrevHash != prevHash:
+				reason = "prev_hash tidak cocok dengan hash entri sebelumnya"
+			case e.auditChainEntry.hash() != e.Hash:
+				reason = "Isi entri tidak cocok dengan hash-nya (entri diubah)"
+			}
+			if reason != "" {
+				result.Valid = false
+				result.Putus = &AuditChainBreak{ChainSeq: e.ChainSeq, LogID: e.ID, Alasan: reason}
+				result.PutusFile = f.path
+				return result, nil
+			}
+			result.Diperiksa++
+			prevHash, expectedSeq = e.Hash, e.ChainSeq+1
+			result.ChainSeq, result.Hash = e.ChainSeq, e.Hash
+		}
+	}
+
+	var archivedSeq int64
+	var archivedHash string
+	err := config.DB.QueryRow(`
+		SELECT archived_seq, archived_hash FROM audit_chain_state WHERE id = 1
+	`).Scan(&archivedSeq, &archivedHash)
+	if err == nil && archivedSeq > 0 && archivedSeq == result.ChainSeq {
+		match := archivedHash == result.Hash
+		result.CocokDatabase = &match
+		result.Valid = match
+	}
+	return result, nil
+}
+
+func readLogArchive(path string) ([]auditArchiveEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	entries := []auditArchiveEntry{}
+	dec := json.NewDecoder(bufio.NewReader(gz))
+	for {
+		var e auditArchiveEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// GetLogArchives lists archive files together with the retention settings
+func GetLogArchives(c *gin.Context) {
+	rows, err := config.DB.Query(`
+		SELECT id, file_path, chain_seq_awal, chain_seq_akhir, jumlah_entri, waktu_awal, waktu_akhir,
+			ukuran_byte, created_at
+		FROM log_archives
+		ORDER BY chain_seq_awal DESC
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch log archives"})
+		return
+	}
+	defer rows.Close()
+
+	archives := []LogArchive{}
+	for rows.Next() {
+		var a LogArchive
+		if err := rows.Scan(&a.ID, &a.File, &a.ChainSeqAwal, &a.ChainSeqAkhir, &a.JumlahEntri,
+			&a.WaktuAwal, &a.WaktuAkhir, &a.UkuranByte, &a.CreatedAt); err != nil {
+			continue
+		}
+		archives = append(archives, a)
+	}
+
+	var archivedSeq sql.NullInt64
+	config.DB.QueryRow("SELECT archived_seq FROM audit_chain_state WHERE id = 1").Scan(&archivedSeq)
+
+	c.JSON(http.StatusOK, gin.H{
+		"retensi_hari": config.AppConfig.LogRetention,
+		"archived_seq": archivedSeq.Int64,
+		"archive_path": config.AppConfig.ArchivePath,
+		"data":         archives,
+	})
+}
+
+// DownloadLogArchive sends one archive file
+func DownloadLogArchive(c *gin.Context) {
+	var path string
+	err := config.DB.QueryRow("SELECT file_path FROM log_archives WHERE id = ?", c.Param("id")).Scan(&path)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archive not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch archive"})
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Archive file is no longer on the server"})
+		return
+	}
+	c.FileAttachment(path, filepath.Base(path))
+}
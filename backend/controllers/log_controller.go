@@ -1,9 +1,14 @@
 package controllers
 
 import (
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
 	"net/http"
-	"sawit-backend/config"
+	"sawit-backend/repository"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,146 +20,114 @@ type LogAktivitas struct {
 	Username     string `json:"username"`
 	Role         string `json:"role"`
 	Aktivitas    string `json:"aktivitas"`
+	Modul        string `json:"modul"`
+	ReferenceID  *int   `json:"reference_id"`
 	Detail       string `json:"detail"`
 	IPAddress    string `json:"ip_address"`
 	UserAgent    string `json:"user_agent"`
 	WaktuAktivitas string `json:"waktu_aktivitas"`
 }
 
+// logFilter reads the filters shared by the log list, export and statistics
+func logFilter(c *gin.Context) repository.LogFilter {
+	return repository.LogFilter{
+		UserID: c.Query("user_id"), Aktivitas: c.Query("aktivitas"), Modul: c.Query("modul"),
+		ReferenceID: c.Query("reference_id"), Role: c.Query("role"),
+		StartDate: c.Query("start_date"), EndDate: c.Query("end_date"),
+	}
+}
+
+// logAktivitas is the JSON form of a log entry
+func logAktivitas(r repository.LogRow) LogAktivitas {
+	return LogAktivitas{
+		ID: r.ID, UserID: r.UserID, Username: r.Username, Role: r.Role, Aktivitas: r.Aktivitas, Modul: r.Modul,
+		ReferenceID: r.ReferenceID, Detail: r.Detail, IPAddress: r.IPAddress, UserAgent: r.UserAgent,
+		WaktuAktivitas: r.WaktuAktivitas,
+	}
+}
+
+// LogHandler serves the activity log from injected repositories. The list, export
+// and statistics share the filter read by logFilter.
+type LogHandler struct {
+	store repository.Store
+}
+
+// NewLogHandler returns a LogHandler backed by store
+func NewLogHandler(store repository.Store) *LogHandler {
+	return &LogHandler{store: store}
+}
+
 // GetLogAktivitas retrieves activity logs with filters
-func GetLogAktivitas(c *gin.Context) {
-	// Get query parameters for filtering
-	userID := c.Query("user_id")
-	aktivitas := c.Query("aktivitas")
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
+func (h *LogHandler) GetLogAktivitas(c *gin.Context) {
 	page := c.DefaultQuery("page", "1")
 	limit := c.DefaultQuery("limit", "50")
-
-	// Log endpoint access
-	println("[LOG_CONTROLLER] GET /api/logs - Filters:", "user_id="+userID, "aktivitas="+aktivitas, "start_date="+startDate, "end_date="+endDate, "page="+page, "limit="+limit)
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
 
 	pageNum, _ := strconv.Atoi(page)
 	limitNum, _ := strconv.Atoi(limit)
+	if pageNum < 1 {
+		pageNum = 1
+	}
+	if limitNum < 1 {
+		limitNum = 50
+	}
 	offset := (pageNum - 1) * limitNum
 
-	// Build query
-	query := `
-		SELECT 
-			la.id,
-			COALESCE(la.user_id, 0) as user_id,
-			COALESCE(u.username, 'System') as username,
-			COALESCE(u.role, 'system') as role,
-			COALESCE(la.aktivitas, '') as aktivitas,
-			CASE 
-				WHEN la.modul IS NOT NULL AND la.reference_id IS NOT NULL 
-					THEN CONCAT(la.modul, ' - Ref ID: ', la.reference_id)
-				WHEN la.modul IS NOT NULL 
-					THEN la.modul
-				ELSE la.aktivitas
-			END as detail,
-			COALESCE(la.ip_address, '') as ip_address,
-			COALESCE(la.user_agent, '') as user_agent,
-			la.created_at as waktu_aktivitas
-		FROM log_aktivitas la
-		LEFT JOIN users u ON la.user_id = u.id
-		WHERE 1=1
-	`
-	
-	args := []interface{}{}
+	filter := logFilter(c)
 
-	// Apply filters
-	if userID != "" {
-		query += " AND la.user_id = ?"
-		args = append(args, userID)
-	}
-	if aktivitas != "" {
-		query += " AND la.aktivitas LIKE ?"
-		args = append(args, "%"+aktivitas+"%")
+	// Keyset pagination: the cursor holds the position of the last entry already seen
+	window := repository.LogPage{Limit: limitNum, Offset: offset}
+	_, keyset := c.GetQuery("cursor")
+	if keyset {
+		window.Offset = 0
 	}
-	if startDate != "" {
-		query += " AND DATE(la.created_at) >= ?"
-		args = append(args, startDate)
-	}
-	if endDate != "" {
-		query += " AND DATE(la.created_at) <= ?"
-		args = append(args, endDate)
+	if cursor := c.Query("cursor"); cursor != "" {
+		createdAt, id, err := decodeLogCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		window.After = &repository.LogPosition{CreatedAt: createdAt, ID: id}
 	}
 
-	query += " ORDER BY la.created_at DESC LIMIT ? OFFSET ?"
-	args = append(args, limitNum, offset)
+	// The CSV export contains every matching entry, not just one page
+	if format == "csv" {
+		exportLogAktivitas(c, h.store.Logs(), filter, window.After)
+		return
+	}
 
-	// Execute query
-	rows, err := config.DB.Query(query, args...)
+	rows, err := h.store.Logs().List(filter, window)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch logs: " + err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	logs := []LogAktivitas{}
-	for rows.Next() {
-		var log LogAktivitas
-		err := rows.Scan(
-			&log.ID,
-			&log.UserID,
-			&log.Username,
-			&log.Role,
-			&log.Aktivitas,
-			&log.Detail,
-			&log.IPAddress,
-			&log.UserAgent,
-			&log.WaktuAktivitas,
-		)
-		if err != nil {
-			// Log error but continue processing other rows
-			println("Error scanning log row:", err.Error())
-			continue
-		}
-		logs = append(logs, log)
+	logs := make([]LogAktivitas, 0, len(rows))
+	for _, r := range rows {
+		logs = append(logs, logAktivitas(r))
 	}
 
-	// Check for errors during iteration
-	if err = rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating logs: " + err.Error()})
+	// Deep browsing skips the count; the next cursor is enough to continue
+	if keyset {
+		var nextCursor interface{}
+		if len(logs) == limitNum {
+			last := logs[len(logs)-1]
+			nextCursor = encodeLogCursor(last.WaktuAktivitas, last.ID)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"logs":        logs,
+			"limit":       limitNum,
+			"next_cursor": nextCursor,
+		})
 		return
 	}
 
 	// Get total count for pagination
-	countQuery := `
-		SELECT COUNT(*) 
-		FROM log_aktivitas la
-		WHERE 1=1
-	`
-	countArgs := []interface{}{}
-
-	if userID != "" {
-		countQuery += " AND la.user_id = ?"
-		countArgs = append(countArgs, userID)
-	}
-	if aktivitas != "" {
-		countQuery += " AND la.aktivitas LIKE ?"
-		countArgs = append(countArgs, "%"+aktivitas+"%")
-	}
-	if startDate != "" {
-		countQuery += " AND DATE(la.created_at) >= ?"
-		countArgs = append(countArgs, startDate)
-	}
-	if endDate != "" {
-		countQuery += " AND DATE(la.created_at) <= ?"
-		countArgs = append(countArgs, endDate)
-	}
-
-	var total int
-	config.DB.QueryRow(countQuery, countArgs...).Scan(&total)
-
-	// Ensure logs is never nil (return empty array instead)
-	if logs == nil {
-		logs = []LogAktivitas{}
-	}
-
-	// Log response summary
-	println("[LOG_CONTROLLER] Response - Total logs:", total, "| Returned:", len(logs), "| Page:", pageNum, "/", (total+limitNum-1)/limitNum)
+	total, _ := h.store.Logs().Count(filter)
 
 	c.JSON(http.StatusOK, gin.H{
 		"logs":  logs,
@@ -165,97 +138,127 @@ func GetLogAktivitas(c *gin.Context) {
 	})
 }
 
-// GetLogStatistics retrieves activity statistics
-func GetLogStatistics(c *gin.Context) {
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-
-	// Log endpoint access
-	println("[LOG_CONTROLLER] GET /api/logs/statistics - Filters:", "start_date="+startDate, "end_date="+endDate)
+// encodeLogCursor returns an opaque cursor for the entry at createdAt with the given id
+func encodeLogCursor(createdAt string, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt + "|" + strconv.Itoa(id)))
+}
 
-	// Query for activity summary
-	query := `
-		SELECT 
-			aktivitas,
-			COUNT(*) as jumlah
-		FROM log_aktivitas
-		WHERE 1=1
-	`
-	
-	args := []interface{}{}
-	if startDate != "" {
-		query += " AND DATE(created_at) >= ?"
-		args = append(args, startDate)
+func decodeLogCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, 0, fmt.Errorf("malformed cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339, parts[0])
+	if err != nil {
+		return time.Time{}, 0, err
 	}
-	if endDate != "" {
-		query += " AND DATE(created_at) <= ?"
-		args = append(args, endDate)
+	id, err := strconv.Atoi(parts[1])
+	return createdAt, id, err
+}
+
+// exportLogAktivitas writes the filtered log as CSV
+func exportLogAktivitas(c *gin.Context, logs repository.LogRepository, filter repository.LogFilter, after *repository.LogPosition) {
+	rows, err := logs.List(filter, repository.LogPage{After: after})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch logs: " + err.Error()})
+		return
 	}
 
-	query += " GROUP BY aktivitas ORDER BY jumlah DESC"
+	filename := fmt.Sprintf("log-aktivitas-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Cache-Control", "no-store")
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"ID", "Waktu", "User ID", "Username", "Role", "Aktivitas", "Modul", "Reference ID",
+		"IP Address", "User Agent"})
+	for _, entry := range rows {
+		referenceID := ""
+		if entry.ReferenceID != nil {
+			referenceID = strconv.Itoa(*entry.ReferenceID)
+		}
+		w.Write([]string{
+			strconv.Itoa(entry.ID), entry.WaktuAktivitas, strconv.Itoa(entry.UserID), entry.Username, entry.Role,
+			entry.Aktivitas, entry.Modul, referenceID, entry.IPAddress, entry.UserAgent,
+		})
+	}
+	w.Flush()
+}
 
-	rows, err := config.DB.Query(query, args...)
+// GetLogStatistics retrieves activity statistics
+func (h *LogHandler) GetLogStatistics(c *gin.Context) {
+	st, err := h.store.Logs().Statistics(logFilter(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
 		return
 	}
-	defer rows.Close()
 
 	stats := []map[string]interface{}{}
-	for rows.Next() {
-		var aktivitas string
-		var jumlah int
-		rows.Scan(&aktivitas, &jumlah)
+	for _, a := range st.Aktivitas {
 		stats = append(stats, map[string]interface{}{
-			"aktivitas": aktivitas,
-			"jumlah":    jumlah,
+			"aktivitas": a.Aktivitas,
+			"jumlah":    a.Jumlah,
 		})
 	}
 
-	// Query for user activity
-	userQuery := `
-		SELECT 
-			u.username,
-			u.role,
-			COUNT(*) as jumlah_aktivitas
-		FROM log_aktivitas la
-		JOIN users u ON la.user_id = u.id
-		WHERE 1=1
-	`
-	
-	userArgs := []interface{}{}
-	if startDate != "" {
-		userQuery += " AND DATE(la.created_at) >= ?"
-		userArgs = append(userArgs, startDate)
-	}
-	if endDate != "" {
-		userQuery += " AND DATE(la.created_at) <= ?"
-		userArgs = append(userArgs, endDate)
+	userStats := []map[string]interface{}{}
+	for _, u := range st.TopUsers {
+		userStats = append(userStats, map[string]interface{}{
+			"username": u.Username,
+			"role":     u.Role,
+			"jumlah":   u.Jumlah,
+		})
 	}
 
-	userQuery += " GROUP BY u.id, u.username, u.role ORDER BY jumlah_aktivitas DESC LIMIT 10"
+	total := 0
+	modulStats := []map[string]interface{}{}
+	for _, m := range st.PerModul {
+		total += m.Jumlah
+		modulStats = append(modulStats, map[string]interface{}{
+			"modul":       m.Modul,
+			"jumlah":      m.Jumlah,
+			"gagal":       m.Gagal,
+			"jumlah_user": m.JumlahUser,
+		})
+	}
 
-	userRows, err := config.DB.Query(userQuery, userArgs...)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user statistics"})
-		return
+	// Heatmap by weekday (0 = Senin) and hour of day
+	var perJam [24]int
+	hariNames := []string{"Senin", "Selasa", "Rabu", "Kamis", "Jumat", "Sabtu", "Minggu"}
+	heatmapRows := []map[string]interface{}{}
+	for i, name := range hariNames {
+		for jam, jumlah := range st.Heatmap[i] {
+			perJam[jam] += jumlah
+		}
+		heatmapRows = append(heatmapRows, map[string]interface{}{
+			"hari": name,
+			"jam":  st.Heatmap[i],
+		})
 	}
-	defer userRows.Close()
 
-	userStats := []map[string]interface{}{}
-	for userRows.Next() {
-		var username, role string
-		var jumlah int
-		userRows.Scan(&username, &role, &jumlah)
-		userStats = append(userStats, map[string]interface{}{
-			"username": username,
-			"role":     role,
-			"jumlah":   jumlah,
+	gagalPerIP := []map[string]interface{}{}
+	for _, ip := range st.GagalPerIP {
+		gagalPerIP = append(gagalPerIP, map[string]interface{}{
+			"ip_address": ip.IPAddress,
+			"jumlah":     ip.Jumlah,
+			"terakhir":   ip.Terakhir,
 		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
+		"total":            total,
 		"activity_summary": stats,
 		"top_users":        userStats,
+		"per_modul":        modulStats,
+		"per_jam":          perJam,
+		"heatmap":          heatmapRows,
+		"aksi_gagal": gin.H{
+			"total":  st.Gagal,
+			"per_ip": gagalPerIP,
+		},
 	})
 }
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/mailer"
+	"sawit-backend/repository"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backoffDuration doubles the base duration for every failure past the limit
+func backoffDuration(failures, limit, baseMinutes, maxMinutes int) time.Duration {
+	if failures < limit {
+		return 0
+	}
+	minutes := float64(baseMinutes) * math.Pow(2, float64(failures-limit))
+	if minutes > float64(maxMinutes) {
+		minutes = float64(maxMinutes)
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// ipBlockedUntil returns when the client IP may try again, or zero time if it is not blocked
+func ipBlockedUntil(auth repository.AuthRepository, ip string) time.Time {
+	since := time.Now().Add(-time.Duration(config.AppConfig.LoginWindowMin) * time.Minute)
+
+	failures, lastFailure, err := auth.IPFailures(ip, since)
+	if err != nil || lastFailure == nil {
+		return time.Time{}
+	}
+
+	delay := backoffDuration(failures, config.AppConfig.IPMaxFails, 1, config.AppConfig.LockoutMaxMin)
+	if delay == 0 {
+		return time.Time{}
+	}
+	return lastFailure.Add(delay)
+}
+
+// recordLoginAttempt stores the attempt and writes an audit entry for failures
+func (h *UserHandler) recordLoginAttempt(c *gin.Context, email string, userID *int, success bool, reason string) {
+	ip := c.ClientIP()
+
+	err := h.store.Auth().RecordAttempt(repository.LoginAttempt{
+		Email: email, UserID: userID, IPAddress: ip, UserAgent: c.Request.UserAgent(), Success: success,
+	})
+	if err != nil {
+		log.Printf("recordLoginAttempt - %v", err)
+	}
+
+	if success {
+		return
+	}
+
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "login_failed", Modul: "auth", UserID: userID,
+		Aktivitas: fmt.Sprintf("Login gagal (%s): %s", reason, email),
+	})
+
+	h.checkCredentialStuffing(ip)
+}
+
+// registerAccountFailure increments the account failure counter and locks it once the limit is reached.
+// A failure after a quiet period longer than the login window starts the count again.
+func (h *UserHandler) registerAccountFailure(userID int) {
+	err := h.store.WithTx(func(tx repository.Store) error {
+		window := time.Duration(config.AppConfig.LoginWindowMin) * time.Minute
+		failures, err := tx.Auth().AddFailure(userID, window)
+		if err != nil {
+			return err
+		}
+
+		lockFor := backoffDuration(failures, config.AppConfig.LoginMaxFails,
+			config.AppConfig.LockoutBaseMin, config.AppConfig.LockoutMaxMin)
+		if lockFor == 0 {
+			return nil
+		}
+		return tx.Auth().LockUntil(userID, time.Now().Add(lockFor))
+	})
+	if err != nil {
+		log.Printf("registerAccountFailure - %v", err)
+	}
+}
+
+// checkCredentialStuffing fires an alert when one IP targets many accounts
+func (h *UserHandler) checkCredentialStuffing(ip string) {
+	since := time.Now().Add(-time.Duration(config.AppConfig.LoginWindowMin) * time.Minute)
+	accounts, err := h.store.Auth().IPTargets(ip, since)
+
+	// Fire only when the threshold is crossed, not on every following attempt
+	if err != nil || accounts != config.AppConfig.AlertAccounts {
+		return
+	}
+
+	message := fmt.Sprintf("ALERT: Percobaan login gagal ke %d akun dari IP %s dalam %d menit",
+		accounts, ip, config.AppConfig.LoginWindowMin)
+	log.Println(message)
+
+	err = h.store.Logs().Record(repository.LogEntry{Aktivitas: message, Modul: "security", IPAddress: ip})
+	if err != nil {
+		log.Printf("checkCredentialStuffing - %v", err)
+	}
+
+	if config.AppConfig.AlertEmail != "" {
+		go func() {
+			err := mailer.Client.Send(mailer.Message{
+				To:      []string{config.AppConfig.AlertEmail},
+				Subject: "[Security] Percobaan login mencurigakan dari " + ip,
+				Body:    message + "\n\nPeriksa log aktivitas modul 'auth' untuk detail akun yang ditargetkan.\n",
+			})
+			if err != nil {
+				log.Printf("Failed to send security alert: %v", err)
+			}
+		}()
+	}
+}
+
+// GetLockedAccounts returns accounts that are currently locked (admin only)
+func (h *UserHandler) GetLockedAccounts(c *gin.Context) {
+	locked, err := h.store.Auth().Locked()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locked accounts"})
+		return
+	}
+
+	accounts := make([]map[string]interface{}, 0, len(locked))
+	for _, a := range locked {
+		accounts = append(accounts, map[string]interface{}{
+			"id":                 a.ID,
+			"username":           a.Username,
+			"email":              a.Email,
+			"role":               a.Role,
+			"failed_login_count": a.FailedLoginCount,
+			"locked_until":       a.LockedUntil,
+		})
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// UnlockAccount clears the lockout of a user account (admin only)
+func (h *UserHandler) UnlockAccount(c *gin.Context) {
+	targetID := int(paramID(c))
+	if _, err := h.store.Users().FindByID(targetID); err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	logs := h.store.Logs()
+	before := snapshotOf(logs, "user", paramID(c))
+
+	if err := h.store.Auth().ResetFailures(targetID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock account"})
+		return
+	}
+
+	recordAuditTo(logs, c, auditEvent{
+		Aksi: "unlock", Modul: "auth", Entitas: "user", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Membuka kunci akun",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked successfully"})
+}
@@ -0,0 +1,348 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/geo"
+	"sawit-backend/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var boundaryLabels = map[string]string{"kebun": "Kebun", "blok": "Blok"}
+
+// UpdateKebunBoundary stores the boundary polygon of a kebun
+func UpdateKebunBoundary(c *gin.Context) {
+	saveBoundary(c, "kebun")
+}
+
+// UpdateBlokBoundary stores the boundary polygon of a blok
+func UpdateBlokBoundary(c *gin.Context) {
+	saveBoundary(c, "blok")
+}
+
+// DeleteKebunBoundary removes the boundary of a kebun
+func DeleteKebunBoundary(c *gin.Context) {
+	clearBoundary(c, "kebun")
+}
+
+// DeleteBlokBoundary removes the boundary of a blok
+func DeleteBlokBoundary(c *gin.Context) {
+	clearBoundary(c, "blok")
+}
+
+// saveBoundary parses GeoJSON or KML, computes the area and stores it on
+// the kebun or blok row. table is always one of the two literals above.
+func saveBoundary(c *gin.Context, table string) {
+	id := c.Param("id")
+
+	var req models.BoundaryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var boundary geo.MultiPolygon
+	var err error
+	switch {
+	case len(req.GeoJSON) > 0 && string(req.GeoJSON) != "null":
+		boundary, err = geo.ParseGeoJSON(req.GeoJSON)
+	case strings.TrimSpace(req.KML) != "":
+		boundary, err = geo.ParseKML(strings.NewReader(req.KML))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either geojson or kml"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var luasHektar float64
+	err = config.DB.QueryRow("SELECT luas_hektar FROM "+table+" WHERE id = ?", id).Scan(&luasHektar)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": boundaryLabels[table] + " not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	geometry, _ := json.Marshal(boundary.Geometry())
+	areaHektar := math.Round(boundary.AreaHectares()*100) / 100
+	minLng, minLat, maxLng, maxLat := boundary.Bounds()
+
+	before := auditSnapshot(config.DB, table, paramID(c))
+	_, err = config.DB.Exec(`
+		UPDATE `+table+` SET boundary = ?, area_hektar = ?,
+		       bbox_min_lng = ?, bbox_min_lat = ?, bbox_max_lng = ?, bbox_max_lat = ?
+		WHERE id = ?
+	`, string(geometry), areaHektar, minLng, minLat, maxLng, maxLat, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save boundary"})
+		return
+	}
+
+	selisih, mismatch := areaDeviation(areaHektar, luasHektar)
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "update_boundary", Modul: "kebun", Entitas: table, ID: paramID(c), Sebelum: before,
+		Aktivitas: fmt.Sprintf("Mengupdate batas %s (%.2f ha)", table, areaHektar),
+	})
+
+	response := gin.H{
+		"message":        "Boundary saved successfully",
+		"area_hektar":    areaHektar,
+		"luas_hektar":    luasHektar,
+		"selisih_persen": selisih,
+		"area_mismatch":  mismatch,
+	}
+	if mismatch {
+		response["warning"] = fmt.Sprintf("Computed area differs from luas_hektar by more than %d%%", config.AppConfig.AreaTolerance)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func clearBoundary(c *gin.Context, table string) {
+	id := c.Param("id")
+
+	before := auditSnapshot(config.DB, table, paramID(c))
+	result, err := config.DB.Exec(`
+		UPDATE `+table+` SET boundary = NULL, area_hektar = NULL,
+		       bbox_min_lng = NULL, bbox_min_lat = NULL, bbox_max_lng = NULL, bbox_max_lat = NULL
+		WHERE id = ?
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete boundary"})
+		return
+	}
+	if !recordExists(result, "SELECT COUNT(*) FROM "+table+" WHERE id = ?", id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": boundaryLabels[table] + " not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "delete_boundary", Modul: "kebun", Entitas: table, ID: paramID(c), Sebelum: before,
+		Aktivitas: "Menghapus batas " + table,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Boundary deleted successfully"})
+}
+
+// areaDeviation returns the difference between the computed and recorded area in
+// percent of the recorded area, and whether it exceeds the configured tolerance
+func areaDeviation(areaHektar, luasHektar float64) (float64, bool) {
+	if luasHektar <= 0 {
+		return 0, false
+	}
+	selisih := math.Round((areaHektar-luasHektar)/luasHektar*10000) / 100
+	return selisih, math.Abs(selisih) > float64(config.AppConfig.AreaTolerance)
+}
+
+// GetMapFeatures returns a GeoJSON FeatureCollection of blok (default) or kebun
+// boundaries with stock and yield attributes for mapping
+func GetMapFeatures(c *gin.Context) {
+	level := c.DefaultQuery("level", "blok")
+	kebunID := c.Query("kebun_id")
+
+	// Stock currently available and harvest of the last 12 months per area
+	var query string
+	args := []interface{}{}
+	switch level {
+	case "blok":
+		query = `
+			SELECT b.id, b.kode_blok, a.kebun_id, k.nama_kebun, a.kode_afdeling, b.tahun_tanam,
+			       b.varietas, b.status, b.luas_hektar, b.area_hektar, b.boundary,
+			       COALESCE(SUM(CASE WHEN s.status = 'available' THEN s.jumlah_tersedia END), 0),
+			       COALESCE(SUM(CASE WHEN s.tanggal_panen >= CURDATE() - INTERVAL 12 MONTH THEN s.jumlah_kg END), 0)
+			FROM blok b
+			JOIN afdeling a ON b.afdeling_id = a.id
+			JOIN kebun k ON a.kebun_id = k.id
+			LEFT JOIN stok_tbs s ON s.blok_id = b.id
+			WHERE b.boundary IS NOT NULL
+		`
+		if kebunID != "" {
+			query += " AND a.kebun_id = ?"
+			args = append(args, kebunID)
+		}
+		query += " GROUP BY b.id, a.id, k.id"
+	case "kebun":
+		query = `
+			SELECT k.id, k.nama_kebun, k.id, k.nama_kebun, '', 0, '', k.status,
+			       k.luas_hektar, k.area_hektar, k.boundary,
+			       COALESCE(SUM(CASE WHEN s.status = 'available' THEN s.jumlah_tersedia END), 0),
+			       COALESCE(SUM(CASE WHEN s.tanggal_panen >= CURDATE() - INTERVAL 12 MONTH THEN s.jumlah_kg END), 0)
+			FROM kebun k
+			LEFT JOIN stok_tbs s ON s.kebun_id = k.id
+			WHERE k.boundary IS NOT NULL
+		`
+		if kebunID != "" {
+			query += " AND k.id = ?"
+			args = append(args, kebunID)
+		}
+		query += " GROUP BY k.id"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "level must be blok or kebun"})
+		return
+	}
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch map features"})
+		return
+	}
+	defer rows.Close()
+
+	features := make([]gin.H, 0)
+	for rows.Next() {
+		var id, featureKebunID, tahunTanam int
+		var kode, namaKebun, kodeAfdeling, status, boundaryJSON string
+		var varietas sql.NullString
+		var luasHektar, stokTersedia, panen12Bulan float64
+		var areaHektar sql.NullFloat64
+		err := rows.Scan(
+			&id, &kode, &featureKebunID, &namaKebun, &kodeAfdeling, &tahunTanam,
+			&varietas, &status, &luasHektar, &areaHektar, &boundaryJSON,
+			&stokTersedia, &panen12Bulan,
+		)
+		if err != nil {
+			continue
+		}
+
+		boundary, err := geo.ParseGeoJSON([]byte(boundaryJSON))
+		if err != nil {
+			continue
+		}
+
+		properties := gin.H{
+			"id":                id,
+			"level":             level,
+			"kode":              kode,
+			"kebun_id":          featureKebunID,
+			"nama_kebun":        namaKebun,
+			"status":            status,
+			"luas_hektar":       luasHektar,
+			"area_hektar":       areaHektar.Float64,
+			"stok_tersedia_kg":  stokTersedia,
+			"panen_12_bulan_kg": panen12Bulan,
+			"yield_ton_per_ha":  0.0,
+		}
+		if luasHektar > 0 {
+			properties["yield_ton_per_ha"] = math.Round(panen12Bulan/1000/luasHektar*100) / 100
+		}
+		if areaHektar.Valid {
+			selisih, mismatch := areaDeviation(areaHektar.Float64, luasHektar)
+			properties["selisih_persen"] = selisih
+			properties["area_mismatch"] = mismatch
+		}
+		if level == "blok" {
+			properties["kode_afdeling"] = kodeAfdeling
+			properties["tahun_tanam"] = tahunTanam
+			properties["varietas"] = varietas.String
+		}
+
+		features = append(features, gin.H{
+			"type":       "Feature",
+			"id":         fmt.Sprintf("%s-%d", level, id),
+			"geometry":   boundary.Geometry(),
+			"properties": properties,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+}
+
+// LocatePoint finds the kebun and blok containing a GPS coordinate
+func LocatePoint(c *gin.Context) {
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, errLng := strconv.ParseFloat(c.Query("lng"), 64)
+	if errLat != nil || errLng != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng must be valid coordinates"})
+		return
+	}
+
+	response := gin.H{"lat": lat, "lng": lng, "kebun": nil, "blok": nil}
+
+	// The bounding box narrows candidates before the exact polygon test
+	kebunRows, err := config.DB.Query(`
+		SELECT id, nama_kebun, boundary FROM kebun
+		WHERE boundary IS NOT NULL
+		  AND ? BETWEEN bbox_min_lng AND bbox_max_lng
+		  AND ? BETWEEN bbox_min_lat AND bbox_max_lat
+	`, lng, lat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to locate point"})
+		return
+	}
+	defer kebunRows.Close()
+
+	for kebunRows.Next() {
+		var id int
+		var nama, boundaryJSON string
+		if err := kebunRows.Scan(&id, &nama, &boundaryJSON); err != nil {
+			continue
+		}
+		if boundary, err := geo.ParseGeoJSON([]byte(boundaryJSON)); err == nil && boundary.Contains(lng, lat) {
+			response["kebun"] = gin.H{"id": id, "nama_kebun": nama}
+			break
+		}
+	}
+
+	blokRows, err := config.DB.Query(`
+		SELECT b.id, b.kode_blok, b.tahun_tanam, a.id, a.kode_afdeling, k.id, k.nama_kebun, b.boundary
+		FROM blok b
+		JOIN afdeling a ON b.afdeling_id = a.id
+		JOIN kebun k ON a.kebun_id = k.id
+		WHERE b.boundary IS NOT NULL
+		  AND ? BETWEEN b.bbox_min_lng AND b.bbox_max_lng
+		  AND ? BETWEEN b.bbox_min_lat AND b.bbox_max_lat
+	`, lng, lat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to locate point"})
+		return
+	}
+	defer blokRows.Close()
+
+	for blokRows.Next() {
+		var blokID, tahunTanam, afdelingID, blokKebunID int
+		var kodeBlok, kodeAfdeling, namaKebun, boundaryJSON string
+		err := blokRows.Scan(&blokID, &kodeBlok, &tahunTanam, &afdelingID, &kodeAfdeling,
+			&blokKebunID, &namaKebun, &boundaryJSON)
+		if err != nil {
+			continue
+		}
+		if boundary, err := geo.ParseGeoJSON([]byte(boundaryJSON)); err == nil && boundary.Contains(lng, lat) {
+			response["blok"] = gin.H{
+				"id":            blokID,
+				"kode_blok":     kodeBlok,
+				"tahun_tanam":   tahunTanam,
+				"afdeling_id":   afdelingID,
+				"kode_afdeling": kodeAfdeling,
+				"kebun_id":      blokKebunID,
+				"nama_kebun":    namaKebun,
+			}
+			// A blok without a kebun boundary still identifies the kebun
+			if response["kebun"] == nil {
+				response["kebun"] = gin.H{"id": blokKebunID, "nama_kebun": namaKebun}
+			}
+			break
+		}
+	}
+
+	if response["kebun"] == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coordinate is outside every mapped kebun", "lat": lat, "lng": lng})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
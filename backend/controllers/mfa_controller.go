@@ -0,0 +1,425 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/middleware"
+	"sawit-backend/models"
+	"sawit-backend/repository"
+	"sawit-backend/totp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const recoveryCodeCount = 10
+
+// mfaRequiredForRole reports whether users with the role must enroll in 2FA
+func mfaRequiredForRole(role string) bool {
+	if role == "admin" {
+		return true
+	}
+	for _, r := range strings.Split(config.AppConfig.MFARoles, ",") {
+		if strings.TrimSpace(r) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyMFALogin completes a two-step login with a TOTP or recovery code
+func (h *UserHandler) VerifyMFALogin(c *gin.Context) {
+	var req models.VerifyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	claims, err := middleware.ParseToken(req.MFAToken)
+	if err != nil || claims.Purpose != middleware.PurposeMFAVerify {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	mfa, err := h.store.Auth().MFA(claims.UserID)
+	if err == repository.ErrNotFound || (err == nil && (!mfa.TOTPEnabled || mfa.Status != "active")) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if mfa.LockedUntil != nil && time.Now().Before(*mfa.LockedUntil) {
+		c.JSON(http.StatusLocked, gin.H{
+			"error":        "Account is temporarily locked due to too many failed login attempts",
+			"locked_until": *mfa.LockedUntil,
+		})
+		return
+	}
+
+	verified := false
+	method := "totp"
+	if req.Code != "" {
+		verified, err = useTOTPCode(h.store.Auth(), claims.UserID, mfa.TOTPSecret, req.Code)
+	} else {
+		method = "recovery code"
+		verified, err = consumeRecoveryCode(h.store.Auth(), claims.UserID, req.RecoveryCode)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !verified {
+		h.registerAccountFailure(claims.UserID)
+		h.recordLoginAttempt(c, claims.Email, &claims.UserID, false, "wrong 2fa "+method)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	h.completeLogin(c, claims.UserID, "Login (2FA "+method+")")
+}
+
+// useTOTPCode checks a TOTP code and claims its time step, so a code is accepted
+// only once even when two requests race within its validity window
+func useTOTPCode(auth repository.AuthRepository, userID int, secret *string, code string) (bool, error) {
+	if secret == nil {
+		return false, nil
+	}
+	step, ok := totp.Validate(*secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return auth.ClaimTOTPStep(userID, step)
+}
+
+// GetMFAStatus returns the two-factor status of the current user
+func (h *UserHandler) GetMFAStatus(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	mfa, err := h.store.Auth().MFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	remaining, err := h.store.Auth().RecoveryCodesLeft(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  mfa.TOTPEnabled,
+		"required":                 mfaRequiredForRole(c.GetString("role")),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupMFA generates a new TOTP secret for enrollment
+func (h *UserHandler) SetupMFA(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	mfa, err := h.store.Auth().MFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if mfa.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := h.store.Auth().SetTOTPSecret(userID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "setup_mfa", Modul: "auth", Entitas: "user", ID: int64(userID),
+		Aktivitas: "Memulai pendaftaran 2FA",
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": totp.ProvisioningURI(config.AppConfig.MFAIssuer, c.GetString("email"), secret),
+	})
+}
+
+// EnableMFA confirms enrollment with a code from the authenticator app
+func (h *UserHandler) EnableMFA(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	purpose, _ := c.Get("token_purpose")
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mfa, err := h.store.Auth().MFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if mfa.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if mfa.TOTPSecret == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Run 2FA setup first"})
+		return
+	}
+
+	step, ok := totp.Validate(*mfa.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	logs := h.store.Logs()
+	before := snapshotOf(logs, "user", int64(userID))
+
+	if err := h.store.Auth().EnableTOTP(userID, step); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	codes, err := h.generateRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	recordAuditTo(logs, c, auditEvent{
+		Aksi: "enable_mfa", Modul: "auth", Entitas: "user", ID: int64(userID), Sebelum: before,
+		Aktivitas: "Mengaktifkan 2FA",
+	})
+
+	// Users enrolling during login get their full token now
+	if purpose == middleware.PurposeMFAEnroll {
+		user, err := h.store.Users().FindByID(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+			return
+		}
+		token, err := middleware.GenerateToken(user.ID, user.Email, user.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		h.resetAccountFailures(user.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Two-factor authentication enabled",
+			"recovery_codes": codes,
+			"token":          token,
+			"user":           user,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns off two-factor authentication for roles where it is optional
+func (h *UserHandler) DisableMFA(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if mfaRequiredForRole(c.GetString("role")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for your role"})
+		return
+	}
+
+	mfa, err := h.store.Auth().MFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(mfa.PasswordHash), []byte(req.Password)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	ok, err := useTOTPCode(h.store.Auth(), userID, mfa.TOTPSecret, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	logs := h.store.Logs()
+	before := snapshotOf(logs, "user", int64(userID))
+
+	if err := h.clearMFA(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	recordAuditTo(logs, c, auditEvent{
+		Aksi: "disable_mfa", Modul: "auth", Entitas: "user", ID: int64(userID), Sebelum: before,
+		Aktivitas: "Menonaktifkan 2FA",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the current user
+func (h *UserHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	mfa, err := h.store.Auth().MFA(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !mfa.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	ok, err := useTOTPCode(h.store.Auth(), userID, mfa.TOTPSecret, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, err := h.generateRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "regenerate_recovery_codes", Modul: "auth", Entitas: "user", ID: int64(userID),
+		Aktivitas: "Membuat ulang recovery code 2FA",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetUserMFA removes 2FA from a user who lost their device (admin only)
+func (h *UserHandler) ResetUserMFA(c *gin.Context) {
+	logs := h.store.Logs()
+	before := snapshotOf(logs, "user", paramID(c))
+
+	if err := h.clearMFA(int(paramID(c))); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	recordAuditTo(logs, c, auditEvent{
+		Aksi: "reset_mfa", Modul: "auth", Entitas: "user", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Reset 2FA pengguna",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset; the user must enroll again"})
+}
+
+// clearMFA removes the TOTP secret and recovery codes of a user
+func (h *UserHandler) clearMFA(userID int) error {
+	return h.store.WithTx(func(tx repository.Store) error {
+		return tx.Auth().ClearMFA(userID)
+	})
+}
+
+// generateRecoveryCodes replaces the user's recovery codes and returns them in plain text once
+func (h *UserHandler) generateRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := hex.EncodeToString(buf)
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(code))
+	}
+
+	err := h.store.WithTx(func(tx repository.Store) error {
+		return tx.Auth().ReplaceRecoveryCodes(userID, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// consumeRecoveryCode marks an unused recovery code as used
+func consumeRecoveryCode(auth repository.AuthRepository, userID int, code string) (bool, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return auth.UseRecoveryCode(userID, hashToken(code))
+}
+
+// resetAccountFailures clears the failure counter after a successful login
+func (h *UserHandler) resetAccountFailures(userID int) {
+	if err := h.store.Auth().ResetFailures(userID); err != nil {
+		log.Printf("resetAccountFailures - %v", err)
+	}
+}
+
+// completeLogin issues the full token after all authentication factors passed
+func (h *UserHandler) completeLogin(c *gin.Context, userID int, aktivitas string) {
+	user, err := h.store.Users().FindByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+
+	token, err := middleware.GenerateToken(user.ID, user.Email, user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	h.resetAccountFailures(user.ID)
+	h.recordLoginAttempt(c, user.Email, &user.ID, true, "")
+
+	// Log aktivitas
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "login", Modul: "auth", UserID: &user.ID,
+		Aktivitas: aktivitas,
+	})
+
+	c.JSON(http.StatusOK, models.LoginResponse{
+		Token: token,
+		User:  user,
+	})
+}
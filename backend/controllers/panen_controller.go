@@ -0,0 +1,350 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPanenList returns harvest records per blok
+func GetPanenList(c *gin.Context) {
+	query := `
+		SELECT p.id, p.blok_id, p.kebun_id, p.stok_id, p.tanggal_panen, p.jumlah_janjang,
+		       p.berat_kg, p.bjr, p.grade, p.tim_pemanen, p.tim_id, p.catatan, p.created_by, p.created_at,
+		       b.kode_blok, a.kode_afdeling, k.nama_kebun
+		FROM panen p
+		JOIN blok b ON p.blok_id = b.id
+		JOIN afdeling a ON b.afdeling_id = a.id
+		JOIN kebun k ON p.kebun_id = k.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if kebunID := c.Query("kebun_id"); kebunID != "" {
+		query += " AND p.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	if blokID := c.Query("blok_id"); blokID != "" {
+		query += " AND p.blok_id = ?"
+		args = append(args, blokID)
+	}
+	if tim := c.Query("tim_pemanen"); tim != "" {
+		query += " AND p.tim_pemanen = ?"
+		args = append(args, tim)
+	}
+	if timID := c.Query("tim_id"); timID != "" {
+		query += " AND p.tim_id = ?"
+		args = append(args, timID)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		query += " AND p.tanggal_panen >= ?"
+		args = append(args, startDate)
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		query += " AND p.tanggal_panen <= ?"
+		args = append(args, endDate)
+	}
+
+	query += " ORDER BY p.tanggal_panen DESC, b.kode_blok"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch harvest records"})
+		return
+	}
+	defer rows.Close()
+
+	panenList := make([]models.Panen, 0)
+	for rows.Next() {
+		var p models.Panen
+		var stokID, timID sql.NullInt64
+		var catatan sql.NullString
+		err := rows.Scan(
+			&p.ID, &p.BlokID, &p.KebunID, &stokID, &p.TanggalPanen, &p.JumlahJanjang,
+			&p.BeratKg, &p.BJR, &p.Grade, &p.TimPemanen, &timID, &catatan, &p.CreatedBy, &p.CreatedAt,
+			&p.KodeBlok, &p.KodeAfdeling, &p.NamaKebun,
+		)
+		if err != nil {
+			continue
+		}
+		if stokID.Valid {
+			id := int(stokID.Int64)
+			p.StokID = &id
+		}
+		if timID.Valid {
+			id := int(timID.Int64)
+			p.TimID = &id
+		}
+		p.Catatan = catatan.String
+		panenList = append(panenList, p)
+	}
+
+	c.JSON(http.StatusOK, panenList)
+}
+
+// CreatePanen records a blok harvest and rolls it up into the stok_tbs batch
+// of the same kebun, date and grade
+func CreatePanen(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.CreatePanenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tanggal, err := time.ParseInLocation("2006-01-02", req.TanggalPanen, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tanggal_panen must be YYYY-MM-DD"})
+		return
+	}
+	if tanggal.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tanggal_panen cannot be in the future"})
+		return
+	}
+
+	var kebunID int
+	var blokStatus string
+	err = config.DB.QueryRow(`
+		SELECT a.kebun_id, b.status FROM blok b
+		JOIN afdeling a ON b.afdeling_id = a.id
+		WHERE b.id = ?
+	`, req.BlokID).Scan(&kebunID, &blokStatus)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blok not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if blokStatus != "active" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Blok is not active"})
+		return
+	}
+
+	if req.TimID != nil {
+		var timKebunID int
+		var namaTim, timStatus string
+		err := config.DB.QueryRow("SELECT kebun_id, nama_tim, status FROM tim_panen WHERE id = ?", *req.TimID).
+			Scan(&timKebunID, &namaTim, &timStatus)
+		if err != nil || timStatus != "active" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tim panen not found or inactive"})
+			return
+		}
+		if timKebunID != kebunID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tim panen does not belong to the blok's kebun"})
+			return
+		}
+		if req.TimPemanen == "" {
+			req.TimPemanen = namaTim
+		}
+	}
+	if req.TimPemanen == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tim_pemanen or tim_id is required"})
+		return
+	}
+
+	bjr := math.Round(req.BeratKg/float64(req.JumlahJanjang)*100) / 100
+
+	outputs, err := allocatePanenPemanen(req.Pemanen, req.JumlahJanjang, req.BeratKg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(outputs) > 0 && panenInFinalizedPayroll(req.TanggalPanen, kebunID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Harvest date is covered by a finalized payroll"})
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Add to the open batch of the day, or start a new one
+	var stokID int64
+	var stokBefore map[string]interface{}
+	stokAksi := "create"
+	err = tx.QueryRow(`
+		SELECT id FROM stok_tbs
+		WHERE kebun_id = ? AND tanggal_panen = ? AND grade = ? AND sumber = 'panen' AND status = 'available'
+		ORDER BY id DESC LIMIT 1
+		FOR UPDATE
+	`, kebunID, req.TanggalPanen, req.Grade).Scan(&stokID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		hargaPerKg := req.HargaPerKg
+		if hargaPerKg == 0 {
+			tx.QueryRow(`
+				SELECT harga_per_kg FROM stok_tbs
+				WHERE kebun_id = ? AND grade = ?
+				ORDER BY tanggal_panen DESC, id DESC LIMIT 1
+			`, kebunID, req.Grade).Scan(&hargaPerKg)
+		}
+		if hargaPerKg <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "harga_per_kg is required for the first batch of this grade"})
+			return
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO stok_tbs (kebun_id, tanggal_panen, jumlah_kg, jumlah_tersedia, grade,
+			                      harga_per_kg, keterangan, status, sumber)
+			VALUES (?, ?, ?, ?, ?, ?, 'Rekap panen per blok', 'available', 'panen')
+		`, kebunID, req.TanggalPanen, req.BeratKg, req.BeratKg, req.Grade, hargaPerKg)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stock batch"})
+			return
+		}
+		stokID, _ = result.LastInsertId()
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	default:
+		stokBefore, stokAksi = auditSnapshot(tx, "stok", stokID), "update"
+		if _, err := tx.Exec(`
+			UPDATE stok_tbs SET jumlah_kg = jumlah_kg + ?, jumlah_tersedia = jumlah_tersedia + ?
+			WHERE id = ?
+		`, req.BeratKg, req.BeratKg, stokID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock batch"})
+			return
+		}
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO panen (blok_id, kebun_id, stok_id, tanggal_panen, jumlah_janjang, berat_kg,
+		                   bjr, grade, tim_pemanen, tim_id, catatan, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, req.BlokID, kebunID, stokID, req.TanggalPanen, req.JumlahJanjang, req.BeratKg,
+		bjr, req.Grade, req.TimPemanen, req.TimID, req.Catatan, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record harvest"})
+		return
+	}
+
+	panenID, _ := result.LastInsertId()
+	if err := insertPanenPemanen(tx, panenID, outputs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record harvester output"})
+		return
+	}
+
+	recordAudit(tx, c, auditEvent{
+		Aksi: "create", Entitas: "panen", ID: panenID,
+		Aktivitas: fmt.Sprintf("Mencatat panen %.0f kg (%d janjang)", req.BeratKg, req.JumlahJanjang),
+	})
+	recordAudit(tx, c, auditEvent{
+		Aksi: stokAksi, Modul: "panen", Entitas: "stok", ID: stokID, Sebelum: stokBefore,
+		Aktivitas: fmt.Sprintf("Menambah %.0f kg hasil panen ke stok TBS", req.BeratKg),
+	})
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record harvest"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Harvest recorded successfully",
+		"panen_id": panenID,
+		"stok_id":  stokID,
+		"bjr":      bjr,
+	})
+}
+
+// DeletePanen removes a harvest record and takes its weight back out of the
+// stock batch, as long as that weight has not been sold
+func DeletePanen(c *gin.Context) {
+	panenID := c.Param("id")
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var beratKg float64
+	var stokID sql.NullInt64
+	var tanggalPanen string
+	var kebunID int
+	err = tx.QueryRow(`
+		SELECT berat_kg, stok_id, DATE_FORMAT(tanggal_panen, '%Y-%m-%d'), kebun_id FROM panen WHERE id = ? FOR UPDATE
+	`, panenID).
+		Scan(&beratKg, &stokID, &tanggalPanen, &kebunID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Harvest record not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if panenInFinalizedPayroll(tanggalPanen, kebunID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Harvest date is covered by a finalized payroll"})
+		return
+	}
+
+	before := auditSnapshot(tx, "panen", paramID(c))
+	if _, err := tx.Exec("DELETE FROM panen WHERE id = ?", panenID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete harvest record"})
+		return
+	}
+
+	if stokID.Valid {
+		var jumlahKg, jumlahTersedia float64
+		err := tx.QueryRow(`
+			SELECT jumlah_kg, jumlah_tersedia FROM stok_tbs WHERE id = ? FOR UPDATE
+		`, stokID.Int64).Scan(&jumlahKg, &jumlahTersedia)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err == nil {
+			if jumlahTersedia < beratKg {
+				c.JSON(http.StatusConflict, gin.H{"error": "Harvest weight has already been sold from the stock batch"})
+				return
+			}
+
+			var poCount int
+			tx.QueryRow("SELECT COUNT(*) FROM purchase_orders WHERE stok_id = ?", stokID.Int64).Scan(&poCount)
+			stokBefore, stokAksi := auditSnapshot(tx, "stok", stokID.Int64), "update"
+			if jumlahKg-beratKg <= 0 && poCount == 0 {
+				stokAksi = "delete"
+				_, err = tx.Exec("DELETE FROM stok_tbs WHERE id = ?", stokID.Int64)
+			} else {
+				_, err = tx.Exec(`
+					UPDATE stok_tbs SET jumlah_kg = jumlah_kg - ?, jumlah_tersedia = jumlah_tersedia - ?
+					WHERE id = ?
+				`, beratKg, beratKg, stokID.Int64)
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock batch"})
+				return
+			}
+			recordAudit(tx, c, auditEvent{
+				Aksi: stokAksi, Modul: "panen", Entitas: "stok", ID: stokID.Int64, Sebelum: stokBefore,
+				Aktivitas: fmt.Sprintf("Mengurangi %.0f kg panen yang dihapus dari stok TBS", beratKg),
+			})
+		}
+	}
+
+	recordAudit(tx, c, auditEvent{
+		Aksi: "delete", Entitas: "panen", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Menghapus catatan panen",
+	})
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete harvest record"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Harvest record deleted successfully"})
+}
@@ -0,0 +1,543 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/models"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// payrollMaxDays caps one payroll period; harvest pay runs are usually half-monthly or monthly
+const payrollMaxDays = 62
+
+// computePayroll sums base pay and premi per harvester for the period.
+// Base pay is earned for every day with recorded output.
+func computePayroll(start, end string, kebunID *int) ([]models.PayrollItem, error) {
+	rules, err := loadPremiRules()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT pm.id, pm.nik, pm.nama, t.nama_tim, pm.nomor_rekening, pm.upah_harian, t.kebun_id,
+		       DATE_FORMAT(p.tanggal_panen, '%Y-%m-%d') AS tanggal,
+		       SUM(pp.berat_kg), SUM(pp.jumlah_janjang)
+		FROM panen_pemanen pp
+		JOIN panen p ON pp.panen_id = p.id
+		JOIN pemanen pm ON pp.pemanen_id = pm.id
+		JOIN tim_panen t ON pm.tim_id = t.id
+		WHERE p.tanggal_panen BETWEEN ? AND ?
+	`
+	args := []interface{}{start, end}
+	if kebunID != nil {
+		query += " AND p.kebun_id = ?"
+		args = append(args, *kebunID)
+	}
+	query += `
+		GROUP BY pm.id, pm.nik, pm.nama, t.nama_tim, pm.nomor_rekening, pm.upah_harian, t.kebun_id, tanggal
+		ORDER BY pm.id, tanggal
+	`
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[int]*models.PayrollItem)
+	for rows.Next() {
+		var item models.PayrollItem
+		var nomorRekening sql.NullString
+		var upahHarian, kg float64
+		var workerKebunID, janjang int
+		var tanggal string
+		err := rows.Scan(&item.PemanenID, &item.NIK, &item.Nama, &item.NamaTim, &nomorRekening,
+			&upahHarian, &workerKebunID, &tanggal, &kg, &janjang)
+		if err != nil {
+			return nil, err
+		}
+
+		existing, ok := items[item.PemanenID]
+		if !ok {
+			item.NomorRekening = nomorRekening.String
+			existing = &item
+			items[item.PemanenID] = existing
+		}
+
+		premi, _ := dailyPremi(rules, workerKebunID, tanggal, kg, janjang)
+		existing.HariKerja++
+		existing.TotalKg += kg
+		existing.TotalJanjang += janjang
+		existing.UpahPokok += upahHarian
+		existing.Premi += premi
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]models.PayrollItem, 0, len(items))
+	for _, item := range items {
+		item.TotalKg = round2(item.TotalKg)
+		item.UpahPokok = round2(item.UpahPokok)
+		item.Premi = round2(item.Premi)
+		item.TotalBayar = round2(item.UpahPokok + item.Premi)
+		result = append(result, *item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].NamaTim != result[j].NamaTim {
+			return result[i].NamaTim < result[j].NamaTim
+		}
+		return result[i].Nama < result[j].Nama
+	})
+	return result, nil
+}
+
+// savePayrollItems replaces the items of a payroll and updates its totals
+func savePayrollItems(tx *sql.Tx, payrollID int64, items []models.PayrollItem) error {
+	if _, err := tx.Exec("DELETE FROM payroll_items WHERE payroll_id = ?", payrollID); err != nil {
+		return err
+	}
+
+	var totalUpah, totalPremi float64
+	for _, item := range items {
+		if _, err := tx.Exec(`
+			INSERT INTO payroll_items (payroll_id, pemanen_id, hari_kerja, total_kg, total_janjang,
+			                           upah_pokok, premi, total_bayar)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, payrollID, item.PemanenID, item.HariKerja, item.TotalKg, item.TotalJanjang,
+			item.UpahPokok, item.Premi, item.TotalBayar); err != nil {
+			return err
+		}
+		totalUpah += item.UpahPokok
+		totalPremi += item.Premi
+	}
+
+	_, err := tx.Exec(`
+		UPDATE payroll_periods SET jumlah_pemanen = ?, total_upah = ?, total_premi = ?, total_bayar = ?
+		WHERE id = ?
+	`, len(items), round2(totalUpah), round2(totalPremi), round2(totalUpah+totalPremi), payrollID)
+	return err
+}
+
+// overlapsFinalizedPayroll reports whether a finalized payroll already covers part of the period
+func overlapsFinalizedPayroll(start, end string, kebunID *int, excludeID int64) bool {
+	query := `
+		SELECT COUNT(*) FROM payroll_periods
+		WHERE status = 'finalized' AND id != ?
+		  AND periode_mulai <= ? AND periode_selesai >= ?
+	`
+	args := []interface{}{excludeID, end, start}
+	if kebunID != nil {
+		query += " AND (kebun_id IS NULL OR kebun_id = ?)"
+		args = append(args, *kebunID)
+	}
+
+	var count int
+	config.DB.QueryRow(query, args...).Scan(&count)
+	return count > 0
+}
+
+// CreatePayroll runs payroll for a period and stores it as a draft
+func CreatePayroll(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.CreatePayrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start, err1 := time.Parse("2006-01-02", req.PeriodeMulai)
+	end, err2 := time.Parse("2006-01-02", req.PeriodeSelesai)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "periode_mulai and periode_selesai must be YYYY-MM-DD"})
+		return
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "periode_selesai cannot be before periode_mulai"})
+		return
+	}
+	if end.Sub(start).Hours()/24 >= payrollMaxDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Payroll period cannot exceed %d days", payrollMaxDays)})
+		return
+	}
+	if overlapsFinalizedPayroll(req.PeriodeMulai, req.PeriodeSelesai, req.KebunID, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Period overlaps a finalized payroll"})
+		return
+	}
+
+	items, err := computePayroll(req.PeriodeMulai, req.PeriodeSelesai, req.KebunID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate payroll"})
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO payroll_periods (kebun_id, periode_mulai, periode_selesai, status, created_by)
+		VALUES (?, ?, ?, 'draft', ?)
+	`, req.KebunID, req.PeriodeMulai, req.PeriodeSelesai, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payroll"})
+		return
+	}
+	payrollID, _ := result.LastInsertId()
+
+	if err := savePayrollItems(tx, payrollID, items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payroll items"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payroll"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Entitas: "payroll", ID: payrollID,
+		Aktivitas: fmt.Sprintf("Menghitung payroll panen %s s/d %s", req.PeriodeMulai, req.PeriodeSelesai),
+	})
+
+	payroll, _ := loadPayroll(payrollID)
+	c.JSON(http.StatusCreated, payroll)
+}
+
+// GetPayrollList returns payroll periods
+func GetPayrollList(c *gin.Context) {
+	query := `
+		SELECT id, kebun_id, DATE_FORMAT(periode_mulai, '%Y-%m-%d'), DATE_FORMAT(periode_selesai, '%Y-%m-%d'),
+		       status, jumlah_pemanen, total_upah, total_premi, total_bayar, created_by,
+		       finalized_by, finalized_at, created_at
+		FROM payroll_periods
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if status := c.Query("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if kebunID := c.Query("kebun_id"); kebunID != "" {
+		query += " AND kebun_id = ?"
+		args = append(args, kebunID)
+	}
+
+	query += " ORDER BY periode_mulai DESC, id DESC"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payrolls"})
+		return
+	}
+	defer rows.Close()
+
+	payrolls := make([]models.PayrollPeriod, 0)
+	for rows.Next() {
+		payroll, err := scanPayroll(rows)
+		if err != nil {
+			continue
+		}
+		payrolls = append(payrolls, payroll)
+	}
+
+	c.JSON(http.StatusOK, payrolls)
+}
+
+// GetPayrollDetail returns a payroll with the payable summary per harvester
+func GetPayrollDetail(c *gin.Context) {
+	payrollID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	payroll, err := loadPayroll(payrollID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payroll not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payroll"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payroll)
+}
+
+// RecalculatePayroll reruns a draft payroll after harvest or rule corrections
+func RecalculatePayroll(c *gin.Context) {
+	payrollID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	payroll, err := loadPayroll(payrollID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payroll not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payroll"})
+		return
+	}
+	if payroll.Status != "draft" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only draft payrolls can be recalculated"})
+		return
+	}
+
+	items, err := computePayroll(payroll.PeriodeMulai, payroll.PeriodeSelesai, payroll.KebunID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate payroll"})
+		return
+	}
+
+	before := auditSnapshot(config.DB, "payroll", payrollID)
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := savePayrollItems(tx, payrollID, items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payroll items"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save payroll items"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "recalculate", Entitas: "payroll", ID: payrollID, Sebelum: before,
+		Aktivitas: "Menghitung ulang payroll panen",
+	})
+
+	payroll, _ = loadPayroll(payrollID)
+	c.JSON(http.StatusOK, payroll)
+}
+
+// FinalizePayroll locks a draft payroll; its harvest dates can no longer be changed
+func FinalizePayroll(c *gin.Context) {
+	payrollID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	userID, _ := c.Get("user_id")
+
+	payroll, err := loadPayroll(payrollID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payroll not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payroll"})
+		return
+	}
+	if payroll.Status != "draft" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payroll is already finalized"})
+		return
+	}
+	if overlapsFinalizedPayroll(payroll.PeriodeMulai, payroll.PeriodeSelesai, payroll.KebunID, payrollID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Period overlaps a finalized payroll"})
+		return
+	}
+
+	before := auditSnapshot(config.DB, "payroll", payrollID)
+
+	result, err := config.DB.Exec(`
+		UPDATE payroll_periods SET status = 'finalized', finalized_by = ?, finalized_at = NOW()
+		WHERE id = ? AND status = 'draft'
+	`, userID, payrollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finalize payroll"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Payroll is already finalized"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "finalize", Entitas: "payroll", ID: payrollID, Sebelum: before,
+		Aktivitas: fmt.Sprintf("Memfinalisasi payroll panen (total Rp %.0f)", payroll.TotalBayar),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payroll finalized successfully"})
+}
+
+// DeletePayroll removes a draft payroll
+func DeletePayroll(c *gin.Context) {
+	payrollID := c.Param("id")
+
+	before := auditSnapshot(config.DB, "payroll", paramID(c))
+
+	result, err := config.DB.Exec("DELETE FROM payroll_periods WHERE id = ? AND status = 'draft'", payrollID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payroll"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft payroll not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "delete", Entitas: "payroll", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Menghapus draft payroll panen",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payroll deleted successfully"})
+}
+
+// ExportPayroll downloads the payable summary as CSV or XLSX
+func ExportPayroll(c *gin.Context) {
+	payrollID, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+
+	payroll, err := loadPayroll(payrollID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payroll not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payroll"})
+		return
+	}
+
+	header := []string{"NIK", "Nama", "Tim", "No. Rekening", "Hari Kerja", "Total Kg", "Total Janjang",
+		"Upah Pokok", "Premi", "Total Bayar"}
+	filename := fmt.Sprintf("payroll-panen-%s_%s.%s", payroll.PeriodeMulai, payroll.PeriodeSelesai, format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write(header)
+		for _, item := range payroll.Items {
+			w.Write([]string{
+				item.NIK, item.Nama, item.NamaTim, item.NomorRekening,
+				strconv.Itoa(item.HariKerja),
+				strconv.FormatFloat(item.TotalKg, 'f', 2, 64),
+				strconv.Itoa(item.TotalJanjang),
+				strconv.FormatFloat(item.UpahPokok, 'f', 2, 64),
+				strconv.FormatFloat(item.Premi, 'f', 2, 64),
+				strconv.FormatFloat(item.TotalBayar, 'f', 2, 64),
+			})
+		}
+		w.Write([]string{"", "TOTAL", "", "", "", "", "",
+			strconv.FormatFloat(payroll.TotalUpah, 'f', 2, 64),
+			strconv.FormatFloat(payroll.TotalPremi, 'f', 2, 64),
+			strconv.FormatFloat(payroll.TotalBayar, 'f', 2, 64),
+		})
+		w.Flush()
+		return
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := "Payroll"
+	f.SetSheetName("Sheet1", sheet)
+
+	f.SetCellValue(sheet, "A1", fmt.Sprintf("Payroll Panen %s s/d %s (%s)", payroll.PeriodeMulai, payroll.PeriodeSelesai, payroll.Status))
+	for i, h := range header {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 3)
+		f.SetCellValue(sheet, cell, h)
+	}
+	for r, item := range payroll.Items {
+		row := r + 4
+		values := []interface{}{item.NIK, item.Nama, item.NamaTim, item.NomorRekening, item.HariKerja,
+			item.TotalKg, item.TotalJanjang, item.UpahPokok, item.Premi, item.TotalBayar}
+		for i, v := range values {
+			cell, _ := excelize.CoordinatesToCellName(i+1, row)
+			f.SetCellValue(sheet, cell, v)
+		}
+	}
+	totalRow := len(payroll.Items) + 4
+	f.SetCellValue(sheet, fmt.Sprintf("B%d", totalRow), "TOTAL")
+	for _, col := range []string{"H", "I", "J"} {
+		f.SetCellFormula(sheet, fmt.Sprintf("%s%d", col, totalRow), fmt.Sprintf("SUM(%s4:%s%d)", col, col, totalRow-1))
+	}
+
+	numberStyle, _ := f.NewStyle(&excelize.Style{NumFmt: 4}) // #,##0.00
+	boldStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	f.SetCellStyle(sheet, "F4", fmt.Sprintf("J%d", totalRow), numberStyle)
+	f.SetCellStyle(sheet, "A1", "A1", boldStyle)
+	f.SetCellStyle(sheet, "A3", "J3", boldStyle)
+	f.SetColWidth(sheet, "A", "D", 18)
+	f.SetColWidth(sheet, "E", "J", 14)
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	if err := f.Write(c.Writer); err != nil {
+		c.Status(http.StatusInternalServerError)
+	}
+}
+
+func scanPayroll(scanner interface{ Scan(...interface{}) error }) (models.PayrollPeriod, error) {
+	var p models.PayrollPeriod
+	var kebunID, finalizedBy sql.NullInt64
+	var finalizedAt sql.NullTime
+	err := scanner.Scan(&p.ID, &kebunID, &p.PeriodeMulai, &p.PeriodeSelesai, &p.Status, &p.JumlahPemanen,
+		&p.TotalUpah, &p.TotalPremi, &p.TotalBayar, &p.CreatedBy, &finalizedBy, &finalizedAt, &p.CreatedAt)
+	if kebunID.Valid {
+		id := int(kebunID.Int64)
+		p.KebunID = &id
+	}
+	if finalizedBy.Valid {
+		id := int(finalizedBy.Int64)
+		p.FinalizedBy = &id
+	}
+	if finalizedAt.Valid {
+		p.FinalizedAt = &finalizedAt.Time
+	}
+	return p, err
+}
+
+// loadPayroll returns a payroll period with its items
+func loadPayroll(payrollID int64) (models.PayrollPeriod, error) {
+	payroll, err := scanPayroll(config.DB.QueryRow(`
+		SELECT id, kebun_id, DATE_FORMAT(periode_mulai, '%Y-%m-%d'), DATE_FORMAT(periode_selesai, '%Y-%m-%d'),
+		       status, jumlah_pemanen, total_upah, total_premi, total_bayar, created_by,
+		       finalized_by, finalized_at, created_at
+		FROM payroll_periods WHERE id = ?
+	`, payrollID))
+	if err != nil {
+		return payroll, err
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT i.pemanen_id, p.nik, p.nama, t.nama_tim, p.nomor_rekening, i.hari_kerja, i.total_kg,
+		       i.total_janjang, i.upah_pokok, i.premi, i.total_bayar
+		FROM payroll_items i
+		JOIN pemanen p ON i.pemanen_id = p.id
+		JOIN tim_panen t ON p.tim_id = t.id
+		WHERE i.payroll_id = ?
+		ORDER BY t.nama_tim, p.nama
+	`, payrollID)
+	if err != nil {
+		return payroll, err
+	}
+	defer rows.Close()
+
+	payroll.Items = make([]models.PayrollItem, 0)
+	for rows.Next() {
+		var item models.PayrollItem
+		var nomorRekening sql.NullString
+		if err := rows.Scan(&item.PemanenID, &item.NIK, &item.Nama, &item.NamaTim, &nomorRekening,
+			&item.HariKerja, &item.TotalKg, &item.TotalJanjang, &item.UpahPokok, &item.Premi,
+			&item.TotalBayar); err != nil {
+			continue
+		}
+		item.NomorRekening = nomorRekening.String
+		payroll.Items = append(payroll.Items, item)
+	}
+	return payroll, rows.Err()
+}
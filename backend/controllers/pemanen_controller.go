@@ -0,0 +1,747 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTimPanenList returns harvest teams
+func GetTimPanenList(c *gin.Context) {
+	query := `
+		SELECT t.id, t.kebun_id, t.kode_tim, t.nama_tim, t.nama_mandor, t.status, t.created_at, t.updated_at,
+		       k.nama_kebun,
+		       (SELECT COUNT(*) FROM pemanen p WHERE p.tim_id = t.id AND p.status = 'active')
+		FROM tim_panen t
+		JOIN kebun k ON t.kebun_id = k.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if kebunID := c.Query("kebun_id"); kebunID != "" {
+		query += " AND t.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	if status := c.Query("status"); status != "" {
+		query += " AND t.status = ?"
+		args = append(args, status)
+	}
+
+	query += " ORDER BY k.nama_kebun, t.kode_tim"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch harvest teams"})
+		return
+	}
+	defer rows.Close()
+
+	timList := make([]models.TimPanen, 0)
+	for rows.Next() {
+		var t models.TimPanen
+		err := rows.Scan(&t.ID, &t.KebunID, &t.KodeTim, &t.NamaTim, &t.NamaMandor, &t.Status,
+			&t.CreatedAt, &t.UpdatedAt, &t.NamaKebun, &t.JumlahAnggota)
+		if err != nil {
+			continue
+		}
+		timList = append(timList, t)
+	}
+
+	c.JSON(http.StatusOK, timList)
+}
+
+// CreateTimPanen creates a harvest team (kemandoran)
+func CreateTimPanen(c *gin.Context) {
+	var req models.TimPanenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO tim_panen (kebun_id, kode_tim, nama_tim, nama_mandor, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, req.KebunID, req.KodeTim, req.NamaTim, req.NamaMandor, req.Status)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode tim already exists in this kebun"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create harvest team"})
+		return
+	}
+
+	timID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Modul: "pemanen", Entitas: "tim_panen", ID: timID,
+		Aktivitas: "Menambah tim panen",
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Harvest team created successfully",
+		"tim_id":  timID,
+	})
+}
+
+// UpdateTimPanen updates a harvest team
+func UpdateTimPanen(c *gin.Context) {
+	timID := c.Param("id")
+
+	var req models.TimPanenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	before := auditSnapshot(config.DB, "tim_panen", paramID(c))
+
+	result, err := config.DB.Exec(`
+		UPDATE tim_panen SET kebun_id = ?, kode_tim = ?, nama_tim = ?, nama_mandor = ?, status = ?
+		WHERE id = ?
+	`, req.KebunID, req.KodeTim, req.NamaTim, req.NamaMandor, req.Status, timID)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Kode tim already exists in this kebun"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update harvest team"})
+		return
+	}
+	if !recordExists(result, "SELECT COUNT(*) FROM tim_panen WHERE id = ?", timID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Harvest team not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "update", Modul: "pemanen", Entitas: "tim_panen", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mengupdate tim panen",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Harvest team updated successfully"})
+}
+
+// GetPemanenList returns harvesters
+func GetPemanenList(c *gin.Context) {
+	query := `
+		SELECT p.id, p.nik, p.nama, p.tim_id, DATE_FORMAT(p.tanggal_masuk, '%Y-%m-%d'), p.upah_harian, p.nomor_rekening,
+		       p.status, p.created_at, p.updated_at, t.nama_tim, t.kebun_id
+		FROM pemanen p
+		JOIN tim_panen t ON p.tim_id = t.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if timID := c.Query("tim_id"); timID != "" {
+		query += " AND p.tim_id = ?"
+		args = append(args, timID)
+	}
+	if kebunID := c.Query("kebun_id"); kebunID != "" {
+		query += " AND t.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	if status := c.Query("status"); status != "" {
+		query += " AND p.status = ?"
+		args = append(args, status)
+	}
+	if search := c.Query("search"); search != "" {
+		query += " AND (p.nama LIKE ? OR p.nik LIKE ?)"
+		args = append(args, "%"+search+"%", "%"+search+"%")
+	}
+
+	query += " ORDER BY t.nama_tim, p.nama"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch harvesters"})
+		return
+	}
+	defer rows.Close()
+
+	pemanenList := make([]models.Pemanen, 0)
+	for rows.Next() {
+		var p models.Pemanen
+		var tanggalMasuk, nomorRekening sql.NullString
+		err := rows.Scan(&p.ID, &p.NIK, &p.Nama, &p.TimID, &tanggalMasuk, &p.UpahHarian, &nomorRekening,
+			&p.Status, &p.CreatedAt, &p.UpdatedAt, &p.NamaTim, &p.KebunID)
+		if err != nil {
+			continue
+		}
+		if tanggalMasuk.Valid {
+			p.TanggalMasuk = &tanggalMasuk.String
+		}
+		p.NomorRekening = nomorRekening.String
+		pemanenList = append(pemanenList, p)
+	}
+
+	c.JSON(http.StatusOK, pemanenList)
+}
+
+// CreatePemanen registers a harvester
+func CreatePemanen(c *gin.Context) {
+	var req models.PemanenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO pemanen (nik, nama, tim_id, tanggal_masuk, upah_harian, nomor_rekening, status)
+		VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?)
+	`, req.NIK, req.Nama, req.TimID, req.TanggalMasuk, req.UpahHarian, req.NomorRekening, req.Status)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "NIK already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create harvester"})
+		return
+	}
+
+	pemanenID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Entitas: "pemanen", ID: pemanenID,
+		Aktivitas: "Menambah pemanen " + req.NIK,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Harvester created successfully",
+		"pemanen_id": pemanenID,
+	})
+}
+
+// UpdatePemanen updates a harvester; set status to inactive when they leave
+func UpdatePemanen(c *gin.Context) {
+	pemanenID := c.Param("id")
+
+	var req models.PemanenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status == "" {
+		req.Status = "active"
+	}
+
+	before := auditSnapshot(config.DB, "pemanen", paramID(c))
+
+	result, err := config.DB.Exec(`
+		UPDATE pemanen SET nik = ?, nama = ?, tim_id = ?, tanggal_masuk = NULLIF(?, ''),
+		       upah_harian = ?, nomor_rekening = ?, status = ?
+		WHERE id = ?
+	`, req.NIK, req.Nama, req.TimID, req.TanggalMasuk, req.UpahHarian, req.NomorRekening, req.Status, pemanenID)
+	if isDuplicateEntry(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "NIK already registered"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update harvester"})
+		return
+	}
+	if !recordExists(result, "SELECT COUNT(*) FROM pemanen WHERE id = ?", pemanenID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Harvester not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "update", Entitas: "pemanen", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mengupdate pemanen",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Harvester updated successfully"})
+}
+
+// GetPemanenOutput returns a harvester's daily output with the premi it earns
+func GetPemanenOutput(c *gin.Context) {
+	pemanenID := c.Param("id")
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+	if startDate == "" || endDate == "" {
+		now := time.Now()
+		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).Format("2006-01-02")
+		endDate = now.Format("2006-01-02")
+	}
+
+	var kebunID int
+	var upahHarian float64
+	err := config.DB.QueryRow(`
+		SELECT t.kebun_id, p.upah_harian FROM pemanen p
+		JOIN tim_panen t ON p.tim_id = t.id
+		WHERE p.id = ?
+	`, pemanenID).Scan(&kebunID, &upahHarian)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Harvester not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rules, err := loadPremiRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch premi rules"})
+		return
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT DATE_FORMAT(p.tanggal_panen, '%Y-%m-%d') AS tanggal, SUM(pp.berat_kg), SUM(pp.jumlah_janjang),
+		       GROUP_CONCAT(DISTINCT b.kode_blok ORDER BY b.kode_blok)
+		FROM panen_pemanen pp
+		JOIN panen p ON pp.panen_id = p.id
+		JOIN blok b ON p.blok_id = b.id
+		WHERE pp.pemanen_id = ? AND p.tanggal_panen BETWEEN ? AND ?
+		GROUP BY tanggal
+		ORDER BY tanggal
+	`, pemanenID, startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch output"})
+		return
+	}
+	defer rows.Close()
+
+	output := make([]gin.H, 0)
+	for rows.Next() {
+		var tanggal, blok string
+		var kg float64
+		var janjang int
+		if err := rows.Scan(&tanggal, &kg, &janjang, &blok); err != nil {
+			continue
+		}
+		premi, rule := dailyPremi(rules, kebunID, tanggal, kg, janjang)
+		row := gin.H{
+			"tanggal":        tanggal,
+			"blok":           blok,
+			"berat_kg":       kg,
+			"jumlah_janjang": janjang,
+			"upah_pokok":     upahHarian,
+			"premi":          premi,
+		}
+		if rule != nil {
+			row["premi_rule_id"] = rule.ID
+		}
+		output = append(output, row)
+	}
+
+	c.JSON(http.StatusOK, output)
+}
+
+// GetPremiRules returns premi rules
+func GetPremiRules(c *gin.Context) {
+	rows, err := config.DB.Query(`
+		SELECT id, nama, kebun_id, basis, target_harian, tarif,
+		       DATE_FORMAT(berlaku_mulai, '%Y-%m-%d'), DATE_FORMAT(berlaku_sampai, '%Y-%m-%d'), status, created_at
+		FROM premi_rules
+		ORDER BY status, berlaku_mulai DESC
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch premi rules"})
+		return
+	}
+	defer rows.Close()
+
+	rules := make([]models.PremiRule, 0)
+	for rows.Next() {
+		rule, err := scanPremiRule(rows)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreatePremiRule adds a premi rule
+func CreatePremiRule(c *gin.Context) {
+	var req models.PremiRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validatePremiRule(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO premi_rules (nama, kebun_id, basis, target_harian, tarif, berlaku_mulai, berlaku_sampai, status)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?)
+	`, req.Nama, req.KebunID, req.Basis, req.TargetHarian, req.Tarif, req.BerlakuMulai, req.BerlakuSampai, req.Status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create premi rule"})
+		return
+	}
+
+	ruleID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Modul: "pemanen", Entitas: "premi_rule", ID: ruleID,
+		Aktivitas: "Menambah aturan premi " + req.Nama,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Premi rule created successfully",
+		"premi_rule_id": ruleID,
+	})
+}
+
+// UpdatePremiRule updates a premi rule. Finalized payrolls keep the amounts they were run with.
+func UpdatePremiRule(c *gin.Context) {
+	ruleID := c.Param("id")
+
+	var req models.PremiRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validatePremiRule(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	before := auditSnapshot(config.DB, "premi_rule", paramID(c))
+
+	result, err := config.DB.Exec(`
+		UPDATE premi_rules SET nama = ?, kebun_id = ?, basis = ?, target_harian = ?, tarif = ?,
+		       berlaku_mulai = ?, berlaku_sampai = NULLIF(?, ''), status = ?
+		WHERE id = ?
+	`, req.Nama, req.KebunID, req.Basis, req.TargetHarian, req.Tarif, req.BerlakuMulai,
+		req.BerlakuSampai, req.Status, ruleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update premi rule"})
+		return
+	}
+	if !recordExists(result, "SELECT COUNT(*) FROM premi_rules WHERE id = ?", ruleID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Premi rule not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "update", Modul: "pemanen", Entitas: "premi_rule", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mengupdate aturan premi",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Premi rule updated successfully"})
+}
+
+// GetPanenPemanen returns the harvester breakdown of a harvest record
+func GetPanenPemanen(c *gin.Context) {
+	rows, err := config.DB.Query(`
+		SELECT pp.pemanen_id, p.nik, p.nama, pp.jumlah_janjang, pp.berat_kg
+		FROM panen_pemanen pp
+		JOIN pemanen p ON pp.pemanen_id = p.id
+		WHERE pp.panen_id = ?
+		ORDER BY p.nama
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch harvester output"})
+		return
+	}
+	defer rows.Close()
+
+	output := make([]gin.H, 0)
+	for rows.Next() {
+		var pemanenID, janjang int
+		var nik, nama string
+		var kg float64
+		if err := rows.Scan(&pemanenID, &nik, &nama, &janjang, &kg); err != nil {
+			continue
+		}
+		output = append(output, gin.H{
+			"pemanen_id":     pemanenID,
+			"nik":            nik,
+			"nama":           nama,
+			"jumlah_janjang": janjang,
+			"berat_kg":       kg,
+		})
+	}
+
+	c.JSON(http.StatusOK, output)
+}
+
+// UpdatePanenPemanen replaces the harvester breakdown of a harvest record
+func UpdatePanenPemanen(c *gin.Context) {
+	panenID := c.Param("id")
+
+	var req models.PanenPemanenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var jumlahJanjang, kebunID int
+	var beratKg float64
+	var tanggalPanen string
+	err := config.DB.QueryRow(`
+		SELECT jumlah_janjang, berat_kg, DATE_FORMAT(tanggal_panen, '%Y-%m-%d'), kebun_id FROM panen WHERE id = ?
+	`, panenID).Scan(&jumlahJanjang, &beratKg, &tanggalPanen, &kebunID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Harvest record not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if panenInFinalizedPayroll(tanggalPanen, kebunID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Harvest date is covered by a finalized payroll"})
+		return
+	}
+
+	outputs, err := allocatePanenPemanen(req.Pemanen, jumlahJanjang, beratKg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	before := panenPemanenSnapshot(tx, paramID(c))
+	if _, err := tx.Exec("DELETE FROM panen_pemanen WHERE panen_id = ?", panenID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update harvester output"})
+		return
+	}
+	var id int64
+	fmt.Sscan(panenID, &id)
+	if err := insertPanenPemanen(tx, id, outputs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update harvester output"})
+		return
+	}
+	recordAudit(tx, c, auditEvent{
+		Aksi: "update_pemanen", Entitas: "panen", ID: id,
+		Sebelum: before, Sesudah: panenPemanenSnapshot(tx, id),
+		Aktivitas: "Mengupdate output pemanen",
+	})
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update harvester output"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Harvester output updated successfully"})
+}
+
+// allocatePanenPemanen validates a harvester breakdown against the harvest totals.
+// Bunch counts must add up; weights default to the harvest's BJR, with the rounding
+// remainder given to the last harvester so the weights add up exactly.
+func allocatePanenPemanen(inputs []models.PanenPemanenInput, jumlahJanjang int, beratKg float64) ([]models.PanenPemanenInput, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[int]bool)
+	totalJanjang, withWeight := 0, 0
+	totalBerat := 0.0
+	for _, in := range inputs {
+		if seen[in.PemanenID] {
+			return nil, fmt.Errorf("pemanen %d is listed twice", in.PemanenID)
+		}
+		seen[in.PemanenID] = true
+		totalJanjang += in.JumlahJanjang
+		if in.BeratKg > 0 {
+			withWeight++
+			totalBerat += in.BeratKg
+		}
+
+		var status string
+		err := config.DB.QueryRow("SELECT status FROM pemanen WHERE id = ?", in.PemanenID).Scan(&status)
+		if err != nil || status != "active" {
+			return nil, fmt.Errorf("pemanen %d not found or inactive", in.PemanenID)
+		}
+	}
+
+	if totalJanjang != jumlahJanjang {
+		return nil, fmt.Errorf("harvester bunches add up to %d, harvest has %d", totalJanjang, jumlahJanjang)
+	}
+
+	outputs := make([]models.PanenPemanenInput, len(inputs))
+	copy(outputs, inputs)
+
+	switch withWeight {
+	case len(inputs):
+		if math.Abs(totalBerat-beratKg) > 1 {
+			return nil, fmt.Errorf("harvester weights add up to %.2f kg, harvest has %.2f kg", totalBerat, beratKg)
+		}
+	case 0:
+		remaining := beratKg
+		for i := range outputs {
+			if i == len(outputs)-1 {
+				outputs[i].BeratKg = math.Round(remaining*100) / 100
+				break
+			}
+			share := math.Round(beratKg*float64(outputs[i].JumlahJanjang)/float64(jumlahJanjang)*100) / 100
+			outputs[i].BeratKg = share
+			remaining -= share
+		}
+	default:
+		return nil, errors.New("give berat_kg for every harvester or for none")
+	}
+
+	return outputs, nil
+}
+
+// panenPemanenSnapshot captures the harvester breakdown of a harvest for the audit trail
+func panenPemanenSnapshot(db auditDB, panenID int64) map[string]interface{} {
+	rows, err := db.Query(`
+		SELECT pemanen_id, jumlah_janjang, berat_kg FROM panen_pemanen WHERE panen_id = ? ORDER BY pemanen_id
+	`, panenID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	outputs := make([]models.PanenPemanenInput, 0)
+	for rows.Next() {
+		var out models.PanenPemanenInput
+		if err := rows.Scan(&out.PemanenID, &out.JumlahJanjang, &out.BeratKg); err == nil {
+			outputs = append(outputs, out)
+		}
+	}
+	return map[string]interface{}{"pemanen": outputs}
+}
+
+func insertPanenPemanen(tx *sql.Tx, panenID int64, outputs []models.PanenPemanenInput) error {
+	for _, out := range outputs {
+		if _, err := tx.Exec(`
+			INSERT INTO panen_pemanen (panen_id, pemanen_id, jumlah_janjang, berat_kg)
+			VALUES (?, ?, ?, ?)
+		`, panenID, out.PemanenID, out.JumlahJanjang, out.BeratKg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// panenInFinalizedPayroll reports whether a finalized payroll already paid out the date
+func panenInFinalizedPayroll(tanggal string, kebunID int) bool {
+	var count int
+	config.DB.QueryRow(`
+		SELECT COUNT(*) FROM payroll_periods
+		WHERE status = 'finalized' AND ? BETWEEN periode_mulai AND periode_selesai
+		  AND (kebun_id IS NULL OR kebun_id = ?)
+	`, tanggal, kebunID).Scan(&count)
+	return count > 0
+}
+
+func validatePremiRule(req *models.PremiRuleRequest) string {
+	if req.Status == "" {
+		req.Status = "active"
+	}
+	mulai, err := time.Parse("2006-01-02", req.BerlakuMulai)
+	if err != nil {
+		return "berlaku_mulai must be YYYY-MM-DD"
+	}
+	if req.BerlakuSampai != "" {
+		sampai, err := time.Parse("2006-01-02", req.BerlakuSampai)
+		if err != nil {
+			return "berlaku_sampai must be YYYY-MM-DD"
+		}
+		if sampai.Before(mulai) {
+			return "berlaku_sampai cannot be before berlaku_mulai"
+		}
+	}
+	return ""
+}
+
+func scanPremiRule(scanner interface{ Scan(...interface{}) error }) (models.PremiRule, error) {
+	var rule models.PremiRule
+	var kebunID sql.NullInt64
+	var sampai sql.NullString
+	err := scanner.Scan(&rule.ID, &rule.Nama, &kebunID, &rule.Basis, &rule.TargetHarian, &rule.Tarif,
+		&rule.BerlakuMulai, &sampai, &rule.Status, &rule.CreatedAt)
+	if kebunID.Valid {
+		id := int(kebunID.Int64)
+		rule.KebunID = &id
+	}
+	if sampai.Valid {
+		rule.BerlakuSampai = &sampai.String
+	}
+	return rule, err
+}
+
+// loadPremiRules returns the active premi rules
+func loadPremiRules() ([]models.PremiRule, error) {
+	rows, err := config.DB.Query(`
+		SELECT id, nama, kebun_id, basis, target_harian, tarif,
+		       DATE_FORMAT(berlaku_mulai, '%Y-%m-%d'), DATE_FORMAT(berlaku_sampai, '%Y-%m-%d'), status, created_at
+		FROM premi_rules
+		WHERE status = 'active'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.PremiRule
+	for rows.Next() {
+		rule, err := scanPremiRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// dailyPremi computes one harvester-day's premi. A kebun-specific rule wins over a
+// general one; among equals the most recently started rule applies.
+func dailyPremi(rules []models.PremiRule, kebunID int, tanggal string, kg float64, janjang int) (float64, *models.PremiRule) {
+	var chosen *models.PremiRule
+	for i := range rules {
+		rule := &rules[i]
+		if tanggal < rule.BerlakuMulai || (rule.BerlakuSampai != nil && tanggal > *rule.BerlakuSampai) {
+			continue
+		}
+		if rule.KebunID != nil && *rule.KebunID != kebunID {
+			continue
+		}
+		if chosen == nil {
+			chosen = rule
+			continue
+		}
+		specific, chosenSpecific := rule.KebunID != nil, chosen.KebunID != nil
+		if specific != chosenSpecific {
+			if specific {
+				chosen = rule
+			}
+			continue
+		}
+		if rule.BerlakuMulai > chosen.BerlakuMulai {
+			chosen = rule
+		}
+	}
+	if chosen == nil {
+		return 0, nil
+	}
+
+	output := kg
+	if chosen.Basis == "janjang" {
+		output = float64(janjang)
+	}
+	if output <= chosen.TargetHarian {
+		return 0, chosen
+	}
+	return math.Round((output-chosen.TargetHarian)*chosen.Tarif*100) / 100, chosen
+}
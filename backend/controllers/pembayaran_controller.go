@@ -1,204 +1,153 @@
 package controllers
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
-	"sawit-backend/config"
+	"net/url"
 	"sawit-backend/models"
+	"sawit-backend/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CreatePembayaran creates new payment record
-func CreatePembayaran(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+// PembayaranHandler records and verifies payments and serves the payment, daily
+// sales and receivables reports from injected repositories
+type PembayaranHandler struct {
+	store repository.Store
+}
+
+// NewPembayaranHandler returns a PembayaranHandler backed by store
+func NewPembayaranHandler(store repository.Store) *PembayaranHandler {
+	return &PembayaranHandler{store: store}
+}
 
+// CreatePembayaran creates new payment record
+func (h *PembayaranHandler) CreatePembayaran(c *gin.Context) {
 	var req models.CreatePembayaranRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get dokumen and PO info
-	var poID int
-	err := config.DB.QueryRow("SELECT po_id FROM dokumen_penjualan WHERE id = ?", req.DokumenID).Scan(&poID)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
-		return
-	}
+	var pembayaranID int64
+	err := h.store.WithTx(func(tx repository.Store) error {
+		// Get dokumen and PO info
+		poID, buyerID, err := tx.Dokumen().FindOwner(req.DokumenID)
+		if err == repository.ErrNotFound {
+			return fail(http.StatusNotFound, "Document not found")
+		}
+		if err != nil {
+			return err
+		}
 
-	// Insert pembayaran
-	result, err := config.DB.Exec(`
-		INSERT INTO pembayaran (
-			dokumen_id, po_id, jumlah_bayar, metode_pembayaran,
-			bank_pengirim, nomor_rekening, nama_pengirim,
-			tanggal_pembayaran, tanggal_jatuh_tempo, status, catatan
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?)
-	`, req.DokumenID, poID, req.JumlahBayar, req.MetodePembayaran,
-		req.BankPengirim, req.NomorRekening, req.NamaPengirim,
-		req.TanggalPembayaran, req.TanggalJatuhTempo, req.Catatan)
+		// Buyers can only pay their own invoices
+		if !canReadOwned(c, "dokumen", buyerID) {
+			return fail(http.StatusForbidden, "Access denied")
+		}
 
+		if pembayaranID, err = tx.Pembayaran().Create(req, poID); err != nil {
+			return err
+		}
+
+		recordAuditTo(tx.Logs(), c, auditEvent{
+			Aksi: "create", Entitas: "pembayaran", ID: pembayaranID,
+			Aktivitas: fmt.Sprintf("Membuat pembayaran Rp %.0f", req.JumlahBayar),
+		})
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		respondError(c, err, "Failed to create payment")
 		return
 	}
 
-	pembayaranID, _ := result.LastInsertId()
-
-	// Log aktivitas
-	config.DB.Exec(`
-		INSERT INTO log_aktivitas (user_id, aktivitas, modul, reference_id, ip_address)
-		VALUES (?, 'Membuat pembayaran', 'pembayaran', ?, ?)
-	`, userID, pembayaranID, c.ClientIP())
-
+	invalidateDashboard()
 	c.JSON(http.StatusCreated, gin.H{
 		"message":       "Payment created successfully",
 		"pembayaran_id": pembayaranID,
 	})
 }
 
-// GetPembayaran returns list of payments
-func GetPembayaran(c *gin.Context) {
-	poID := c.Query("po_id")
-	status := c.Query("status")
-
-	query := `
-		SELECT 
-			p.id as bayar_id,
-			p.dokumen_id,
-			p.po_id,
-			p.jumlah_bayar,
-			p.metode_pembayaran,
-			p.bank_pengirim,
-			p.nomor_rekening,
-			p.nama_pengirim,
-			p.bukti_transfer as bukti_bayar,
-			p.tanggal_jatuh_tempo,
-			p.tanggal_pembayaran as tanggal_bayar,
-			p.status as status_verifikasi,
-			p.verified_by,
-			p.verified_at,
-			p.catatan,
-			p.created_at,
-			p.updated_at,
-			d.nomor_invoice,
-			u.username as buyer_name
-		FROM pembayaran p
-		LEFT JOIN dokumen_penjualan d ON p.dokumen_id = d.id
-		LEFT JOIN purchase_orders po ON p.po_id = po.id
-		LEFT JOIN users u ON po.buyer_id = u.id
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	if poID != "" {
-		query += " AND p.po_id = ?"
-		args = append(args, poID)
+// pembayaranJSON is the GetPembayaran entry for a payment; optional fields are left out when empty
+func pembayaranJSON(p repository.PembayaranRow) map[string]interface{} {
+	payment := map[string]interface{}{
+		"bayar_id":          p.ID,
+		"dokumen_id":        p.DokumenID,
+		"po_id":             p.POID,
+		"jumlah_bayar":      p.JumlahBayar,
+		"metode_pembayaran": p.MetodePembayaran,
+		"tanggal_bayar":     p.TanggalBayar,
+		"created_at":        p.CreatedAt,
+		"updated_at":        p.UpdatedAt,
+		"bank_pengirim":     p.BankPengirim,
+		"nomor_rekening":    p.NomorRekening,
+		"nama_pengirim":     p.NamaPengirim,
+		"catatan":           p.Catatan,
+		"status_verifikasi": p.Status,
+	}
+
+	if p.BuktiBayar != nil {
+		payment["bukti_bayar"] = *p.BuktiBayar
+	}
+	if p.TanggalJatuhTempo != nil {
+		payment["tanggal_jatuh_tempo"] = *p.TanggalJatuhTempo
+	}
+	if p.VerifiedAt != nil {
+		payment["verified_at"] = *p.VerifiedAt
 	}
-	if status != "" {
-		query += " AND p.status = ?"
-		args = append(args, status)
+	if p.VerifiedBy != nil {
+		payment["verified_by"] = *p.VerifiedBy
 	}
+	if p.NomorInvoice != nil {
+		payment["nomor_invoice"] = *p.NomorInvoice
+	}
+	if p.BuyerName != nil {
+		payment["buyer_name"] = *p.BuyerName
+	}
+	return payment
+}
 
-	query += " ORDER BY p.created_at DESC"
+// pembayaranFilter reads the payment list filters; owner limits it to one buyer
+func pembayaranFilter(f url.Values, owner *int) repository.PembayaranFilter {
+	return repository.PembayaranFilter{
+		POID: f.Get("po_id"), Status: f.Get("status"),
+		StartDate: f.Get("start_date"), EndDate: f.Get("end_date"), BuyerID: owner,
+	}
+}
 
-	rows, err := config.DB.Query(query, args...)
-	if err != nil {
-		fmt.Printf("GetPembayaran Query Error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments", "details": err.Error()})
+// GetPembayaran returns list of payments, or a file with ?format=xlsx|csv|pdf
+func (h *PembayaranHandler) GetPembayaran(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
 		return
 	}
-	defer rows.Close()
-
-	pembayaranList := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var bayarID, dokumenID, poID int
-		var jumlahBayar float64
-		var metodePembayaran string
-		var bankPengirim, nomorRekening, namaPengirim, catatan sql.NullString
-		var buktiTransfer, tanggalJatuhTempo, verifiedAt sql.NullString
-		var verifiedBy sql.NullInt64
-		var tanggalBayar, createdAt, updatedAt string
-		var statusVerifikasi, nomorInvoice, buyerName sql.NullString
-
-		err := rows.Scan(
-			&bayarID, &dokumenID, &poID, &jumlahBayar, &metodePembayaran,
-			&bankPengirim, &nomorRekening, &namaPengirim, &buktiTransfer,
-			&tanggalJatuhTempo, &tanggalBayar, &statusVerifikasi, &verifiedBy,
-			&verifiedAt, &catatan, &createdAt, &updatedAt,
-			&nomorInvoice, &buyerName,
-		)
-		if err != nil {
-			fmt.Printf("GetPembayaran Scan Error: %v\n", err)
-			continue
-		}
 
-		payment := map[string]interface{}{
-			"bayar_id":          bayarID,
-			"dokumen_id":        dokumenID,
-			"po_id":             poID,
-			"jumlah_bayar":      jumlahBayar,
-			"metode_pembayaran": metodePembayaran,
-			"tanggal_bayar":     tanggalBayar,
-			"created_at":        createdAt,
-			"updated_at":        updatedAt,
-		}
+	buyerID, ok := scopeOwner(c, "pembayaran")
+	if !ok {
+		return
+	}
 
-		if bankPengirim.Valid {
-			payment["bank_pengirim"] = bankPengirim.String
-		} else {
-			payment["bank_pengirim"] = ""
-		}
-		if nomorRekening.Valid {
-			payment["nomor_rekening"] = nomorRekening.String
-		} else {
-			payment["nomor_rekening"] = ""
-		}
-		if namaPengirim.Valid {
-			payment["nama_pengirim"] = namaPengirim.String
-		} else {
-			payment["nama_pengirim"] = ""
-		}
-		if catatan.Valid {
-			payment["catatan"] = catatan.String
-		} else {
-			payment["catatan"] = ""
-		}
-		if buktiTransfer.Valid {
-			payment["bukti_bayar"] = buktiTransfer.String
-		}
-		if tanggalJatuhTempo.Valid {
-			payment["tanggal_jatuh_tempo"] = tanggalJatuhTempo.String
-		}
-		if verifiedAt.Valid {
-			payment["verified_at"] = verifiedAt.String
-		}
-		if verifiedBy.Valid {
-			payment["verified_by"] = verifiedBy.Int64
-		}
-		if statusVerifikasi.Valid {
-			payment["status_verifikasi"] = statusVerifikasi.String
-		} else {
-			payment["status_verifikasi"] = "pending"
-		}
-		if nomorInvoice.Valid {
-			payment["nomor_invoice"] = nomorInvoice.String
-		}
-		if buyerName.Valid {
-			payment["buyer_name"] = buyerName.String
-		}
+	if format != "" {
+		sendExport(c, h.store, format, reportSources["pembayaran"], buyerID)
+		return
+	}
 
-		pembayaranList = append(pembayaranList, payment)
+	payments, err := h.store.Pembayaran().List(pembayaranFilter(c.Request.URL.Query(), buyerID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payments", "details": err.Error()})
+		return
+	}
+
+	pembayaranList := make([]map[string]interface{}, 0, len(payments))
+	for _, p := range payments {
+		pembayaranList = append(pembayaranList, pembayaranJSON(p))
 	}
 
 	c.JSON(http.StatusOK, pembayaranList)
 }
 
 // VerifyPembayaran verifies payment (admin only)
-func VerifyPembayaran(c *gin.Context) {
-	pembayaranID := c.Param("id")
-	userID, _ := c.Get("user_id")
+func (h *PembayaranHandler) VerifyPembayaran(c *gin.Context) {
+	pembayaranID := int(paramID(c))
 
 	var req struct {
 		Status  string `json:"status" binding:"required"`
@@ -210,125 +159,137 @@ func VerifyPembayaran(c *gin.Context) {
 		return
 	}
 
-	_, err := config.DB.Exec(`
-		UPDATE pembayaran
-		SET status = ?, catatan = ?, verified_by = ?, verified_at = NOW()
-		WHERE id = ?
-	`, req.Status, req.Catatan, userID, pembayaranID)
+	err := h.store.WithTx(func(tx repository.Store) error {
+		before := snapshotOf(tx.Logs(), "pembayaran", int64(pembayaranID))
+
+		if err := tx.Pembayaran().Verify(pembayaranID, req.Status, req.Catatan, c.GetInt("user_id")); err != nil {
+			return err
+		}
 
+		recordAuditTo(tx.Logs(), c, auditEvent{
+			Aksi: "verify", Entitas: "pembayaran", ID: int64(pembayaranID), Sebelum: before,
+			Aktivitas: "Verifikasi pembayaran: " + req.Status,
+		})
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify payment"})
+		respondError(c, err, "Failed to verify payment")
 		return
 	}
 
+	invalidateDashboard()
 	c.JSON(http.StatusOK, gin.H{"message": "Payment verified successfully"})
 }
 
-// GetDailySales returns daily sales report
-func GetDailySales(c *gin.Context) {
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-
-	query := `
-		SELECT DATE(dp.tanggal_dokumen) as tanggal,
-		       COUNT(DISTINCT dp.id) as jumlah_transaksi,
-		       SUM(dp.jumlah_kg) as total_kg,
-		       SUM(total_akhir) as total_pendapatan,
-		       AVG(dp.harga_per_kg) as rata_rata_harga,
-		       SUM(CASE WHEN t.grade_aktual = 'A' THEN dp.jumlah_kg ELSE 0 END) as grade_a,
-		       SUM(CASE WHEN t.grade_aktual = 'B' THEN dp.jumlah_kg ELSE 0 END) as grade_b,
-		       SUM(CASE WHEN t.grade_aktual = 'C' THEN dp.jumlah_kg ELSE 0 END) as grade_c
-		FROM dokumen_penjualan dp
-		LEFT JOIN timbangan t ON dp.timbang_id = t.id
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	if startDate != "" {
-		query += " AND DATE(dp.tanggal_dokumen) >= ?"
-		args = append(args, startDate)
-	}
-	if endDate != "" {
-		query += " AND DATE(dp.tanggal_dokumen) <= ?"
-		args = append(args, endDate)
+// salesFilter reads the sales report period
+func salesFilter(f url.Values) repository.SalesFilter {
+	return repository.SalesFilter{StartDate: f.Get("start_date"), EndDate: f.Get("end_date")}
+}
+
+// GetDailySales returns daily sales report. With ?format=xlsx|csv|pdf it is
+// downloaded as a file instead.
+func (h *PembayaranHandler) GetDailySales(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
 	}
 
-	query += " GROUP BY DATE(dp.tanggal_dokumen) ORDER BY tanggal DESC"
+	if format != "" {
+		sendExport(c, h.store, format, reportSources["daily_sales"], nil)
+		return
+	}
 
-	rows, err := config.DB.Query(query, args...)
+	sales, err := h.store.Dokumen().DailySales(salesFilter(c.Request.URL.Query()))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales report"})
 		return
 	}
-	defer rows.Close()
-
-	salesList := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var tanggal string
-		var jumlahTransaksi int
-		var totalKg, totalPendapatan, rataHarga float64
-		var gradeA, gradeB, gradeC sql.NullFloat64
-
-		err := rows.Scan(&tanggal, &jumlahTransaksi, &totalKg, &totalPendapatan, &rataHarga, &gradeA, &gradeB, &gradeC)
-		if err != nil {
-			continue
-		}
 
+	salesList := make([]map[string]interface{}, 0, len(sales))
+	for _, d := range sales {
 		salesList = append(salesList, map[string]interface{}{
-			"tanggal":           tanggal,
-			"jumlah_transaksi":  jumlahTransaksi,
-			"total_kg":          totalKg,
-			"total_pendapatan":  totalPendapatan,
-			"rata_rata_harga":   rataHarga,
-			"grade_a":           gradeA.Float64,
-			"grade_b":           gradeB.Float64,
-			"grade_c":           gradeC.Float64,
+			"tanggal":          d.Tanggal,
+			"jumlah_transaksi": d.JumlahTransaksi,
+			"total_kg":         d.TotalKg,
+			"total_pendapatan": d.TotalPendapatan,
+			"rata_rata_harga":  d.RataRataHarga,
+			"grade_a":          d.GradeA,
+			"grade_b":          d.GradeB,
+			"grade_c":          d.GradeC,
 		})
 	}
 
 	c.JSON(http.StatusOK, salesList)
 }
 
-// GetDashboardStats returns dashboard statistics
-func GetDashboardStats(c *gin.Context) {
-	role, _ := c.Get("role")
-	userID, _ := c.Get("user_id")
-
-	stats := make(map[string]interface{})
-
-	if role == "buyer" {
-		// Buyer statistics
-		var totalPO, pendingPO, approvedPO, completedPO int
-		var totalSpent float64
-
-		config.DB.QueryRow("SELECT COUNT(*) FROM purchase_orders WHERE buyer_id = ?", userID).Scan(&totalPO)
-		config.DB.QueryRow("SELECT COUNT(*) FROM purchase_orders WHERE buyer_id = ? AND status = 'pending'", userID).Scan(&pendingPO)
-		config.DB.QueryRow("SELECT COUNT(*) FROM purchase_orders WHERE buyer_id = ? AND status = 'approved'", userID).Scan(&approvedPO)
-		config.DB.QueryRow("SELECT COUNT(*) FROM purchase_orders WHERE buyer_id = ? AND status = 'completed'", userID).Scan(&completedPO)
-		config.DB.QueryRow("SELECT COALESCE(SUM(total_harga), 0) FROM purchase_orders WHERE buyer_id = ? AND status = 'completed'", userID).Scan(&totalSpent)
-
-		stats["total_po"] = totalPO
-		stats["pending_po"] = pendingPO
-		stats["approved_po"] = approvedPO
-		stats["completed_po"] = completedPO
-		stats["total_spent"] = totalSpent
-	} else {
-		// Admin statistics
-		var totalStok, totalKebun, totalBuyer int
-		var totalPendingPO, totalRevenue float64
-
-		config.DB.QueryRow("SELECT COUNT(*) FROM stok_tbs WHERE status = 'available'").Scan(&totalStok)
-		config.DB.QueryRow("SELECT COUNT(*) FROM kebun WHERE status = 'active'").Scan(&totalKebun)
-		config.DB.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'buyer' AND status = 'active'").Scan(&totalBuyer)
-		config.DB.QueryRow("SELECT COUNT(*) FROM purchase_orders WHERE status = 'pending'").Scan(&totalPendingPO)
-		config.DB.QueryRow("SELECT COALESCE(SUM(total_akhir), 0) FROM dokumen_penjualan WHERE MONTH(tanggal_dokumen) = MONTH(CURDATE())").Scan(&totalRevenue)
-
-		stats["total_stok"] = totalStok
-		stats["total_kebun"] = totalKebun
-		stats["total_buyer"] = totalBuyer
-		stats["pending_po"] = totalPendingPO
-		stats["revenue_month"] = totalRevenue
+// receivableFilter reads the receivables filters
+func receivableFilter(f url.Values) repository.ReceivableFilter {
+	return repository.ReceivableFilter{
+		BuyerID: f.Get("buyer_id"), StartDate: f.Get("start_date"), EndDate: f.Get("end_date"),
+	}
+}
+
+// receivableAge is the ageing bucket finance uses to follow up an invoice
+func receivableAge(umurHari int) string {
+	switch {
+	case umurHari > 90:
+		return ">90"
+	case umurHari > 60:
+		return "61-90"
+	case umurHari > 30:
+		return "31-60"
 	}
+	return "0-30"
+}
 
-	c.JSON(http.StatusOK, stats)
+// GetReceivables returns unpaid and partly paid invoices with their age, or a
+// file with ?format=xlsx|csv|pdf
+func (h *PembayaranHandler) GetReceivables(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
+	}
+
+	if format != "" {
+		sendExport(c, h.store, format, reportSources["receivables"], nil)
+		return
+	}
+
+	rows, err := h.store.Dokumen().Receivables(receivableFilter(c.Request.URL.Query()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch receivables"})
+		return
+	}
+
+	invoices := make([]map[string]interface{}, 0, len(rows))
+	perKategori := map[string]float64{"0-30": 0, "31-60": 0, "61-90": 0, ">90": 0}
+	var totalSisa float64
+	for _, inv := range rows {
+		kategori := receivableAge(inv.UmurHari)
+		sisa := round2(inv.TotalTagihan - inv.Terbayar)
+		perKategori[kategori] += sisa
+		totalSisa += sisa
+		invoices = append(invoices, map[string]interface{}{
+			"dokumen_id":      inv.DokumenID,
+			"nomor_invoice":   inv.NomorInvoice,
+			"po_number":       inv.PONumber,
+			"buyer_id":        inv.BuyerID,
+			"buyer_company":   inv.BuyerCompany,
+			"tanggal_invoice": inv.TanggalInvoice,
+			"umur_hari":       inv.UmurHari,
+			"kategori_umur":   kategori,
+			"total_tagihan":   inv.TotalTagihan,
+			"terbayar":        inv.Terbayar,
+			"sisa":            sisa,
+		})
+	}
+	for k, v := range perKategori {
+		perKategori[k] = round2(v)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invoices":     invoices,
+		"total_sisa":   round2(totalSisa),
+		"per_kategori": perKategori,
+	})
 }
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/middleware"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPermissions returns the permission registry (admin only)
+func GetPermissions(c *gin.Context) {
+	codes := make([]string, 0, len(middleware.Permissions))
+	for code := range middleware.Permissions {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	permissions := make([]gin.H, 0, len(codes))
+	for _, code := range codes {
+		permissions = append(permissions, gin.H{
+			"code":        code,
+			"description": middleware.Permissions[code],
+		})
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
+
+// GetRolePermissions returns the permissions granted to each role (admin only)
+func GetRolePermissions(c *gin.Context) {
+	rows, err := config.DB.Query(`
+		SELECT role, permission_code FROM role_permissions ORDER BY role, permission_code
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role permissions"})
+		return
+	}
+	defer rows.Close()
+
+	roles := make(map[string][]string)
+	for rows.Next() {
+		var role, code string
+		if err := rows.Scan(&role, &code); err != nil {
+			continue
+		}
+		roles[role] = append(roles[role], code)
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// UpdateRolePermissions replaces the permissions of a role (admin only)
+func UpdateRolePermissions(c *gin.Context) {
+	role := c.Param("role")
+	if !middleware.IsRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + role})
+		return
+	}
+
+	var req struct {
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, code := range req.Permissions {
+		if _, ok := middleware.Permissions[code]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + code})
+			return
+		}
+	}
+
+	// Admin always keeps every permission so nobody can lock themselves out
+	if role == "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admin permissions cannot be changed"})
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	before := rolePermissionSnapshot(tx, role)
+	if _, err := tx.Exec("DELETE FROM role_permissions WHERE role = ?", role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role permissions"})
+		return
+	}
+	for _, code := range req.Permissions {
+		if _, err := tx.Exec(`
+			INSERT IGNORE INTO role_permissions (role, permission_code) VALUES (?, ?)
+		`, role, code); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role permissions"})
+			return
+		}
+	}
+	recordAudit(tx, c, auditEvent{
+		Aksi: "update", Modul: "permission", Sebelum: before, Sesudah: rolePermissionSnapshot(tx, role),
+		Aktivitas: fmt.Sprintf("Mengubah hak akses role %s (%d permission)", role, len(req.Permissions)),
+	})
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role permissions"})
+		return
+	}
+
+	middleware.LoadPermissions()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role permissions updated successfully"})
+}
+
+// rolePermissionSnapshot lists the permissions of a role for the audit trail
+func rolePermissionSnapshot(db auditDB, role string) map[string]interface{} {
+	rows, err := db.Query("SELECT permission_code FROM role_permissions WHERE role = ? ORDER BY permission_code", role)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	codes := make([]string, 0)
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err == nil {
+			codes = append(codes, code)
+		}
+	}
+	return map[string]interface{}{"role": role, "permissions": codes}
+}
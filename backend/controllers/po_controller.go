@@ -1,185 +1,239 @@
 package controllers
 
 import (
-	"database/sql"
 	"fmt"
+	"math"
 	"net/http"
-	"sawit-backend/config"
+	"net/url"
+	"sawit-backend/domain"
+	"sawit-backend/middleware"
 	"sawit-backend/models"
+	"sawit-backend/repository"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CreatePurchaseOrder creates new purchase order
-func CreatePurchaseOrder(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+// POHandler serves purchase orders from injected repositories
+type POHandler struct {
+	store repository.Store
+}
 
-	var req models.CreatePORequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+// NewPOHandler returns a POHandler backed by store
+func NewPOHandler(store repository.Store) *POHandler {
+	return &POHandler{store: store}
+}
+
+// allocatePOStock locks and picks the batches a PO ships from. With stok_id the
+// whole order comes from that batch; with kebun_id + grade it is spread over the
+// oldest batches first (FIFO by tanggal_panen).
+func allocatePOStock(stok repository.StokRepository, req *models.CreatePORequest) ([]models.POAllocation, error) {
+	if req.StokID != 0 {
+		batch, err := stok.LockBatch(req.StokID)
+		if err == repository.ErrNotFound {
+			return nil, fail(http.StatusNotFound, "Stock not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		req.KebunID, req.Grade = batch.KebunID, batch.Grade
+		if batch.Status == "restan" || batch.Status == "expired" {
+			return nil, fail(http.StatusBadRequest, "Stock is past its freshness limit ("+batch.Status+") and can no longer be ordered")
+		}
+		if !domain.StokOrderable(batch.Status) {
+			return nil, fail(http.StatusBadRequest, "Stock not available")
+		}
+		if batch.Tersedia < req.JumlahKg {
+			return nil, fail(http.StatusBadRequest, "Insufficient stock")
+		}
+		return []models.POAllocation{{
+			StokID: batch.ID, TanggalPanen: batch.TanggalPanen, JumlahKg: req.JumlahKg, HargaPerKg: batch.HargaPerKg,
+		}}, nil
 	}
 
-	// Get stock details
-	var stok models.StokTBS
-	err := config.DB.QueryRow(`
-		SELECT id, kebun_id, jumlah_tersedia, grade, harga_per_kg, status
-		FROM stok_tbs WHERE id = ?
-	`, req.StokID).Scan(&stok.ID, &stok.KebunID, &stok.JumlahTersedia, 
-		&stok.Grade, &stok.HargaPerKg, &stok.Status)
+	if req.KebunID == 0 || req.Grade == "" {
+		return nil, fail(http.StatusBadRequest, "stok_id or kebun_id and grade are required")
+	}
 
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Stock not found"})
-		return
+	batches, err := stok.LockOpenBatches(req.KebunID, req.Grade)
+	if err != nil {
+		return nil, err
+	}
+
+	allocs := make([]models.POAllocation, 0)
+	remaining := req.JumlahKg
+	for _, batch := range batches {
+		if remaining <= 0 {
+			break
+		}
+		alloc := models.POAllocation{StokID: batch.ID, TanggalPanen: batch.TanggalPanen, HargaPerKg: batch.HargaPerKg}
+		alloc.JumlahKg = math.Min(batch.Tersedia, remaining)
+		remaining = round2(remaining - alloc.JumlahKg)
+		allocs = append(allocs, alloc)
+	}
+	if remaining > 0 {
+		return nil, fail(http.StatusBadRequest, fmt.Sprintf("Insufficient stock: only %.2f kg of grade %s available in this kebun",
+			req.JumlahKg-remaining, req.Grade))
 	}
+	return allocs, nil
+}
+
+// reservePOStock takes kg out of a locked batch for an order
+func reservePOStock(stok repository.StokRepository, stokID int, kg float64) error {
+	batch, err := stok.Lock(stokID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock"})
-		return
+		return err
 	}
+	batch, err = domain.ReserveStok(batch, kg)
+	if err != nil {
+		return err
+	}
+	return stok.Save(stokID, batch)
+}
 
-	// Check stock availability
-	if stok.Status != "available" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock not available"})
-		return
+// releasePOStock returns the stock a PO reserved. POs created before allocations
+// were recorded give the whole quantity back to their single batch.
+func releasePOStock(tx repository.Store, poID int) error {
+	allocs, err := tx.PurchaseOrders().Allocations(poID)
+	if err != nil {
+		return err
 	}
-	if stok.JumlahTersedia < req.JumlahKg {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient stock"})
-		return
+	if len(allocs) == 0 {
+		po, err := tx.PurchaseOrders().Lock(poID)
+		if err != nil {
+			return err
+		}
+		allocs = append(allocs, models.POAllocation{StokID: po.StokID, JumlahKg: po.JumlahKg})
 	}
 
-	// Generate PO number
-	var poNumber string
-	config.DB.QueryRow("CALL generate_po_number(@po_num)").Scan()
-	config.DB.QueryRow("SELECT @po_num").Scan(&poNumber)
-
-	// Get kebun location
-	var lokasiPengambilan string
-	config.DB.QueryRow("SELECT nama_kebun FROM kebun WHERE id = ?", stok.KebunID).Scan(&lokasiPengambilan)
-
-	// Insert PO
-	result, err := config.DB.Exec(`
-		INSERT INTO purchase_orders (
-			po_number, buyer_id, stok_id, kebun_id, jumlah_kg, grade_diminta,
-			harga_per_kg, total_harga, tanggal_pengambilan, lokasi_pengambilan,
-			metode_pembayaran, status, catatan
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?)
-	`, poNumber, userID, req.StokID, stok.KebunID, req.JumlahKg, stok.Grade,
-		stok.HargaPerKg, req.JumlahKg*stok.HargaPerKg, req.TanggalPengambilan,
-		lokasiPengambilan, req.MetodePembayaran, req.Catatan)
+	for _, a := range allocs {
+		batch, err := tx.Stok().Lock(a.StokID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Stok().Save(a.StokID, domain.ReleaseStok(batch, a.JumlahKg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// nextPONumber issues the next number of the day. The day's counter row stays locked
+// until the order commits, so concurrent orders wait instead of reusing a number.
+func nextPONumber(pos repository.PORepository) (string, error) {
+	now := time.Now()
+	seq, err := pos.NextSequence(now)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create purchase order"})
+		return "", err
+	}
+	return domain.PONumber(now, seq)
+}
+
+// CreatePurchaseOrder creates new purchase order
+func (h *POHandler) CreatePurchaseOrder(c *gin.Context) {
+	var req models.CreatePORequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	poID, _ := result.LastInsertId()
+	var poID int64
+	var poNumber string
+	var allocs []models.POAllocation
+	err := h.store.WithTx(func(tx repository.Store) error {
+		var err error
+
+		// Lock and pick the stock batches
+		if allocs, err = allocatePOStock(tx.Stok(), &req); err != nil {
+			return err
+		}
+
+		hargaPerKg, totalHarga, err := domain.POPricing(allocs, req.JumlahKg)
+		if err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+
+		if poNumber, err = nextPONumber(tx.PurchaseOrders()); err != nil {
+			return err
+		}
+
+		poID, err = tx.PurchaseOrders().Create(models.PurchaseOrder{
+			PONumber: poNumber, BuyerID: c.GetInt("user_id"), StokID: allocs[0].StokID, KebunID: req.KebunID,
+			JumlahKg: req.JumlahKg, GradeDiminta: req.Grade, HargaPerKg: hargaPerKg, TotalHarga: totalHarga,
+			TanggalPengambilan: req.TanggalPengambilan, MetodePembayaran: req.MetodePembayaran, Catatan: req.Catatan,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Reserve stock per batch; it is released again on rejection or cancellation
+		for _, a := range allocs {
+			if err := tx.PurchaseOrders().AddAllocation(poID, a); err != nil {
+				return err
+			}
+			if err := reservePOStock(tx.Stok(), a.StokID, a.JumlahKg); err != nil {
+				return err
+			}
+		}
 
-	// Reserve stock temporarily
-	config.DB.Exec(`
-		UPDATE stok_tbs SET jumlah_tersedia = jumlah_tersedia - ?
-		WHERE id = ?
-	`, req.JumlahKg, req.StokID)
+		recordAuditTo(tx.Logs(), c, auditEvent{
+			Aksi: "create", Entitas: "po", ID: poID,
+			Aktivitas: fmt.Sprintf("Membuat Purchase Order: %s (%.2f kg)", poNumber, req.JumlahKg),
+		})
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create purchase order")
+		return
+	}
 
+	invalidateDashboard()
 	c.JSON(http.StatusCreated, gin.H{
 		"message":   "Purchase order created successfully",
 		"po_id":     poID,
 		"po_number": poNumber,
+		"alokasi":   allocs,
 	})
 }
 
-// GetPurchaseOrders returns list of purchase orders
-func GetPurchaseOrders(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-	status := c.Query("status")
-
-	query := `
-		SELECT po.id, po.po_number, po.buyer_id, po.stok_id, po.kebun_id,
-		       po.jumlah_kg, po.grade_diminta, po.harga_per_kg, po.total_harga,
-		       po.tanggal_pengambilan, po.lokasi_pengambilan, po.metode_pembayaran,
-		       po.status, po.catatan, po.approved_by, po.approved_at,
-		       po.created_at, po.updated_at, u.company_name, k.nama_kebun,
-		       COALESCE(pb.status, 'unpaid') as payment_status
-		FROM purchase_orders po
-		JOIN users u ON po.buyer_id = u.id
-		JOIN kebun k ON po.kebun_id = k.id
-		LEFT JOIN dokumen_penjualan dp ON po.id = dp.po_id
-		LEFT JOIN pembayaran pb ON dp.id = pb.dokumen_id
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	// Filter by buyer if not admin
-	if role == "buyer" {
-		query += " AND po.buyer_id = ?"
-		args = append(args, userID)
+// purchaseOrderFilter reads the order list filters; owner limits it to one buyer
+func purchaseOrderFilter(f url.Values, owner *int) repository.POFilter {
+	return repository.POFilter{
+		Status: f.Get("status"), StartDate: f.Get("start_date"), EndDate: f.Get("end_date"), BuyerID: owner,
+	}
+}
+
+// GetPurchaseOrders returns list of purchase orders, or a file with ?format=xlsx|csv|pdf
+func (h *POHandler) GetPurchaseOrders(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
 	}
 
-	if status != "" {
-		query += " AND po.status = ?"
-		args = append(args, status)
+	// Buyers only see their own orders
+	buyerID, ok := scopeOwner(c, "po")
+	if !ok {
+		return
 	}
 
-	query += " ORDER BY po.created_at DESC"
+	if format != "" {
+		sendExport(c, h.store, format, reportSources["purchase_orders"], buyerID)
+		return
+	}
 
-	rows, err := config.DB.Query(query, args...)
+	poList, err := h.store.PurchaseOrders().List(purchaseOrderFilter(c.Request.URL.Query(), buyerID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders"})
 		return
 	}
-	defer rows.Close()
-
-	poList := make([]models.PurchaseOrder, 0)
-	for rows.Next() {
-		var po models.PurchaseOrder
-		err := rows.Scan(
-			&po.ID, &po.PONumber, &po.BuyerID, &po.StokID, &po.KebunID,
-			&po.JumlahKg, &po.GradeDiminta, &po.HargaPerKg, &po.TotalHarga,
-			&po.TanggalPengambilan, &po.LokasiPengambilan, &po.MetodePembayaran,
-			&po.Status, &po.Catatan, &po.ApprovedBy, &po.ApprovedAt,
-			&po.CreatedAt, &po.UpdatedAt, &po.BuyerCompany, &po.NamaKebun,
-			&po.PaymentStatus,
-		)
-		if err != nil {
-			continue
-		}
-		poList = append(poList, po)
-	}
 
 	c.JSON(http.StatusOK, poList)
 }
 
 // GetPurchaseOrderDetail returns detail of specific PO
-func GetPurchaseOrderDetail(c *gin.Context) {
-	poID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	var po models.PurchaseOrder
-	err := config.DB.QueryRow(`
-		SELECT po.id, po.po_number, po.buyer_id, po.stok_id, po.kebun_id,
-		       po.jumlah_kg, po.grade_diminta, po.harga_per_kg, po.total_harga,
-		       po.tanggal_pengambilan, po.lokasi_pengambilan, po.metode_pembayaran,
-		       po.status, po.catatan, po.approved_by, po.approved_at,
-		       po.created_at, po.updated_at, u.company_name, k.nama_kebun,
-		       COALESCE(pb.status, 'unpaid') as payment_status
-		FROM purchase_orders po
-		JOIN users u ON po.buyer_id = u.id
-		JOIN kebun k ON po.kebun_id = k.id
-		LEFT JOIN dokumen_penjualan dp ON po.id = dp.po_id
-		LEFT JOIN pembayaran pb ON dp.id = pb.dokumen_id
-		WHERE po.id = ?
-	`, poID).Scan(
-		&po.ID, &po.PONumber, &po.BuyerID, &po.StokID, &po.KebunID,
-		&po.JumlahKg, &po.GradeDiminta, &po.HargaPerKg, &po.TotalHarga,
-		&po.TanggalPengambilan, &po.LokasiPengambilan, &po.MetodePembayaran,
-		&po.Status, &po.Catatan, &po.ApprovedBy, &po.ApprovedAt,
-		&po.CreatedAt, &po.UpdatedAt, &po.BuyerCompany, &po.NamaKebun,
-		&po.PaymentStatus,
-	)
-
-	if err == sql.ErrNoRows {
+func (h *POHandler) GetPurchaseOrderDetail(c *gin.Context) {
+	po, err := h.store.PurchaseOrders().FindByID(int(paramID(c)))
+	if err == repository.ErrNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
 		return
 	}
@@ -188,19 +242,23 @@ func GetPurchaseOrderDetail(c *gin.Context) {
 		return
 	}
 
-	// Check authorization for buyers
-	if role == "buyer" && po.BuyerID != userID.(int) {
+	// Check authorization
+	if !canReadOwned(c, "po", po.BuyerID) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
 
+	if allocs, err := h.store.PurchaseOrders().Allocations(po.ID); err == nil {
+		po.Alokasi = allocs
+	}
+
 	c.JSON(http.StatusOK, po)
 }
 
 // UpdatePOStatus updates purchase order status (admin only)
-func UpdatePOStatus(c *gin.Context) {
-	poID := c.Param("id")
-	userID, _ := c.Get("user_id")
+func (h *POHandler) UpdatePOStatus(c *gin.Context) {
+	poID := int(paramID(c))
+	userID := c.GetInt("user_id")
 
 	var req models.UpdatePOStatusRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -208,99 +266,105 @@ func UpdatePOStatus(c *gin.Context) {
 		return
 	}
 
-	// Get current PO
-	var currentStatus string
-	err := config.DB.QueryRow("SELECT status FROM purchase_orders WHERE id = ?", poID).Scan(&currentStatus)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
-		return
-	}
+	err := h.store.WithTx(func(tx repository.Store) error {
+		// Get current PO
+		po, err := tx.PurchaseOrders().Lock(poID)
+		if err == repository.ErrNotFound {
+			return fail(http.StatusNotFound, "Purchase order not found")
+		}
+		if err != nil {
+			return err
+		}
+		releaseStock, err := domain.POTransition(po.Status, req.Status)
+		if err != nil {
+			return fail(http.StatusBadRequest, fmt.Sprintf("Cannot change status from %s to %s", po.Status, req.Status))
+		}
+		before := snapshotOf(tx.Logs(), "po", int64(poID))
+
+		// Stock was reserved when the order was placed, so approval leaves it untouched
+		var approvedBy *int
+		var approvedAt *time.Time
+		if req.Status == "approved" {
+			now := time.Now()
+			approvedBy, approvedAt = &userID, &now
+		}
+		if err := tx.PurchaseOrders().UpdateStatus(poID, req.Status, req.Catatan, approvedBy, approvedAt); err != nil {
+			return err
+		}
 
-	// Update PO status
-	if req.Status == "approved" {
-		now := time.Now()
-		_, err = config.DB.Exec(`
-			UPDATE purchase_orders 
-			SET status = ?, catatan = ?, approved_by = ?, approved_at = ?
-			WHERE id = ?
-		`, req.Status, req.Catatan, userID, now, poID)
-	} else {
-		_, err = config.DB.Exec(`
-			UPDATE purchase_orders 
-			SET status = ?, catatan = ?
-			WHERE id = ?
-		`, req.Status, req.Catatan, poID)
-	}
+		// A rejected order gives its reserved stock back
+		if releaseStock {
+			if err := releasePOStock(tx, poID); err != nil {
+				return err
+			}
+		}
 
+		recordAuditTo(tx.Logs(), c, auditEvent{
+			Aksi: req.Status, Entitas: "po", ID: int64(poID), Sebelum: before,
+			Aktivitas: fmt.Sprintf("Update status PO menjadi %s", req.Status),
+		})
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order"})
+		respondError(c, err, "Failed to update purchase order")
 		return
 	}
 
-	// If rejected, restore stock
-	if req.Status == "rejected" && currentStatus == "pending" {
-		config.DB.Exec(`
-			UPDATE stok_tbs s
-			JOIN purchase_orders po ON s.id = po.stok_id
-			SET s.jumlah_tersedia = s.jumlah_tersedia + po.jumlah_kg
-			WHERE po.id = ?
-		`, poID)
-	}
-
-	// Log aktivitas
-	config.DB.Exec(`
-		INSERT INTO log_aktivitas (user_id, aktivitas, modul, reference_id, ip_address)
-		VALUES (?, ?, 'po', ?, ?)
-	`, userID, fmt.Sprintf("Update status PO menjadi %s", req.Status), poID, c.ClientIP())
-
+	invalidateDashboard()
 	c.JSON(http.StatusOK, gin.H{"message": "Purchase order updated successfully"})
 }
 
 // CancelPurchaseOrder cancels a purchase order
-func CancelPurchaseOrder(c *gin.Context) {
-	poID := c.Param("id")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-
-	// Get PO details
-	var po models.PurchaseOrder
-	err := config.DB.QueryRow(`
-		SELECT id, buyer_id, stok_id, jumlah_kg, status
-		FROM purchase_orders WHERE id = ?
-	`, poID).Scan(&po.ID, &po.BuyerID, &po.StokID, &po.JumlahKg, &po.Status)
-
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
-		return
-	}
+func (h *POHandler) CancelPurchaseOrder(c *gin.Context) {
+	poID := int(paramID(c))
+	userID := c.GetInt("user_id")
+
+	err := h.store.WithTx(func(tx repository.Store) error {
+		// Get PO details
+		po, err := tx.PurchaseOrders().Lock(poID)
+		if err == repository.ErrNotFound {
+			return fail(http.StatusNotFound, "Purchase order not found")
+		}
+		if err != nil {
+			return err
+		}
 
-	// Check authorization
-	if role == "buyer" && po.BuyerID != userID.(int) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
+		// Check authorization
+		if !middleware.HasPermission(c, middleware.PermPOCancel) && po.BuyerID != userID {
+			return fail(http.StatusForbidden, "Access denied")
+		}
 
-	// Check if can be cancelled
-	if po.Status != "pending" && po.Status != "approved" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot cancel this purchase order"})
-		return
-	}
+		// Check if can be cancelled
+		releaseStock, err := domain.POTransition(po.Status, "cancelled")
+		if err != nil {
+			return fail(http.StatusBadRequest, "Cannot cancel this purchase order")
+		}
+
+		before := snapshotOf(tx.Logs(), "po", int64(poID))
 
-	// Update status to cancelled
-	_, err = config.DB.Exec(`
-		UPDATE purchase_orders SET status = 'cancelled' WHERE id = ?
-	`, poID)
+		// Update status to cancelled
+		if err := tx.PurchaseOrders().SetStatus(poID, "cancelled"); err != nil {
+			return err
+		}
 
+		// Restore stock
+		if releaseStock {
+			if err := releasePOStock(tx, poID); err != nil {
+				return err
+			}
+		}
+
+		recordAuditTo(tx.Logs(), c, auditEvent{
+			Aksi: "cancel", Entitas: "po", ID: int64(poID), Sebelum: before,
+			Aktivitas: "Membatalkan Purchase Order",
+		})
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel purchase order"})
+		respondError(c, err, "Failed to cancel purchase order")
 		return
 	}
 
-	// Restore stock
-	config.DB.Exec(`
-		UPDATE stok_tbs SET jumlah_tersedia = jumlah_tersedia + ?
-		WHERE id = ?
-	`, po.JumlahKg, po.StokID)
-
+	invalidateDashboard()
 	c.JSON(http.StatusOK, gin.H{"message": "Purchase order cancelled successfully"})
 }
@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"sawit-backend/config"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gradeRank orders grades from best to worst; a higher rank at weigh-out is a downgrade
+var gradeRank = map[string]int{"A": 1, "B": 2, "C": 3}
+
+// qualityDelivery is one completed weigh-out with the grades expected for it
+type qualityDelivery struct {
+	KebunID      int
+	NamaKebun    string
+	TanggalPanen string
+	GradeStok    string
+	GradeDiminta string
+	GradeAktual  string
+	KadarAir     sql.NullFloat64
+	KadarSampah  sql.NullFloat64
+	Kematangan   string
+	WaktuKeluar  time.Time
+	BeratBersih  float64
+	Penyesuaian  float64
+}
+
+func (d qualityDelivery) downgraded() bool {
+	return gradeRank[d.GradeAktual] > gradeRank[d.GradeDiminta]
+}
+
+// qualityStats accumulates grade outcomes and lab values for a group of deliveries
+type qualityStats struct {
+	info              gin.H
+	jumlah            int
+	kg                float64
+	sesuaiPO          int
+	sesuaiStok        int
+	downgrade         int
+	upgrade           int
+	kgDowngrade       float64
+	air, sampah       float64
+	nAir, nSampah     int
+	kerugian          float64
+	beruntun          int // current run of consecutive downgrades
+	beruntunMaks      int
+	downgradeTerakhir *time.Time
+}
+
+func (q *qualityStats) add(d qualityDelivery) {
+	q.jumlah++
+	q.kg += d.BeratBersih
+	if d.GradeAktual == d.GradeDiminta {
+		q.sesuaiPO++
+	}
+	if d.GradeAktual == d.GradeStok {
+		q.sesuaiStok++
+	}
+	switch {
+	case d.downgraded():
+		q.downgrade++
+		q.kgDowngrade += d.BeratBersih
+		q.beruntun++
+		if q.beruntun > q.beruntunMaks {
+			q.beruntunMaks = q.beruntun
+		}
+		t := d.WaktuKeluar
+		q.downgradeTerakhir = &t
+	case gradeRank[d.GradeAktual] < gradeRank[d.GradeDiminta]:
+		q.upgrade++
+		q.beruntun = 0
+	default:
+		q.beruntun = 0
+	}
+	// Moisture is never 0 in fresh fruit bunches, so 0 means it was not measured
+	if d.KadarAir.Valid && d.KadarAir.Float64 > 0 {
+		q.air += d.KadarAir.Float64
+		q.nAir++
+	}
+	if d.KadarSampah.Valid {
+		q.sampah += d.KadarSampah.Float64
+		q.nSampah++
+	}
+	if d.Penyesuaian < 0 {
+		q.kerugian -= d.Penyesuaian
+	}
+}
+
+func (q *qualityStats) downgradePersen() float64 {
+	if q.jumlah == 0 {
+		return 0
+	}
+	return float64(q.downgrade) / float64(q.jumlah) * 100
+}
+
+func (q *qualityStats) toJSON() gin.H {
+	pct := func(n int) float64 {
+		if q.jumlah == 0 {
+			return 0
+		}
+		return round2(float64(n) / float64(q.jumlah) * 100)
+	}
+	row := gin.H{
+		"jumlah_pengiriman":  q.jumlah,
+		"berat_bersih_kg":    round2(q.kg),
+		"sesuai_po_persen":   pct(q.sesuaiPO),
+		"sesuai_stok_persen": pct(q.sesuaiStok),
+		"downgrade":          q.downgrade,
+		"downgrade_persen":   round2(q.downgradePersen()),
+		"upgrade":            q.upgrade,
+		"kg_downgrade":       round2(q.kgDowngrade),
+		"rata_kadar_air":     nil,
+		"rata_kadar_sampah":  nil,
+		"kerugian_rp":        round2(q.kerugian),
+	}
+	if q.nAir > 0 {
+		row["rata_kadar_air"] = round2(q.air / float64(q.nAir))
+	}
+	if q.nSampah > 0 {
+		row["rata_kadar_sampah"] = round2(q.sampah / float64(q.nSampah))
+	}
+	for k, v := range q.info {
+		row[k] = v
+	}
+	return row
+}
+
+func loadQualityDeliveries(start, end time.Time, kebunID string) ([]qualityDelivery, error) {
+	query := `
+		SELECT po.kebun_id, k.nama_kebun, DATE_FORMAT(s.tanggal_panen, '%Y-%m-%d'), s.grade, po.grade_diminta,
+		       t.grade_aktual, t.kadar_air, t.kadar_sampah, COALESCE(t.tingkat_kematangan, ''), t.waktu_keluar,
+		       COALESCE(t.berat_bersih, 0), COALESCE(dp.penyesuaian_harga, 0)
+		FROM timbangan t
+		JOIN purchase_orders po ON t.po_id = po.id
+		JOIN kebun k ON po.kebun_id = k.id
+		JOIN stok_tbs s ON po.stok_id = s.id
+		LEFT JOIN dokumen_penjualan dp ON dp.timbang_id = t.id
+		WHERE t.status = 'completed' AND t.grade_aktual IS NOT NULL
+		  AND t.waktu_keluar >= ? AND t.waktu_keluar < ?
+	`
+	args := []interface{}{start, end.AddDate(0, 0, 1)}
+	if kebunID != "" {
+		query += " AND po.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	query += " ORDER BY t.waktu_keluar, t.id"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []qualityDelivery
+	for rows.Next() {
+		var d qualityDelivery
+		if err := rows.Scan(&d.KebunID, &d.NamaKebun, &d.TanggalPanen, &d.GradeStok, &d.GradeDiminta,
+			&d.GradeAktual, &d.KadarAir, &d.KadarSampah, &d.Kematangan, &d.WaktuKeluar,
+			&d.BeratBersih, &d.Penyesuaian); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// qualityBucket returns the trend bucket label of a weigh-out, matching salesBucketLabels
+func qualityBucket(interval string, t time.Time) string {
+	switch interval {
+	case "day":
+		return t.Format("2006-01-02")
+	case "month":
+		return t.Format("2006-01")
+	}
+	return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7)).Format("2006-01-02")
+}
+
+// GetQualityReport compares stock and ordered grades with the grade found at
+// weigh-out per kebun and harvest date, trends moisture and dirt content,
+// totals the rupiah lost to quality adjustments and flags kebun with
+// repeated downgrades
+func GetQualityReport(c *gin.Context) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	start := end.AddDate(0, 0, -89)
+	var err error
+	if s := c.Query("start_date"); s != "" {
+		if start, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be YYYY-MM-DD"})
+			return
+		}
+	}
+	if s := c.Query("end_date"); s != "" {
+		if end, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be YYYY-MM-DD"})
+			return
+		}
+	}
+	if end.Before(start) || end.Sub(start) > 3*366*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must not be after end_date and the range cannot exceed 36 months"})
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "week")
+	if interval != "day" && interval != "week" && interval != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return
+	}
+
+	minDowngrade := config.AppConfig.QualityFlagMin
+	if v := c.Query("min_downgrade"); v != "" {
+		if minDowngrade, err = strconv.Atoi(v); err != nil || minDowngrade < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_downgrade must be a positive number"})
+			return
+		}
+	}
+	threshold := float64(config.AppConfig.QualityFlagPct)
+	if v := c.Query("threshold"); v != "" {
+		if threshold, err = strconv.ParseFloat(v, 64); err != nil || threshold < 0 || threshold > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a percentage between 0 and 100"})
+			return
+		}
+	}
+
+	deliveries, err := loadQualityDeliveries(start, end, c.Query("kebun_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quality data"})
+		return
+	}
+
+	total := &qualityStats{}
+	perKebun := make(map[int]*qualityStats)
+	perPanen := make(map[string]*qualityStats)
+	perPeriode := make(map[string]*qualityStats)
+	var kebunOrder []int
+	var panenOrder []string
+
+	grades := []string{"A", "B", "C"}
+	matrix := func() map[string]map[string]int {
+		m := make(map[string]map[string]int)
+		for _, from := range grades {
+			m[from] = map[string]int{"A": 0, "B": 0, "C": 0}
+		}
+		return m
+	}
+	matriksPO, matriksStok := matrix(), matrix()
+	kematangan := make(map[string]int)
+
+	for _, d := range deliveries {
+		if perKebun[d.KebunID] == nil {
+			perKebun[d.KebunID] = &qualityStats{info: gin.H{"kebun_id": d.KebunID, "nama_kebun": d.NamaKebun}}
+			kebunOrder = append(kebunOrder, d.KebunID)
+		}
+		panenKey := d.TanggalPanen + "|" + strconv.Itoa(d.KebunID)
+		if perPanen[panenKey] == nil {
+			perPanen[panenKey] = &qualityStats{info: gin.H{
+				"tanggal_panen": d.TanggalPanen, "kebun_id": d.KebunID, "nama_kebun": d.NamaKebun,
+			}}
+			panenOrder = append(panenOrder, panenKey)
+		}
+		bucket := qualityBucket(interval, d.WaktuKeluar)
+		if perPeriode[bucket] == nil {
+			perPeriode[bucket] = &qualityStats{info: gin.H{"periode": bucket}}
+		}
+
+		total.add(d)
+		perKebun[d.KebunID].add(d)
+		perPanen[panenKey].add(d)
+		perPeriode[bucket].add(d)
+
+		if m, ok := matriksPO[d.GradeDiminta]; ok {
+			m[d.GradeAktual]++
+		}
+		if m, ok := matriksStok[d.GradeStok]; ok {
+			m[d.GradeAktual]++
+		}
+		if d.Kematangan != "" {
+			kematangan[d.Kematangan]++
+		}
+	}
+
+	sort.Slice(kebunOrder, func(i, j int) bool {
+		return perKebun[kebunOrder[i]].info["nama_kebun"].(string) < perKebun[kebunOrder[j]].info["nama_kebun"].(string)
+	})
+	kebunList := make([]gin.H, 0, len(kebunOrder))
+	flagged := make([]gin.H, 0)
+	for _, id := range kebunOrder {
+		q := perKebun[id]
+		row := q.toJSON()
+		row["downgrade_beruntun_maks"] = q.beruntunMaks
+		row["perlu_tindakan"] = false
+		if q.downgrade >= minDowngrade && q.downgradePersen() >= threshold {
+			row["perlu_tindakan"] = true
+			flagged = append(flagged, gin.H{
+				"kebun_id":                id,
+				"nama_kebun":              q.info["nama_kebun"],
+				"downgrade":               q.downgrade,
+				"downgrade_persen":        round2(q.downgradePersen()),
+				"downgrade_beruntun_maks": q.beruntunMaks,
+				"downgrade_terakhir":      q.downgradeTerakhir,
+				"kerugian_rp":             round2(q.kerugian),
+			})
+		}
+		kebunList = append(kebunList, row)
+	}
+	sort.SliceStable(flagged, func(i, j int) bool {
+		return flagged[i]["downgrade_persen"].(float64) > flagged[j]["downgrade_persen"].(float64)
+	})
+
+	sort.Strings(panenOrder)
+	panenList := make([]gin.H, 0, len(panenOrder))
+	for _, key := range panenOrder {
+		panenList = append(panenList, perPanen[key].toJSON())
+	}
+
+	// Trend over every bucket in the range so charts show the gaps
+	tren := make([]gin.H, 0)
+	for _, label := range salesBucketLabels(interval, start, end) {
+		q := perPeriode[label]
+		if q == nil {
+			q = &qualityStats{info: gin.H{"periode": label}}
+		}
+		tren = append(tren, q.toJSON())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":            gin.H{"start_date": start.Format("2006-01-02"), "end_date": end.Format("2006-01-02")},
+		"interval":          interval,
+		"kriteria":          gin.H{"min_downgrade": minDowngrade, "threshold_persen": threshold},
+		"ringkasan":         total.toJSON(),
+		"per_kebun":         kebunList,
+		"per_tanggal_panen": panenList,
+		"tren":              tren,
+		"matriks_grade": gin.H{
+			"diminta_ke_aktual": matriksPO,
+			"stok_ke_aktual":    matriksStok,
+		},
+		"tingkat_kematangan": kematangan,
+		"kebun_bermasalah":   flagged,
+	})
+}
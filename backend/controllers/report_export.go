@@ -0,0 +1,311 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sawit-backend/config"
+	"sawit-backend/export"
+	"sawit-backend/middleware"
+	"sawit-backend/repository"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportSource is a list or report that can be downloaded and scheduled.
+// rows loads it through the repositories from the same filters as the JSON
+// endpoint, limited to the records of owner when owner is not nil.
+type reportSource struct {
+	name       string // File name prefix
+	title      string
+	permission string // Needed to schedule the report
+	columns    []export.Column
+	rows       func(store repository.Store, f url.Values, owner *int) ([][]interface{}, error)
+}
+
+var reportSources = map[string]reportSource{
+	"daily_sales": {
+		name:       "laporan-penjualan",
+		title:      "Laporan Penjualan Harian",
+		permission: middleware.PermReportSales,
+		columns: []export.Column{
+			{Header: "Tanggal", Kind: export.Date},
+			{Header: "Transaksi", Kind: export.Number, Total: true},
+			{Header: "Total (kg)", Kind: export.Number, Total: true},
+			{Header: "Pendapatan (Rp)", Kind: export.Money, Total: true, Width: 1.4},
+			{Header: "Rata-rata Harga/kg", Kind: export.Money},
+			{Header: "Grade A (kg)", Kind: export.Number, Total: true},
+			{Header: "Grade B (kg)", Kind: export.Number, Total: true},
+			{Header: "Grade C (kg)", Kind: export.Number, Total: true},
+		},
+		rows: func(store repository.Store, f url.Values, owner *int) ([][]interface{}, error) {
+			sales, err := store.Dokumen().DailySales(salesFilter(f))
+			cells := make([][]interface{}, 0, len(sales))
+			for _, d := range sales {
+				cells = append(cells, []interface{}{d.Tanggal, d.JumlahTransaksi, d.TotalKg, d.TotalPendapatan,
+					d.RataRataHarga, d.GradeA, d.GradeB, d.GradeC})
+			}
+			return cells, err
+		},
+	},
+	"receivables": {
+		name:       "laporan-piutang",
+		title:      "Laporan Piutang Pembeli",
+		permission: middleware.PermReportSales,
+		columns: []export.Column{
+			{Header: "No. Invoice", Kind: export.Text, Width: 1.3},
+			{Header: "No. PO", Kind: export.Text, Width: 1.2},
+			{Header: "Pembeli", Kind: export.Text, Width: 1.5},
+			{Header: "Tanggal Invoice", Kind: export.Date},
+			{Header: "Umur (hari)", Kind: export.Number, Width: 0.7},
+			{Header: "Kategori", Kind: export.Text, Width: 0.8},
+			{Header: "Tagihan (Rp)", Kind: export.Money, Total: true, Width: 1.3},
+			{Header: "Terbayar (Rp)", Kind: export.Money, Total: true, Width: 1.3},
+			{Header: "Sisa (Rp)", Kind: export.Money, Total: true, Width: 1.3},
+		},
+		rows: func(store repository.Store, f url.Values, owner *int) ([][]interface{}, error) {
+			invoices, err := store.Dokumen().Receivables(receivableFilter(f))
+			cells := make([][]interface{}, 0, len(invoices))
+			for _, inv := range invoices {
+				cells = append(cells, []interface{}{inv.NomorInvoice, inv.PONumber, inv.BuyerCompany, inv.TanggalInvoice,
+					inv.UmurHari, receivableAge(inv.UmurHari), inv.TotalTagihan, inv.Terbayar,
+					round2(inv.TotalTagihan - inv.Terbayar)})
+			}
+			return cells, err
+		},
+	},
+	"stok": {
+		name:       "laporan-stok",
+		title:      "Laporan Stok TBS",
+		permission: middleware.PermStokRead,
+		columns: []export.Column{
+			{Header: "ID", Kind: export.Text, Width: 0.5},
+			{Header: "Kebun", Kind: export.Text, Width: 1.4},
+			{Header: "Blok", Kind: export.Text, Width: 0.6},
+			{Header: "Tanggal Panen", Kind: export.Date},
+			{Header: "Grade", Kind: export.Text, Width: 0.5},
+			{Header: "Jumlah (kg)", Kind: export.Number, Total: true},
+			{Header: "Tersedia (kg)", Kind: export.Number, Total: true},
+			{Header: "Kadar Minyak (%)", Kind: export.Number, Width: 0.8},
+			{Header: "Harga/kg", Kind: export.Money},
+			{Header: "Nilai Tersedia (Rp)", Kind: export.Money, Total: true, Width: 1.3},
+			{Header: "Status", Kind: export.Text, Width: 0.8},
+		},
+		rows: func(store repository.Store, f url.Values, owner *int) ([][]interface{}, error) {
+			stokList, err := store.Stok().List(stokFilter(f))
+			cells := make([][]interface{}, 0, len(stokList))
+			for _, stok := range stokList {
+				cells = append(cells, []interface{}{stok.ID, stok.NamaKebun, stok.KodeBlok, stok.TanggalPanen, stok.Grade,
+					stok.JumlahKg, stok.JumlahTersedia, stok.KadarMinyak, stok.HargaPerKg,
+					round2(stok.JumlahTersedia * stok.HargaPerKg), stok.Status})
+			}
+			return cells, err
+		},
+	},
+	"purchase_orders": {
+		name:       "laporan-po",
+		title:      "Laporan Purchase Order",
+		permission: middleware.PermPORead,
+		columns: []export.Column{
+			{Header: "No. PO", Kind: export.Text, Width: 1.2},
+			{Header: "Tanggal", Kind: export.Date},
+			{Header: "Pembeli", Kind: export.Text, Width: 1.4},
+			{Header: "Kebun", Kind: export.Text, Width: 1.3},
+			{Header: "Grade", Kind: export.Text, Width: 0.5},
+			{Header: "Jumlah (kg)", Kind: export.Number, Total: true},
+			{Header: "Harga/kg", Kind: export.Money},
+			{Header: "Total (Rp)", Kind: export.Money, Total: true, Width: 1.4},
+			{Header: "Pengambilan", Kind: export.Date},
+			{Header: "Status", Kind: export.Text, Width: 0.8},
+			{Header: "Pembayaran", Kind: export.Text, Width: 0.8},
+		},
+		rows: func(store repository.Store, f url.Values, owner *int) ([][]interface{}, error) {
+			poList, err := store.PurchaseOrders().List(purchaseOrderFilter(f, owner))
+			cells := make([][]interface{}, 0, len(poList))
+			for _, po := range poList {
+				cells = append(cells, []interface{}{po.PONumber, po.CreatedAt, po.BuyerCompany, po.NamaKebun, po.GradeDiminta,
+					po.JumlahKg, po.HargaPerKg, po.TotalHarga, po.TanggalPengambilan, po.Status, po.PaymentStatus})
+			}
+			return cells, err
+		},
+	},
+	"timbangan": {
+		name:       "laporan-timbangan",
+		title:      "Laporan Timbangan",
+		permission: middleware.PermTimbanganRead,
+		columns: []export.Column{
+			{Header: "ID", Kind: export.Text, Width: 0.5},
+			{Header: "PO", Kind: export.Text, Width: 0.6},
+			{Header: "Plat Nomor", Kind: export.Text},
+			{Header: "Waktu Masuk", Kind: export.Text, Width: 1.2},
+			{Header: "Waktu Keluar", Kind: export.Text, Width: 1.2},
+			{Header: "Berat Masuk (kg)", Kind: export.Number, Total: true},
+			{Header: "Berat Keluar (kg)", Kind: export.Number, Total: true},
+			{Header: "Berat Bersih (kg)", Kind: export.Number, Total: true},
+			{Header: "Grade", Kind: export.Text, Width: 0.5},
+			{Header: "Kadar Air (%)", Kind: export.Number, Width: 0.8},
+			{Header: "Kadar Sampah (%)", Kind: export.Number, Width: 0.8},
+			{Header: "Status", Kind: export.Text, Width: 0.8},
+		},
+		rows: func(store repository.Store, f url.Values, owner *int) ([][]interface{}, error) {
+			timbangList, err := store.Timbangan().List(timbanganFilter(f, owner))
+			cells := make([][]interface{}, 0, len(timbangList))
+			for _, t := range timbangList {
+				cells = append(cells, []interface{}{t.ID, fmt.Sprintf("PO-%d", t.POID), t.PlatNomor, t.WaktuMasuk, t.WaktuKeluar,
+					t.BeratMasuk, t.BeratKeluar, t.BeratBersih, t.GradeAktual.String, t.KadarAir, t.KadarSampah, t.Status})
+			}
+			return cells, err
+		},
+	},
+	"pembayaran": {
+		name:       "laporan-pembayaran",
+		title:      "Laporan Pembayaran",
+		permission: middleware.PermPembayaranRead,
+		columns: []export.Column{
+			{Header: "No. Invoice", Kind: export.Text, Width: 1.3},
+			{Header: "PO", Kind: export.Text, Width: 0.6},
+			{Header: "Pembeli", Kind: export.Text, Width: 1.3},
+			{Header: "Tanggal Bayar", Kind: export.Date},
+			{Header: "Jatuh Tempo", Kind: export.Date},
+			{Header: "Metode", Kind: export.Text},
+			{Header: "Bank", Kind: export.Text},
+			{Header: "Pengirim", Kind: export.Text, Width: 1.3},
+			{Header: "Status", Kind: export.Text},
+			{Header: "Jumlah (Rp)", Kind: export.Money, Total: true, Width: 1.4},
+		},
+		rows: func(store repository.Store, f url.Values, owner *int) ([][]interface{}, error) {
+			payments, err := store.Pembayaran().List(pembayaranFilter(f, owner))
+			cells := make([][]interface{}, 0, len(payments))
+			for _, p := range payments {
+				cells = append(cells, []interface{}{p.NomorInvoice, fmt.Sprintf("PO-%d", p.POID), p.BuyerName,
+					p.TanggalBayar, p.TanggalJatuhTempo, p.MetodePembayaran, p.BankPengirim,
+					p.NamaPengirim, p.Status, p.JumlahBayar})
+			}
+			return cells, err
+		},
+	},
+}
+
+// exportFormat returns the requested ?format=, or "" for the normal JSON response.
+// It writes a 400 response and returns false for an unknown format.
+func exportFormat(c *gin.Context) (string, bool) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" || format == "json" {
+		return "", true
+	}
+	if !export.Supported(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be xlsx, csv or pdf"})
+		return "", false
+	}
+	return format, true
+}
+
+// periodLabel describes the start_date/end_date filter for the report header
+func periodLabel(f url.Values) string {
+	start, end := f.Get("start_date"), f.Get("end_date")
+	switch {
+	case start != "" && end != "":
+		return "Periode: " + start + " s/d " + end
+	case start != "":
+		return "Periode: sejak " + start
+	case end != "":
+		return "Periode: sampai " + end
+	}
+	return "Periode: semua data"
+}
+
+func (src reportSource) report(f url.Values) export.Report {
+	return export.Report{
+		Company:  config.AppConfig.CompanyName,
+		Address:  config.AppConfig.CompanyAddress,
+		Title:    src.title,
+		Subtitle: periodLabel(f),
+		Columns:  src.columns,
+	}
+}
+
+func (src reportSource) filename(format string) string {
+	return src.name + "-" + time.Now().Format("20060102") + "." + format
+}
+
+// writeRows copies the report rows into w
+func (src reportSource) writeRows(w export.Writer, cells [][]interface{}) (int, error) {
+	for i, values := range cells {
+		if err := w.Row(values...); err != nil {
+			return i, err
+		}
+	}
+	return len(cells), nil
+}
+
+// sendExport loads the report for owner and writes it as a file download
+func sendExport(c *gin.Context, store repository.Store, format string, src reportSource, owner *int) {
+	cells, err := src.rows(store, c.Request.URL.Query(), owner)
+	if err != nil {
+		log.Printf("Export %s - query error: %v", src.name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report"})
+		return
+	}
+
+	setHeaders := func() {
+		c.Header("Content-Type", export.ContentType(format))
+		c.Header("Content-Disposition", "attachment; filename="+src.filename(format))
+		c.Header("Cache-Control", "no-store")
+	}
+
+	// CSV is written to the response as rows are added; XLSX and PDF are only sent
+	// on Close, so an error before then can still be reported as JSON
+	if format == "csv" {
+		setHeaders()
+	}
+	w, err := export.New(format, c.Writer, src.report(c.Request.URL.Query()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export"})
+		return
+	}
+
+	if _, err := src.writeRows(w, cells); err != nil {
+		if errors.Is(err, export.ErrTooManyRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Export %s - write error: %v", src.name, err)
+		return
+	}
+
+	if format != "csv" {
+		setHeaders()
+	}
+	if err := w.Close(); err != nil {
+		log.Printf("Export %s - write error: %v", src.name, err)
+	}
+}
+
+// renderReport runs a report without a request, e.g. for scheduled delivery.
+// Scheduled reports are restricted by permission when they are created, so
+// they cover every buyer.
+func renderReport(store repository.Store, src reportSource, f url.Values, format string) ([]byte, int, error) {
+	cells, err := src.rows(store, f, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var buf bytes.Buffer
+	w, err := export.New(format, &buf, src.report(f))
+	if err != nil {
+		return nil, 0, err
+	}
+	count, err := src.writeRows(w, cells)
+	if err != nil {
+		return nil, count, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, count, err
+	}
+	return buf.Bytes(), count, nil
+}
@@ -0,0 +1,540 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sawit-backend/config"
+	"sawit-backend/cron"
+	"sawit-backend/export"
+	"sawit-backend/mailer"
+	"sawit-backend/middleware"
+	"sawit-backend/models"
+	"sawit-backend/repository"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportPeriods are the relative date ranges a schedule can use instead of fixed dates
+var reportPeriods = map[string]bool{
+	"today": true, "yesterday": true, "last_7_days": true,
+	"last_week": true, "month_to_date": true, "last_month": true,
+}
+
+// StartReportScheduler delivers due report schedules every ReportInterval seconds.
+// Cron expressions are evaluated in the server's local time.
+func StartReportScheduler() {
+	interval := config.AppConfig.ReportInterval
+	if interval <= 0 {
+		log.Println("Report scheduler disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := runDueReports(time.Now()); err != nil {
+				log.Printf("Report scheduler failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// runDueReports sends every active schedule whose next_run_at has passed.
+// A schedule is claimed by moving next_run_at forward first, so a run is
+// never delivered twice when several instances share the database.
+func runDueReports(now time.Time) error {
+	rows, err := config.DB.Query(`
+		SELECT id, cron_expr, next_run_at FROM report_schedules
+		WHERE is_active = TRUE AND (next_run_at IS NULL OR next_run_at <= ?)
+		ORDER BY next_run_at
+	`, now)
+	if err != nil {
+		return err
+	}
+
+	type dueSchedule struct {
+		id      int
+		expr    string
+		nextRun sql.NullTime
+	}
+	var due []dueSchedule
+	for rows.Next() {
+		var d dueSchedule
+		if err := rows.Scan(&d.id, &d.expr, &d.nextRun); err == nil {
+			due = append(due, d)
+		}
+	}
+	rows.Close()
+
+	for _, d := range due {
+		var next interface{}
+		if sched, err := cron.Parse(d.expr); err == nil {
+			if t := sched.Next(now); !t.IsZero() {
+				next = t
+			}
+		}
+
+		result, err := config.DB.Exec(`
+			UPDATE report_schedules SET next_run_at = ?, is_active = ?
+			WHERE id = ? AND next_run_at <=> ?
+		`, next, next != nil, d.id, d.nextRun)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected != 1 {
+			continue
+		}
+		if next == nil {
+			log.Printf("Report schedule %d deactivated: cron %q never fires", d.id, d.expr)
+			continue
+		}
+		// Schedules without next_run_at were just activated; they start at the next tick
+		if !d.nextRun.Valid {
+			continue
+		}
+
+		schedule, err := getReportSchedule(d.id)
+		if err != nil {
+			log.Printf("Report schedule %d: %v", d.id, err)
+			continue
+		}
+		run := deliverReport(schedule, nil, now)
+		if run.Status == "failed" {
+			log.Printf("Report schedule %d failed: %s", d.id, *run.ErrorMessage)
+		}
+	}
+	return nil
+}
+
+// deliverReport renders a schedule's report and emails it to the recipients,
+// recording the attempt in report_schedule_runs
+func deliverReport(schedule models.ReportSchedule, triggeredBy interface{}, now time.Time) models.ReportScheduleRun {
+	run := models.ReportScheduleRun{
+		ScheduleID: schedule.ID,
+		StartedAt:  now,
+		Status:     "running",
+		Recipients: strings.Join(schedule.Recipients, ","),
+	}
+	if id, ok := triggeredBy.(int); ok {
+		run.TriggeredBy = &id
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO report_schedule_runs (schedule_id, started_at, status, recipients, triggered_by)
+		VALUES (?, ?, 'running', ?, ?)
+	`, schedule.ID, now, run.Recipients, triggeredBy)
+	if err == nil {
+		id, _ := result.LastInsertId()
+		run.ID = int(id)
+	}
+
+	err = sendScheduledReport(schedule, now, &run)
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Status = "success"
+	if err != nil {
+		msg := err.Error()
+		run.Status = "failed"
+		run.ErrorMessage = &msg
+	}
+
+	config.DB.Exec(`
+		UPDATE report_schedule_runs SET finished_at = ?, status = ?, row_count = ?, file_name = ?, error_message = ?
+		WHERE id = ?
+	`, finished, run.Status, run.RowCount, run.FileName, run.ErrorMessage, run.ID)
+	config.DB.Exec(`
+		UPDATE report_schedules SET last_run_at = ?, last_status = ? WHERE id = ?
+	`, now, run.Status, schedule.ID)
+
+	return run
+}
+
+func sendScheduledReport(schedule models.ReportSchedule, now time.Time, run *models.ReportScheduleRun) error {
+	src, ok := reportSources[schedule.ReportType]
+	if !ok {
+		return fmt.Errorf("unknown report type %q", schedule.ReportType)
+	}
+	filters := reportFilters(schedule.Filters, now)
+
+	data, count, err := renderReport(repository.NewStore(config.DB), src, filters, schedule.Format)
+	run.RowCount = count
+	if err != nil {
+		return fmt.Errorf("render report: %w", err)
+	}
+
+	filename := src.filename(schedule.Format)
+	run.FileName = &filename
+
+	err = mailer.Client.Send(mailer.Message{
+		To:      schedule.Recipients,
+		Subject: fmt.Sprintf("%s - %s", src.title, schedule.Nama),
+		Body: fmt.Sprintf("Terlampir %s (%s).\n%s\nJumlah baris: %d\n\n"+
+			"Email ini dikirim otomatis oleh Sistem Informasi Perkebunan Sawit.\n",
+			src.title, schedule.Nama, periodLabel(filters), count),
+		Attachments: []mailer.Attachment{{
+			Filename:    filename,
+			ContentType: export.ContentType(schedule.Format),
+			Data:        data,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("send mail: %w", err)
+	}
+	return nil
+}
+
+// reportFilters turns saved filters into report query parameters, replacing
+// "period" with the start_date/end_date it covers on the given day
+func reportFilters(saved map[string]string, now time.Time) url.Values {
+	f := url.Values{}
+	for k, v := range saved {
+		if k != "period" && v != "" {
+			f.Set(k, v)
+		}
+	}
+	if period := saved["period"]; period != "" {
+		start, end := resolvePeriod(period, now)
+		f.Set("start_date", start.Format("2006-01-02"))
+		f.Set("end_date", end.Format("2006-01-02"))
+	}
+	return f
+}
+
+// resolvePeriod returns the first and last day of a relative period. Weeks start on Monday.
+func resolvePeriod(period string, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case "yesterday":
+		y := today.AddDate(0, 0, -1)
+		return y, y
+	case "last_7_days":
+		return today.AddDate(0, 0, -7), today.AddDate(0, 0, -1)
+	case "last_week":
+		monday := today.AddDate(0, 0, -((int(today.Weekday())+6)%7 + 7))
+		return monday, monday.AddDate(0, 0, 6)
+	case "month_to_date":
+		return today.AddDate(0, 0, 1-today.Day()), today
+	case "last_month":
+		first := today.AddDate(0, 0, 1-today.Day())
+		return first.AddDate(0, -1, 0), first.AddDate(0, 0, -1)
+	}
+	return today, today
+}
+
+func getReportSchedule(id interface{}) (models.ReportSchedule, error) {
+	return scanReportSchedule(config.DB.QueryRow(`
+		SELECT id, nama, report_type, filters, format, recipients, cron_expr, is_active,
+		       next_run_at, last_run_at, last_status, created_by, created_at, updated_at
+		FROM report_schedules WHERE id = ?
+	`, id))
+}
+
+func scanReportSchedule(scanner interface{ Scan(...interface{}) error }) (models.ReportSchedule, error) {
+	var s models.ReportSchedule
+	var filters []byte
+	var recipients string
+	var lastStatus sql.NullString
+	var createdBy sql.NullInt64
+	var nextRun, lastRun sql.NullTime
+	err := scanner.Scan(&s.ID, &s.Nama, &s.ReportType, &filters, &s.Format, &recipients, &s.CronExpr,
+		&s.IsActive, &nextRun, &lastRun, &lastStatus, &createdBy, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+
+	s.Filters = map[string]string{}
+	if len(filters) > 0 {
+		json.Unmarshal(filters, &s.Filters)
+	}
+	s.Recipients = splitRecipients(recipients)
+	if nextRun.Valid {
+		s.NextRunAt = &nextRun.Time
+	}
+	if lastRun.Valid {
+		s.LastRunAt = &lastRun.Time
+	}
+	if lastStatus.Valid {
+		s.LastStatus = &lastStatus.String
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		s.CreatedBy = &id
+	}
+	return s, nil
+}
+
+func splitRecipients(list string) []string {
+	recipients := make([]string, 0)
+	for _, r := range strings.Split(list, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			recipients = append(recipients, r)
+		}
+	}
+	return recipients
+}
+
+// validateReportSchedule checks the report type, filters and cron expression,
+// and returns the schedule's first run time
+func validateReportSchedule(c *gin.Context, req *models.ReportScheduleRequest) (*time.Time, int, string) {
+	src, ok := reportSources[req.ReportType]
+	if !ok {
+		return nil, http.StatusBadRequest, "Unknown report_type"
+	}
+	// Scheduled reports run without row scoping, so only users who can see everything may schedule them
+	if !middleware.HasPermission(c, src.permission) {
+		return nil, http.StatusForbidden, "Insufficient permissions for report " + req.ReportType
+	}
+	if period := req.Filters["period"]; period != "" && !reportPeriods[period] {
+		return nil, http.StatusBadRequest, "Invalid period, use today, yesterday, last_7_days, last_week, month_to_date or last_month"
+	}
+	if req.Filters == nil {
+		req.Filters = map[string]string{}
+	}
+
+	sched, err := cron.Parse(req.CronExpr)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid cron_expr: " + err.Error()
+	}
+	next := sched.Next(time.Now())
+	if next.IsZero() {
+		return nil, http.StatusBadRequest, "cron_expr never fires"
+	}
+	return &next, 0, ""
+}
+
+// GetReportScheduleTypes lists the reports that can be scheduled
+func GetReportScheduleTypes(c *gin.Context) {
+	types := make([]gin.H, 0, len(reportSources))
+	for key, src := range reportSources {
+		types = append(types, gin.H{"report_type": key, "title": src.title, "permission": src.permission})
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i]["report_type"].(string) < types[j]["report_type"].(string)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"types":   types,
+		"formats": []string{"xlsx", "csv", "pdf"},
+		"periods": []string{"today", "yesterday", "last_7_days", "last_week", "month_to_date", "last_month"},
+	})
+}
+
+// GetReportSchedules returns all report schedules
+func GetReportSchedules(c *gin.Context) {
+	rows, err := config.DB.Query(`
+		SELECT id, nama, report_type, filters, format, recipients, cron_expr, is_active,
+		       next_run_at, last_run_at, last_status, created_by, created_at, updated_at
+		FROM report_schedules
+		ORDER BY is_active DESC, nama
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report schedules"})
+		return
+	}
+	defer rows.Close()
+
+	schedules := make([]models.ReportSchedule, 0)
+	for rows.Next() {
+		s, err := scanReportSchedule(rows)
+		if err != nil {
+			continue
+		}
+		schedules = append(schedules, s)
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// CreateReportSchedule saves a report delivered by email on a cron schedule
+func CreateReportSchedule(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req models.ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	next, status, msg := validateReportSchedule(c, &req)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	active := req.IsActive == nil || *req.IsActive
+
+	filters, _ := json.Marshal(req.Filters)
+	result, err := config.DB.Exec(`
+		INSERT INTO report_schedules (nama, report_type, filters, format, recipients, cron_expr, is_active, next_run_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, req.Nama, req.ReportType, filters, req.Format, strings.Join(req.Recipients, ","), req.CronExpr,
+		active, next, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report schedule"})
+		return
+	}
+
+	scheduleID, _ := result.LastInsertId()
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "create", Modul: "laporan", Entitas: "report_schedule", ID: scheduleID,
+		Aktivitas: "Membuat jadwal laporan " + req.Nama,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Report schedule created successfully",
+		"schedule_id": scheduleID,
+		"next_run_at": next,
+	})
+}
+
+// UpdateReportSchedule replaces a report schedule and recomputes its next run
+func UpdateReportSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+
+	var req models.ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	next, status, msg := validateReportSchedule(c, &req)
+	if msg != "" {
+		c.JSON(status, gin.H{"error": msg})
+		return
+	}
+	active := req.IsActive == nil || *req.IsActive
+
+	before := auditSnapshot(config.DB, "report_schedule", paramID(c))
+
+	filters, _ := json.Marshal(req.Filters)
+	result, err := config.DB.Exec(`
+		UPDATE report_schedules SET nama = ?, report_type = ?, filters = ?, format = ?, recipients = ?,
+		       cron_expr = ?, is_active = ?, next_run_at = ?
+		WHERE id = ?
+	`, req.Nama, req.ReportType, filters, req.Format, strings.Join(req.Recipients, ","), req.CronExpr,
+		active, next, scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update report schedule"})
+		return
+	}
+	if !recordExists(result, "SELECT COUNT(*) FROM report_schedules WHERE id = ?", scheduleID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "update", Modul: "laporan", Entitas: "report_schedule", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mengupdate jadwal laporan",
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Report schedule updated successfully",
+		"next_run_at": next,
+	})
+}
+
+// DeleteReportSchedule removes a report schedule and its run history
+func DeleteReportSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+
+	before := auditSnapshot(config.DB, "report_schedule", paramID(c))
+
+	result, err := config.DB.Exec("DELETE FROM report_schedules WHERE id = ?", scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete report schedule"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return
+	}
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "delete", Modul: "laporan", Entitas: "report_schedule", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Menghapus jadwal laporan",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report schedule deleted successfully"})
+}
+
+// RunReportScheduleNow delivers a schedule immediately without changing its next run
+func RunReportScheduleNow(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	schedule, err := getReportSchedule(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report schedule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report schedule"})
+		return
+	}
+
+	run := deliverReport(schedule, userID, time.Now())
+
+	recordAudit(config.DB, c, auditEvent{
+		Aksi: "run", Modul: "laporan", Entitas: "report_schedule", ID: int64(schedule.ID),
+		Aktivitas: "Mengirim jadwal laporan " + schedule.Nama,
+	})
+
+	if run.Status == "failed" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to deliver report", "run": run})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Report delivered successfully", "run": run})
+}
+
+// GetReportScheduleRuns returns the delivery history of a schedule, newest first
+func GetReportScheduleRuns(c *gin.Context) {
+	rows, err := config.DB.Query(`
+		SELECT id, schedule_id, started_at, finished_at, status, row_count, recipients,
+		       file_name, error_message, triggered_by
+		FROM report_schedule_runs
+		WHERE schedule_id = ?
+		ORDER BY started_at DESC, id DESC
+		LIMIT 100
+	`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch report runs"})
+		return
+	}
+	defer rows.Close()
+
+	runs := make([]models.ReportScheduleRun, 0)
+	for rows.Next() {
+		var r models.ReportScheduleRun
+		var finished sql.NullTime
+		var recipients, fileName, errMsg sql.NullString
+		var triggeredBy sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.ScheduleID, &r.StartedAt, &finished, &r.Status, &r.RowCount,
+			&recipients, &fileName, &errMsg, &triggeredBy); err != nil {
+			continue
+		}
+		r.Recipients = recipients.String
+		if finished.Valid {
+			r.FinishedAt = &finished.Time
+		}
+		if fileName.Valid {
+			r.FileName = &fileName.String
+		}
+		if errMsg.Valid {
+			r.ErrorMessage = &errMsg.String
+		}
+		if triggeredBy.Valid {
+			id := int(triggeredBy.Int64)
+			r.TriggeredBy = &id
+		}
+		runs = append(runs, r)
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestError is returned from inside a transaction to answer with a specific
+// status and message once the transaction has rolled back
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+// fail aborts a transaction with an error response
+func fail(status int, message string) error {
+	return &requestError{status: status, message: message}
+}
+
+// respondError writes err; anything but a requestError is logged and answered
+// with 500 and fallback
+func respondError(c *gin.Context, err error, fallback string) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		c.JSON(reqErr.status, gin.H{"error": reqErr.message})
+		return
+	}
+	log.Printf("%s %s: %v", c.Request.Method, c.FullPath(), err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
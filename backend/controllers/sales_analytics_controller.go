@@ -0,0 +1,481 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sawit-backend/config"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// salesTimeBuckets formats a sale date into its bucket label. Weeks start on Monday.
+var salesTimeBuckets = map[string]string{
+	"day":   "DATE_FORMAT(%[1]s, '%%Y-%%m-%%d')",
+	"week":  "DATE_FORMAT(%[1]s - INTERVAL WEEKDAY(%[1]s) DAY, '%%Y-%%m-%%d')",
+	"month": "DATE_FORMAT(%[1]s, '%%Y-%%m')",
+}
+
+// salesMetrics are the names accepted by ?metric for chart series
+var salesMetrics = []string{"pendapatan", "berat_bersih_kg", "harga_rata_rata", "penyesuaian_grade", "jumlah_transaksi"}
+
+// salesComparisons shift the period back for month-over-month and year-over-year
+var salesComparisons = map[string]struct {
+	months   int
+	interval string
+}{
+	"mom": {1, "1 MONTH"},
+	"yoy": {12, "1 YEAR"},
+}
+
+type salesGrouping struct {
+	time   string // day, week, month or empty
+	kebun  bool
+	buyer  bool
+	grade  bool
+	fields []string
+}
+
+// salesTotals accumulates one group of invoiced sales
+type salesTotals struct {
+	Transaksi   int
+	KG          float64
+	Kotor       float64
+	Penyesuaian float64
+	Pendapatan  float64
+	BedaGrade   int
+	KGBedaGrade float64
+}
+
+func (m *salesTotals) add(o salesTotals) {
+	m.Transaksi += o.Transaksi
+	m.KG += o.KG
+	m.Kotor += o.Kotor
+	m.Penyesuaian += o.Penyesuaian
+	m.Pendapatan += o.Pendapatan
+	m.BedaGrade += o.BedaGrade
+	m.KGBedaGrade += o.KGBedaGrade
+}
+
+// hargaRataRata is the realized price: revenue after grade adjustments per net kg
+func (m salesTotals) hargaRataRata() float64 {
+	if m.KG == 0 {
+		return 0
+	}
+	return m.Pendapatan / m.KG
+}
+
+func (m salesTotals) metric(name string) float64 {
+	switch name {
+	case "berat_bersih_kg":
+		return round2(m.KG)
+	case "harga_rata_rata":
+		return round2(m.hargaRataRata())
+	case "penyesuaian_grade":
+		return round2(m.Penyesuaian)
+	case "jumlah_transaksi":
+		return float64(m.Transaksi)
+	}
+	return round2(m.Pendapatan)
+}
+
+func (m salesTotals) toJSON() gin.H {
+	return gin.H{
+		"jumlah_transaksi":     m.Transaksi,
+		"berat_bersih_kg":      round2(m.KG),
+		"pendapatan_kotor":     round2(m.Kotor),
+		"penyesuaian_grade":    round2(m.Penyesuaian),
+		"pendapatan":           round2(m.Pendapatan),
+		"harga_rata_rata":      round2(m.hargaRataRata()),
+		"transaksi_beda_grade": m.BedaGrade,
+		"kg_beda_grade":        round2(m.KGBedaGrade),
+	}
+}
+
+// salesChange returns the percentage change of the main metrics, nil when there is no base
+func salesChange(cur, prev salesTotals) gin.H {
+	pct := func(a, b float64) interface{} {
+		if b == 0 {
+			return nil
+		}
+		return round2((a - b) / b * 100)
+	}
+	return gin.H{
+		"pendapatan":       pct(cur.Pendapatan, prev.Pendapatan),
+		"berat_bersih_kg":  pct(cur.KG, prev.KG),
+		"harga_rata_rata":  pct(cur.hargaRataRata(), prev.hargaRataRata()),
+		"jumlah_transaksi": pct(float64(cur.Transaksi), float64(prev.Transaksi)),
+	}
+}
+
+// salesGroup is one row of the analytics result
+type salesGroup struct {
+	bucket string
+	series string // identifies the non-time dimensions
+	label  string
+	info   gin.H
+	cur    salesTotals
+	prev   salesTotals
+}
+
+func parseSalesGrouping(groupBy string) (salesGrouping, error) {
+	var g salesGrouping
+	if groupBy == "" {
+		return g, nil
+	}
+	seen := map[string]bool{}
+	for _, field := range strings.Split(groupBy, ",") {
+		field = strings.TrimSpace(field)
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		switch field {
+		case "day", "week", "month":
+			if g.time != "" {
+				return g, fmt.Errorf("group_by accepts only one of day, week or month")
+			}
+			g.time = field
+		case "kebun":
+			g.kebun = true
+		case "buyer":
+			g.buyer = true
+		case "grade":
+			g.grade = true
+		default:
+			return g, fmt.Errorf("unknown group_by %q, use day, week, month, kebun, buyer or grade", field)
+		}
+		g.fields = append(g.fields, field)
+	}
+	return g, nil
+}
+
+// querySalesGroups aggregates invoiced sales between start and end. With a
+// shift interval the dates are moved forward before bucketing, so a comparison
+// period lands on the same bucket labels as the current one.
+func querySalesGroups(c *gin.Context, g salesGrouping, start, end time.Time, shift string) ([]salesGroup, error) {
+	dateExpr := "dp.tanggal_dokumen"
+	if shift != "" {
+		dateExpr = "(dp.tanggal_dokumen + INTERVAL " + shift + ")"
+	}
+
+	selects := []string{"''"}
+	groups := []string{}
+	if g.time != "" {
+		selects[0] = fmt.Sprintf(salesTimeBuckets[g.time], dateExpr)
+		groups = append(groups, "1")
+	}
+	if g.kebun {
+		selects = append(selects, "po.kebun_id", "k.nama_kebun")
+		groups = append(groups, "po.kebun_id", "k.nama_kebun")
+	} else {
+		selects = append(selects, "0", "''")
+	}
+	if g.buyer {
+		selects = append(selects, "po.buyer_id", "COALESCE(NULLIF(u.company_name, ''), u.username)")
+		groups = append(groups, "po.buyer_id", "u.company_name", "u.username")
+	} else {
+		selects = append(selects, "0", "''")
+	}
+	if g.grade {
+		selects = append(selects, "COALESCE(t.grade_aktual, po.grade_diminta)")
+		groups = append(groups, "COALESCE(t.grade_aktual, po.grade_diminta)")
+	} else {
+		selects = append(selects, "''")
+	}
+
+	query := `
+		SELECT ` + strings.Join(selects, ", ") + `,
+		       COUNT(*),
+		       COALESCE(SUM(dp.jumlah_kg), 0),
+		       COALESCE(SUM(dp.total_harga), 0),
+		       COALESCE(SUM(dp.penyesuaian_harga), 0),
+		       COALESCE(SUM(dp.total_akhir), 0),
+		       COALESCE(SUM(t.grade_aktual <> po.grade_diminta), 0),
+		       COALESCE(SUM(CASE WHEN t.grade_aktual <> po.grade_diminta THEN dp.jumlah_kg ELSE 0 END), 0)
+		FROM dokumen_penjualan dp
+		JOIN purchase_orders po ON dp.po_id = po.id
+		JOIN kebun k ON po.kebun_id = k.id
+		JOIN users u ON po.buyer_id = u.id
+		LEFT JOIN timbangan t ON dp.timbang_id = t.id
+		WHERE dp.tanggal_dokumen BETWEEN ? AND ?
+	`
+	args := []interface{}{start.Format("2006-01-02"), end.Format("2006-01-02")}
+
+	if kebunID := c.Query("kebun_id"); kebunID != "" {
+		query += " AND po.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	if buyerID := c.Query("buyer_id"); buyerID != "" {
+		query += " AND po.buyer_id = ?"
+		args = append(args, buyerID)
+	}
+	if grade := c.Query("grade"); grade != "" {
+		query += " AND COALESCE(t.grade_aktual, po.grade_diminta) = ?"
+		args = append(args, grade)
+	}
+	if len(groups) > 0 {
+		query += " GROUP BY " + strings.Join(groups, ", ")
+	}
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]salesGroup, 0)
+	for rows.Next() {
+		var sg salesGroup
+		var kebunID, buyerID int
+		var namaKebun, buyer, grade string
+		if err := rows.Scan(&sg.bucket, &kebunID, &namaKebun, &buyerID, &buyer, &grade,
+			&sg.cur.Transaksi, &sg.cur.KG, &sg.cur.Kotor, &sg.cur.Penyesuaian, &sg.cur.Pendapatan,
+			&sg.cur.BedaGrade, &sg.cur.KGBedaGrade); err != nil {
+			return nil, err
+		}
+
+		sg.info = gin.H{}
+		var labels []string
+		if g.kebun {
+			sg.info["kebun_id"] = kebunID
+			sg.info["nama_kebun"] = namaKebun
+			labels = append(labels, namaKebun)
+		}
+		if g.buyer {
+			sg.info["buyer_id"] = buyerID
+			sg.info["buyer"] = buyer
+			labels = append(labels, buyer)
+		}
+		if g.grade {
+			sg.info["grade"] = grade
+			labels = append(labels, "Grade "+grade)
+		}
+		sg.series = fmt.Sprintf("%d|%d|%s", kebunID, buyerID, grade)
+		sg.label = strings.Join(labels, " / ")
+		if sg.label == "" {
+			sg.label = "Total"
+		}
+		result = append(result, sg)
+	}
+	return result, rows.Err()
+}
+
+// salesBucketLabels lists every bucket between start and end so series have no gaps
+func salesBucketLabels(timeGroup string, start, end time.Time) []string {
+	var labels []string
+	switch timeGroup {
+	case "day":
+		for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+			labels = append(labels, d.Format("2006-01-02"))
+		}
+	case "week":
+		monday := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		for d := monday; !d.After(end); d = d.AddDate(0, 0, 7) {
+			labels = append(labels, d.Format("2006-01-02"))
+		}
+	case "month":
+		for d := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location()); !d.After(end); d = d.AddDate(0, 1, 0) {
+			labels = append(labels, d.Format("2006-01"))
+		}
+	}
+	return labels
+}
+
+// shiftMonths moves a date back by n months, clamping to the end of the target month
+func shiftMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).AddDate(0, -n, 0)
+	last := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+// GetSalesAnalytics aggregates invoiced sales by any combination of period,
+// kebun, buyer and grade, optionally against the previous month or year
+func GetSalesAnalytics(c *gin.Context) {
+	g, err := parseSalesGrouping(c.Query("group_by"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	metric := c.DefaultQuery("metric", "pendapatan")
+	validMetric := false
+	for _, m := range salesMetrics {
+		validMetric = validMetric || m == metric
+	}
+	if !validMetric {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "metric must be one of " + strings.Join(salesMetrics, ", ")})
+		return
+	}
+
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	start := end.AddDate(0, 0, 1-end.Day())
+	if s := c.Query("start_date"); s != "" {
+		if start, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be YYYY-MM-DD"})
+			return
+		}
+	}
+	if s := c.Query("end_date"); s != "" {
+		if end, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be YYYY-MM-DD"})
+			return
+		}
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must not be after end_date"})
+		return
+	}
+	if end.Sub(start) > 3*366*24*time.Hour || (g.time == "day" && end.Sub(start) > 366*24*time.Hour) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Range cannot exceed 36 months (12 months when grouped by day)"})
+		return
+	}
+
+	compare := c.Query("compare")
+	shift, comparing := salesComparisons[compare]
+	if compare != "" && !comparing {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "compare must be mom or yoy"})
+		return
+	}
+
+	current, err := querySalesGroups(c, g, start, end, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales analytics"})
+		return
+	}
+
+	groups := make(map[string]*salesGroup)
+	var order []string
+	var total, totalPrev salesTotals
+	for i := range current {
+		sg := current[i]
+		key := sg.bucket + "|" + sg.series
+		groups[key] = &sg
+		order = append(order, key)
+		total.add(sg.cur)
+	}
+
+	response := gin.H{
+		"group_by": g.fields,
+		"metric":   metric,
+		"period":   gin.H{"start_date": start.Format("2006-01-02"), "end_date": end.Format("2006-01-02")},
+	}
+
+	if comparing {
+		prevStart, prevEnd := shiftMonths(start, shift.months), shiftMonths(end, shift.months)
+		previous, err := querySalesGroups(c, g, prevStart, prevEnd, shift.interval)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales analytics"})
+			return
+		}
+		for i := range previous {
+			p := previous[i]
+			totalPrev.add(p.cur)
+			key := p.bucket + "|" + p.series
+			sg, exists := groups[key]
+			if !exists {
+				// Groups that sold in the comparison period only still show up, with zero current sales
+				sg = &salesGroup{bucket: p.bucket, series: p.series, label: p.label, info: p.info}
+				groups[key] = sg
+				order = append(order, key)
+			}
+			sg.prev = p.cur
+		}
+		response["compare"] = compare
+		response["compare_period"] = gin.H{
+			"start_date": prevStart.Format("2006-01-02"),
+			"end_date":   prevEnd.Format("2006-01-02"),
+		}
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := groups[order[i]], groups[order[j]]
+		if a.bucket != b.bucket {
+			return a.bucket < b.bucket
+		}
+		return a.label < b.label
+	})
+
+	rows := make([]gin.H, 0, len(order))
+	type seriesInfo struct{ key, label string }
+	var series []seriesInfo
+	seriesSeen := map[string]bool{}
+	for _, key := range order {
+		sg := groups[key]
+		row := sg.cur.toJSON()
+		for k, v := range sg.info {
+			row[k] = v
+		}
+		if g.time != "" {
+			row["periode"] = sg.bucket
+		}
+		if comparing {
+			row["pembanding"] = sg.prev.toJSON()
+			row["perubahan_persen"] = salesChange(sg.cur, sg.prev)
+		}
+		rows = append(rows, row)
+
+		if !seriesSeen[sg.series] {
+			seriesSeen[sg.series] = true
+			series = append(series, seriesInfo{sg.series, sg.label})
+		}
+	}
+	sort.SliceStable(series, func(i, j int) bool { return series[i].label < series[j].label })
+
+	// Chart-ready series: one dataset per non-time group over the bucket labels,
+	// or a single dataset over the groups when there is no time dimension
+	var labels []string
+	datasets := make([]gin.H, 0)
+	if g.time != "" {
+		labels = salesBucketLabels(g.time, start, end)
+		for _, se := range series {
+			data := make([]float64, len(labels))
+			prevData := make([]float64, len(labels))
+			for i, label := range labels {
+				if sg, ok := groups[label+"|"+se.key]; ok {
+					data[i] = sg.cur.metric(metric)
+					prevData[i] = sg.prev.metric(metric)
+				}
+			}
+			datasets = append(datasets, gin.H{"label": se.label, "data": data})
+			if comparing {
+				datasets = append(datasets, gin.H{"label": se.label + " (" + compare + ")", "data": prevData, "pembanding": true})
+			}
+		}
+	} else {
+		labels = make([]string, len(series))
+		data := make([]float64, len(series))
+		prevData := make([]float64, len(series))
+		for i, se := range series {
+			labels[i] = se.label
+			sg := groups["|"+se.key]
+			data[i] = sg.cur.metric(metric)
+			prevData[i] = sg.prev.metric(metric)
+		}
+		datasets = append(datasets, gin.H{"label": metric, "data": data})
+		if comparing {
+			datasets = append(datasets, gin.H{"label": metric + " (" + compare + ")", "data": prevData, "pembanding": true})
+		}
+	}
+	if labels == nil {
+		labels = []string{}
+	}
+
+	summary := total.toJSON()
+	if comparing {
+		summary["pembanding"] = totalPrev.toJSON()
+		summary["perubahan_persen"] = salesChange(total, totalPrev)
+	}
+	response["summary"] = summary
+	response["data"] = rows
+	response["series"] = gin.H{"labels": labels, "datasets": datasets}
+
+	c.JSON(http.StatusOK, response)
+}
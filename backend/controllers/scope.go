@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"net/http"
+	"sawit-backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scopeQuery applies row-level scoping for a resource to a list query.
+// ownerCondition must contain a single placeholder for the current user ID,
+// e.g. "po.buyer_id = ?". It writes a 403 response and returns false when
+// the user may not read the resource at all.
+func scopeQuery(c *gin.Context, resource, ownerCondition string, query *string, args *[]interface{}) bool {
+	all, ok := middleware.ReadScope(c, resource)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return false
+	}
+	if !all {
+		userID, _ := c.Get("user_id")
+		*query += " AND " + ownerCondition
+		*args = append(*args, userID)
+	}
+	return true
+}
+
+// canReadOwned reports whether the user may read a single record of a scoped resource
+func canReadOwned(c *gin.Context, resource string, ownerID int) bool {
+	all, ok := middleware.ReadScope(c, resource)
+	if !ok {
+		return false
+	}
+	if all {
+		return true
+	}
+	userID, _ := c.Get("user_id")
+	return userID == ownerID
+}
+
+// scopeOwner is scopeQuery for repository filters: it returns the user ID a list must
+// be limited to, or nil when the user may read every record. It writes a 403 response
+// and returns false when the user may not read the resource at all.
+func scopeOwner(c *gin.Context, resource string) (*int, bool) {
+	all, ok := middleware.ReadScope(c, resource)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return nil, false
+	}
+	if all {
+		return nil, true
+	}
+	userID := c.GetInt("user_id")
+	return &userID, true
+}
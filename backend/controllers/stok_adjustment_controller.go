@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sawit-backend/domain"
+	"sawit-backend/models"
+	"sawit-backend/repository"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateStokAdjustment requests a quantity change on a batch; it takes effect once approved
+func (h *StokHandler) CreateStokAdjustment(c *gin.Context) {
+	stokID := int(paramID(c))
+
+	var req models.StokAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Shrinkage and spoilage only ever remove fruit
+	if (req.Alasan == "shrinkage" || req.Alasan == "spoilage") && req.SelisihKg > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "selisih_kg must be negative for " + req.Alasan})
+		return
+	}
+
+	stok, err := h.store.Stok().FindByID(stokID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if stok.JumlahTersedia+req.SelisihKg < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Adjustment exceeds available stock (%.2f kg)", stok.JumlahTersedia)})
+		return
+	}
+
+	adjustmentID, err := h.store.StokAdjustments().Create(stokID, c.GetInt("user_id"), req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stock adjustment"})
+		return
+	}
+
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "create", Modul: "stok", Entitas: "stok_adjustment", ID: adjustmentID,
+		Aktivitas: fmt.Sprintf("Mengajukan penyesuaian stok #%d (%s, %+.2f kg)", stokID, req.Alasan, req.SelisihKg),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Stock adjustment submitted for approval",
+		"adjustment_id": adjustmentID,
+	})
+}
+
+// GetStokAdjustments returns stock adjustments
+func (h *StokHandler) GetStokAdjustments(c *gin.Context) {
+	adjustments, err := h.store.StokAdjustments().List(repository.AdjustmentFilter{
+		Status:  c.Query("status"),
+		StokID:  c.Query("stok_id"),
+		KebunID: c.Query("kebun_id"),
+		Alasan:  c.Query("alasan"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock adjustments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, adjustments)
+}
+
+// ReviewStokAdjustment approves or rejects a pending adjustment. Approval applies
+// the change to the batch; the requester cannot approve their own adjustment.
+func (h *StokHandler) ReviewStokAdjustment(c *gin.Context) {
+	adjustmentID := int(paramID(c))
+	userID := c.GetInt("user_id")
+
+	var req models.ReviewStokAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.store.WithTx(func(tx repository.Store) error {
+		adjustment, err := tx.StokAdjustments().Lock(adjustmentID)
+		if err == repository.ErrNotFound {
+			return fail(http.StatusNotFound, "Stock adjustment not found")
+		}
+		if err != nil {
+			return err
+		}
+		if adjustment.Status != "pending" {
+			return fail(http.StatusConflict, "Stock adjustment has already been reviewed")
+		}
+		if userID == adjustment.RequestedBy {
+			return fail(http.StatusForbidden, "Adjustments must be approved by another user")
+		}
+
+		logs := tx.Logs()
+		before := snapshotOf(logs, "stok_adjustment", int64(adjustmentID))
+		stokBefore := snapshotOf(logs, "stok", int64(adjustment.StokID))
+
+		review := repository.AdjustmentReview{Status: req.Status, ReviewedBy: userID, Catatan: req.Catatan}
+		if req.Status == "approved" {
+			stok, err := tx.Stok().Lock(adjustment.StokID)
+			if err != nil {
+				return err
+			}
+
+			// Stock may have been ordered since the request
+			adjusted, err := domain.AdjustStok(stok, adjustment.SelisihKg)
+			if errors.Is(err, domain.ErrInsufficientStock) {
+				return fail(http.StatusConflict, fmt.Sprintf("Adjustment exceeds available stock (%.2f kg)", stok.Tersedia))
+			}
+			if err != nil {
+				return err
+			}
+			if err := tx.Stok().Save(adjustment.StokID, adjusted); err != nil {
+				return err
+			}
+			review.Sebelum, review.Sesudah = &stok.Tersedia, &adjusted.Tersedia
+		}
+
+		if err := tx.StokAdjustments().Review(adjustmentID, review); err != nil {
+			return err
+		}
+
+		aktivitas := "Menyetujui penyesuaian stok #" + strconv.Itoa(adjustment.StokID)
+		if req.Status == "rejected" {
+			aktivitas = "Menolak penyesuaian stok #" + strconv.Itoa(adjustment.StokID)
+		}
+		recordAuditTo(logs, c, auditEvent{
+			Aksi: req.Status, Modul: "stok", Entitas: "stok_adjustment", ID: int64(adjustmentID), Sebelum: before,
+			Aktivitas: aktivitas,
+		})
+		if req.Status == "approved" {
+			recordAuditTo(logs, c, auditEvent{
+				Aksi: "adjust", Entitas: "stok", ID: int64(adjustment.StokID), Sebelum: stokBefore,
+				Aktivitas: fmt.Sprintf("Penyesuaian stok %+.2f kg", adjustment.SelisihKg),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update stock adjustment")
+		return
+	}
+
+	invalidateDashboard()
+	c.JSON(http.StatusOK, gin.H{"message": "Stock adjustment " + req.Status})
+}
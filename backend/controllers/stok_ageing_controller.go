@@ -0,0 +1,345 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sawit-backend/config"
+	"sawit-backend/models"
+	"sawit-backend/repository"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ageingMu keeps the scheduled job and manual runs from ageing the same batch twice
+var ageingMu sync.Mutex
+
+type ageingSummary struct {
+	Batch     int `json:"batch_diproses"`
+	Discount  int `json:"didiskon"`
+	Downgrade int `json:"turun_grade"`
+	Restan    int `json:"restan"`
+	Expired   int `json:"expired"`
+}
+
+// nextGrade is the grade a batch falls to on downgrade; C is the lowest
+var nextGrade = map[string]string{"A": "B", "B": "C", "C": "C"}
+
+// StartStokAgeingJob ages stock in the background every AgeingInterval minutes
+func StartStokAgeingJob(store repository.Store) {
+	interval := config.AppConfig.AgeingInterval
+	if interval <= 0 {
+		log.Println("Stock ageing job disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Minute)
+		defer ticker.Stop()
+		for {
+			summary, err := RunStokAgeing(store)
+			if err != nil {
+				log.Printf("Stock ageing failed: %v", err)
+			} else if summary.Batch > 0 {
+				log.Printf("Stock ageing: %d batch diproses, %d restan, %d expired",
+					summary.Batch, summary.Restan, summary.Expired)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// RunStokAgeing applies every due ageing rule to unsold batches, then refreshes
+// today's restan snapshot. Each rule is applied to a batch at most once.
+func RunStokAgeing(store repository.Store) (ageingSummary, error) {
+	ageingMu.Lock()
+	defer ageingMu.Unlock()
+
+	var summary ageingSummary
+
+	ageing := store.StokAgeing()
+	rules, err := ageing.ActiveRules()
+	if err != nil {
+		return summary, err
+	}
+	if len(rules) > 0 {
+		ids, err := ageing.DueBatches(rules[0].UmurJam)
+		if err != nil {
+			return summary, err
+		}
+		for _, id := range ids {
+			if err := ageBatch(store, id, rules, &summary); err != nil {
+				log.Printf("Stock ageing: batch %d: %v", id, err)
+			}
+		}
+	}
+
+	if err := ageing.SnapshotRestan(); err != nil {
+		return summary, err
+	}
+
+	if summary.Batch > 0 {
+		recordAuditTo(store.Logs(), nil, auditEvent{
+			Aksi: "ageing", Modul: "stok",
+			Aktivitas: fmt.Sprintf("Ageing stok TBS: %d batch diproses (%d diskon, %d turun grade, %d restan, %d expired)",
+				summary.Batch, summary.Discount, summary.Downgrade, summary.Restan, summary.Expired),
+		})
+		invalidateDashboard()
+	}
+
+	return summary, nil
+}
+
+// ageBatch applies the due rules to one batch inside its own transaction
+func ageBatch(store repository.Store, stokID int, rules []models.StokAgeingRule, summary *ageingSummary) error {
+	var counts ageingSummary
+	err := store.WithTx(func(tx repository.Store) error {
+		ageing := tx.StokAgeing()
+		batch, err := ageing.LockBatch(stokID)
+		if err != nil {
+			return err
+		}
+		applied, err := ageing.AppliedRules(stokID)
+		if err != nil {
+			return err
+		}
+
+		aged := batch
+		for _, rule := range rules {
+			if rule.UmurJam > batch.UmurJam || aged.Status == "expired" {
+				break
+			}
+			if applied[rule.ID] || (rule.Grade != nil && *rule.Grade != batch.GradeAwal) {
+				continue
+			}
+			if rule.Aksi == "discount" && rule.DiskonPersen == nil {
+				continue
+			}
+
+			next := aged
+			switch rule.Aksi {
+			case "discount":
+				next.HargaPerKg = round2(batch.HargaAwal * (1 - *rule.DiskonPersen/100))
+				counts.Discount++
+			case "downgrade":
+				next.Grade = nextGrade[aged.Grade]
+				counts.Downgrade++
+			case "restan":
+				next.Status = "restan"
+				counts.Restan++
+			case "expired":
+				next.Status = "expired"
+				counts.Expired++
+			}
+
+			err := ageing.RecordStep(repository.AgeingStep{
+				StokID: stokID, RuleID: rule.ID, Aksi: rule.Aksi, UmurJam: batch.UmurJam,
+				GradeSebelum: aged.Grade, GradeSesudah: next.Grade,
+				HargaSebelum: aged.HargaPerKg, HargaSesudah: next.HargaPerKg,
+				StatusSebelum: aged.Status, StatusSesudah: next.Status,
+			})
+			if err != nil {
+				return err
+			}
+			aged = next
+			counts.Batch = 1
+		}
+
+		if counts.Batch == 0 {
+			return nil
+		}
+
+		logs := tx.Logs()
+		before := snapshotOf(logs, "stok", int64(stokID))
+		if err := ageing.SaveBatch(stokID, aged); err != nil {
+			return err
+		}
+		recordAuditTo(logs, nil, auditEvent{
+			Aksi: "ageing", Entitas: "stok", ID: int64(stokID), Sebelum: before,
+			Aktivitas: fmt.Sprintf("Ageing stok TBS: grade %s, Rp %.2f/kg, status %s", aged.Grade, aged.HargaPerKg, aged.Status),
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	summary.Batch += counts.Batch
+	summary.Discount += counts.Discount
+	summary.Downgrade += counts.Downgrade
+	summary.Restan += counts.Restan
+	summary.Expired += counts.Expired
+	return nil
+}
+
+func validateAgeingRule(req *models.StokAgeingRuleRequest) string {
+	if req.Status == "" {
+		req.Status = "active"
+	}
+	if req.Aksi == "discount" && req.DiskonPersen == nil {
+		return "diskon_persen is required for discount rules"
+	}
+	if req.Aksi != "discount" {
+		req.DiskonPersen = nil
+	}
+	return ""
+}
+
+// GetStokAgeingRules returns all ageing rules
+func (h *StokHandler) GetStokAgeingRules(c *gin.Context) {
+	rules, err := h.store.StokAgeing().Rules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ageing rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateStokAgeingRule adds an ageing rule
+func (h *StokHandler) CreateStokAgeingRule(c *gin.Context) {
+	var req models.StokAgeingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateAgeingRule(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ruleID, err := h.store.StokAgeing().CreateRule(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ageing rule"})
+		return
+	}
+
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "create", Modul: "stok", Entitas: "ageing_rule", ID: ruleID,
+		Aktivitas: "Menambah aturan ageing stok " + req.Nama,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Ageing rule created successfully",
+		"rule_id": ruleID,
+	})
+}
+
+// UpdateStokAgeingRule updates an ageing rule. Batches already aged keep their changes.
+func (h *StokHandler) UpdateStokAgeingRule(c *gin.Context) {
+	var req models.StokAgeingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := validateAgeingRule(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	logs := h.store.Logs()
+	before := snapshotOf(logs, "ageing_rule", paramID(c))
+
+	err := h.store.StokAgeing().UpdateRule(int(paramID(c)), req)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ageing rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update ageing rule"})
+		return
+	}
+
+	recordAuditTo(logs, c, auditEvent{
+		Aksi: "update", Modul: "stok", Entitas: "ageing_rule", ID: paramID(c), Sebelum: before,
+		Aktivitas: "Mengupdate aturan ageing stok",
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ageing rule updated successfully"})
+}
+
+// RunStokAgeingNow runs the ageing job immediately
+func (h *StokHandler) RunStokAgeingNow(c *gin.Context) {
+	summary, err := RunStokAgeing(h.store)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run stock ageing"})
+		return
+	}
+
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "run", Modul: "stok",
+		Aktivitas: "Menjalankan ageing stok TBS",
+	})
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// GetStokAgeingLog returns the ageing history of a batch
+func (h *StokHandler) GetStokAgeingLog(c *gin.Context) {
+	history, err := h.store.StokAgeing().History(int(paramID(c)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ageing history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// GetRestanReport returns unsold restan/expired stock per kebun for one day.
+// Today's figures are refreshed on request; past days come from the daily snapshot.
+func (h *StokHandler) GetRestanReport(c *gin.Context) {
+	today := time.Now().Format("2006-01-02")
+	tanggal := c.DefaultQuery("tanggal", today)
+	if _, err := time.Parse("2006-01-02", tanggal); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tanggal must be YYYY-MM-DD"})
+		return
+	}
+
+	ageing := h.store.StokAgeing()
+	if tanggal == today {
+		if err := ageing.SnapshotRestan(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh restan report"})
+			return
+		}
+	}
+
+	rows, err := ageing.Restan(tanggal, tanggal, c.Query("kebun_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch restan report"})
+		return
+	}
+
+	var totalRestan, totalNilai, totalExpired float64
+	for _, r := range rows {
+		totalRestan += r.RestanKg
+		totalNilai += r.NilaiRestan
+		totalExpired += r.ExpiredKg
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tanggal": tanggal,
+		"kebun":   rows,
+		"total": gin.H{
+			"restan_kg":    round2(totalRestan),
+			"nilai_restan": round2(totalNilai),
+			"expired_kg":   round2(totalExpired),
+		},
+	})
+}
+
+// GetRestanHistory returns the daily restan snapshots in a date range
+func (h *StokHandler) GetRestanHistory(c *gin.Context) {
+	now := time.Now()
+	startDate := c.DefaultQuery("start_date", now.AddDate(0, 0, -29).Format("2006-01-02"))
+	endDate := c.DefaultQuery("end_date", now.Format("2006-01-02"))
+
+	rows, err := h.store.StokAgeing().Restan(startDate, endDate, c.Query("kebun_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch restan history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rows)
+}
@@ -1,101 +1,67 @@
 package controllers
 
 import (
-	"database/sql"
+	"fmt"
 	"net/http"
-	"sawit-backend/config"
+	"net/url"
 	"sawit-backend/models"
+	"sawit-backend/repository"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetStokList returns list of available TBS stock
-func GetStokList(c *gin.Context) {
-	status := c.DefaultQuery("status", "available")
-	grade := c.Query("grade")
-	kebunID := c.Query("kebun_id")
+// stokFilter reads the stock list filters. status defaults to available;
+// status=all includes sold out, restan and expired batches, e.g. for reports.
+func stokFilter(f url.Values) repository.StokFilter {
+	status := f.Get("status")
+	if status == "" {
+		status = "available"
+	}
+	if status == "all" {
+		status = ""
+	}
+	return repository.StokFilter{
+		Status: status, Grade: f.Get("grade"), KebunID: f.Get("kebun_id"), BlokID: f.Get("blok_id"),
+		StartDate: f.Get("start_date"), EndDate: f.Get("end_date"),
+	}
+}
 
-	query := `
-		SELECT s.id, s.kebun_id, s.tanggal_panen, s.jumlah_kg, s.jumlah_tersedia,
-		       s.grade, s.kadar_minyak, s.harga_per_kg, s.keterangan, s.status,
-		       s.created_at, s.updated_at, k.nama_kebun, k.lokasi
-		FROM stok_tbs s
-		JOIN kebun k ON s.kebun_id = k.id
-		WHERE s.status = ?
-	`
-	args := []interface{}{status}
+// StokHandler serves stock batches from injected repositories
+type StokHandler struct {
+	store repository.Store
+}
 
-	if grade != "" {
-		query += " AND s.grade = ?"
-		args = append(args, grade)
-	}
-	if kebunID != "" {
-		query += " AND s.kebun_id = ?"
-		args = append(args, kebunID)
+// NewStokHandler returns a StokHandler backed by store
+func NewStokHandler(store repository.Store) *StokHandler {
+	return &StokHandler{store: store}
+}
+
+// GetStokList returns list of available TBS stock, or a file with ?format=xlsx|csv|pdf
+func (h *StokHandler) GetStokList(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
 	}
 
-	query += " ORDER BY s.tanggal_panen DESC, s.grade ASC"
+	if format != "" {
+		sendExport(c, h.store, format, reportSources["stok"], nil)
+		return
+	}
 
-	rows, err := config.DB.Query(query, args...)
+	stokList, err := h.store.Stok().List(stokFilter(c.Request.URL.Query()))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock"})
 		return
 	}
-	defer rows.Close()
-
-	stokList := make([]models.StokTBS, 0)
-	for rows.Next() {
-		var stok models.StokTBS
-		var kadarMinyak sql.NullFloat64
-		var keterangan sql.NullString
-		err := rows.Scan(
-			&stok.ID, &stok.KebunID, &stok.TanggalPanen, &stok.JumlahKg, &stok.JumlahTersedia,
-			&stok.Grade, &kadarMinyak, &stok.HargaPerKg, &keterangan, &stok.Status,
-			&stok.CreatedAt, &stok.UpdatedAt, &stok.NamaKebun, &stok.LokasiKebun,
-		)
-		if err != nil {
-			continue
-		}
-		if kadarMinyak.Valid {
-			stok.KadarMinyak = &kadarMinyak.Float64
-		}
-		if keterangan.Valid {
-			stok.Keterangan = &keterangan.String
-		}
-		stokList = append(stokList, stok)
-	}
 
 	c.JSON(http.StatusOK, stokList)
 }
 
 // GetStokDetail returns detail of specific stock
-func GetStokDetail(c *gin.Context) {
-	stokID := c.Param("id")
-
-	var stok models.StokTBS
-	var kadarMinyak sql.NullFloat64
-	var keterangan sql.NullString
-	err := config.DB.QueryRow(`
-		SELECT s.id, s.kebun_id, s.tanggal_panen, s.jumlah_kg, s.jumlah_tersedia,
-		       s.grade, s.kadar_minyak, s.harga_per_kg, s.keterangan, s.status,
-		       s.created_at, s.updated_at, k.nama_kebun, k.lokasi
-		FROM stok_tbs s
-		JOIN kebun k ON s.kebun_id = k.id
-		WHERE s.id = ?
-	`, stokID).Scan(
-		&stok.ID, &stok.KebunID, &stok.TanggalPanen, &stok.JumlahKg, &stok.JumlahTersedia,
-		&stok.Grade, &kadarMinyak, &stok.HargaPerKg, &keterangan, &stok.Status,
-		&stok.CreatedAt, &stok.UpdatedAt, &stok.NamaKebun, &stok.LokasiKebun,
-	)
-
-	if kadarMinyak.Valid {
-		stok.KadarMinyak = &kadarMinyak.Float64
-	}
-	if keterangan.Valid {
-		stok.Keterangan = &keterangan.String
-	}
-
-	if err == sql.ErrNoRows {
+func (h *StokHandler) GetStokDetail(c *gin.Context) {
+	stok, err := h.store.Stok().FindByID(int(paramID(c)))
+	if err == repository.ErrNotFound {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Stock not found"})
 		return
 	}
@@ -107,113 +73,123 @@ func GetStokDetail(c *gin.Context) {
 	c.JSON(http.StatusOK, stok)
 }
 
-// CreateStok creates new TBS stock (admin only)
-func CreateStok(c *gin.Context) {
-	var req struct {
-		KebunID      int     `json:"kebun_id" binding:"required"`
-		TanggalPanen string  `json:"tanggal_panen" binding:"required"`
-		JumlahKg     float64 `json:"jumlah_kg" binding:"required,gt=0"`
-		Grade        string  `json:"grade" binding:"required"`
-		KadarMinyak  float64 `json:"kadar_minyak"`
-		HargaPerKg   float64 `json:"harga_per_kg" binding:"required,gt=0"`
-		Keterangan   string  `json:"keterangan"`
+// validateStok checks a new batch against the kebun and blok master data
+func validateStok(stok repository.StokRepository, req *models.CreateStokRequest) string {
+	tanggal, err := time.Parse("2006-01-02", req.TanggalPanen)
+	if err != nil {
+		return "tanggal_panen must be YYYY-MM-DD"
+	}
+	if tanggal.After(time.Now()) {
+		return "tanggal_panen cannot be in the future"
+	}
+
+	kebunStatus, err := stok.KebunStatus(req.KebunID)
+	if err != nil {
+		return "Kebun not found"
+	}
+	if kebunStatus != "active" {
+		return "Kebun is not active"
+	}
+
+	// The blok must belong to the kebun and still be harvested
+	if req.BlokID != nil {
+		blokKebunID, blokStatus, err := stok.BlokOrigin(*req.BlokID)
+		if err != nil {
+			return "Blok not found"
+		}
+		if blokKebunID != req.KebunID {
+			return "Blok does not belong to the selected kebun"
+		}
+		if blokStatus != "active" {
+			return "Blok is not active"
+		}
 	}
+	return ""
+}
+
+// CreateStok creates new TBS stock (admin only)
+func (h *StokHandler) CreateStok(c *gin.Context) {
+	var req models.CreateStokRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if msg := validateStok(h.store.Stok(), &req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
 
-	result, err := config.DB.Exec(`
-		INSERT INTO stok_tbs (kebun_id, tanggal_panen, jumlah_kg, jumlah_tersedia, 
-		                      grade, kadar_minyak, harga_per_kg, keterangan, status)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'available')
-	`, req.KebunID, req.TanggalPanen, req.JumlahKg, req.JumlahKg, req.Grade, 
-	   req.KadarMinyak, req.HargaPerKg, req.Keterangan)
-
+	stokID, err := h.store.Stok().Create(req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create stock"})
 		return
 	}
 
-	stokID, _ := result.LastInsertId()
-
-	// Log aktivitas
-	userID, _ := c.Get("user_id")
-	config.DB.Exec(`
-		INSERT INTO log_aktivitas (user_id, aktivitas, modul, reference_id, ip_address)
-		VALUES (?, 'Menambah stok TBS', 'stok', ?, ?)
-	`, userID, stokID, c.ClientIP())
+	recordAuditTo(h.store.Logs(), c, auditEvent{
+		Aksi: "create", Entitas: "stok", ID: stokID,
+		Aktivitas: fmt.Sprintf("Menambah stok TBS %.2f kg grade %s", req.JumlahKg, req.Grade),
+	})
 
+	invalidateDashboard()
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Stock created successfully",
 		"stok_id": stokID,
 	})
 }
 
-// UpdateStok updates existing stock (admin only)
-func UpdateStok(c *gin.Context) {
-	stokID := c.Param("id")
+// UpdateStok updates price and notes of a batch. Quantities only change through
+// approved stock adjustments, and the status follows from them.
+func (h *StokHandler) UpdateStok(c *gin.Context) {
+	stokID := int(paramID(c))
 
 	var req struct {
-		JumlahTersedia float64 `json:"jumlah_tersedia"`
-		HargaPerKg     float64 `json:"harga_per_kg"`
-		Status         string  `json:"status"`
-		Keterangan     string  `json:"keterangan"`
+		JumlahTersedia *float64 `json:"jumlah_tersedia"`
+		HargaPerKg     *float64 `json:"harga_per_kg" binding:"omitempty,gt=0"`
+		Status         *string  `json:"status"`
+		Keterangan     *string  `json:"keterangan"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.JumlahTersedia != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "jumlah_tersedia can only be changed through a stock adjustment (POST /api/stok/:id/adjustments)"})
+		return
+	}
 
-	_, err := config.DB.Exec(`
-		UPDATE stok_tbs 
-		SET jumlah_tersedia = ?, harga_per_kg = ?, status = ?, keterangan = ?
-		WHERE id = ?
-	`, req.JumlahTersedia, req.HargaPerKg, req.Status, req.Keterangan, stokID)
+	if req.Status != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status is derived from jumlah_tersedia and cannot be set directly"})
+		return
+	}
 
+	_, err := h.store.Stok().Status(stokID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stock not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	// Log aktivitas
-	userID, _ := c.Get("user_id")
-	config.DB.Exec(`
-		INSERT INTO log_aktivitas (user_id, aktivitas, modul, reference_id, ip_address)
-		VALUES (?, 'Mengupdate stok TBS', 'stok', ?, ?)
-	`, userID, stokID, c.ClientIP())
-
-	c.JSON(http.StatusOK, gin.H{"message": "Stock updated successfully"})
-}
+	logs := h.store.Logs()
+	before := snapshotOf(logs, "stok", int64(stokID))
 
-// GetKebunList returns list of kebun
-func GetKebunList(c *gin.Context) {
-	rows, err := config.DB.Query(`
-		SELECT id, nama_kebun, lokasi, luas_hektar, koordinat, status, created_at, updated_at
-		FROM kebun
-		WHERE status = 'active'
-		ORDER BY nama_kebun
-	`)
+	err = h.store.Stok().Update(stokID, repository.StokUpdate{
+		HargaPerKg: req.HargaPerKg, Keterangan: req.Keterangan,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch kebun"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
 		return
 	}
-	defer rows.Close()
 
-	kebunList := make([]models.Kebun, 0)
-	for rows.Next() {
-		var kebun models.Kebun
-		err := rows.Scan(
-			&kebun.ID, &kebun.NamaKebun, &kebun.Lokasi, &kebun.LuasHektar,
-			&kebun.Koordinat, &kebun.Status, &kebun.CreatedAt, &kebun.UpdatedAt,
-		)
-		if err != nil {
-			continue
-		}
-		kebunList = append(kebunList, kebun)
-	}
+	recordAuditTo(logs, c, auditEvent{
+		Aksi: "update", Entitas: "stok", ID: int64(stokID), Sebelum: before,
+		Aktivitas: "Mengupdate stok TBS",
+	})
 
-	c.JSON(http.StatusOK, kebunList)
+	invalidateDashboard()
+	c.JSON(http.StatusOK, gin.H{"message": "Stock updated successfully"})
 }
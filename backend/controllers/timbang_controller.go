@@ -1,131 +1,115 @@
 package controllers
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
-	"sawit-backend/config"
+	"net/url"
+	"sawit-backend/domain"
 	"sawit-backend/models"
-	"strconv"
+	"sawit-backend/repository"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// TimbangHandler serves pickup schedules, the weighbridge and the sales documents
+// issued at weigh-out from injected repositories
+type TimbangHandler struct {
+	store repository.Store
+}
+
+// NewTimbangHandler returns a TimbangHandler backed by store
+func NewTimbangHandler(store repository.Store) *TimbangHandler {
+	return &TimbangHandler{store: store}
+}
+
 // CreateJadwal creates loading schedule
-func CreateJadwal(c *gin.Context) {
+func (h *TimbangHandler) CreateJadwal(c *gin.Context) {
 	var req models.CreateJadwalRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if PO is approved
-	var poStatus string
-	err := config.DB.QueryRow("SELECT status FROM purchase_orders WHERE id = ?", req.POID).Scan(&poStatus)
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
-		return
-	}
-	if poStatus != "approved" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "PO must be approved first"})
-		return
-	}
-
-	// Generate queue number
+	var jadwalID int64
 	var nomorAntrian int
-	config.DB.QueryRow(`
-		SELECT COALESCE(MAX(nomor_antrian), 0) + 1
-		FROM jadwal_pengambilan
-		WHERE DATE(waktu_loading) = DATE(?)
-	`, req.WaktuLoading).Scan(&nomorAntrian)
-
-	// Insert jadwal
-	result, err := config.DB.Exec(`
-		INSERT INTO jadwal_pengambilan (po_id, nomor_antrian, waktu_loading, plat_nomor, nama_sopir, status)
-		VALUES (?, ?, ?, ?, ?, 'scheduled')
-	`, req.POID, nomorAntrian, req.WaktuLoading, req.PlatNomor, req.NamaSopir)
+	err := h.store.WithTx(func(tx repository.Store) error {
+		// Check if PO is approved
+		po, err := tx.PurchaseOrders().Lock(req.POID)
+		if err == repository.ErrNotFound {
+			return fail(http.StatusNotFound, "Purchase order not found")
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := domain.POTransition(po.Status, "loading"); err != nil {
+			return fail(http.StatusBadRequest, "PO must be approved first")
+		}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schedule"})
-		return
-	}
+		// Generate queue number
+		if nomorAntrian, err = tx.Jadwal().NextAntrian(req.WaktuLoading); err != nil {
+			return err
+		}
+		if jadwalID, err = tx.Jadwal().Create(req, nomorAntrian); err != nil {
+			return err
+		}
 
-	jadwalID, _ := result.LastInsertId()
+		poBefore := snapshotOf(tx.Logs(), "po", int64(req.POID))
 
-	// Update PO status to loading
-	config.DB.Exec("UPDATE purchase_orders SET status = 'loading' WHERE id = ?", req.POID)
+		// Update PO status to loading and open the weighing record
+		if err := tx.PurchaseOrders().SetStatus(req.POID, "loading"); err != nil {
+			return err
+		}
+		if _, err := tx.Timbangan().Create(req.POID, jadwalID, req.PlatNomor); err != nil {
+			return err
+		}
 
-	// Create timbangan record
-	_, err = config.DB.Exec(`
-		INSERT INTO timbangan (po_id, jadwal_id, plat_nomor, status)
-		VALUES (?, ?, ?, 'weigh_in')
-	`, req.POID, jadwalID, req.PlatNomor)
-	
+		recordAuditTo(tx.Logs(), c, auditEvent{
+			Aksi: "create", Modul: "timbang", Entitas: "jadwal", ID: jadwalID,
+			Aktivitas: fmt.Sprintf("Menjadwalkan pengambilan antrian %d (%s)", nomorAntrian, req.PlatNomor),
+		})
+		recordAuditTo(tx.Logs(), c, auditEvent{
+			Aksi: "loading", Entitas: "po", ID: int64(req.POID), Sebelum: poBefore,
+			Aktivitas: "Update status PO menjadi loading",
+		})
+		return nil
+	})
 	if err != nil {
-		// Log error but don't fail the request since jadwal already created
-		fmt.Printf("Warning: Failed to create timbangan record: %v\n", err)
+		respondError(c, err, "Failed to create schedule")
+		return
 	}
 
+	invalidateDashboard()
 	c.JSON(http.StatusCreated, gin.H{
-		"message":        "Schedule created successfully",
-		"jadwal_id":      jadwalID,
-		"nomor_antrian":  nomorAntrian,
+		"message":       "Schedule created successfully",
+		"jadwal_id":     jadwalID,
+		"nomor_antrian": nomorAntrian,
 	})
 }
 
 // GetJadwalList returns list of loading schedules
-func GetJadwalList(c *gin.Context) {
-	status := c.Query("status")
-	date := c.Query("date")
-
-	query := `
-		SELECT j.id, j.po_id, j.nomor_antrian, j.waktu_loading, j.plat_nomor,
-		       j.nama_sopir, j.status, j.created_at, j.updated_at
-		FROM jadwal_pengambilan j
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	if status != "" {
-		query += " AND j.status = ?"
-		args = append(args, status)
-	}
-	if date != "" {
-		query += " AND DATE(j.waktu_loading) = ?"
-		args = append(args, date)
+func (h *TimbangHandler) GetJadwalList(c *gin.Context) {
+	buyerID, ok := scopeOwner(c, "jadwal")
+	if !ok {
+		return
 	}
 
-	query += " ORDER BY j.waktu_loading ASC"
-
-	rows, err := config.DB.Query(query, args...)
+	jadwalList, err := h.store.Jadwal().List(repository.JadwalFilter{
+		Status: c.Query("status"), Date: c.Query("date"), BuyerID: buyerID,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedules"})
 		return
 	}
-	defer rows.Close()
-
-	jadwalList := make([]models.JadwalPengambilan, 0)
-	for rows.Next() {
-		var jadwal models.JadwalPengambilan
-		err := rows.Scan(
-			&jadwal.ID, &jadwal.POID, &jadwal.NomorAntrian, &jadwal.WaktuLoading,
-			&jadwal.PlatNomor, &jadwal.NamaSopir, &jadwal.Status,
-			&jadwal.CreatedAt, &jadwal.UpdatedAt,
-		)
-		if err != nil {
-			continue
-		}
-		jadwalList = append(jadwalList, jadwal)
-	}
 
 	c.JSON(http.StatusOK, jadwalList)
 }
 
 // WeighIn records truck weight when entering
-func WeighIn(c *gin.Context) {
-	timbangID := c.Param("id")
-	userID, _ := c.Get("user_id")
+func (h *TimbangHandler) WeighIn(c *gin.Context) {
+	timbangID := int(paramID(c))
+	userID := c.GetInt("user_id")
 
 	var req models.WeighInRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -133,302 +117,269 @@ func WeighIn(c *gin.Context) {
 		return
 	}
 
-	now := time.Now()
-	_, err := config.DB.Exec(`
-		UPDATE timbangan
-		SET berat_masuk = ?, waktu_masuk = ?, petugas_masuk = ?, status = 'loading'
-		WHERE id = ?
-	`, req.BeratMasuk, now, userID, timbangID)
+	if req.Input == "" {
+		req.Input = "manual"
+	}
 
+	override := false
+	err := h.store.WithTx(func(tx repository.Store) error {
+		t, err := tx.Timbangan().FindByID(timbangID)
+		if err == repository.ErrNotFound {
+			return fail(http.StatusNotFound, "Weighing record not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		// A second weigh-in corrects the first one; the sales document is already
+		// based on the weights once the truck has weighed out
+		override = t.BeratMasuk != nil
+		if override && t.Status == "completed" {
+			return fail(http.StatusConflict, "Timbang keluar sudah dicatat, berat masuk tidak dapat diubah")
+		}
+		if override && strings.TrimSpace(req.AlasanOverride) == "" {
+			return fail(http.StatusBadRequest, "alasan_override is required to weigh in again")
+		}
+
+		before := snapshotOf(tx.Logs(), "timbangan", int64(timbangID))
+		now := time.Now()
+
+		if override {
+			// Keep the original arrival time so turnaround is measured from the first weigh-in
+			if err := tx.Timbangan().CorrectWeighIn(timbangID, req.BeratMasuk, now, userID, req.Input); err != nil {
+				return err
+			}
+			recordAuditTo(tx.Logs(), c, auditEvent{
+				Aksi: "override", Modul: "timbang", Entitas: "timbangan", ID: int64(timbangID), Sebelum: before,
+				Aktivitas: fmt.Sprintf("Override timbang masuk %.2f -> %.2f kg: %s", *t.BeratMasuk, req.BeratMasuk, req.AlasanOverride),
+			})
+			return nil
+		}
+
+		if err := tx.Timbangan().RecordWeighIn(timbangID, req.BeratMasuk, now, userID, req.Input); err != nil {
+			return err
+		}
+		if err := tx.Jadwal().SetStatusByTimbangan(timbangID, "in_progress"); err != nil {
+			return err
+		}
+
+		recordAuditTo(tx.Logs(), c, auditEvent{
+			Aksi: "weigh_in", Modul: "timbang", Entitas: "timbangan", ID: int64(timbangID), Sebelum: before,
+			Aktivitas: fmt.Sprintf("Timbang masuk %.2f kg (%s)", req.BeratMasuk, req.Input),
+		})
+		return nil
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record weigh-in"})
+		respondError(c, err, "Failed to record weigh-in")
 		return
 	}
 
-	// Update jadwal status
-	config.DB.Exec(`
-		UPDATE jadwal_pengambilan j
-		JOIN timbangan t ON j.id = t.jadwal_id
-		SET j.status = 'in_progress'
-		WHERE t.id = ?
-	`, timbangID)
+	if override {
+		c.JSON(http.StatusOK, gin.H{"message": "Weigh-in corrected successfully"})
+		return
+	}
 
+	invalidateDashboard()
 	c.JSON(http.StatusOK, gin.H{"message": "Weigh-in recorded successfully"})
 }
 
-// WeighOut records truck weight when exiting
-func WeighOut(c *gin.Context) {
-	timbangID := c.Param("id")
-	userID, _ := c.Get("user_id")
-
-	fmt.Printf("WeighOut - Timbang ID: %s, User ID: %v\n", timbangID, userID)
+// WeighOut records truck weight when exiting and issues the sales documents
+func (h *TimbangHandler) WeighOut(c *gin.Context) {
+	timbangID := int(paramID(c))
+	userID := c.GetInt("user_id")
 
 	var req models.WeighOutRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		fmt.Printf("WeighOut Error - Invalid request body: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	fmt.Printf("WeighOut Request - Berat Keluar: %.2f, Grade: %s\n", req.BeratKeluar, req.GradeAktual)
-
-	// Get current timbangan data
-	var beratMasuk sql.NullFloat64
-	var poID, jadwalID int
-	err := config.DB.QueryRow(`
-		SELECT berat_masuk, po_id, jadwal_id FROM timbangan WHERE id = ?
-	`, timbangID).Scan(&beratMasuk, &poID, &jadwalID)
-
-	if err != nil {
-		fmt.Printf("WeighOut Error - Failed to get timbangan: %v\n", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Weighing record not found"})
-		return
+	if req.Input == "" {
+		req.Input = "manual"
 	}
 
-	if !beratMasuk.Valid || beratMasuk.Float64 == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Berat masuk belum dicatat. Silakan lakukan weigh-in terlebih dahulu."})
-		return
-	}
-
-	// Calculate net weight
-	beratBersih := req.BeratKeluar - beratMasuk.Float64
-	fmt.Printf("WeighOut - Berat Masuk: %.2f, Berat Keluar: %.2f, Berat Bersih: %.2f\n", beratMasuk.Float64, req.BeratKeluar, beratBersih)
-
-	now := time.Now()
-	_, err = config.DB.Exec(`
-		UPDATE timbangan
-		SET berat_keluar = ?, waktu_keluar = ?, petugas_keluar = ?,
-		    berat_bersih = ?, grade_aktual = ?, kadar_air = ?, kadar_sampah = ?,
-		    tingkat_kematangan = ?, catatan = ?, status = 'completed'
-		WHERE id = ?
-	`, req.BeratKeluar, now, userID, beratBersih, req.GradeAktual,
-		req.KadarAir, req.KadarSampah, req.TingkatKematangan, req.Catatan, timbangID)
+	var beratBersih float64
+	err := h.store.WithTx(func(tx repository.Store) error {
+		t, err := tx.Timbangan().FindByID(timbangID)
+		if err == repository.ErrNotFound {
+			return fail(http.StatusNotFound, "Weighing record not found")
+		}
+		if err != nil {
+			return err
+		}
+		if t.BeratMasuk == nil || *t.BeratMasuk == 0 {
+			return fail(http.StatusBadRequest, "Berat masuk belum dicatat. Silakan lakukan weigh-in terlebih dahulu.")
+		}
 
-	if err != nil {
-		fmt.Printf("WeighOut Error - Failed to UPDATE timbangan: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record weigh-out: " + err.Error()})
-		return
-	}
+		// Calculate net weight
+		beratBersih, err = domain.BeratBersih(*t.BeratMasuk, req.BeratKeluar)
+		if err != nil {
+			return fail(http.StatusBadRequest, fmt.Sprintf("Berat keluar harus lebih besar dari berat masuk (%.2f kg)", *t.BeratMasuk))
+		}
 
-	// Update jadwal status
-	config.DB.Exec("UPDATE jadwal_pengambilan SET status = 'completed' WHERE id = ?", jadwalID)
+		logs := tx.Logs()
+		before := snapshotOf(logs, "timbangan", int64(timbangID))
+		jadwalBefore := snapshotOf(logs, "jadwal", int64(t.JadwalID))
+		poBefore := snapshotOf(logs, "po", int64(t.POID))
 
-	// Update PO status
-	config.DB.Exec("UPDATE purchase_orders SET status = 'completed' WHERE id = ?", poID)
+		if err := tx.Timbangan().RecordWeighOut(timbangID, req, beratBersih, time.Now(), userID); err != nil {
+			return err
+		}
+		if err := tx.Jadwal().SetStatus(t.JadwalID, "completed"); err != nil {
+			return err
+		}
+		if err := tx.PurchaseOrders().SetStatus(t.POID, "completed"); err != nil {
+			return err
+		}
 
-	// Convert timbangID to int
-	timbangIDInt, err := strconv.Atoi(timbangID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timbang ID"})
-		return
-	}
+		dokumenID, err := createDokumenPenjualan(tx, t.POID, timbangID, beratBersih, req.GradeAktual)
+		if err != nil {
+			return err
+		}
 
-	// Create dokumen penjualan
-	err = createDokumenPenjualan(poID, timbangIDInt, beratBersih, req.GradeAktual)
+		recordAuditTo(logs, c, auditEvent{
+			Aksi: "weigh_out", Modul: "timbang", Entitas: "timbangan", ID: int64(timbangID), Sebelum: before,
+			Aktivitas: fmt.Sprintf("Timbang keluar %.2f kg, berat bersih %.2f kg (%s)", req.BeratKeluar, beratBersih, req.Input),
+		})
+		recordAuditTo(logs, c, auditEvent{
+			Aksi: "completed", Modul: "timbang", Entitas: "jadwal", ID: int64(t.JadwalID), Sebelum: jadwalBefore,
+			Aktivitas: "Pengambilan selesai",
+		})
+		recordAuditTo(logs, c, auditEvent{
+			Aksi: "completed", Entitas: "po", ID: int64(t.POID), Sebelum: poBefore,
+			Aktivitas: "Update status PO menjadi completed",
+		})
+		recordAuditTo(logs, c, auditEvent{
+			Aksi: "create", Modul: "timbang", Entitas: "dokumen", ID: dokumenID,
+			Aktivitas: "Menerbitkan dokumen penjualan",
+		})
+		return nil
+	})
 	if err != nil {
-		fmt.Printf("WeighOut Error - Failed to create dokumen: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sales document: " + err.Error()})
+		respondError(c, err, "Failed to record weigh-out")
 		return
 	}
 
+	invalidateDashboard()
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Weigh-out recorded successfully",
 		"berat_bersih": beratBersih,
 	})
 }
 
-// createDokumenPenjualan creates sales documents
-func createDokumenPenjualan(poID, timbangID int, beratBersih float64, gradeAktual string) error {
+// createDokumenPenjualan creates sales documents and returns the document ID
+func createDokumenPenjualan(tx repository.Store, poID, timbangID int, beratBersih float64, gradeAktual string) (int64, error) {
 	// Get PO details
-	var hargaPerKg, gradeDiminta string
-	err := config.DB.QueryRow(`
-		SELECT harga_per_kg, grade_diminta FROM purchase_orders WHERE id = ?
-	`, poID).Scan(&hargaPerKg, &gradeDiminta)
-
+	po, err := tx.PurchaseOrders().FindByID(poID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Calculate price adjustment based on grade
 	var penyesuaian float64
-	hargaFloat := 0.0
-	fmt.Sscan(hargaPerKg, &hargaFloat)
-
-	if gradeAktual != gradeDiminta {
+	if gradeAktual != po.GradeDiminta {
 		// Grade B: -10%, Grade C: -20%
 		if gradeAktual == "B" {
-			penyesuaian = -0.10 * hargaFloat * beratBersih
+			penyesuaian = -0.10 * po.HargaPerKg * beratBersih
 		} else if gradeAktual == "C" {
-			penyesuaian = -0.20 * hargaFloat * beratBersih
+			penyesuaian = -0.20 * po.HargaPerKg * beratBersih
 		}
 	}
 
-	totalHarga := hargaFloat * beratBersih
+	totalHarga := po.HargaPerKg * beratBersih
 	totalAkhir := totalHarga + penyesuaian
 
 	// Generate document numbers
+	counter, err := tx.Dokumen().NextNumber()
+	if err != nil {
+		return 0, err
+	}
 	today := time.Now().Format("20060102")
-	var counter int
-	config.DB.QueryRow(`
-		SELECT COUNT(*) + 1 FROM dokumen_penjualan WHERE DATE(tanggal_dokumen) = CURDATE()
-	`).Scan(&counter)
-
-	nomorSJ := fmt.Sprintf("SJ-%s-%04d", today, counter)
-	nomorInv := fmt.Sprintf("INV-%s-%04d", today, counter)
-	nomorBT := fmt.Sprintf("BT-%s-%04d", today, counter)
-
-	// Insert dokumen
-	_, err = config.DB.Exec(`
-		INSERT INTO dokumen_penjualan (
-			po_id, timbang_id, nomor_surat_jalan, nomor_invoice, nomor_bukti_timbang,
-			tanggal_dokumen, jumlah_kg, harga_per_kg, total_harga, penyesuaian_harga, total_akhir
-		) VALUES (?, ?, ?, ?, ?, CURDATE(), ?, ?, ?, ?, ?)
-	`, poID, timbangID, nomorSJ, nomorInv, nomorBT, beratBersih, hargaFloat, totalHarga, penyesuaian, totalAkhir)
-
-	return err
+
+	return tx.Dokumen().Create(models.DokumenPenjualan{
+		POID: poID, TimbangID: timbangID,
+		NomorSuratJalan:   fmt.Sprintf("SJ-%s-%04d", today, counter),
+		NomorInvoice:      fmt.Sprintf("INV-%s-%04d", today, counter),
+		NomorBuktiTimbang: fmt.Sprintf("BT-%s-%04d", today, counter),
+		JumlahKg:          beratBersih, HargaPerKg: po.HargaPerKg,
+		TotalHarga: totalHarga, PenyesuaianHarga: penyesuaian, TotalAkhir: totalAkhir,
+	})
 }
 
-// GetTimbangan returns weighing records
-func GetTimbangan(c *gin.Context) {
-	poID := c.Query("po_id")
-	status := c.Query("status")
-
-	query := `
-		SELECT id, po_id, jadwal_id, plat_nomor, berat_masuk, waktu_masuk, petugas_masuk,
-		       berat_keluar, waktu_keluar, petugas_keluar, berat_bersih, grade_aktual,
-		       kadar_air, kadar_sampah, tingkat_kematangan, status, catatan, created_at, updated_at
-		FROM timbangan
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	if poID != "" {
-		query += " AND po_id = ?"
-		args = append(args, poID)
+// timbanganFilter reads the weighing list filters; owner limits it to one buyer
+func timbanganFilter(f url.Values, owner *int) repository.TimbanganFilter {
+	return repository.TimbanganFilter{
+		POID: f.Get("po_id"), Status: f.Get("status"), Grade: f.Get("grade"),
+		StartDate: f.Get("start_date"), EndDate: f.Get("end_date"), BuyerID: owner,
 	}
-	if status != "" {
-		query += " AND status = ?"
-		args = append(args, status)
+}
+
+// GetTimbangan returns weighing records, or a file with ?format=xlsx|csv|pdf
+func (h *TimbangHandler) GetTimbangan(c *gin.Context) {
+	format, ok := exportFormat(c)
+	if !ok {
+		return
 	}
 
-	query += " ORDER BY created_at DESC"
+	// Buyers only see the weighing of their own orders
+	buyerID, ok := scopeOwner(c, "timbangan")
+	if !ok {
+		return
+	}
 
-	fmt.Printf("GetTimbangan Query: %s\n", query)
-	fmt.Printf("GetTimbangan Args: %v\n", args)
+	if format != "" {
+		sendExport(c, h.store, format, reportSources["timbangan"], buyerID)
+		return
+	}
 
-	rows, err := config.DB.Query(query, args...)
+	timbangList, err := h.store.Timbangan().List(timbanganFilter(c.Request.URL.Query(), buyerID))
 	if err != nil {
-		fmt.Printf("GetTimbangan Error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weighing records"})
 		return
 	}
-	defer rows.Close()
-
-	timbangList := make([]models.Timbangan, 0)
-	for rows.Next() {
-		var t models.Timbangan
-		err := rows.Scan(
-			&t.ID, &t.POID, &t.JadwalID, &t.PlatNomor, &t.BeratMasuk, &t.WaktuMasuk, &t.PetugasMasuk,
-			&t.BeratKeluar, &t.WaktuKeluar, &t.PetugasKeluar, &t.BeratBersih, &t.GradeAktual,
-			&t.KadarAir, &t.KadarSampah, &t.TingkatKematangan, &t.Status, &t.Catatan, &t.CreatedAt, &t.UpdatedAt,
-		)
-		if err != nil {
-			fmt.Printf("GetTimbangan Scan Error: %v\n", err)
-			continue
-		}
-		timbangList = append(timbangList, t)
-	}
 
-	fmt.Printf("GetTimbangan Found %d records\n", len(timbangList))
 	c.JSON(http.StatusOK, timbangList)
 }
 
 // GetDokumen returns sales documents
-func GetDokumen(c *gin.Context) {
-	poID := c.Query("po_id")
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-
-	query := `
-		SELECT dp.id, dp.po_id, dp.timbang_id, dp.nomor_surat_jalan, dp.nomor_invoice, dp.nomor_bukti_timbang,
-		       dp.tanggal_dokumen, dp.jumlah_kg, dp.harga_per_kg, dp.total_harga, dp.penyesuaian_harga, dp.total_akhir,
-		       dp.file_surat_jalan, dp.file_invoice, dp.file_bukti_timbang, dp.file_quality_report,
-		       dp.created_at, dp.updated_at,
-		       po.po_number, po.grade_diminta, u.username as buyer_name, u.company_name as perusahaan
-		FROM dokumen_penjualan dp
-		JOIN purchase_orders po ON dp.po_id = po.id
-		JOIN users u ON po.buyer_id = u.id
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	if poID != "" {
-		query += " AND dp.po_id = ?"
-		args = append(args, poID)
-	}
-
-	if startDate != "" {
-		query += " AND DATE(dp.tanggal_dokumen) >= ?"
-		args = append(args, startDate)
-	}
-
-	if endDate != "" {
-		query += " AND DATE(dp.tanggal_dokumen) <= ?"
-		args = append(args, endDate)
+func (h *TimbangHandler) GetDokumen(c *gin.Context) {
+	buyerID, ok := scopeOwner(c, "dokumen")
+	if !ok {
+		return
 	}
 
-	query += " ORDER BY dp.created_at DESC"
-
-	rows, err := config.DB.Query(query, args...)
+	rows, err := h.store.Dokumen().List(repository.DokumenFilter{
+		POID: c.Query("po_id"), StartDate: c.Query("start_date"), EndDate: c.Query("end_date"), BuyerID: buyerID,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch documents"})
 		return
 	}
-	defer rows.Close()
-
-	dokumenList := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var id, poID, timbangID int
-		var nomorSJ, nomorInvoice, nomorBukti, poNumber, grade, buyerName, perusahaan string
-		var tanggalDokumen, createdAt, updatedAt string
-		var jumlahKg, hargaPerKg, totalHarga, penyesuaianHarga, totalAkhir float64
-		var fileSJ, fileInvoice, fileBukti, fileQuality sql.NullString
-
-		err := rows.Scan(
-			&id, &poID, &timbangID, &nomorSJ, &nomorInvoice, &nomorBukti,
-			&tanggalDokumen, &jumlahKg, &hargaPerKg, &totalHarga, &penyesuaianHarga, &totalAkhir,
-			&fileSJ, &fileInvoice, &fileBukti, &fileQuality,
-			&createdAt, &updatedAt,
-			&poNumber, &grade, &buyerName, &perusahaan,
-		)
-		if err != nil {
-			continue
-		}
-
-		dokumen := map[string]interface{}{
-			"id":                   id,
-			"dokumen_id":           id,
-			"po_id":                poID,
-			"timbang_id":           timbangID,
-			"nomor_surat_jalan":    nomorSJ,
-			"nomor_invoice":        nomorInvoice,
-			"nomor_bukti_timbang":  nomorBukti,
-			"tanggal_dokumen":      tanggalDokumen,
-			"total_berat_kg":       jumlahKg,
-			"jumlah_kg":            jumlahKg,
-			"harga_per_kg":         hargaPerKg,
-			"total_harga":          totalAkhir,
-			"total_akhir":          totalAkhir,
-			"created_at":           createdAt,
-			"updated_at":           updatedAt,
-			"po_number":            poNumber,
-			"nomor_po":             poNumber,
-			"grade":                grade,
-			"buyer_name":           buyerName,
-			"perusahaan":           perusahaan,
-		}
 
-		dokumenList = append(dokumenList, dokumen)
+	dokumenList := make([]map[string]interface{}, 0, len(rows))
+	for _, d := range rows {
+		dokumenList = append(dokumenList, map[string]interface{}{
+			"id":                  d.ID,
+			"dokumen_id":          d.ID,
+			"po_id":               d.POID,
+			"timbang_id":          d.TimbangID,
+			"nomor_surat_jalan":   d.NomorSuratJalan,
+			"nomor_invoice":       d.NomorInvoice,
+			"nomor_bukti_timbang": d.NomorBuktiTimbang,
+			"tanggal_dokumen":     d.TanggalDokumen,
+			"total_berat_kg":      d.JumlahKg,
+			"jumlah_kg":           d.JumlahKg,
+			"harga_per_kg":        d.HargaPerKg,
+			"total_harga":         d.TotalAkhir,
+			"total_akhir":         d.TotalAkhir,
+			"created_at":          d.CreatedAt,
+			"updated_at":          d.UpdatedAt,
+			"po_number":           d.PONumber,
+			"nomor_po":            d.PONumber,
+			"grade":               d.Grade,
+			"buyer_name":          d.BuyerName,
+			"perusahaan":          d.Perusahaan,
+		})
 	}
 
 	c.JSON(http.StatusOK, dokumenList)
@@ -0,0 +1,443 @@
+package controllers
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"sawit-backend/config"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// weighShifts are the weighbridge shifts by starting hour; the last one runs past midnight
+var weighShifts = []struct {
+	nama  string
+	mulai int
+}{
+	{"pagi", 6},
+	{"siang", 14},
+	{"malam", 22},
+}
+
+func shiftOf(t time.Time) string {
+	h := t.Hour()
+	for i := len(weighShifts) - 1; i >= 0; i-- {
+		if h >= weighShifts[i].mulai {
+			return weighShifts[i].nama
+		}
+	}
+	return weighShifts[len(weighShifts)-1].nama
+}
+
+// weighVisit is one scheduled truck and what happened at the weighbridge
+type weighVisit struct {
+	JadwalID     int
+	NomorAntrian int
+	PlatNomor    string
+	WaktuLoading time.Time
+	KebunID      int
+	NamaKebun    string
+	Masuk        sql.NullTime
+	Keluar       sql.NullTime
+	PetugasMasuk sql.NullInt64
+	NamaMasuk    sql.NullString
+	PetugasKlr   sql.NullInt64
+	NamaKeluar   sql.NullString
+	InputMasuk   sql.NullString
+	InputKeluar  sql.NullString
+	Override     int
+}
+
+// durations collects minutes for average, p90 and maximum
+type durations []float64
+
+func (d durations) toJSON() gin.H {
+	out := gin.H{"jumlah": len(d), "rata_rata_menit": 0.0, "p90_menit": 0.0, "maks_menit": 0.0}
+	if len(d) == 0 {
+		return out
+	}
+	sorted := append(durations(nil), d...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	// Nearest-rank percentile
+	p90 := sorted[int(math.Ceil(0.9*float64(len(sorted))))-1]
+	out["rata_rata_menit"] = round2(sum / float64(len(sorted)))
+	out["p90_menit"] = round2(p90)
+	out["maks_menit"] = round2(sorted[len(sorted)-1])
+	return out
+}
+
+func (d durations) mean() float64 {
+	if len(d) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range d {
+		sum += v
+	}
+	return sum / float64(len(d))
+}
+
+// turnaround accumulates the stages of a group of visits
+type turnaround struct {
+	info       gin.H
+	jadwal     int
+	selesai    int
+	belumMasuk int
+	tunggu     durations // schedule to weigh-in; early arrivals count as 0
+	muat       durations // weigh-in to weigh-out
+	total      durations // schedule to weigh-out
+}
+
+func (ta *turnaround) add(v weighVisit) {
+	ta.jadwal++
+	if !v.Masuk.Valid {
+		ta.belumMasuk++
+		return
+	}
+	tunggu := math.Max(0, v.Masuk.Time.Sub(v.WaktuLoading).Minutes())
+	ta.tunggu = append(ta.tunggu, tunggu)
+	if v.Keluar.Valid {
+		ta.selesai++
+		muat := v.Keluar.Time.Sub(v.Masuk.Time).Minutes()
+		ta.muat = append(ta.muat, muat)
+		ta.total = append(ta.total, tunggu+muat)
+	}
+}
+
+func (ta *turnaround) toJSON() gin.H {
+	row := gin.H{
+		"jumlah_jadwal":    ta.jadwal,
+		"selesai":          ta.selesai,
+		"belum_masuk":      ta.belumMasuk,
+		"jadwal_ke_masuk":  ta.tunggu.toJSON(),
+		"masuk_ke_keluar":  ta.muat.toJSON(),
+		"jadwal_ke_keluar": ta.total.toJSON(),
+	}
+	for k, v := range ta.info {
+		row[k] = v
+	}
+	return row
+}
+
+type weighOperator struct {
+	id           int64
+	nama         string
+	masuk        int
+	keluar       int
+	manualMasuk  int
+	manualKeluar int
+	override     int
+	shift        map[string]map[string]int
+	muat         durations
+}
+
+func loadWeighVisits(start, end time.Time, kebunID string) ([]weighVisit, error) {
+	query := `
+		SELECT j.id, j.nomor_antrian, COALESCE(j.plat_nomor, ''), j.waktu_loading, po.kebun_id, k.nama_kebun,
+		       t.waktu_masuk, t.waktu_keluar, t.petugas_masuk, um.username, t.petugas_keluar, uk.username,
+		       t.input_masuk, t.input_keluar, COALESCE(t.jumlah_override, 0)
+		FROM jadwal_pengambilan j
+		JOIN purchase_orders po ON j.po_id = po.id
+		JOIN kebun k ON po.kebun_id = k.id
+		LEFT JOIN timbangan t ON t.jadwal_id = j.id
+		LEFT JOIN users um ON t.petugas_masuk = um.id
+		LEFT JOIN users uk ON t.petugas_keluar = uk.id
+		WHERE j.status <> 'cancelled' AND j.waktu_loading >= ? AND j.waktu_loading < ?
+	`
+	args := []interface{}{start, end.AddDate(0, 0, 1)}
+	if kebunID != "" {
+		query += " AND po.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	query += " ORDER BY j.waktu_loading, j.nomor_antrian"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []weighVisit
+	for rows.Next() {
+		var v weighVisit
+		if err := rows.Scan(&v.JadwalID, &v.NomorAntrian, &v.PlatNomor, &v.WaktuLoading, &v.KebunID, &v.NamaKebun,
+			&v.Masuk, &v.Keluar, &v.PetugasMasuk, &v.NamaMasuk, &v.PetugasKlr, &v.NamaKeluar,
+			&v.InputMasuk, &v.InputKeluar, &v.Override); err != nil {
+			return nil, err
+		}
+		visits = append(visits, v)
+	}
+	return visits, rows.Err()
+}
+
+// peakQueue sweeps one day's arrivals and weigh-ins and returns the longest
+// queue of trucks past their loading time but not yet weighed in. Trucks that
+// never weighed in leave the queue at the end of the day (or now, for today).
+func peakQueue(visits []weighVisit, dayEnd time.Time) (int, time.Time) {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+	var events []event
+	for _, v := range visits {
+		leave := dayEnd
+		if v.Masuk.Valid {
+			leave = v.Masuk.Time
+		}
+		if !leave.After(v.WaktuLoading) {
+			continue
+		}
+		events = append(events, event{v.WaktuLoading, 1}, event{leave, -1})
+	}
+	// Departures before arrivals at the same instant
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+
+	var queue, peak int
+	var peakAt time.Time
+	for _, e := range events {
+		queue += e.delta
+		if queue > peak {
+			peak, peakAt = queue, e.at
+		}
+	}
+	return peak, peakAt
+}
+
+// GetWeighbridgeReport reports turnaround from schedule to weigh-in to
+// weigh-out, operator workload per shift, manual entries and overrides, and
+// the truck queue against jadwal_pengambilan.waktu_loading
+func GetWeighbridgeReport(c *gin.Context) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	start := end.AddDate(0, 0, -6)
+	var err error
+	if s := c.Query("start_date"); s != "" {
+		if start, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be YYYY-MM-DD"})
+			return
+		}
+	}
+	if s := c.Query("end_date"); s != "" {
+		if end, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be YYYY-MM-DD"})
+			return
+		}
+	}
+	if end.Before(start) || end.Sub(start) > 92*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must not be after end_date and the range cannot exceed 92 days"})
+		return
+	}
+
+	visits, err := loadWeighVisits(start, end, c.Query("kebun_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch weighbridge data"})
+		return
+	}
+
+	total := &turnaround{}
+	perHari := make(map[string]*turnaround)
+	perKebun := make(map[int]*turnaround)
+	visitsByDay := make(map[string][]weighVisit)
+	operators := make(map[int64]*weighOperator)
+	var hariOrder []string
+	var kebunOrder []int
+
+	type hourStat struct {
+		dijadwalkan int
+		masuk       int
+		tunggu      durations
+	}
+	var perJam [24]hourStat
+
+	var manualMasuk, scaleMasuk, manualKeluar, scaleKeluar, override, trukOverride int
+	menunggu := make([]gin.H, 0)
+
+	operator := func(id sql.NullInt64, nama sql.NullString) *weighOperator {
+		op, ok := operators[id.Int64]
+		if !ok {
+			op = &weighOperator{id: id.Int64, nama: nama.String, shift: map[string]map[string]int{}}
+			for _, s := range weighShifts {
+				op.shift[s.nama] = map[string]int{"timbang_masuk": 0, "timbang_keluar": 0}
+			}
+			operators[id.Int64] = op
+		}
+		return op
+	}
+
+	for _, v := range visits {
+		hari := v.WaktuLoading.Format("2006-01-02")
+		if perHari[hari] == nil {
+			perHari[hari] = &turnaround{info: gin.H{"tanggal": hari}}
+			hariOrder = append(hariOrder, hari)
+		}
+		if perKebun[v.KebunID] == nil {
+			perKebun[v.KebunID] = &turnaround{info: gin.H{"kebun_id": v.KebunID, "nama_kebun": v.NamaKebun}}
+			kebunOrder = append(kebunOrder, v.KebunID)
+		}
+		total.add(v)
+		perHari[hari].add(v)
+		perKebun[v.KebunID].add(v)
+		visitsByDay[hari] = append(visitsByDay[hari], v)
+
+		jam := &perJam[v.WaktuLoading.Hour()]
+		jam.dijadwalkan++
+		if v.Masuk.Valid {
+			perJam[v.Masuk.Time.Hour()].masuk++
+			jam.tunggu = append(jam.tunggu, math.Max(0, v.Masuk.Time.Sub(v.WaktuLoading).Minutes()))
+		} else if v.WaktuLoading.Before(now) {
+			menunggu = append(menunggu, gin.H{
+				"jadwal_id":       v.JadwalID,
+				"nomor_antrian":   v.NomorAntrian,
+				"plat_nomor":      v.PlatNomor,
+				"nama_kebun":      v.NamaKebun,
+				"waktu_loading":   v.WaktuLoading,
+				"terlambat_menit": int(now.Sub(v.WaktuLoading).Minutes()),
+			})
+		}
+
+		if v.Masuk.Valid && v.PetugasMasuk.Valid {
+			op := operator(v.PetugasMasuk, v.NamaMasuk)
+			op.masuk++
+			op.shift[shiftOf(v.Masuk.Time)]["timbang_masuk"]++
+			op.override += v.Override
+			if v.InputMasuk.String == "manual" {
+				op.manualMasuk++
+			}
+		}
+		if v.Keluar.Valid && v.PetugasKlr.Valid {
+			op := operator(v.PetugasKlr, v.NamaKeluar)
+			op.keluar++
+			op.shift[shiftOf(v.Keluar.Time)]["timbang_keluar"]++
+			if v.InputKeluar.String == "manual" {
+				op.manualKeluar++
+			}
+			if v.Masuk.Valid {
+				op.muat = append(op.muat, v.Keluar.Time.Sub(v.Masuk.Time).Minutes())
+			}
+		}
+
+		switch v.InputMasuk.String {
+		case "manual":
+			manualMasuk++
+		case "scale":
+			scaleMasuk++
+		}
+		switch v.InputKeluar.String {
+		case "manual":
+			manualKeluar++
+		case "scale":
+			scaleKeluar++
+		}
+		override += v.Override
+		if v.Override > 0 {
+			trukOverride++
+		}
+	}
+	hariList := make([]gin.H, 0, len(hariOrder))
+	for _, hari := range hariOrder {
+		row := perHari[hari].toJSON()
+		dayEnd, _ := time.ParseInLocation("2006-01-02", hari, time.Local)
+		dayEnd = dayEnd.AddDate(0, 0, 1)
+		if dayEnd.After(now) {
+			dayEnd = now
+		}
+		peak, peakAt := peakQueue(visitsByDay[hari], dayEnd)
+		row["antrian_puncak"] = peak
+		if peak > 0 {
+			row["waktu_antrian_puncak"] = peakAt
+		}
+		hariList = append(hariList, row)
+	}
+
+	sort.Slice(kebunOrder, func(i, j int) bool {
+		return perKebun[kebunOrder[i]].info["nama_kebun"].(string) < perKebun[kebunOrder[j]].info["nama_kebun"].(string)
+	})
+	kebunList := make([]gin.H, 0, len(kebunOrder))
+	for _, id := range kebunOrder {
+		kebunList = append(kebunList, perKebun[id].toJSON())
+	}
+
+	opList := make([]gin.H, 0, len(operators))
+	for _, op := range operators {
+		opList = append(opList, gin.H{
+			"user_id":               op.id,
+			"nama":                  op.nama,
+			"timbang_masuk":         op.masuk,
+			"timbang_keluar":        op.keluar,
+			"truk_ditangani":        op.masuk + op.keluar,
+			"per_shift":             op.shift,
+			"timbang_masuk_manual":  op.manualMasuk,
+			"timbang_keluar_manual": op.manualKeluar,
+			"jumlah_override":       op.override,
+			"masuk_ke_keluar":       op.muat.toJSON(),
+		})
+	}
+	sort.Slice(opList, func(i, j int) bool {
+		return opList[i]["truk_ditangani"].(int) > opList[j]["truk_ditangani"].(int)
+	})
+
+	jamList := make([]gin.H, 0, 24)
+	for h, js := range perJam {
+		if js.dijadwalkan == 0 && js.masuk == 0 {
+			continue
+		}
+		jamList = append(jamList, gin.H{
+			"jam":             strconv.Itoa(h) + ":00",
+			"dijadwalkan":     js.dijadwalkan,
+			"timbang_masuk":   js.masuk,
+			"selisih":         js.dijadwalkan - js.masuk,
+			"jadwal_ke_masuk": js.tunggu.toJSON(),
+		})
+	}
+
+	// Bottleneck hours: the longest average wait from loading time to weigh-in
+	bottleneck := make([]gin.H, 0, 3)
+	hours := make([]int, 0, 24)
+	for h := range perJam {
+		if len(perJam[h].tunggu) > 0 {
+			hours = append(hours, h)
+		}
+	}
+	sort.Slice(hours, func(i, j int) bool { return perJam[hours[i]].tunggu.mean() > perJam[hours[j]].tunggu.mean() })
+	for i, h := range hours {
+		if i == 3 {
+			break
+		}
+		bottleneck = append(bottleneck, gin.H{
+			"jam":             strconv.Itoa(h) + ":00",
+			"rata_rata_menit": round2(perJam[h].tunggu.mean()),
+			"dijadwalkan":     perJam[h].dijadwalkan,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":    gin.H{"start_date": start.Format("2006-01-02"), "end_date": end.Format("2006-01-02")},
+		"ringkasan": total.toJSON(),
+		"per_hari":  hariList,
+		"per_kebun": kebunList,
+		"operator":  opList,
+		"entri": gin.H{
+			"timbang_masuk_manual":  manualMasuk,
+			"timbang_masuk_scale":   scaleMasuk,
+			"timbang_keluar_manual": manualKeluar,
+			"timbang_keluar_scale":  scaleKeluar,
+			"jumlah_override":       override,
+			"truk_dengan_override":  trukOverride,
+		},
+		"per_jam":   jamList,
+		"jam_sibuk": bottleneck,
+		"menunggu":  menunggu,
+	})
+}
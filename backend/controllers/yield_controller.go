@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"sawit-backend/config"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// yieldBlok is a planted blok with the attributes used for yield grouping
+type yieldBlok struct {
+	ID           int
+	KodeBlok     string
+	KodeAfdeling string
+	KebunID      int
+	NamaKebun    string
+	TahunTanam   int
+	LuasHektar   float64
+}
+
+// ageCohort buckets palm age into the usual plantation phases
+func ageCohort(umur int) string {
+	switch {
+	case umur <= 3:
+		return "TBM (0-3 tahun)"
+	case umur <= 7:
+		return "TM muda (4-7 tahun)"
+	case umur <= 14:
+		return "TM remaja (8-14 tahun)"
+	case umur <= 20:
+		return "TM dewasa (15-20 tahun)"
+	default:
+		return "TM tua (21+ tahun)"
+	}
+}
+
+// loadYieldBlok returns productive bloks, optionally for one kebun
+func loadYieldBlok(kebunID string) ([]yieldBlok, error) {
+	query := `
+		SELECT b.id, b.kode_blok, a.kode_afdeling, a.kebun_id, k.nama_kebun, b.tahun_tanam, b.luas_hektar
+		FROM blok b
+		JOIN afdeling a ON b.afdeling_id = a.id
+		JOIN kebun k ON a.kebun_id = k.id
+		WHERE b.status != 'inactive'
+	`
+	args := []interface{}{}
+	if kebunID != "" {
+		query += " AND a.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	query += " ORDER BY k.nama_kebun, a.kode_afdeling, b.kode_blok"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bloks []yieldBlok
+	for rows.Next() {
+		var b yieldBlok
+		if err := rows.Scan(&b.ID, &b.KodeBlok, &b.KodeAfdeling, &b.KebunID, &b.NamaKebun,
+			&b.TahunTanam, &b.LuasHektar); err != nil {
+			continue
+		}
+		bloks = append(bloks, b)
+	}
+	return bloks, rows.Err()
+}
+
+// loadMonthlyHarvest returns harvested kg and bunches keyed by blok and "YYYY-MM"
+func loadMonthlyHarvest(start, end time.Time) (map[int]map[string][2]float64, error) {
+	rows, err := config.DB.Query(`
+		SELECT blok_id, DATE_FORMAT(tanggal_panen, '%Y-%m') AS bulan,
+		       SUM(berat_kg), SUM(jumlah_janjang)
+		FROM panen
+		WHERE tanggal_panen >= ? AND tanggal_panen < ?
+		GROUP BY blok_id, bulan
+	`, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	harvest := make(map[int]map[string][2]float64)
+	for rows.Next() {
+		var blokID int
+		var bulan string
+		var kg, janjang float64
+		if err := rows.Scan(&blokID, &bulan, &kg, &janjang); err != nil {
+			continue
+		}
+		if harvest[blokID] == nil {
+			harvest[blokID] = make(map[string][2]float64)
+		}
+		harvest[blokID][bulan] = [2]float64{kg, janjang}
+	}
+	return harvest, rows.Err()
+}
+
+// loadNormaProduksi returns the age norm in ton/ha/year keyed by age
+func loadNormaProduksi() (map[int]float64, int, error) {
+	rows, err := config.DB.Query("SELECT umur_tahun, ton_per_ha_tahun FROM norma_produksi")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	norma := make(map[int]float64)
+	maxUmur := 0
+	for rows.Next() {
+		var umur int
+		var ton float64
+		if err := rows.Scan(&umur, &ton); err != nil {
+			continue
+		}
+		norma[umur] = ton
+		if umur > maxUmur {
+			maxUmur = umur
+		}
+	}
+	return norma, maxUmur, rows.Err()
+}
+
+// normaFor returns the yearly norm for an age; ages past the table use the oldest entry
+func normaFor(norma map[int]float64, maxUmur, umur int) float64 {
+	if umur > maxUmur {
+		return norma[maxUmur]
+	}
+	return norma[umur]
+}
+
+// parseMonthRange reads start_month/end_month (YYYY-MM), defaulting to the last 12 months
+func parseMonthRange(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	start := end.AddDate(0, -11, 0)
+
+	if s := c.Query("start_month"); s != "" {
+		t, err := time.ParseInLocation("2006-01", s, time.Local)
+		if err != nil {
+			return start, end, false
+		}
+		start = t
+	}
+	if s := c.Query("end_month"); s != "" {
+		t, err := time.ParseInLocation("2006-01", s, time.Local)
+		if err != nil {
+			return start, end, false
+		}
+		end = t
+	}
+	return start, end, !end.Before(start)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// GetYieldReport returns tonnes per hectare per month grouped by blok, age cohort or kebun
+func GetYieldReport(c *gin.Context) {
+	groupBy := c.DefaultQuery("group_by", "kebun")
+	if groupBy != "blok" && groupBy != "cohort" && groupBy != "kebun" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be blok, cohort or kebun"})
+		return
+	}
+
+	start, end, ok := parseMonthRange(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_month and end_month must be YYYY-MM with start_month <= end_month"})
+		return
+	}
+	if end.Sub(start) > 3*366*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Range cannot exceed 36 months"})
+		return
+	}
+
+	bloks, err := loadYieldBlok(c.Query("kebun_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blok"})
+		return
+	}
+	harvest, err := loadMonthlyHarvest(start, end.AddDate(0, 1, 0))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch harvest"})
+		return
+	}
+	norma, maxUmur, err := loadNormaProduksi()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch production norms"})
+		return
+	}
+
+	type bucket struct {
+		key, bulan        string
+		info              gin.H
+		luas, kg, janjang float64
+		normaTon          float64
+	}
+	// order keeps rows sorted by month, then in blok order within the month
+	buckets := make(map[string]*bucket)
+	var order []string
+
+	// Area counts every planted blok of the group, harvested that month or not
+	for month := start; !month.After(end); month = month.AddDate(0, 1, 0) {
+		bulan := month.Format("2006-01")
+		for _, b := range bloks {
+			umur := month.Year() - b.TahunTanam
+
+			var key string
+			var info gin.H
+			switch groupBy {
+			case "blok":
+				key = strconv.Itoa(b.ID)
+				info = gin.H{
+					"blok_id":       b.ID,
+					"kode_blok":     b.KodeBlok,
+					"kode_afdeling": b.KodeAfdeling,
+					"kebun_id":      b.KebunID,
+					"nama_kebun":    b.NamaKebun,
+					"tahun_tanam":   b.TahunTanam,
+					"umur_tahun":    umur,
+				}
+			case "cohort":
+				key = ageCohort(umur)
+				info = gin.H{"cohort": key}
+			case "kebun":
+				key = strconv.Itoa(b.KebunID)
+				info = gin.H{"kebun_id": b.KebunID, "nama_kebun": b.NamaKebun}
+			}
+
+			id := bulan + "|" + key
+			bk, exists := buckets[id]
+			if !exists {
+				bk = &bucket{key: key, bulan: bulan, info: info}
+				buckets[id] = bk
+				order = append(order, id)
+			}
+			h := harvest[b.ID][bulan]
+			bk.luas += b.LuasHektar
+			bk.kg += h[0]
+			bk.janjang += h[1]
+			bk.normaTon += normaFor(norma, maxUmur, umur) / 12 * b.LuasHektar
+		}
+	}
+
+	report := make([]gin.H, 0, len(order))
+	for _, id := range order {
+		bk := buckets[id]
+		row := gin.H{
+			"bulan":          bk.bulan,
+			"luas_hektar":    round2(bk.luas),
+			"produksi_ton":   round2(bk.kg / 1000),
+			"jumlah_janjang": int(bk.janjang),
+			"bjr_kg":         0.0,
+			"ton_per_ha":     0.0,
+			"norma_ton_ha":   0.0,
+		}
+		for k, v := range bk.info {
+			row[k] = v
+		}
+		if bk.janjang > 0 {
+			row["bjr_kg"] = round2(bk.kg / bk.janjang)
+		}
+		if bk.luas > 0 {
+			row["ton_per_ha"] = round2(bk.kg / 1000 / bk.luas)
+			row["norma_ton_ha"] = round2(bk.normaTon / bk.luas)
+		}
+		report = append(report, row)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group_by":    groupBy,
+		"start_month": start.Format("2006-01"),
+		"end_month":   end.Format("2006-01"),
+		"data":        report,
+	})
+}
+
+// GetUnderperformingBlok flags mature bloks whose yield over the last months
+// falls below a percentage of the norm for their age
+func GetUnderperformingBlok(c *gin.Context) {
+	months, err := strconv.Atoi(c.DefaultQuery("months", "12"))
+	if err != nil || months < 1 || months > 36 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "months must be between 1 and 36"})
+		return
+	}
+	threshold := float64(config.AppConfig.YieldAlertPct)
+	if t := c.Query("threshold"); t != "" {
+		threshold, err = strconv.ParseFloat(t, 64)
+		if err != nil || threshold <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a positive percentage"})
+			return
+		}
+	}
+
+	// Only complete months are compared
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	start := end.AddDate(0, -months, 0)
+
+	bloks, err := loadYieldBlok(c.Query("kebun_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blok"})
+		return
+	}
+	harvest, err := loadMonthlyHarvest(start, end)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch harvest"})
+		return
+	}
+	norma, maxUmur, err := loadNormaProduksi()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch production norms"})
+		return
+	}
+
+	flagged := make([]gin.H, 0)
+	evaluated := 0
+	for _, b := range bloks {
+		if b.LuasHektar <= 0 {
+			continue
+		}
+
+		var actualKg, normaTonHa float64
+		for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+			actualKg += harvest[b.ID][month.Format("2006-01")][0]
+			normaTonHa += normaFor(norma, maxUmur, month.Year()-b.TahunTanam) / 12
+		}
+		// Immature bloks have no norm and are not judged
+		if normaTonHa <= 0 {
+			continue
+		}
+		evaluated++
+
+		actualTonHa := actualKg / 1000 / b.LuasHektar
+		persen := actualTonHa / normaTonHa * 100
+		if persen >= threshold {
+			continue
+		}
+
+		flagged = append(flagged, gin.H{
+			"blok_id":        b.ID,
+			"kode_blok":      b.KodeBlok,
+			"kode_afdeling":  b.KodeAfdeling,
+			"kebun_id":       b.KebunID,
+			"nama_kebun":     b.NamaKebun,
+			"tahun_tanam":    b.TahunTanam,
+			"umur_tahun":     now.Year() - b.TahunTanam,
+			"cohort":         ageCohort(now.Year() - b.TahunTanam),
+			"luas_hektar":    b.LuasHektar,
+			"aktual_ton_ha":  round2(actualTonHa),
+			"norma_ton_ha":   round2(normaTonHa),
+			"persen_norma":   round2(persen),
+			"kekurangan_ton": round2((normaTonHa - actualTonHa) * b.LuasHektar),
+		})
+	}
+
+	sort.Slice(flagged, func(i, j int) bool {
+		return flagged[i]["persen_norma"].(float64) < flagged[j]["persen_norma"].(float64)
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"periode_bulan":     months,
+		"start_month":       start.Format("2006-01"),
+		"end_month":         end.AddDate(0, -1, 0).Format("2006-01"),
+		"threshold_persen":  threshold,
+		"blok_dievaluasi":   evaluated,
+		"blok_underperform": len(flagged),
+		"data":              flagged,
+	})
+}
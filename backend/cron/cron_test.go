@@ -0,0 +1,84 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// 2025-01-01 is a Wednesday
+func at(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2025, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"step from a start value", "5/15 * * * *", at(1, 1, 10, 6), at(1, 1, 10, 20)},
+		{"step wraps into the next hour", "5/15 * * * *", at(1, 1, 10, 50), at(1, 1, 11, 5)},
+		{"step over the whole range", "*/20 * * * *", at(1, 1, 10, 41), at(1, 1, 11, 0)},
+		{"strictly after the given time", "0 9 * * *", at(1, 1, 9, 0), at(1, 2, 9, 0)},
+		{"seconds are ignored", "0 9 * * *", at(1, 1, 8, 59).Add(30 * time.Second), at(1, 1, 9, 0)},
+		{"day of month only", "0 0 13 * *", at(1, 1, 0, 0), at(1, 13, 0, 0)},
+		{"day of week only", "0 9 * * fri", at(1, 1, 0, 0), at(1, 3, 9, 0)},
+		{"either day field matches: friday first", "0 9 13 * 5", at(1, 1, 0, 0), at(1, 3, 9, 0)},
+		{"either day field matches: next friday", "0 9 13 * 5", at(1, 3, 9, 0), at(1, 10, 9, 0)},
+		{"either day field matches: the 13th", "0 9 13 * 5", at(1, 10, 9, 0), at(1, 13, 9, 0)},
+		{"7 is sunday", "0 8 * * 7", at(1, 1, 0, 0), at(1, 5, 8, 0)},
+		{"weekday range skips the weekend", "0 6 * * mon-fri", at(1, 3, 7, 0), at(1, 6, 6, 0)},
+		{"month names", "0 0 1 mar *", at(1, 1, 0, 0), at(3, 1, 0, 0)},
+		{"list", "0 7,19 * * *", at(1, 1, 8, 0), at(1, 1, 19, 0)},
+		{"macro", "@daily", at(1, 1, 10, 0), at(1, 2, 0, 0)},
+		{"leap day", "0 0 29 2 *", at(1, 1, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"never matches", "0 0 30 2 *", at(1, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSundayAliases(t *testing.T) {
+	seven, err := Parse("0 8 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, err := Parse("0 8 * * 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *seven != *zero {
+		t.Errorf("0 and 7 parse differently: %+v vs %+v", seven, zero)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"x * * * *",
+		"@every5m",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) accepted", expr)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Package domain holds the business rules for orders, stock and weighing as plain
+// functions, so they run and are tested in Go instead of in database triggers.
+package domain
+
+import "math"
+
+// round2 rounds to the two decimals the DECIMAL(…,2) columns store
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"sawit-backend/models"
+)
+
+var ErrInvalidJumlah = errors.New("jumlah_kg must be greater than zero")
+
+var ErrPOTransition = errors.New("purchase order status change not allowed")
+
+// poTransitions lists the statuses a PO may move to from each status. Rejected,
+// cancelled and completed orders are final.
+var poTransitions = map[string][]string{
+	"pending":  {"approved", "rejected", "cancelled"},
+	"approved": {"loading", "rejected", "cancelled"},
+	"loading":  {"completed"},
+}
+
+// poHoldsStock reports whether an order in status still holds the kg reserved when
+// it was placed. A loading order holds them too, but may only complete.
+func poHoldsStock(status string) bool {
+	return status == "pending" || status == "approved"
+}
+
+// POTransition checks a status change of an order and reports whether its reserved
+// stock goes back to the batches, which happens on every move out of a stock-holding
+// status into rejected or cancelled and on no other move
+func POTransition(from, to string) (releaseStock bool, err error) {
+	for _, next := range poTransitions[from] {
+		if next == to {
+			return poHoldsStock(from) && (to == "rejected" || to == "cancelled"), nil
+		}
+	}
+	return false, ErrPOTransition
+}
+
+// POPricing totals the allocated batches. Batches can differ in price after ageing,
+// so the order carries the weighted average per kg.
+func POPricing(allocs []models.POAllocation, jumlahKg float64) (hargaPerKg, totalHarga float64, err error) {
+	if jumlahKg <= 0 {
+		return 0, 0, ErrInvalidJumlah
+	}
+	for _, a := range allocs {
+		totalHarga += a.JumlahKg * a.HargaPerKg
+	}
+	return round2(totalHarga / jumlahKg), round2(totalHarga), nil
+}
+
+// PONumber formats the seq-th PO number of day, e.g. PO-20250307-0001
+func PONumber(day time.Time, seq int) (string, error) {
+	if seq < 1 {
+		return "", fmt.Errorf("invalid PO sequence %d", seq)
+	}
+	return fmt.Sprintf("PO-%s-%04d", day.Format("20060102"), seq), nil
+}
@@ -0,0 +1,139 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"sawit-backend/models"
+)
+
+func TestPOPricing(t *testing.T) {
+	tests := []struct {
+		name      string
+		allocs    []models.POAllocation
+		jumlahKg  float64
+		wantHarga float64
+		wantTotal float64
+	}{
+		{
+			name:      "single batch",
+			allocs:    []models.POAllocation{{JumlahKg: 1000, HargaPerKg: 2500}},
+			jumlahKg:  1000,
+			wantHarga: 2500,
+			wantTotal: 2500000,
+		},
+		{
+			name: "weighted average over aged batches",
+			allocs: []models.POAllocation{
+				{JumlahKg: 300, HargaPerKg: 2000},
+				{JumlahKg: 700, HargaPerKg: 2500},
+			},
+			jumlahKg:  1000,
+			wantHarga: 2350,
+			wantTotal: 2350000,
+		},
+		{
+			name: "average is rounded to cents",
+			allocs: []models.POAllocation{
+				{JumlahKg: 1, HargaPerKg: 1000},
+				{JumlahKg: 2, HargaPerKg: 2000},
+			},
+			jumlahKg:  3,
+			wantHarga: 1666.67,
+			wantTotal: 5000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			harga, total, err := POPricing(tt.allocs, tt.jumlahKg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if harga != tt.wantHarga || total != tt.wantTotal {
+				t.Errorf("got harga %.2f total %.2f, want %.2f and %.2f", harga, total, tt.wantHarga, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestPOPricingRejectsEmptyOrder(t *testing.T) {
+	if _, _, err := POPricing(nil, 0); err != ErrInvalidJumlah {
+		t.Errorf("got %v, want ErrInvalidJumlah", err)
+	}
+}
+
+func TestPONumber(t *testing.T) {
+	day := time.Date(2025, 3, 7, 15, 0, 0, 0, time.Local)
+	tests := []struct {
+		seq     int
+		want    string
+		wantErr bool
+	}{
+		{seq: 1, want: "PO-20250307-0001"},
+		{seq: 100, want: "PO-20250307-0100"},
+		{seq: 10000, want: "PO-20250307-10000"},
+		{seq: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := PONumber(day, tt.seq)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("PONumber(%d) = %q, want error", tt.seq, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("PONumber(%d) = %q, %v, want %q", tt.seq, got, err, tt.want)
+		}
+	}
+}
+
+func TestPOTransition(t *testing.T) {
+	tests := []struct {
+		from, to    string
+		wantRelease bool
+		wantErr     bool
+	}{
+		{from: "pending", to: "approved"},
+		{from: "pending", to: "rejected", wantRelease: true},
+		{from: "pending", to: "cancelled", wantRelease: true},
+		{from: "approved", to: "loading"},
+		{from: "approved", to: "rejected", wantRelease: true},
+		{from: "approved", to: "cancelled", wantRelease: true},
+		{from: "loading", to: "completed"},
+
+		{from: "pending", to: "pending", wantErr: true},
+		{from: "pending", to: "completed", wantErr: true},
+		{from: "approved", to: "approved", wantErr: true},
+		{from: "approved", to: "completed", wantErr: true},
+		{from: "loading", to: "cancelled", wantErr: true},
+		{from: "loading", to: "rejected", wantErr: true},
+		// Final statuses: a cancelled or rejected order must not be revived, or its
+		// stock would be released a second time on the next cancel
+		{from: "cancelled", to: "approved", wantErr: true},
+		{from: "cancelled", to: "cancelled", wantErr: true},
+		{from: "rejected", to: "approved", wantErr: true},
+		{from: "rejected", to: "cancelled", wantErr: true},
+		{from: "completed", to: "cancelled", wantErr: true},
+		{from: "unknown", to: "approved", wantErr: true},
+	}
+	for _, tt := range tests {
+		release, err := POTransition(tt.from, tt.to)
+		if tt.wantErr {
+			if err != ErrPOTransition {
+				t.Errorf("POTransition(%s, %s) error = %v, want ErrPOTransition", tt.from, tt.to, err)
+			}
+			if release {
+				t.Errorf("POTransition(%s, %s) releases stock on a refused change", tt.from, tt.to)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("POTransition(%s, %s) error = %v", tt.from, tt.to, err)
+			continue
+		}
+		if release != tt.wantRelease {
+			t.Errorf("POTransition(%s, %s) release = %v, want %v", tt.from, tt.to, release, tt.wantRelease)
+		}
+	}
+}
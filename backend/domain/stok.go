@@ -0,0 +1,76 @@
+package domain
+
+import "errors"
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// Stok is the part of a stok_tbs row the stock rules read and change
+type Stok struct {
+	JumlahKg float64
+	Tersedia float64
+	Status   string
+}
+
+// reservedShare is the share of a batch below which it is marked reserved, as the
+// update_stok_after_po procedure did
+const reservedShare = 0.1
+
+// OrderableStokStatuses lists the batch statuses a PO may draw from. A reserved
+// batch is nearly used up but its remaining kg are still for sale; restan and
+// expired batches are past their freshness limit.
+var OrderableStokStatuses = []string{"available", "reserved"}
+
+// StokOrderable reports whether a batch with status can supply an order
+func StokOrderable(status string) bool {
+	for _, s := range OrderableStokStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// StokStatus returns the status a batch of jumlahKg has once tersedia kg are left.
+// An emptied batch is sold out, one with less than 10% left is reserved and any
+// other is available. Restan and expired batches keep their status.
+func StokStatus(status string, tersedia, jumlahKg float64) string {
+	switch {
+	case status == "restan" || status == "expired":
+		return status
+	case tersedia <= 0:
+		return "sold_out"
+	case tersedia < jumlahKg*reservedShare:
+		return "reserved"
+	}
+	return "available"
+}
+
+// ReserveStok takes kg out of a batch for an order. This is the only point where an
+// order reduces stock; approving it later does not deduct again.
+func ReserveStok(s Stok, kg float64) (Stok, error) {
+	if kg <= 0 {
+		return s, ErrInvalidJumlah
+	}
+	tersedia := round2(s.Tersedia - kg)
+	if tersedia < 0 {
+		return s, ErrInsufficientStock
+	}
+	return Stok{JumlahKg: s.JumlahKg, Tersedia: tersedia, Status: StokStatus(s.Status, tersedia, s.JumlahKg)}, nil
+}
+
+// ReleaseStok gives kg back to a batch when its order is rejected or cancelled
+func ReleaseStok(s Stok, kg float64) Stok {
+	tersedia := round2(s.Tersedia + kg)
+	return Stok{JumlahKg: s.JumlahKg, Tersedia: tersedia, Status: StokStatus(s.Status, tersedia, s.JumlahKg)}
+}
+
+// AdjustStok applies an approved adjustment of selisih kg to both the batch size and
+// its available amount, as when a batch is reweighed or part of it spoils
+func AdjustStok(s Stok, selisih float64) (Stok, error) {
+	tersedia := round2(s.Tersedia + selisih)
+	if tersedia < 0 {
+		return s, ErrInsufficientStock
+	}
+	jumlahKg := round2(s.JumlahKg + selisih)
+	return Stok{JumlahKg: jumlahKg, Tersedia: tersedia, Status: StokStatus(s.Status, tersedia, jumlahKg)}, nil
+}
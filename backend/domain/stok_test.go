@@ -0,0 +1,121 @@
+package domain
+
+import "testing"
+
+func TestStokStatus(t *testing.T) {
+	tests := []struct {
+		status   string
+		tersedia float64
+		jumlahKg float64
+		want     string
+	}{
+		{"available", 500, 1000, "available"},
+		{"available", 100, 1000, "available"},
+		{"available", 99.99, 1000, "reserved"},
+		{"available", 0, 1000, "sold_out"},
+		{"reserved", 0, 1000, "sold_out"},
+		{"reserved", 10, 1000, "reserved"},
+		{"reserved", 500, 1000, "available"},
+		{"sold_out", 10, 1000, "reserved"},
+		{"sold_out", 200, 1000, "available"},
+		{"sold_out", 0, 1000, "sold_out"},
+		{"restan", 0, 1000, "restan"},
+		{"expired", 50, 1000, "expired"},
+	}
+	for _, tt := range tests {
+		if got := StokStatus(tt.status, tt.tersedia, tt.jumlahKg); got != tt.want {
+			t.Errorf("StokStatus(%q, %.2f, %.2f) = %q, want %q", tt.status, tt.tersedia, tt.jumlahKg, got, tt.want)
+		}
+	}
+}
+
+func TestStokOrderable(t *testing.T) {
+	tests := map[string]bool{
+		"available": true,
+		"reserved":  true,
+		"sold_out":  false,
+		"restan":    false,
+		"expired":   false,
+	}
+	for status, want := range tests {
+		if got := StokOrderable(status); got != want {
+			t.Errorf("StokOrderable(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestReserveStok(t *testing.T) {
+	tests := []struct {
+		name    string
+		stok    Stok
+		kg      float64
+		want    Stok
+		wantErr error
+	}{
+		{"partial", Stok{JumlahKg: 1000, Tersedia: 1000, Status: "available"}, 400, Stok{JumlahKg: 1000, Tersedia: 600, Status: "available"}, nil},
+		{"last tenth is reserved", Stok{JumlahKg: 1000, Tersedia: 1000, Status: "available"}, 950, Stok{JumlahKg: 1000, Tersedia: 50, Status: "reserved"}, nil},
+		{"whole batch sells out", Stok{JumlahKg: 1000, Tersedia: 1000, Status: "available"}, 1000, Stok{JumlahKg: 1000, Tersedia: 0, Status: "sold_out"}, nil},
+		{"reserved batch sells out", Stok{JumlahKg: 1000, Tersedia: 50, Status: "reserved"}, 50, Stok{JumlahKg: 1000, Tersedia: 0, Status: "sold_out"}, nil},
+		{"float remainder is rounded", Stok{JumlahKg: 0.3, Tersedia: 0.3, Status: "available"}, 0.1 + 0.2, Stok{JumlahKg: 0.3, Tersedia: 0, Status: "sold_out"}, nil},
+		{"more than available", Stok{JumlahKg: 100, Tersedia: 100, Status: "available"}, 100.01, Stok{JumlahKg: 100, Tersedia: 100, Status: "available"}, ErrInsufficientStock},
+		{"zero quantity", Stok{JumlahKg: 100, Tersedia: 100, Status: "available"}, 0, Stok{JumlahKg: 100, Tersedia: 100, Status: "available"}, ErrInvalidJumlah},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReserveStok(tt.stok, tt.kg)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseStokUndoesReserve(t *testing.T) {
+	start := Stok{JumlahKg: 1000, Tersedia: 750, Status: "available"}
+	for _, kg := range []float64{700, 750} {
+		reserved, err := ReserveStok(start, kg)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := ReleaseStok(reserved, kg); got != start {
+			t.Errorf("reserve and release %.2f kg: got %+v, want %+v", kg, got, start)
+		}
+	}
+}
+
+func TestReleaseStokKeepsAgedStatus(t *testing.T) {
+	got := ReleaseStok(Stok{JumlahKg: 1000, Tersedia: 0, Status: "restan"}, 200)
+	if got != (Stok{JumlahKg: 1000, Tersedia: 200, Status: "restan"}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestAdjustStok(t *testing.T) {
+	tests := []struct {
+		name    string
+		stok    Stok
+		selisih float64
+		want    Stok
+		wantErr error
+	}{
+		{"reweigh adds", Stok{JumlahKg: 1000, Tersedia: 600, Status: "available"}, 25.5, Stok{JumlahKg: 1025.5, Tersedia: 625.5, Status: "available"}, nil},
+		{"shrinkage removes", Stok{JumlahKg: 1000, Tersedia: 600, Status: "available"}, -100, Stok{JumlahKg: 900, Tersedia: 500, Status: "available"}, nil},
+		{"spoilage empties the batch", Stok{JumlahKg: 1000, Tersedia: 80, Status: "reserved"}, -80, Stok{JumlahKg: 920, Tersedia: 0, Status: "sold_out"}, nil},
+		{"restan keeps its status", Stok{JumlahKg: 1000, Tersedia: 500, Status: "restan"}, -450, Stok{JumlahKg: 550, Tersedia: 50, Status: "restan"}, nil},
+		{"more than available", Stok{JumlahKg: 1000, Tersedia: 100, Status: "available"}, -100.01, Stok{JumlahKg: 1000, Tersedia: 100, Status: "available"}, ErrInsufficientStock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AdjustStok(tt.stok, tt.selisih)
+			if err != tt.wantErr {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "errors"
+
+var ErrBeratKeluar = errors.New("berat keluar must be greater than berat masuk")
+
+// BeratBersih is the load taken out: the truck is weighed empty on the way in and
+// loaded on the way out
+func BeratBersih(beratMasuk, beratKeluar float64) (float64, error) {
+	bersih := round2(beratKeluar - beratMasuk)
+	if bersih <= 0 {
+		return 0, ErrBeratKeluar
+	}
+	return bersih, nil
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "testing"
+
+func TestBeratBersih(t *testing.T) {
+	tests := []struct {
+		masuk, keluar float64
+		want          float64
+		wantErr       bool
+	}{
+		{masuk: 8000, keluar: 15500, want: 7500},
+		{masuk: 8000.25, keluar: 15500.5, want: 7500.25},
+		{masuk: 8000, keluar: 8000, wantErr: true},
+		{masuk: 8000, keluar: 7900, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := BeratBersih(tt.masuk, tt.keluar)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("BeratBersih(%.2f, %.2f) error = %v, wantErr %v", tt.masuk, tt.keluar, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("BeratBersih(%.2f, %.2f) = %.2f, want %.2f", tt.masuk, tt.keluar, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,501 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/xuri/excelize/v2"
+)
+
+// PDFMaxRows caps PDF exports; the whole document is built in memory before it is
+// sent, so larger ranges have to be exported as XLSX or CSV
+const PDFMaxRows = 5000
+
+// ErrTooManyRows is returned by a PDF writer once PDFMaxRows is exceeded
+var ErrTooManyRows = fmt.Errorf("too many rows for PDF (max %d), use xlsx or csv", PDFMaxRows)
+
+// Kind controls how a column is formatted
+type Kind int
+
+const (
+	Text Kind = iota
+	Number
+	Money
+	Date
+)
+
+// Column describes one report column. Total columns are summed into the totals row.
+type Column struct {
+	Header string
+	Kind   Kind
+	Total  bool
+	Width  float64 // Relative width, defaults to 1
+}
+
+// Report is the header printed above the table
+type Report struct {
+	Company  string
+	Address  string
+	Title    string
+	Subtitle string // Period or filters
+	Columns  []Column
+}
+
+// Writer streams table rows in one format. Close writes the totals row and
+// flushes the document; nothing is written by a PDF or XLSX writer before Close.
+type Writer interface {
+	Row(values ...interface{}) error
+	Close() error
+}
+
+// Supported reports whether format can be exported
+func Supported(format string) bool {
+	return format == "xlsx" || format == "csv" || format == "pdf"
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case "xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case "pdf":
+		return "application/pdf"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// New returns a writer for format that writes to w
+func New(format string, w io.Writer, r Report) (Writer, error) {
+	switch format {
+	case "csv":
+		return newCSVWriter(w, r), nil
+	case "xlsx":
+		return newXLSXWriter(w, r)
+	case "pdf":
+		return newPDFWriter(w, r), nil
+	}
+	return nil, errors.New("format must be xlsx, csv or pdf")
+}
+
+// totals sums the Total columns of every row
+type totals struct {
+	columns []Column
+	sums    []float64
+	rows    int
+}
+
+func newTotals(columns []Column) totals {
+	return totals{columns: columns, sums: make([]float64, len(columns))}
+}
+
+func (t *totals) add(values []interface{}) {
+	t.rows++
+	for i, v := range values {
+		if i < len(t.columns) && t.columns[i].Total {
+			if n, ok := number(v); ok {
+				t.sums[i] += n
+			}
+		}
+	}
+}
+
+// row returns the totals row, or nil when no column is totalled
+func (t *totals) row() []interface{} {
+	has := false
+	for _, col := range t.columns {
+		has = has || col.Total
+	}
+	if !has {
+		return nil
+	}
+	values := make([]interface{}, len(t.columns))
+	values[0] = fmt.Sprintf("TOTAL (%d)", t.rows)
+	for i, col := range t.columns {
+		if col.Total {
+			values[i] = math.Round(t.sums[i]*100) / 100
+		}
+	}
+	return values
+}
+
+// deref unwraps the nullable values controllers scan into
+func deref(v interface{}) interface{} {
+	switch x := v.(type) {
+	case *string:
+		if x == nil {
+			return nil
+		}
+		return *x
+	case *float64:
+		if x == nil {
+			return nil
+		}
+		return *x
+	case *int:
+		if x == nil {
+			return nil
+		}
+		return *x
+	case *time.Time:
+		if x == nil {
+			return nil
+		}
+		return *x
+	}
+	return v
+}
+
+func number(v interface{}) (float64, bool) {
+	switch x := deref(v).(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	}
+	return 0, false
+}
+
+// text formats a value for CSV and PDF output
+func text(v interface{}, kind Kind) string {
+	v = deref(v)
+	if v == nil {
+		return ""
+	}
+	switch x := v.(type) {
+	case time.Time:
+		if kind == Date {
+			return x.Format("2006-01-02")
+		}
+		return x.Format("2006-01-02 15:04")
+	case string:
+		// DATE columns scanned into strings come back as RFC3339 timestamps
+		if kind == Date && len(x) > 10 && x[4] == '-' && x[10] == 'T' {
+			return x[:10]
+		}
+		return x
+	}
+	if n, ok := number(v); ok {
+		if kind == Money {
+			return strconv.FormatFloat(math.Round(n), 'f', 0, 64)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func generatedAt() string {
+	return "Dicetak: " + time.Now().Format("2006-01-02 15:04")
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	report Report
+	totals totals
+}
+
+func newCSVWriter(w io.Writer, r Report) *csvWriter {
+	cw := &csvWriter{w: csv.NewWriter(w), report: r, totals: newTotals(r.Columns)}
+	// The BOM makes Excel open the file as UTF-8
+	io.WriteString(w, "\xef\xbb\xbf")
+	for _, line := range []string{r.Company, r.Address, r.Title, r.Subtitle, generatedAt()} {
+		if line != "" {
+			cw.w.Write([]string{line})
+		}
+	}
+	cw.w.Write(nil)
+
+	headers := make([]string, len(r.Columns))
+	for i, col := range r.Columns {
+		headers[i] = col.Header
+	}
+	cw.w.Write(headers)
+	return cw
+}
+
+func (cw *csvWriter) Row(values ...interface{}) error {
+	cw.totals.add(values)
+	return cw.write(values)
+}
+
+func (cw *csvWriter) write(values []interface{}) error {
+	record := make([]string, len(cw.report.Columns))
+	for i, col := range cw.report.Columns {
+		if i < len(values) {
+			record[i] = text(values[i], col.Kind)
+		}
+	}
+	cw.w.Write(record)
+	// Flush every row so the response streams instead of buffering
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	if row := cw.totals.row(); row != nil {
+		return cw.write(row)
+	}
+	return nil
+}
+
+type xlsxWriter struct {
+	out    io.Writer
+	file   *excelize.File
+	sw     *excelize.StreamWriter
+	report Report
+	totals totals
+	next   int
+	styles map[Kind]int
+	bold   map[Kind]int
+}
+
+func newXLSXWriter(w io.Writer, r Report) (*xlsxWriter, error) {
+	f := excelize.NewFile()
+	sheet := "Sheet1"
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+	xw := &xlsxWriter{out: w, file: f, sw: sw, report: r, totals: newTotals(r.Columns),
+		styles: make(map[Kind]int), bold: make(map[Kind]int)}
+
+	// Built-in number formats: 3 is #,##0 and 4 is #,##0.00
+	formats := map[Kind]int{Text: 0, Date: 0, Money: 3, Number: 4}
+	for kind, numFmt := range formats {
+		xw.styles[kind], _ = f.NewStyle(&excelize.Style{NumFmt: numFmt})
+		xw.bold[kind], _ = f.NewStyle(&excelize.Style{NumFmt: numFmt, Font: &excelize.Font{Bold: true},
+			Border: []excelize.Border{{Type: "top", Color: "000000", Style: 1}}})
+	}
+	titleStyle, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true, Size: 14}})
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font:   &excelize.Font{Bold: true, Color: "FFFFFF"},
+		Fill:   excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"2E7D32"}},
+		Border: []excelize.Border{{Type: "bottom", Color: "000000", Style: 1}},
+	})
+
+	// Column widths must be set before the first row is streamed
+	for i, col := range r.Columns {
+		width := col.Width
+		if width == 0 {
+			width = 1
+		}
+		sw.SetColWidth(i+1, i+1, 14*width)
+	}
+
+	xw.next = 1
+	lines := []string{r.Company, r.Address, r.Title, r.Subtitle, generatedAt()}
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		cell := excelize.Cell{Value: line}
+		if i == 0 || i == 2 {
+			cell.StyleID = titleStyle
+		}
+		if err := xw.writeRow([]interface{}{cell}); err != nil {
+			return nil, err
+		}
+	}
+	xw.next++
+
+	headers := make([]interface{}, len(r.Columns))
+	for i, col := range r.Columns {
+		headers[i] = excelize.Cell{Value: col.Header, StyleID: headerStyle}
+	}
+	if err := xw.writeRow(headers); err != nil {
+		return nil, err
+	}
+	return xw, nil
+}
+
+func (xw *xlsxWriter) writeRow(cells []interface{}) error {
+	axis, _ := excelize.CoordinatesToCellName(1, xw.next)
+	xw.next++
+	return xw.sw.SetRow(axis, cells)
+}
+
+func (xw *xlsxWriter) cells(values []interface{}, styles map[Kind]int) []interface{} {
+	cells := make([]interface{}, len(xw.report.Columns))
+	for i, col := range xw.report.Columns {
+		var v interface{}
+		if i < len(values) {
+			v = deref(values[i])
+		}
+		if t, ok := v.(time.Time); ok {
+			v = text(t, col.Kind)
+		} else if s, ok := v.(string); ok && col.Kind == Date {
+			v = text(s, col.Kind)
+		}
+		cells[i] = excelize.Cell{Value: v, StyleID: styles[col.Kind]}
+	}
+	return cells
+}
+
+func (xw *xlsxWriter) Row(values ...interface{}) error {
+	xw.totals.add(values)
+	return xw.writeRow(xw.cells(values, xw.styles))
+}
+
+func (xw *xlsxWriter) Close() error {
+	defer xw.file.Close()
+	if row := xw.totals.row(); row != nil {
+		if err := xw.writeRow(xw.cells(row, xw.bold)); err != nil {
+			return err
+		}
+	}
+	if err := xw.sw.Flush(); err != nil {
+		return err
+	}
+	_, err := xw.file.WriteTo(xw.out)
+	return err
+}
+
+type pdfWriter struct {
+	out    io.Writer
+	pdf    *fpdf.Fpdf
+	report Report
+	totals totals
+	widths []float64
+	tr     func(string) string
+}
+
+func newPDFWriter(w io.Writer, r Report) *pdfWriter {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pw := &pdfWriter{out: w, pdf: pdf, report: r, totals: newTotals(r.Columns),
+		tr: pdf.UnicodeTranslatorFromDescriptor("")}
+
+	// Spread the printable width over the columns by relative width
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	var units float64
+	for _, col := range r.Columns {
+		if col.Width == 0 {
+			units++
+		}
+		units += col.Width
+	}
+	for _, col := range r.Columns {
+		width := col.Width
+		if width == 0 {
+			width = 1
+		}
+		pw.widths = append(pw.widths, (pageWidth-left-right)*width/units)
+	}
+
+	pdf.SetHeaderFunc(pw.header)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 6, fmt.Sprintf("Halaman %d", pdf.PageNo()), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+	return pw
+}
+
+// header repeats the company header and column titles on every page
+func (pw *pdfWriter) header() {
+	pdf, r := pw.pdf, pw.report
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(0, 6, pw.tr(r.Company), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	if r.Address != "" {
+		pdf.CellFormat(0, 5, pw.tr(r.Address), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(2)
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 6, pw.tr(r.Title), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	if r.Subtitle != "" {
+		pdf.CellFormat(0, 5, pw.tr(r.Subtitle), "", 1, "L", false, 0, "")
+	}
+	pdf.CellFormat(0, 5, generatedAt(), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.SetFillColor(46, 125, 50)
+	pdf.SetTextColor(255, 255, 255)
+	for i, col := range r.Columns {
+		pdf.CellFormat(pw.widths[i], 7, pw.tr(col.Header), "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Helvetica", "", 8)
+}
+
+func (pw *pdfWriter) write(values []interface{}, style string) {
+	pw.pdf.SetFont("Helvetica", style, 8)
+	for i, col := range pw.report.Columns {
+		var s string
+		if i < len(values) {
+			s = text(values[i], col.Kind)
+			if n, ok := number(values[i]); ok && (col.Kind == Money || col.Kind == Number) {
+				s = thousands(n, col.Kind)
+			}
+		}
+		align := "L"
+		if col.Kind == Money || col.Kind == Number {
+			align = "R"
+		}
+		// Clip long text so rows keep a fixed height
+		for r := []rune(s); len(r) > 1 && pw.pdf.GetStringWidth(s) > pw.widths[i]-2; s = string(r) {
+			r = r[:len(r)-1]
+		}
+		pw.pdf.CellFormat(pw.widths[i], 6, pw.tr(s), "1", 0, align, false, 0, "")
+	}
+	pw.pdf.Ln(-1)
+}
+
+func (pw *pdfWriter) Row(values ...interface{}) error {
+	if pw.totals.rows >= PDFMaxRows {
+		return ErrTooManyRows
+	}
+	pw.totals.add(values)
+	pw.write(values, "")
+	return nil
+}
+
+func (pw *pdfWriter) Close() error {
+	if row := pw.totals.row(); row != nil {
+		pw.write(row, "B")
+	}
+	return pw.pdf.Output(pw.out)
+}
+
+// thousands formats numbers the Indonesian way, e.g. 1.250.000 or 7.380,50
+func thousands(n float64, kind Kind) string {
+	decimals := 2
+	if kind == Money {
+		decimals = 0
+	}
+	s := strconv.FormatFloat(math.Abs(n), 'f', decimals, 64)
+	intPart, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, frac = s[:i], s[i+1:]
+	}
+
+	var b strings.Builder
+	if n < 0 {
+		b.WriteByte('-')
+	}
+	for i, d := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(d)
+	}
+	if frac != "" && strings.Trim(frac, "0") != "" {
+		b.WriteString("," + frac)
+	}
+	return b.String()
+}
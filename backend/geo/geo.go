@@ -0,0 +1,286 @@
+package geo
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Position is a [longitude, latitude] pair, the GeoJSON axis order
+type Position [2]float64
+
+// MultiPolygon is a list of polygons; each polygon is an outer ring followed by holes
+type MultiPolygon [][][]Position
+
+// earthRadius is the WGS84 equatorial radius in metres, as used by common GIS tools
+const earthRadius = 6378137.0
+
+var ErrNoPolygon = errors.New("no polygon geometry found")
+
+// ParseGeoJSON reads a Geometry, Feature or FeatureCollection and merges every
+// Polygon and MultiPolygon it contains
+func ParseGeoJSON(data []byte) (MultiPolygon, error) {
+	var obj struct {
+		Type        string            `json:"type"`
+		Coordinates json.RawMessage   `json:"coordinates"`
+		Geometry    json.RawMessage   `json:"geometry"`
+		Geometries  []json.RawMessage `json:"geometries"`
+		Features    []json.RawMessage `json:"features"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %v", err)
+	}
+
+	var result MultiPolygon
+	switch obj.Type {
+	case "Polygon":
+		var polygon [][]Position
+		if err := json.Unmarshal(obj.Coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %v", err)
+		}
+		result = MultiPolygon{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(obj.Coordinates, &result); err != nil {
+			return nil, fmt.Errorf("invalid MultiPolygon coordinates: %v", err)
+		}
+	case "Feature":
+		if len(obj.Geometry) == 0 || string(obj.Geometry) == "null" {
+			return nil, ErrNoPolygon
+		}
+		return ParseGeoJSON(obj.Geometry)
+	case "FeatureCollection", "GeometryCollection":
+		parts := obj.Features
+		if obj.Type == "GeometryCollection" {
+			parts = obj.Geometries
+		}
+		for _, part := range parts {
+			polygons, err := ParseGeoJSON(part)
+			if err == ErrNoPolygon {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, polygons...)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON type %q", obj.Type)
+	}
+
+	if len(result) == 0 {
+		return nil, ErrNoPolygon
+	}
+	return result, result.normalize()
+}
+
+// ParseKML reads every <Polygon> in a KML document
+func ParseKML(r io.Reader) (MultiPolygon, error) {
+	decoder := xml.NewDecoder(r)
+
+	var result MultiPolygon
+	var polygon [][]Position
+	var inPolygon, inOuter, inInner, inCoordinates bool
+	var text strings.Builder
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "Polygon":
+				inPolygon = true
+				polygon = nil
+			case "outerBoundaryIs":
+				inOuter = true
+			case "innerBoundaryIs":
+				inInner = true
+			case "coordinates":
+				inCoordinates = inPolygon && (inOuter || inInner)
+				text.Reset()
+			}
+		case xml.CharData:
+			if inCoordinates {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "coordinates":
+				if !inCoordinates {
+					continue
+				}
+				inCoordinates = false
+				ring, err := parseKMLCoordinates(text.String())
+				if err != nil {
+					return nil, err
+				}
+				// The outer ring always comes first in a GeoJSON polygon
+				if inOuter {
+					polygon = append([][]Position{ring}, polygon...)
+				} else {
+					polygon = append(polygon, ring)
+				}
+			case "outerBoundaryIs":
+				inOuter = false
+			case "innerBoundaryIs":
+				inInner = false
+			case "Polygon":
+				inPolygon = false
+				if len(polygon) > 0 {
+					result = append(result, polygon)
+				}
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, ErrNoPolygon
+	}
+	return result, result.normalize()
+}
+
+// parseKMLCoordinates parses "lon,lat[,alt] lon,lat[,alt] ..."
+func parseKMLCoordinates(s string) ([]Position, error) {
+	var ring []Position
+	for _, tuple := range strings.Fields(s) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid KML coordinate %q", tuple)
+		}
+		lon, err1 := strconv.ParseFloat(parts[0], 64)
+		lat, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid KML coordinate %q", tuple)
+		}
+		ring = append(ring, Position{lon, lat})
+	}
+	return ring, nil
+}
+
+// normalize closes open rings and validates coordinates
+func (mp MultiPolygon) normalize() error {
+	for i, polygon := range mp {
+		if len(polygon) == 0 {
+			return fmt.Errorf("polygon %d has no rings", i+1)
+		}
+		for j, ring := range polygon {
+			if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+				ring = append(ring, ring[0])
+				polygon[j] = ring
+			}
+			if len(ring) < 4 {
+				return fmt.Errorf("polygon %d ring %d needs at least 3 distinct points", i+1, j+1)
+			}
+			for _, p := range ring {
+				if p[0] < -180 || p[0] > 180 || p[1] < -90 || p[1] > 90 {
+					return fmt.Errorf("coordinate %v is out of range; expected [longitude, latitude]", p)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// AreaHectares returns the geodesic area of the polygons, holes excluded
+func (mp MultiPolygon) AreaHectares() float64 {
+	var total float64
+	for _, polygon := range mp {
+		for i, ring := range polygon {
+			if i == 0 {
+				total += ringArea(ring)
+			} else {
+				total -= ringArea(ring)
+			}
+		}
+	}
+	return total / 10000
+}
+
+// ringArea computes the area of a closed ring on a sphere in square metres
+// (Chamberlain & Duquette, "Some Algorithms for Polygons on a Sphere")
+func ringArea(ring []Position) float64 {
+	n := len(ring)
+	if n < 4 {
+		return 0
+	}
+
+	var area float64
+	for i := 0; i < n-1; i++ {
+		p1 := ring[i]
+		p2 := ring[(i+1)%(n-1)]
+		p3 := ring[(i+2)%(n-1)]
+		area += (radians(p3[0]) - radians(p1[0])) * math.Sin(radians(p2[1]))
+	}
+	return math.Abs(area * earthRadius * earthRadius / 2)
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// Contains reports whether the point lies inside any polygon and outside its holes
+func (mp MultiPolygon) Contains(lon, lat float64) bool {
+	for _, polygon := range mp {
+		if !ringContains(polygon[0], lon, lat) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if ringContains(hole, lon, lat) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// ringContains is the even-odd ray casting test
+func ringContains(ring []Position, lon, lat float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Bounds returns the bounding box as min longitude, min latitude, max longitude, max latitude
+func (mp MultiPolygon) Bounds() (minLon, minLat, maxLon, maxLat float64) {
+	minLon, minLat = 180, 90
+	maxLon, maxLat = -180, -90
+	for _, polygon := range mp {
+		for _, p := range polygon[0] {
+			minLon = math.Min(minLon, p[0])
+			minLat = math.Min(minLat, p[1])
+			maxLon = math.Max(maxLon, p[0])
+			maxLat = math.Max(maxLat, p[1])
+		}
+	}
+	return
+}
+
+// Geometry returns the GeoJSON geometry object for the polygons
+func (mp MultiPolygon) Geometry() map[string]interface{} {
+	if len(mp) == 1 {
+		return map[string]interface{}{"type": "Polygon", "coordinates": mp[0]}
+	}
+	return map[string]interface{}{"type": "MultiPolygon", "coordinates": mp}
+}
@@ -0,0 +1,282 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"sawit-backend/controllers"
+)
+
+// TestOrderToPaymentFlow follows one order from PO to verified payment and checks
+// stock, statuses and the audit trail along the way
+func TestOrderToPaymentFlow(t *testing.T) {
+	requireDB(t)
+	stokID := createStok(t, 5000, 2500)
+	besok := time.Now().AddDate(0, 0, 1)
+
+	// Buyer orders 1000 kg; stock is reserved once
+	var created struct {
+		POID     int    `json:"po_id"`
+		PONumber string `json:"po_number"`
+	}
+	do(t, buyer, http.MethodPost, "/api/purchase-orders", map[string]interface{}{
+		"stok_id":             stokID,
+		"jumlah_kg":           1000,
+		"tanggal_pengambilan": besok.Format("2006-01-02"),
+		"metode_pembayaran":   "transfer",
+	}, http.StatusCreated, &created)
+	if created.PONumber == "" {
+		t.Fatal("expected a PO number")
+	}
+	if tersedia, _ := stokTersedia(t, stokID); tersedia != 4000 {
+		t.Fatalf("stock after order = %.2f, want 4000", tersedia)
+	}
+
+	var totalHarga float64
+	db.QueryRow("SELECT total_harga FROM purchase_orders WHERE id = ?", created.POID).Scan(&totalHarga)
+	if totalHarga != 2500000 {
+		t.Fatalf("total_harga = %.2f, want 2500000", totalHarga)
+	}
+
+	// Approval must not take the stock a second time
+	do(t, admin, http.MethodPut, fmt.Sprintf("/api/purchase-orders/%d/status", created.POID),
+		map[string]string{"status": "approved"}, http.StatusOK, nil)
+	if tersedia, _ := stokTersedia(t, stokID); tersedia != 4000 {
+		t.Fatalf("stock after approval = %.2f, want 4000", tersedia)
+	}
+
+	// Staff schedules the pickup, which opens a weighing record
+	var jadwal struct {
+		JadwalID     int `json:"jadwal_id"`
+		NomorAntrian int `json:"nomor_antrian"`
+	}
+	do(t, staff, http.MethodPost, "/api/jadwal", map[string]interface{}{
+		"po_id":         created.POID,
+		"waktu_loading": besok.Format("2006-01-02") + " 08:00:00",
+		"plat_nomor":    "BM 1234 XY",
+		"nama_sopir":    "Budi",
+	}, http.StatusCreated, &jadwal)
+	if jadwal.NomorAntrian != 1 {
+		t.Fatalf("nomor_antrian = %d, want 1", jadwal.NomorAntrian)
+	}
+
+	var timbangID int
+	if err := db.QueryRow("SELECT id FROM timbangan WHERE jadwal_id = ?", jadwal.JadwalID).Scan(&timbangID); err != nil {
+		t.Fatal("weighing record not created: ", err)
+	}
+
+	// Weigh the truck in empty and out loaded
+	do(t, staff, http.MethodPost, fmt.Sprintf("/api/timbangan/%d/weigh-in", timbangID),
+		map[string]interface{}{"berat_masuk": 8000}, http.StatusOK, nil)
+
+	var weighOut struct {
+		BeratBersih float64 `json:"berat_bersih"`
+	}
+	do(t, staff, http.MethodPost, fmt.Sprintf("/api/timbangan/%d/weigh-out", timbangID),
+		map[string]interface{}{"berat_keluar": 9000, "grade_aktual": "A"}, http.StatusOK, &weighOut)
+	if weighOut.BeratBersih != 1000 {
+		t.Fatalf("berat_bersih = %.2f, want 1000", weighOut.BeratBersih)
+	}
+
+	// The buyer sees the sales document issued at weigh-out
+	var dokumen []struct {
+		ID         int     `json:"id"`
+		POID       int     `json:"po_id"`
+		TotalAkhir float64 `json:"total_akhir"`
+	}
+	do(t, buyer, http.MethodGet, fmt.Sprintf("/api/dokumen?po_id=%d", created.POID), nil, http.StatusOK, &dokumen)
+	if len(dokumen) != 1 {
+		t.Fatalf("got %d documents, want 1", len(dokumen))
+	}
+	if dokumen[0].TotalAkhir != 2500000 {
+		t.Fatalf("total_akhir = %.2f, want 2500000", dokumen[0].TotalAkhir)
+	}
+
+	// Buyer pays, admin verifies
+	var bayar struct {
+		PembayaranID int `json:"pembayaran_id"`
+	}
+	do(t, buyer, http.MethodPost, "/api/pembayaran", map[string]interface{}{
+		"dokumen_id":         dokumen[0].ID,
+		"jumlah_bayar":       dokumen[0].TotalAkhir,
+		"metode_pembayaran":  "transfer",
+		"tanggal_pembayaran": time.Now().Format("2006-01-02"),
+	}, http.StatusCreated, &bayar)
+
+	do(t, admin, http.MethodPut, fmt.Sprintf("/api/pembayaran/%d/verify", bayar.PembayaranID),
+		map[string]string{"status": "verified"}, http.StatusOK, nil)
+
+	var poStatus, jadwalStatus, bayarStatus string
+	db.QueryRow("SELECT status FROM purchase_orders WHERE id = ?", created.POID).Scan(&poStatus)
+	db.QueryRow("SELECT status FROM jadwal_pengambilan WHERE id = ?", jadwal.JadwalID).Scan(&jadwalStatus)
+	db.QueryRow("SELECT status FROM pembayaran WHERE id = ?", bayar.PembayaranID).Scan(&bayarStatus)
+	if poStatus != "completed" || jadwalStatus != "completed" || bayarStatus != "verified" {
+		t.Fatalf("statuses po=%s jadwal=%s pembayaran=%s, want completed/completed/verified",
+			poStatus, jadwalStatus, bayarStatus)
+	}
+
+	// Every step left an audit entry, and the chain over them holds
+	var poLogs int
+	db.QueryRow("SELECT COUNT(*) FROM log_aktivitas WHERE entitas = 'po' AND reference_id = ?", created.POID).Scan(&poLogs)
+	if poLogs < 3 {
+		t.Fatalf("got %d audit entries for the PO, want at least 3 (create, approve, completed)", poLogs)
+	}
+	if _, err := controllers.SealAuditChain(); err != nil {
+		t.Fatal(err)
+	}
+	v, err := controllers.VerifyAuditChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Putus != nil {
+		t.Fatalf("audit chain broken: %+v", v.Putus)
+	}
+}
+
+// TestCancelReleasesStock checks that cancelling a pending PO returns its stock
+func TestCancelReleasesStock(t *testing.T) {
+	requireDB(t)
+	stokID := createStok(t, 1000, 2000)
+
+	var created struct {
+		POID int `json:"po_id"`
+	}
+	do(t, buyer, http.MethodPost, "/api/purchase-orders", map[string]interface{}{
+		"stok_id":             stokID,
+		"jumlah_kg":           1000,
+		"tanggal_pengambilan": time.Now().AddDate(0, 0, 1).Format("2006-01-02"),
+		"metode_pembayaran":   "transfer",
+	}, http.StatusCreated, &created)
+	if tersedia, status := stokTersedia(t, stokID); tersedia != 0 || status != "sold_out" {
+		t.Fatalf("stock after order = %.2f (%s), want 0 (sold_out)", tersedia, status)
+	}
+
+	do(t, buyer, http.MethodDelete, fmt.Sprintf("/api/purchase-orders/%d", created.POID), nil, http.StatusOK, nil)
+
+	if tersedia, status := stokTersedia(t, stokID); tersedia != 1000 || status != "available" {
+		t.Fatalf("stock after cancel = %.2f (%s), want 1000 (available)", tersedia, status)
+	}
+}
+
+// TestRejectApprovedReleasesStockOnce checks that rejecting an approved PO returns its
+// stock and that a rejected PO can be neither revived nor cancelled again
+func TestRejectApprovedReleasesStockOnce(t *testing.T) {
+	requireDB(t)
+	stokID := createStok(t, 1000, 2000)
+
+	var created struct {
+		POID int `json:"po_id"`
+	}
+	do(t, buyer, http.MethodPost, "/api/purchase-orders", map[string]interface{}{
+		"stok_id":             stokID,
+		"jumlah_kg":           400,
+		"tanggal_pengambilan": time.Now().AddDate(0, 0, 1).Format("2006-01-02"),
+		"metode_pembayaran":   "transfer",
+	}, http.StatusCreated, &created)
+
+	statusPath := fmt.Sprintf("/api/purchase-orders/%d/status", created.POID)
+	do(t, admin, http.MethodPut, statusPath, map[string]string{"status": "approved"}, http.StatusOK, nil)
+	do(t, admin, http.MethodPut, statusPath, map[string]string{"status": "rejected"}, http.StatusOK, nil)
+	if tersedia, _ := stokTersedia(t, stokID); tersedia != 1000 {
+		t.Fatalf("stock after rejecting an approved PO = %.2f, want 1000", tersedia)
+	}
+
+	do(t, admin, http.MethodPut, statusPath, map[string]string{"status": "approved"}, http.StatusBadRequest, nil)
+	do(t, buyer, http.MethodDelete, fmt.Sprintf("/api/purchase-orders/%d", created.POID), nil, http.StatusBadRequest, nil)
+	if tersedia, _ := stokTersedia(t, stokID); tersedia != 1000 {
+		t.Fatalf("stock after refused changes = %.2f, want 1000", tersedia)
+	}
+}
+
+// TestOrderRejectsOverdraw checks that a PO larger than the batch is refused untouched
+func TestOrderRejectsOverdraw(t *testing.T) {
+	requireDB(t)
+	stokID := createStok(t, 500, 2000)
+
+	do(t, buyer, http.MethodPost, "/api/purchase-orders", map[string]interface{}{
+		"stok_id":             stokID,
+		"jumlah_kg":           600,
+		"tanggal_pengambilan": time.Now().AddDate(0, 0, 1).Format("2006-01-02"),
+		"metode_pembayaran":   "transfer",
+	}, http.StatusBadRequest, nil)
+
+	if tersedia, _ := stokTersedia(t, stokID); tersedia != 500 {
+		t.Fatalf("stock after rejected order = %.2f, want 500", tersedia)
+	}
+}
+
+// TestBuyerCannotSeeOtherBuyersDocuments takes an order of a second buyer through
+// to payment and checks the first buyer sees none of its records
+func TestBuyerCannotSeeOtherBuyersDocuments(t *testing.T) {
+	requireDB(t)
+	other := createUserNamed(t, "buyer", "other")
+	stokID := createStok(t, 2000, 2000)
+	besok := time.Now().AddDate(0, 0, 1)
+
+	var created struct {
+		POID int `json:"po_id"`
+	}
+	do(t, other, http.MethodPost, "/api/purchase-orders", map[string]interface{}{
+		"stok_id":             stokID,
+		"jumlah_kg":           500,
+		"tanggal_pengambilan": besok.Format("2006-01-02"),
+		"metode_pembayaran":   "transfer",
+	}, http.StatusCreated, &created)
+	do(t, admin, http.MethodPut, fmt.Sprintf("/api/purchase-orders/%d/status", created.POID),
+		map[string]string{"status": "approved"}, http.StatusOK, nil)
+
+	var jadwal struct {
+		JadwalID int `json:"jadwal_id"`
+	}
+	do(t, staff, http.MethodPost, "/api/jadwal", map[string]interface{}{
+		"po_id":         created.POID,
+		"waktu_loading": besok.Format("2006-01-02") + " 10:00:00",
+		"plat_nomor":    "BM 5678 ZZ",
+		"nama_sopir":    "Andi",
+	}, http.StatusCreated, &jadwal)
+
+	var timbangID int
+	if err := db.QueryRow("SELECT id FROM timbangan WHERE jadwal_id = ?", jadwal.JadwalID).Scan(&timbangID); err != nil {
+		t.Fatal("weighing record not created: ", err)
+	}
+	do(t, staff, http.MethodPost, fmt.Sprintf("/api/timbangan/%d/weigh-in", timbangID),
+		map[string]interface{}{"berat_masuk": 8000}, http.StatusOK, nil)
+	do(t, staff, http.MethodPost, fmt.Sprintf("/api/timbangan/%d/weigh-out", timbangID),
+		map[string]interface{}{"berat_keluar": 8500, "grade_aktual": "A"}, http.StatusOK, nil)
+
+	var dokumenID int
+	if err := db.QueryRow("SELECT id FROM dokumen_penjualan WHERE po_id = ?", created.POID).Scan(&dokumenID); err != nil {
+		t.Fatal("sales document not created: ", err)
+	}
+	do(t, other, http.MethodPost, "/api/pembayaran", map[string]interface{}{
+		"dokumen_id":         dokumenID,
+		"jumlah_bayar":       1000000,
+		"metode_pembayaran":  "transfer",
+		"tanggal_pembayaran": time.Now().Format("2006-01-02"),
+	}, http.StatusCreated, nil)
+
+	// None of the lists show the first buyer a record of the other buyer's order
+	for _, path := range []string{"/api/purchase-orders", "/api/jadwal", "/api/timbangan", "/api/dokumen", "/api/pembayaran"} {
+		var list []struct {
+			ID   int `json:"id"`
+			POID int `json:"po_id"`
+		}
+		do(t, buyer, http.MethodGet, path, nil, http.StatusOK, &list)
+		for _, r := range list {
+			if r.POID == created.POID || (path == "/api/purchase-orders" && r.ID == created.POID) {
+				t.Fatalf("buyer %d sees %s record %d of PO %d owned by buyer %d", buyer.ID, path, r.ID, created.POID, other.ID)
+			}
+		}
+	}
+
+	// Nor can it read the order or pay the invoice by ID
+	do(t, buyer, http.MethodGet, fmt.Sprintf("/api/purchase-orders/%d", created.POID), nil, http.StatusForbidden, nil)
+	do(t, buyer, http.MethodPost, "/api/pembayaran", map[string]interface{}{
+		"dokumen_id":         dokumenID,
+		"jumlah_bayar":       1000000,
+		"metode_pembayaran":  "transfer",
+		"tanggal_pembayaran": time.Now().Format("2006-01-02"),
+	}, http.StatusForbidden, nil)
+}
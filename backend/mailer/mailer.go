@@ -0,0 +1,140 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sawit-backend/config"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email with optional attachments
+type Message struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Client is the mailer used by the application
+var Client Mailer
+
+// Init selects the mailer implementation from configuration
+func Init() {
+	switch config.AppConfig.MailDriver {
+	case "smtp":
+		Client = &SMTPMailer{
+			Host:     config.AppConfig.SMTPHost,
+			Port:     config.AppConfig.SMTPPort,
+			Username: config.AppConfig.SMTPUser,
+			Password: config.AppConfig.SMTPPassword,
+			From:     config.AppConfig.MailFrom,
+		}
+	default:
+		Client = &FileMailer{
+			Dir:  config.AppConfig.MailLogPath,
+			From: config.AppConfig.MailFrom,
+		}
+	}
+	log.Printf("Mailer initialized (driver: %s)", config.AppConfig.MailDriver)
+}
+
+// SMTPMailer sends messages through an SMTP server.
+// Leave Username empty for servers without authentication (e.g. MailHog, Mailpit).
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message via SMTP
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := m.Host + ":" + m.Port
+	return smtp.SendMail(addr, auth, m.From, msg.To, buildMessage(m.From, msg))
+}
+
+// FileMailer writes messages as .eml files for development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send writes the message to Dir and logs the recipient
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102-150405"), time.Now().UnixNano()%1e6)
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, buildMessage(m.From, msg), 0o644); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s (%s) written to %s", strings.Join(msg.To, ", "), msg.Subject, path)
+	return nil
+}
+
+// buildMessage renders RFC 5322 headers and body
+func buildMessage(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(msg.To, ", ") + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	body := strings.ReplaceAll(msg.Body, "\n", "\r\n")
+	if len(msg.Attachments) == 0 {
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		b.WriteString("\r\n")
+		b.WriteString(body)
+		return []byte(b.String())
+	}
+
+	w := multipart.NewWriter(&b)
+	b.WriteString("Content-Type: multipart/mixed; boundary=" + w.Boundary() + "\r\n")
+	b.WriteString("\r\n")
+
+	part, _ := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=UTF-8"}})
+	part.Write([]byte(body))
+
+	for _, a := range msg.Attachments {
+		part, _ := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		// Base64 lines must not exceed 76 characters
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+	w.Close()
+	return []byte(b.String())
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"sawit-backend/config"
+	"sawit-backend/controllers"
+	"sawit-backend/mailer"
 	"sawit-backend/middleware"
+	"sawit-backend/migrations"
+	"sawit-backend/repository"
 	"sawit-backend/routes"
+	"strconv"
 	"strings"
 
 	"github.com/gin-contrib/cors"
@@ -16,10 +25,45 @@ func main() {
 	// Load configuration
 	config.LoadConfig()
 
+	// Maintenance commands run instead of the server, e.g. `go run main.go migrate up`
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// Initialize database
 	config.InitDB()
 	defer config.CloseDB()
 
+	// The server does not migrate on its own; warn when the schema is behind
+	var dirty *migrations.DirtyError
+	if pending, err := migrations.Pending(config.DB); errors.As(err, &dirty) {
+		log.Printf("⚠️  %v", err)
+	} else if err != nil {
+		log.Printf("Could not check migrations: %v", err)
+	} else if pending > 0 {
+		log.Printf("⚠️  %d pending migration(s), run `go run main.go migrate up`", pending)
+	}
+
+	// Load role permissions
+	middleware.SyncPermissions()
+
+	// Initialize mailer
+	mailer.Init()
+
+	store := repository.NewStore(config.DB)
+
+	// Start stock ageing job
+	controllers.StartStokAgeingJob(store)
+
+	// Start scheduled report delivery
+	controllers.StartReportScheduler()
+
+	// Start sealing the audit log into its hash chain
+	controllers.StartAuditChainJob()
+
+	// Start archiving log entries past their retention period
+	controllers.StartLogArchiveJob()
+
 	// Set Gin mode
 	gin.SetMode(gin.ReleaseMode)
 
@@ -31,12 +75,13 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 	}))
 
-	// Add custom logger middleware
+	// Tag requests with an ID for the audit trail, then log them
+	router.Use(middleware.RequestID())
 	router.Use(middleware.Logger())
 
 	// Health check endpoint
@@ -48,7 +93,7 @@ func main() {
 	})
 
 	// Setup routes
-	routes.SetupRoutes(router)
+	routes.SetupRoutes(router, store)
 
 	// Create uploads directory
 	os.MkdirAll(config.AppConfig.UploadPath, os.ModePerm)
@@ -65,18 +110,314 @@ func main() {
 	}
 }
 
+// runCommand runs a maintenance command and returns the process exit code
+func runCommand(args []string) int {
+	usage := "Usage: sawit-backend migrate up | migrate down [n] | migrate status | migrate baseline <version> | " +
+		"migrate resolve <version> applied|pending | seed | create-admin <username> <email> | " +
+		"audit seal | audit verify [checkpoint.json ...] | audit checkpoint | " +
+		"audit archive | audit verify-archive <archive.jsonl.gz ...>"
+
+	switch {
+	case len(args) >= 2 && args[0] == "migrate":
+		if args[1] == "up" {
+			config.CreateDatabase()
+		}
+		config.InitDB()
+		defer config.CloseDB()
+		return runMigrate(args[1:], usage)
+	case len(args) == 1 && args[0] == "seed":
+		config.InitDB()
+		defer config.CloseDB()
+		seeded, err := migrations.Seed(config.DB)
+		for _, name := range seeded {
+			log.Printf("Seeded %s", name)
+		}
+		if err != nil {
+			log.Printf("Seeding failed: %v", err)
+			return 1
+		}
+		if len(seeded) == 0 {
+			log.Println("Nothing to seed")
+		}
+		return 0
+	case len(args) == 3 && args[0] == "create-admin":
+		config.InitDB()
+		defer config.CloseDB()
+		return runCreateAdmin(args[1], args[2])
+	case len(args) >= 2 && args[0] == "audit":
+		config.InitDB()
+		defer config.CloseDB()
+	default:
+		log.Println(usage)
+		return 2
+	}
+
+	switch args[1] {
+	case "seal":
+		sealed, err := controllers.SealAuditChain()
+		if err != nil {
+			log.Printf("Sealing failed: %v", err)
+			return 1
+		}
+		log.Printf("%d audit entries sealed", sealed)
+	case "verify":
+		if _, err := controllers.SealAuditChain(); err != nil {
+			log.Printf("Sealing failed: %v", err)
+			return 1
+		}
+		result, err := controllers.VerifyAuditChain(args[2:]...)
+		if err != nil {
+			log.Printf("Verification failed: %v", err)
+			return 1
+		}
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+		if !result.Valid {
+			return 1
+		}
+	case "checkpoint":
+		if _, err := controllers.SealAuditChain(); err != nil {
+			log.Printf("Sealing failed: %v", err)
+			return 1
+		}
+		checkpoint, err := controllers.CreateAuditCheckpoint()
+		if err != nil {
+			log.Printf("Checkpoint failed: %v", err)
+			return 1
+		}
+		log.Printf("Checkpoint at chain_seq %d written to %s", checkpoint.ChainSeq, checkpoint.File)
+	case "archive":
+		if _, err := controllers.SealAuditChain(); err != nil {
+			log.Printf("Sealing failed: %v", err)
+			return 1
+		}
+		archives, err := controllers.ArchiveLogAktivitas()
+		for _, archive := range archives {
+			log.Printf("%d entries archived to %s", archive.JumlahEntri, archive.File)
+		}
+		if err != nil {
+			log.Printf("Archiving failed: %v", err)
+			return 1
+		}
+	case "verify-archive":
+		if len(args) < 3 {
+			log.Println(usage)
+			return 2
+		}
+		result, err := controllers.VerifyLogArchives(args[2:])
+		if err != nil {
+			log.Printf("Verification failed: %v", err)
+			return 1
+		}
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+		if !result.Valid {
+			return 1
+		}
+	default:
+		log.Println(usage)
+		return 2
+	}
+	return 0
+}
+
+// runMigrate handles `migrate up|down|status|baseline|resolve`
+func runMigrate(args []string, usage string) int {
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(config.DB)
+		for _, m := range applied {
+			log.Printf("Applied %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Printf("Migration failed: %v", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			log.Println("Database is up to date")
+		}
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			parsed, err := strconv.Atoi(args[1])
+			if err != nil || parsed < 1 {
+				log.Println(usage)
+				return 2
+			}
+			n = parsed
+		}
+		reverted, err := migrations.Down(config.DB, n)
+		for _, m := range reverted {
+			log.Printf("Rolled back %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Printf("Rollback failed: %v", err)
+			return 1
+		}
+	case "status":
+		statuses, err := migrations.Statuses(config.DB)
+		if err != nil {
+			log.Printf("Could not read migrations: %v", err)
+			return 1
+		}
+		healthy := true
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				state += " (file changed since applied)"
+				healthy = false
+			}
+			if s.Missing {
+				state += " (file missing)"
+				healthy = false
+			}
+			if s.Dirty {
+				state += " (dirty, run `migrate resolve`)"
+				healthy = false
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+		if !healthy {
+			return 1
+		}
+	case "baseline":
+		if len(args) < 2 {
+			log.Println(usage)
+			return 2
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 1 {
+			log.Println(usage)
+			return 2
+		}
+		marked, err := migrations.Baseline(config.DB, version)
+		for _, m := range marked {
+			log.Printf("Marked %04d_%s as applied", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Printf("Baseline failed: %v", err)
+			return 1
+		}
+	case "resolve":
+		if len(args) < 3 || (args[2] != "applied" && args[2] != "pending") {
+			log.Println(usage)
+			return 2
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 1 {
+			log.Println(usage)
+			return 2
+		}
+		if err := migrations.Resolve(config.DB, version, args[2] == "applied"); err != nil {
+			log.Printf("Resolve failed: %v", err)
+			return 1
+		}
+		log.Printf("Marked %04d as %s", version, args[2])
+	default:
+		log.Println(usage)
+		return 2
+	}
+	return 0
+}
+
+// runCreateAdmin adds an admin account so a fresh install can be used without the
+// demo seed. The password comes from ADMIN_PASSWORD or, when unset, from stdin.
+func runCreateAdmin(username, email string) int {
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Print("Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Printf("Could not read password: %v", err)
+			return 1
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	id, err := controllers.CreateAdmin(repository.NewStore(config.DB), username, email, password)
+	if err != nil {
+		log.Printf("Could not create admin: %v", err)
+		return 1
+	}
+	log.Printf("Admin %s created with ID %d", username, id)
+	return 0
+}
+
 func printEndpoints(port string) {
 	log.Println("\n📋 Available Endpoints:")
 	log.Println("  GET    /health")
 	log.Println("  POST   /api/auth/register")
 	log.Println("  POST   /api/auth/login")
+	log.Println("  POST   /api/auth/forgot-password")
+	log.Println("  POST   /api/auth/reset-password")
+	log.Println("  POST   /api/auth/verify-email")
+	log.Println("  POST   /api/auth/resend-verification")
+	log.Println("  POST   /api/auth/2fa/verify")
+	log.Println("  POST   /api/auth/2fa/setup")
+	log.Println("  POST   /api/auth/2fa/enable")
+	log.Println("  GET    /api/auth/2fa/status")
+	log.Println("  POST   /api/auth/2fa/disable")
+	log.Println("  POST   /api/auth/2fa/recovery-codes")
 	log.Println("  GET    /api/profile")
 	log.Println("  PUT    /api/profile")
 	log.Println("  GET    /api/kebun")
+	log.Println("  GET    /api/kebun/:id")
+	log.Println("  POST   /api/kebun")
+	log.Println("  PUT    /api/kebun/:id")
+	log.Println("  DELETE /api/kebun/:id")
+	log.Println("  PUT    /api/kebun/:id/boundary")
+	log.Println("  DELETE /api/kebun/:id/boundary")
+	log.Println("  GET    /api/kebun/:id/afdeling")
+	log.Println("  POST   /api/kebun/:id/afdeling")
+	log.Println("  PUT    /api/afdeling/:id")
+	log.Println("  DELETE /api/afdeling/:id")
+	log.Println("  GET    /api/afdeling/:id/blok")
+	log.Println("  POST   /api/afdeling/:id/blok")
+	log.Println("  GET    /api/blok")
+	log.Println("  GET    /api/blok/:id")
+	log.Println("  PUT    /api/blok/:id")
+	log.Println("  DELETE /api/blok/:id")
+	log.Println("  PUT    /api/blok/:id/boundary")
+	log.Println("  DELETE /api/blok/:id/boundary")
+	log.Println("  GET    /api/map/features")
+	log.Println("  GET    /api/map/locate")
 	log.Println("  GET    /api/stok")
 	log.Println("  GET    /api/stok/:id")
 	log.Println("  POST   /api/stok")
 	log.Println("  PUT    /api/stok/:id")
+	log.Println("  GET    /api/stok/:id/ageing")
+	log.Println("  POST   /api/stok/:id/adjustments")
+	log.Println("  GET    /api/stok-adjustments")
+	log.Println("  PUT    /api/stok-adjustments/:id/review")
+	log.Println("  GET    /api/stok-ageing/rules")
+	log.Println("  POST   /api/stok-ageing/rules")
+	log.Println("  PUT    /api/stok-ageing/rules/:id")
+	log.Println("  POST   /api/stok-ageing/run")
+	log.Println("  GET    /api/panen")
+	log.Println("  POST   /api/panen")
+	log.Println("  DELETE /api/panen/:id")
+	log.Println("  GET    /api/panen/:id/pemanen")
+	log.Println("  PUT    /api/panen/:id/pemanen")
+	log.Println("  GET    /api/tim-panen")
+	log.Println("  POST   /api/tim-panen")
+	log.Println("  PUT    /api/tim-panen/:id")
+	log.Println("  GET    /api/pemanen")
+	log.Println("  GET    /api/pemanen/:id/output")
+	log.Println("  POST   /api/pemanen")
+	log.Println("  PUT    /api/pemanen/:id")
+	log.Println("  GET    /api/premi-rules")
+	log.Println("  POST   /api/premi-rules")
+	log.Println("  PUT    /api/premi-rules/:id")
+	log.Println("  GET    /api/payroll")
+	log.Println("  GET    /api/payroll/:id")
+	log.Println("  GET    /api/payroll/:id/export")
+	log.Println("  POST   /api/payroll")
+	log.Println("  POST   /api/payroll/:id/recalculate")
+	log.Println("  POST   /api/payroll/:id/finalize")
+	log.Println("  DELETE /api/payroll/:id")
 	log.Println("  GET    /api/purchase-orders")
 	log.Println("  GET    /api/purchase-orders/:id")
 	log.Println("  POST   /api/purchase-orders")
@@ -84,6 +425,8 @@ func printEndpoints(port string) {
 	log.Println("  DELETE /api/purchase-orders/:id")
 	log.Println("  GET    /api/jadwal")
 	log.Println("  POST   /api/jadwal")
+	log.Println("  GET    /api/kendaraan")
+	log.Println("  POST   /api/kendaraan")
 	log.Println("  GET    /api/timbangan")
 	log.Println("  POST   /api/timbangan/:id/weigh-in")
 	log.Println("  POST   /api/timbangan/:id/weigh-out")
@@ -91,9 +434,44 @@ func printEndpoints(port string) {
 	log.Println("  GET    /api/pembayaran")
 	log.Println("  POST   /api/pembayaran")
 	log.Println("  PUT    /api/pembayaran/:id/verify")
+	log.Println("  GET    /api/import/:entity/template")
+	log.Println("  POST   /api/import/:entity")
 	log.Println("  GET    /api/reports/dashboard")
 	log.Println("  GET    /api/reports/daily-sales")
+	log.Println("  GET    /api/reports/sales-analytics")
+	log.Println("  GET    /api/reports/yield")
+	log.Println("  GET    /api/reports/yield/underperforming")
+	log.Println("  GET    /api/reports/restan")
+	log.Println("  GET    /api/reports/restan/history")
+	log.Println("  GET    /api/reports/receivables")
+	log.Println("  GET    /api/reports/weighbridge")
+	log.Println("  GET    /api/reports/quality")
+	log.Println("  GET    /api/report-schedules")
+	log.Println("  GET    /api/report-schedules/types")
+	log.Println("  POST   /api/report-schedules")
+	log.Println("  PUT    /api/report-schedules/:id")
+	log.Println("  DELETE /api/report-schedules/:id")
+	log.Println("  POST   /api/report-schedules/:id/run")
+	log.Println("  GET    /api/report-schedules/:id/runs")
+	log.Println("  GET    /api/admin/locked-accounts")
+	log.Println("  POST   /api/admin/users/:id/unlock")
+	log.Println("  POST   /api/admin/users/:id/reset-2fa")
+	log.Println("  GET    /api/admin/permissions")
+	log.Println("  GET    /api/admin/roles/permissions")
+	log.Println("  PUT    /api/admin/roles/:role/permissions")
+	log.Println("  GET    /api/admin/service-accounts")
+	log.Println("  POST   /api/admin/service-accounts")
+	log.Println("  GET    /api/admin/api-keys")
+	log.Println("  POST   /api/admin/api-keys")
+	log.Println("  DELETE /api/admin/api-keys/:id")
 	log.Println("  GET    /api/logs")
 	log.Println("  GET    /api/logs/statistics")
+	log.Println("  GET    /api/logs/archives")
+	log.Println("  GET    /api/logs/archives/:id/download")
+	log.Println("  GET    /api/audit/verify")
+	log.Println("  GET    /api/audit/checkpoints")
+	log.Println("  POST   /api/audit/checkpoints")
+	log.Println("  GET    /api/audit/checkpoints/:id/download")
+	log.Println("  GET    /api/audit/:entity/:id")
 	log.Printf("\n✅ Server ready: http://localhost:%s\n", port)
 }
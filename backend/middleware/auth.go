@@ -11,12 +11,19 @@ import (
 )
 
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Purpose string `json:"purpose,omitempty"` // Empty for full access tokens
 	jwt.RegisteredClaims
 }
 
+// Purposes of short-lived tokens issued during two-factor login
+const (
+	PurposeMFAVerify = "mfa_verify"
+	PurposeMFAEnroll = "mfa_enroll"
+)
+
 // GenerateToken generates a JWT token for a user
 func GenerateToken(userID int, email string, role string) (string, error) {
 	jwtSecret := os.Getenv("JWT_SECRET")
@@ -39,9 +46,75 @@ func GenerateToken(userID int, email string, role string) (string, error) {
 	return token.SignedString([]byte(jwtSecret))
 }
 
+// GenerateMFAToken generates a short-lived token that only allows completing two-factor login
+func GenerateMFAToken(userID int, email string, role string, purpose string) (string, error) {
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		jwtSecret = "sawit-secret-key-2025"
+	}
+
+	expirationTime := time.Now().Add(10 * time.Minute)
+	claims := &Claims{
+		UserID:  userID,
+		Email:   email,
+		Role:    role,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(jwtSecret))
+}
+
+// ParseToken validates a JWT token string and returns its claims
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		jwtSecret = "sawit-secret-key-2025"
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(jwtSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
 // AuthMiddleware validates JWT token
 func AuthMiddleware() gin.HandlerFunc {
+	return authenticate("")
+}
+
+// EnrollmentAuthMiddleware also accepts the partial token issued to users
+// who must enroll in two-factor authentication before they get full access
+func EnrollmentAuthMiddleware() gin.HandlerFunc {
+	return authenticate(PurposeMFAEnroll)
+}
+
+// authenticate validates the Bearer token; full tokens are always accepted,
+// partial tokens only when their purpose matches extraPurpose
+func authenticate(extraPurpose string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Service accounts authenticate with an API key instead of a JWT
+		if extraPurpose == "" {
+			if key := extractAPIKey(c); key != "" {
+				if authenticateAPIKey(c, key) {
+					c.Next()
+				}
+				return
+			}
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -57,20 +130,16 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &Claims{}
-
-		jwtSecret := os.Getenv("JWT_SECRET")
-		if jwtSecret == "" {
-			jwtSecret = "sawit-secret-key-2025"
+		claims, err := ParseToken(parts[1])
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		// Partial tokens from two-factor login cannot access the API
+		if claims.Purpose != "" && claims.Purpose != extraPurpose {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor authentication required"})
 			c.Abort()
 			return
 		}
@@ -79,6 +148,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("role", claims.Role)
+		c.Set("token_purpose", claims.Purpose)
 
 		c.Next()
 	}
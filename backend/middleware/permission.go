@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"sawit-backend/config"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission codes. Resources with ".read.all" / ".read.own" pairs are
+// row-scoped: ".own" limits results to records owned by the user.
+const (
+	PermKebunRead         = "kebun.read"
+	PermKebunManage       = "kebun.manage"
+	PermStokRead          = "stok.read"
+	PermStokCreate        = "stok.create"
+	PermStokUpdate        = "stok.update"
+	PermStokAgeing        = "stok.ageing"
+	PermStokAdjustApprove = "stok.adjust.approve"
+	PermPanenRead         = "panen.read"
+	PermPanenCreate       = "panen.create"
+	PermPemanenManage     = "pemanen.manage"
+	PermPayrollRead       = "payroll.read"
+	PermPayrollRun        = "payroll.run"
+	PermPORead            = "po.read.all"
+	PermPOReadOwn         = "po.read.own"
+	PermPOCreate          = "po.create"
+	PermPOApprove         = "po.approve"
+	PermPOCancel          = "po.cancel.all"
+	PermPOCancelOwn       = "po.cancel.own"
+	PermJadwalRead        = "jadwal.read.all"
+	PermJadwalReadOwn     = "jadwal.read.own"
+	PermJadwalCreate      = "jadwal.create"
+	PermTimbanganRead     = "timbangan.read.all"
+	PermTimbanganReadOwn  = "timbangan.read.own"
+	PermTimbanganWeigh    = "timbangan.weigh"
+	PermDokumenRead       = "dokumen.read.all"
+	PermDokumenReadOwn    = "dokumen.read.own"
+	PermPembayaranRead    = "pembayaran.read.all"
+	PermPembayaranReadOwn = "pembayaran.read.own"
+	PermPembayaranCreate  = "pembayaran.create"
+	PermPembayaranVerify  = "pembayaran.verify"
+	PermReportSales       = "reports.sales"
+	PermReportDashboard   = "reports.dashboard"
+	PermReportYield       = "reports.yield"
+	PermReportRestan      = "reports.restan"
+	PermReportSchedule    = "reports.schedule"
+	PermReportWeighbridge = "reports.weighbridge"
+	PermReportQuality     = "reports.quality"
+	PermLogRead           = "logs.read"
+	PermAuditRead         = "audit.read"
+	PermUserManage        = "users.manage"
+	PermPermissionManage  = "permissions.manage"
+	PermAPIKeyManage      = "apikeys.manage"
+)
+
+// Permissions is the registry of every permission known to the application
+var Permissions = map[string]string{
+	PermKebunRead:         "Melihat data kebun",
+	PermKebunManage:       "Mengelola kebun, afdeling dan blok",
+	PermStokRead:          "Melihat stok TBS",
+	PermStokCreate:        "Menambah stok TBS",
+	PermStokUpdate:        "Mengubah stok TBS dan mengajukan penyesuaian",
+	PermStokAgeing:        "Mengelola aturan ageing stok TBS",
+	PermStokAdjustApprove: "Menyetujui penyesuaian stok TBS",
+	PermPanenRead:         "Melihat catatan panen per blok",
+	PermPanenCreate:       "Mencatat dan menghapus panen per blok",
+	PermPemanenManage:     "Mengelola tim panen, pemanen dan aturan premi",
+	PermPayrollRead:       "Melihat dan mengekspor payroll panen",
+	PermPayrollRun:        "Menghitung dan memfinalisasi payroll panen",
+	PermPORead:            "Melihat semua purchase order",
+	PermPOReadOwn:         "Melihat purchase order milik sendiri",
+	PermPOCreate:          "Membuat purchase order",
+	PermPOApprove:         "Menyetujui/menolak purchase order",
+	PermPOCancel:          "Membatalkan semua purchase order",
+	PermPOCancelOwn:       "Membatalkan purchase order milik sendiri",
+	PermJadwalRead:        "Melihat semua jadwal pengambilan",
+	PermJadwalReadOwn:     "Melihat jadwal pengambilan milik sendiri",
+	PermJadwalCreate:      "Membuat jadwal pengambilan",
+	PermTimbanganRead:     "Melihat semua data timbangan",
+	PermTimbanganReadOwn:  "Melihat data timbangan milik sendiri",
+	PermTimbanganWeigh:    "Mencatat timbang masuk/keluar",
+	PermDokumenRead:       "Melihat semua dokumen penjualan",
+	PermDokumenReadOwn:    "Melihat dokumen penjualan milik sendiri",
+	PermPembayaranRead:    "Melihat semua pembayaran",
+	PermPembayaranReadOwn: "Melihat pembayaran milik sendiri",
+	PermPembayaranCreate:  "Membuat pembayaran",
+	PermPembayaranVerify:  "Memverifikasi pembayaran",
+	PermReportSales:       "Melihat laporan penjualan",
+	PermReportDashboard:   "Melihat dashboard",
+	PermReportYield:       "Melihat analisis produktivitas (ton/ha)",
+	PermReportRestan:      "Melihat laporan restan harian",
+	PermReportSchedule:    "Mengelola jadwal pengiriman laporan",
+	PermReportWeighbridge: "Melihat laporan operasional jembatan timbang",
+	PermReportQuality:     "Melihat analisis kualitas TBS (grade, kadar air dan sampah)",
+	PermLogRead:           "Melihat log aktivitas",
+	PermAuditRead:         "Melihat riwayat perubahan (audit trail) dan memverifikasi hash chain audit",
+	PermUserManage:        "Mengelola akun pengguna (unlock, reset 2FA)",
+	PermPermissionManage:  "Mengelola hak akses role",
+	PermAPIKeyManage:      "Mengelola service account dan API key",
+}
+
+// Roles whose permissions come from role_permissions. Service accounts are left
+// out: their API keys carry their own scopes.
+var Roles = []string{"admin", "staff", "buyer", "security"}
+
+// IsRole reports whether role is one of Roles
+func IsRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// adminOnlyPermissions can never be granted to API keys
+var adminOnlyPermissions = map[string]bool{
+	PermUserManage:       true,
+	PermPermissionManage: true,
+	PermAPIKeyManage:     true,
+}
+
+// GrantableToAPIKey reports whether an API key may be scoped with the permission
+func GrantableToAPIKey(permission string) bool {
+	_, known := Permissions[permission]
+	return known && !adminOnlyPermissions[permission]
+}
+
+const permissionCacheTTL = time.Minute
+
+var (
+	permMu       sync.RWMutex
+	rolePerms    map[string]map[string]bool
+	permLoadedAt time.Time
+)
+
+// SyncPermissions registers new permission codes in the database and grants them to admin
+func SyncPermissions() {
+	for code, description := range Permissions {
+		config.DB.Exec(`
+			INSERT INTO permissions (code, description) VALUES (?, ?)
+			ON DUPLICATE KEY UPDATE description = VALUES(description)
+		`, code, description)
+		config.DB.Exec(`
+			INSERT IGNORE INTO role_permissions (role, permission_code) VALUES ('admin', ?)
+		`, code)
+	}
+
+	if err := LoadPermissions(); err != nil {
+		log.Fatal("Failed to load role permissions: ", err)
+	}
+}
+
+// LoadPermissions refreshes the role → permission cache from the database
+func LoadPermissions() error {
+	rows, err := config.DB.Query("SELECT role, permission_code FROM role_permissions")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	loaded := make(map[string]map[string]bool)
+	for rows.Next() {
+		var role, code string
+		if err := rows.Scan(&role, &code); err != nil {
+			return err
+		}
+		if loaded[role] == nil {
+			loaded[role] = make(map[string]bool)
+		}
+		loaded[role][code] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	permMu.Lock()
+	rolePerms = loaded
+	permLoadedAt = time.Now()
+	permMu.Unlock()
+	return nil
+}
+
+// RoleHasPermission reports whether the role is granted the permission
+func RoleHasPermission(role, permission string) bool {
+	permMu.RLock()
+	stale := time.Since(permLoadedAt) > permissionCacheTTL
+	permMu.RUnlock()
+
+	// Pick up changes made by other instances
+	if stale {
+		if err := LoadPermissions(); err != nil {
+			log.Printf("Failed to refresh role permissions: %v", err)
+		}
+	}
+
+	permMu.RLock()
+	defer permMu.RUnlock()
+	return rolePerms[role][permission]
+}
+
+// HasPermission reports whether the authenticated user holds the permission
+func HasPermission(c *gin.Context, permission string) bool {
+	// API keys are limited to the scopes they were issued with
+	if scopes, ok := c.Get("api_key_scopes"); ok {
+		return scopes.(map[string]bool)[permission]
+	}
+
+	role, exists := c.Get("role")
+	if !exists {
+		return false
+	}
+	return RoleHasPermission(role.(string), permission)
+}
+
+// PermissionMiddleware allows the request if the user holds any of the permissions
+func PermissionMiddleware(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, permission := range permissions {
+			if HasPermission(c, permission) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
+
+// ReadScope resolves row-level access for a scoped resource such as "po".
+// all is true when the user may see every row; ok is false when the user may see none.
+func ReadScope(c *gin.Context, resource string) (all bool, ok bool) {
+	if HasPermission(c, resource+".read.all") {
+		return true, true
+	}
+	if HasPermission(c, resource+".read.own") {
+		return false, true
+	}
+	return false, false
+}
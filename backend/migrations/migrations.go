@@ -0,0 +1,555 @@
+// Package migrations applies the versioned schema files embedded in the binary and
+// records them in schema_migrations, so every install runs the same DDL in the same order.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+//go:embed seeds/*.sql
+var seedFiles embed.FS
+
+// lockName serialises migration runs from several processes on one database
+const lockName = "sawit_schema_migrations"
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one schema version with its up and optional down script
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status describes one version, whether it is applied and whether the embedded
+// file still matches what was applied. Dirty means a run stopped part-way through
+// the script and the schema has to be checked by hand before `migrate resolve`.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+	Modified  bool       `json:"modified"`
+	Missing   bool       `json:"missing"`
+	Dirty     bool       `json:"dirty"`
+}
+
+type appliedRow struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+	dirty     bool
+}
+
+// DirtyError reports a migration whose last run stopped part-way. MySQL commits DDL
+// implicitly, so nothing runs until someone has checked the schema and resolved it.
+type DirtyError struct {
+	Version int
+	Name    string
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("migration %04d_%s is dirty: a previous run failed part-way; check the schema, finish or undo "+
+		"the script by hand, then run `migrate resolve %d applied` or `migrate resolve %d pending`",
+		e.Version, e.Name, e.Version, e.Version)
+}
+
+// Load reads the embedded migrations ordered by version
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(sqlFiles, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := sqlFiles.ReadFile(path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %04d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			sum := sha256.Sum256(body)
+			mig.Up = string(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration in order and returns the ones it ran
+func Up(db *sql.DB) ([]Migration, error) {
+	var done []Migration
+	err := withLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		migrations, applied, err := load(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			if row, ok := applied[mig.Version]; ok {
+				if row.checksum != "" && row.checksum != mig.Checksum {
+					return fmt.Errorf("migration %04d_%s was changed after it was applied; add a new migration instead", mig.Version, mig.Name)
+				}
+				continue
+			}
+			// Recorded dirty first so a script that dies half-way blocks the next run
+			if _, err := conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum, dirty) VALUES (?, ?, ?, TRUE)",
+				mig.Version, mig.Name, mig.Checksum); err != nil {
+				return err
+			}
+			if err := execScript(ctx, conn, mig.Up); err != nil {
+				return fmt.Errorf("migration %04d_%s: %v", mig.Version, mig.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx,
+				"UPDATE schema_migrations SET dirty = FALSE WHERE version = ?", mig.Version); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the last n applied migrations, newest first
+func Down(db *sql.DB, n int) ([]Migration, error) {
+	var done []Migration
+	err := withLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		migrations, applied, err := load(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(done) < n; i-- {
+			mig := migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down script", mig.Version, mig.Name)
+			}
+			if _, err := conn.ExecContext(ctx,
+				"UPDATE schema_migrations SET dirty = TRUE WHERE version = ?", mig.Version); err != nil {
+				return err
+			}
+			if err := execScript(ctx, conn, mig.Down); err != nil {
+				return fmt.Errorf("rollback %04d_%s: %v", mig.Version, mig.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Baseline marks every migration up to version as applied without running it, for
+// databases that were created from the old schema.sql
+func Baseline(db *sql.DB, version int) ([]Migration, error) {
+	var done []Migration
+	err := withLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		migrations, applied, err := load(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			if mig.Version > version {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if _, err := conn.ExecContext(ctx,
+				"INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)",
+				mig.Version, mig.Name, mig.Checksum); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Statuses lists every known version, including applied ones whose file is gone
+func Statuses(db *sql.DB) ([]Status, error) {
+	var statuses []Status
+	err := withLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		migrations, applied, err := load(ctx, conn)
+		if err != nil {
+			return err
+		}
+		known := map[int]bool{}
+		for _, mig := range migrations {
+			known[mig.Version] = true
+			s := Status{Version: mig.Version, Name: mig.Name}
+			if row, ok := applied[mig.Version]; ok {
+				appliedAt := row.appliedAt
+				s.Applied = true
+				s.AppliedAt = &appliedAt
+				s.Modified = row.checksum != "" && row.checksum != mig.Checksum
+				s.Dirty = row.dirty
+			}
+			statuses = append(statuses, s)
+		}
+		for version, row := range applied {
+			if !known[version] {
+				appliedAt := row.appliedAt
+				statuses = append(statuses, Status{Version: version, Name: row.name, Applied: true, AppliedAt: &appliedAt, Missing: true, Dirty: row.dirty})
+			}
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+// Pending counts migrations that have not been applied yet, and returns a
+// *DirtyError when a previous run stopped part-way
+func Pending(db *sql.DB) (int, error) {
+	statuses, err := Statuses(db)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, s := range statuses {
+		if s.Dirty {
+			return 0, &DirtyError{Version: s.Version, Name: s.Name}
+		}
+		if !s.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Resolve clears the dirty mark left by a failed run once the schema has been
+// fixed by hand: applied keeps the version as applied, otherwise it goes back to
+// pending and the next `migrate up` runs it again
+func Resolve(db *sql.DB, version int, applied bool) error {
+	return withLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		var dirty bool
+		err := conn.QueryRowContext(ctx, "SELECT dirty FROM schema_migrations WHERE version = ?", version).Scan(&dirty)
+		if err == sql.ErrNoRows || (err == nil && !dirty) {
+			return fmt.Errorf("migration %04d is not dirty", version)
+		}
+		if err != nil {
+			return err
+		}
+		if applied {
+			_, err = conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = FALSE WHERE version = ?", version)
+		} else {
+			_, err = conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", version)
+		}
+		return err
+	})
+}
+
+// Seed loads the optional demo data files that have not been loaded before. Each
+// file runs in its own transaction; a file that changed after it was loaded is an
+// error, since its rows are already in the database.
+func Seed(db *sql.DB) ([]string, error) {
+	var done []string
+	err := withLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		_, applied, err := load(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(applied); err != nil {
+			return err
+		}
+
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_seeds (
+			name VARCHAR(255) PRIMARY KEY,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`); err != nil {
+			return err
+		}
+
+		entries, err := fs.ReadDir(seedFiles, "seeds")
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			body, err := seedFiles.ReadFile(path.Join("seeds", entry.Name()))
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(body)
+			checksum := hex.EncodeToString(sum[:])
+
+			var loaded string
+			err = conn.QueryRowContext(ctx, "SELECT checksum FROM schema_seeds WHERE name = ?", entry.Name()).Scan(&loaded)
+			if err == nil {
+				if loaded != checksum {
+					return fmt.Errorf("seed %s was changed after it was loaded; add a new seed file instead", entry.Name())
+				}
+				continue
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+
+			tx, err := conn.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			for _, stmt := range splitStatements(string(body)) {
+				if _, err := tx.ExecContext(ctx, stmt); err != nil {
+					tx.Rollback()
+					return fmt.Errorf("seed %s: %v", entry.Name(), err)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO schema_seeds (name, checksum) VALUES (?, ?)",
+				entry.Name(), checksum); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			done = append(done, entry.Name())
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withLock runs fn on a single connection holding a named lock, so two servers
+// starting together never apply the same migration twice
+func withLock(db *sql.DB, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", lockName).Scan(&locked); err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("another process is running migrations")
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum CHAR(64) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		dirty BOOLEAN NOT NULL DEFAULT FALSE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`); err != nil {
+		return err
+	}
+
+	// Tables created before dirty tracking lack the column
+	var hasDirty int
+	if err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'schema_migrations' AND COLUMN_NAME = 'dirty'
+	`).Scan(&hasDirty); err != nil {
+		return err
+	}
+	if hasDirty == 0 {
+		if _, err := conn.ExecContext(ctx,
+			"ALTER TABLE schema_migrations ADD COLUMN dirty BOOLEAN NOT NULL DEFAULT FALSE"); err != nil {
+			return err
+		}
+	}
+	return fn(ctx, conn)
+}
+
+// load returns the embedded migrations and the versions recorded as applied
+func load(ctx context.Context, conn *sql.Conn) ([]Migration, map[int]appliedRow, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, applied_at, dirty FROM schema_migrations")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedRow{}
+	for rows.Next() {
+		var version int
+		var row appliedRow
+		if err := rows.Scan(&version, &row.name, &row.checksum, &row.appliedAt, &row.dirty); err != nil {
+			return nil, nil, err
+		}
+		applied[version] = row
+	}
+	return migrations, applied, rows.Err()
+}
+
+// checkClean refuses to go on while a version is marked dirty
+func checkClean(applied map[int]appliedRow) error {
+	versions := make([]int, 0, len(applied))
+	for version, row := range applied {
+		if row.dirty {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+	sort.Ints(versions)
+	return &DirtyError{Version: versions[0], Name: applied[versions[0]].name}
+}
+
+// execScript runs a script statement by statement. MySQL commits DDL implicitly, so a
+// failed script is reported with the statement that broke it and its version stays dirty.
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%v\n%s", err, stmt)
+		}
+	}
+	return nil
+}
+
+// splitStatements cuts a script the way the mysql client does: on the current
+// delimiter outside quotes and comments, honouring DELIMITER lines around
+// procedure and trigger bodies. Line comments are dropped.
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	delimiter := ";"
+	atLineStart := true
+
+	flush := func() {
+		if stmt := strings.TrimSpace(cur.String()); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		cur.Reset()
+	}
+
+	for i := 0; i < len(script); {
+		if atLineStart {
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			line := strings.TrimSpace(script[i : i+end])
+			if len(line) > 10 && strings.EqualFold(line[:10], "DELIMITER ") {
+				flush()
+				delimiter = strings.TrimSpace(line[10:])
+				i += end
+				continue
+			}
+		}
+
+		ch := script[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			j := i + 1
+			for j < len(script) {
+				if script[j] == '\\' && ch != '`' {
+					j += 2
+					continue
+				}
+				if script[j] == ch {
+					if j+1 < len(script) && script[j+1] == ch {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(script) {
+				j = len(script) - 1
+			}
+			cur.WriteString(script[i : j+1])
+			i = j + 1
+			atLineStart = false
+		case ch == '-' && isLineComment(script[i:]), ch == '#':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case ch == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script) - i - 4
+			}
+			cur.WriteString(script[i : i+end+4])
+			i += end + 4
+			atLineStart = false
+		case strings.HasPrefix(script[i:], delimiter):
+			flush()
+			i += len(delimiter)
+			atLineStart = false
+		default:
+			cur.WriteByte(ch)
+			atLineStart = ch == '\n'
+			i++
+		}
+	}
+	flush()
+	return stmts
+}
+
+// isLineComment reports whether s starts a `--` comment, which MySQL only
+// recognises when the dashes are followed by whitespace or the end of input
+func isLineComment(s string) bool {
+	if !strings.HasPrefix(s, "--") {
+		return false
+	}
+	return len(s) == 2 || s[2] == ' ' || s[2] == '\t' || s[2] == '\n' || s[2] == '\r'
+}
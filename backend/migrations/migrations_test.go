@@ -0,0 +1,170 @@
+package migrations
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "plain statements",
+			script: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);\n",
+			want:   []string{"CREATE TABLE a (id INT)", "CREATE TABLE b (id INT)"},
+		},
+		{
+			name:   "missing final delimiter",
+			script: "SELECT 1;\nSELECT 2",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "semicolon inside strings",
+			script: `INSERT INTO t VALUES ('a;b', "c;d");`,
+			want:   []string{`INSERT INTO t VALUES ('a;b', "c;d")`},
+		},
+		{
+			name:   "backslash and doubled quotes",
+			script: `INSERT INTO t VALUES ('it\'s;', 'it''s;'); SELECT 2;`,
+			want:   []string{`INSERT INTO t VALUES ('it\'s;', 'it''s;')`, "SELECT 2"},
+		},
+		{
+			name:   "backtick identifiers",
+			script: "SELECT `a;b` FROM t;",
+			want:   []string{"SELECT `a;b` FROM t"},
+		},
+		{
+			name:   "line comments are dropped",
+			script: "-- header; not a statement\nSELECT 1; -- trailing; comment\n# hash; comment\nSELECT 2;",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "bare double dash ends a line comment",
+			script: "--\nSELECT 1;\n--",
+			want:   []string{"SELECT 1"},
+		},
+		{
+			name:   "double dash without space is an operator",
+			script: "SELECT 5--1;",
+			want:   []string{"SELECT 5--1"},
+		},
+		{
+			name:   "comment markers inside strings are kept",
+			script: "INSERT INTO t VALUES ('-- x', '# y', '/* z */');",
+			want:   []string{"INSERT INTO t VALUES ('-- x', '# y', '/* z */')"},
+		},
+		{
+			name:   "block comments are kept",
+			script: "SELECT /* a; b */ 1;",
+			want:   []string{"SELECT /* a; b */ 1"},
+		},
+		{
+			name: "delimiter blocks",
+			script: "DELIMITER //\n" +
+				"CREATE PROCEDURE p()\nBEGIN\n    SELECT 1;\n    SELECT 2;\nEND //\n" +
+				"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW\nBEGIN\n    SET NEW.x = 1;\nEND //\n" +
+				"DELIMITER ;\nSELECT 3;",
+			want: []string{
+				"CREATE PROCEDURE p()\nBEGIN\n    SELECT 1;\n    SELECT 2;\nEND",
+				"CREATE TRIGGER tr BEFORE INSERT ON t FOR EACH ROW\nBEGIN\n    SET NEW.x = 1;\nEND",
+				"SELECT 3",
+			},
+		},
+		{
+			name:   "unterminated string does not panic",
+			script: "SELECT 'abc",
+			want:   []string{"SELECT 'abc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			t.Fatalf("migration %04d_%s: versions must run 1..n without gaps", mig.Version, mig.Name)
+		}
+		if mig.Down == "" {
+			t.Errorf("migration %04d_%s has no down script", mig.Version, mig.Name)
+		}
+		for _, script := range []string{mig.Up, mig.Down} {
+			for _, stmt := range splitStatements(script) {
+				if strings.HasPrefix(strings.ToUpper(stmt), "DELIMITER") {
+					t.Errorf("migration %04d_%s: DELIMITER leaked into %q", mig.Version, mig.Name, stmt)
+				}
+			}
+		}
+	}
+}
+
+func TestTriggerScripts(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var drop *Migration
+	for i := range migrations {
+		if migrations[i].Name == "drop_triggers_and_procedures" {
+			drop = &migrations[i]
+		}
+	}
+	if drop == nil {
+		t.Fatal("drop_triggers_and_procedures migration not found")
+	}
+
+	up := splitStatements(drop.Up)
+	if len(up) != 7 {
+		t.Fatalf("up has %d statements, want 7: %q", len(up), up)
+	}
+
+	// Three procedures and three triggers, each with its body in one piece
+	down := splitStatements(drop.Down)
+	if len(down) != 6 {
+		t.Fatalf("down has %d statements, want 6: %q", len(down), down)
+	}
+	for _, stmt := range down {
+		if !strings.HasPrefix(stmt, "CREATE ") || !strings.HasSuffix(stmt, "END") {
+			t.Errorf("statement was cut inside its body: %q", stmt)
+		}
+	}
+}
+
+func TestDirtyError(t *testing.T) {
+	applied := map[int]appliedRow{
+		1: {name: "initial_schema"},
+		3: {name: "login_protection", dirty: true},
+		5: {name: "permissions", dirty: true},
+	}
+	err := checkClean(applied)
+	dirty, ok := err.(*DirtyError)
+	if !ok {
+		t.Fatalf("checkClean() = %v, want *DirtyError", err)
+	}
+	if dirty.Version != 3 {
+		t.Fatalf("reported version %d, want the oldest dirty one (3)", dirty.Version)
+	}
+
+	delete(applied, 3)
+	delete(applied, 5)
+	if err := checkClean(applied); err != nil {
+		t.Fatalf("checkClean() on clean rows = %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+-- ============================================
+-- Data contoh (opsional): akun demo, kebun, stok, tim panen dan aturan
+-- Jalankan dengan: go run main.go seed
+-- ============================================
+
+-- Insert Admin User (password: admin123)
+-- Staff User (password: staff123)
+INSERT INTO users (username, email, password, role, company_name, phone, status, email_verified_at) VALUES
+('admin', 'admin@sawit.com', '$2a$10$0sJK.ByxugLVMb/Z8W/2reoyh065dJjiJbxAXS77ksKSpHdeMEFHC', 'admin', 'PT Sawit Perkebunan', '081234567890', 'active', NOW()),
+('staff_weighing', 'staff@sawit.com', '$2a$10$CMdIoEFHMJhyfily0woA4OhR0wwO6DpUiPGxB8/dnEE.NndezVOT6', 'staff', 'PT Sawit Perkebunan', '081234567891', 'active', NOW()),
+('security', 'security@sawit.com', '$2a$10$0sJK.ByxugLVMb/Z8W/2reoyh065dJjiJbxAXS77ksKSpHdeMEFHC', 'security', 'PT Sawit Perkebunan', '081234567892', 'active', NOW());
+
+-- Insert Sample Buyer (password: buyer123)
+INSERT INTO users (username, email, password, role, company_name, address, nib, phone, status, email_verified_at) VALUES
+('buyer1', 'buyer1@company.com', '$2a$10$wDRq.xs3Uw9zgSO0Ld6r1e7XnmxrrqHd8IrUMGfuAHY5Gn/Huui0y', 'buyer', 'PT CPO Indonesia', 'Jakarta Selatan', '1234567890123', '081234567893', 'active', NOW()),
+('buyer2', 'buyer2@company.com', '$2a$10$wDRq.xs3Uw9zgSO0Ld6r1e7XnmxrrqHd8IrUMGfuAHY5Gn/Huui0y', 'buyer', 'CV Minyak Sawit', 'Medan', '9876543210123', '081234567894', 'active', NOW());
+
+-- Insert Kebun
+INSERT INTO kebun (nama_kebun, lokasi, luas_hektar, koordinat, status) VALUES
+('Kebun Sawit A', 'Riau, Pekanbaru', 150.50, '0.533333,101.447777', 'active'),
+('Kebun Sawit B', 'Sumatera Utara, Medan', 200.00, '3.595196,98.672226', 'active'),
+('Kebun Sawit C', 'Kalimantan Barat', 175.75, '-0.026611,109.342453', 'active');
+
+-- Insert Afdeling
+INSERT INTO afdeling (kebun_id, kode_afdeling, nama_afdeling, luas_hektar) VALUES
+(1, 'AFD-I', 'Afdeling I', 80.00),
+(1, 'AFD-II', 'Afdeling II', 70.50),
+(2, 'AFD-I', 'Afdeling I', 200.00),
+(3, 'AFD-I', 'Afdeling I', 175.75);
+
+-- Insert Blok
+INSERT INTO blok (afdeling_id, kode_blok, tahun_tanam, varietas, luas_hektar, jumlah_pokok) VALUES
+(1, 'A01', 2012, 'Tenera DxP', 40.00, 5720),
+(1, 'A02', 2014, 'Tenera DxP', 40.00, 5720),
+(2, 'B01', 2016, 'Simalungun', 70.50, 10080),
+(3, 'C01', 2010, 'Tenera DxP', 100.00, 14300),
+(3, 'C02', 2018, 'PPKS 540', 100.00, 14300),
+(4, 'D01', 2015, 'Tenera DxP', 175.75, 25130);
+
+-- Insert Stok TBS
+INSERT INTO stok_tbs (kebun_id, tanggal_panen, jumlah_kg, jumlah_tersedia, grade, kadar_minyak, harga_per_kg, status) VALUES
+(1, '2025-11-26', 50000.00, 50000.00, 'A', 22.50, 1800, 'available'),
+(1, '2025-11-27', 45000.00, 45000.00, 'A', 23.00, 1850, 'available'),
+(2, '2025-11-26', 60000.00, 60000.00, 'B', 20.00, 1600, 'available'),
+(2, '2025-11-27', 55000.00, 55000.00, 'A', 22.00, 1800, 'available'),
+(3, '2025-11-25', 40000.00, 40000.00, 'B', 19.50, 1550, 'available'),
+(3, '2025-11-26', 48000.00, 48000.00, 'A', 21.50, 1750, 'available');
+
+-- Insert Aturan Ageing Stok (TBS idealnya diolah < 24 jam setelah panen)
+INSERT INTO stok_ageing_rules (nama, grade, umur_jam, aksi, diskon_persen) VALUES
+('Diskon 12 jam', NULL, 12, 'discount', 5.00),
+('Turun grade 24 jam', NULL, 24, 'downgrade', NULL),
+('Diskon 24 jam', NULL, 24, 'discount', 10.00),
+('Restan 48 jam', NULL, 48, 'restan', NULL),
+('Kedaluwarsa 96 jam', NULL, 96, 'expired', NULL);
+
+-- Insert Tim Panen & Pemanen
+INSERT INTO tim_panen (kebun_id, kode_tim, nama_tim, nama_mandor) VALUES
+(1, 'KMD-01', 'Kemandoran 1', 'Sutrisno'),
+(2, 'KMD-01', 'Kemandoran 1', 'Rahmat Hidayat');
+
+INSERT INTO pemanen (nik, nama, tim_id, tanggal_masuk, upah_harian) VALUES
+('PMN-0001', 'Budi Santoso', 1, '2020-03-01', 120000),
+('PMN-0002', 'Agus Salim', 1, '2021-06-15', 120000),
+('PMN-0003', 'Joko Susilo', 2, '2019-01-10', 125000);
+
+-- Insert Aturan Premi (basis 1.200 kg/hari, premi Rp 35/kg di atas basis)
+INSERT INTO premi_rules (nama, kebun_id, basis, target_harian, tarif, berlaku_mulai) VALUES
+('Premi lebih basis umum', NULL, 'kg', 1200, 35, '2025-01-01');
+
+-- Insert Jadwal Laporan (nonaktif sampai penerima diisi)
+INSERT INTO report_schedules (nama, report_type, filters, format, recipients, cron_expr, is_active, created_by) VALUES
+('Penjualan Harian', 'daily_sales', '{"period": "yesterday"}', 'xlsx', 'admin@sawit.com', '0 6 * * *', FALSE, 1),
+('Piutang Mingguan', 'receivables', '{}', 'pdf', 'admin@sawit.com', '0 7 * * 1', FALSE, 1);
@@ -0,0 +1,24 @@
+-- Menghapus seluruh skema awal. Semua data ikut terhapus.
+
+DROP TRIGGER IF EXISTS after_timbang_keluar;
+DROP TRIGGER IF EXISTS before_po_insert;
+DROP TRIGGER IF EXISTS after_po_approved;
+DROP TRIGGER IF EXISTS after_po_insert;
+
+DROP PROCEDURE IF EXISTS hitung_berat_bersih;
+DROP PROCEDURE IF EXISTS update_stok_after_po;
+DROP PROCEDURE IF EXISTS generate_po_number;
+
+DROP VIEW IF EXISTS v_daily_sales;
+DROP VIEW IF EXISTS v_po_summary;
+DROP VIEW IF EXISTS v_stok_summary;
+
+DROP TABLE IF EXISTS log_aktivitas;
+DROP TABLE IF EXISTS pembayaran;
+DROP TABLE IF EXISTS dokumen_penjualan;
+DROP TABLE IF EXISTS timbangan;
+DROP TABLE IF EXISTS jadwal_pengambilan;
+DROP TABLE IF EXISTS purchase_orders;
+DROP TABLE IF EXISTS stok_tbs;
+DROP TABLE IF EXISTS kebun;
+DROP TABLE IF EXISTS users;
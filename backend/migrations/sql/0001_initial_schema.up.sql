@@ -1,11 +1,9 @@
 -- ============================================
--- Database Schema untuk Sistem Informasi
--- Perkebunan Kelapa Sawit
+-- Skema awal Sistem Informasi Perkebunan Kelapa Sawit
+-- Sama persis dengan database/schema.sql sebelum migrasi berversi, sehingga
+-- database lama cukup ditandai dengan `migrate baseline 1`
 -- ============================================
 
-CREATE DATABASE IF NOT EXISTS sawit_db CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;
-USE sawit_db;
-
 -- ============================================
 -- Tabel Users (Pembeli dan Admin)
 -- ============================================
@@ -246,37 +244,6 @@ CREATE TABLE log_aktivitas (
     INDEX idx_created (created_at)
 ) ENGINE=InnoDB;
 
--- ============================================
--- Insert Data Awal (Sample Data)
--- ============================================
-
--- Insert Admin User (password: admin123)
--- Staff User (password: staff123)
-INSERT INTO users (username, email, password, role, company_name, phone, status) VALUES
-('admin', 'admin@sawit.com', '$2a$10$0sJK.ByxugLVMb/Z8W/2reoyh065dJjiJbxAXS77ksKSpHdeMEFHC', 'admin', 'PT Sawit Perkebunan', '081234567890', 'active'),
-('staff_weighing', 'staff@sawit.com', '$2a$10$CMdIoEFHMJhyfily0woA4OhR0wwO6DpUiPGxB8/dnEE.NndezVOT6', 'staff', 'PT Sawit Perkebunan', '081234567891', 'active'),
-('security', 'security@sawit.com', '$2a$10$0sJK.ByxugLVMb/Z8W/2reoyh065dJjiJbxAXS77ksKSpHdeMEFHC', 'security', 'PT Sawit Perkebunan', '081234567892', 'active');
-
--- Insert Sample Buyer (password: buyer123)
-INSERT INTO users (username, email, password, role, company_name, address, nib, phone, status) VALUES
-('buyer1', 'buyer1@company.com', '$2a$10$wDRq.xs3Uw9zgSO0Ld6r1e7XnmxrrqHd8IrUMGfuAHY5Gn/Huui0y', 'buyer', 'PT CPO Indonesia', 'Jakarta Selatan', '1234567890123', '081234567893', 'active'),
-('buyer2', 'buyer2@company.com', '$2a$10$wDRq.xs3Uw9zgSO0Ld6r1e7XnmxrrqHd8IrUMGfuAHY5Gn/Huui0y', 'buyer', 'CV Minyak Sawit', 'Medan', '9876543210123', '081234567894', 'active');
-
--- Insert Kebun
-INSERT INTO kebun (nama_kebun, lokasi, luas_hektar, koordinat, status) VALUES
-('Kebun Sawit A', 'Riau, Pekanbaru', 150.50, '0.533333,101.447777', 'active'),
-('Kebun Sawit B', 'Sumatera Utara, Medan', 200.00, '3.595196,98.672226', 'active'),
-('Kebun Sawit C', 'Kalimantan Barat', 175.75, '-0.026611,109.342453', 'active');
-
--- Insert Stok TBS
-INSERT INTO stok_tbs (kebun_id, tanggal_panen, jumlah_kg, jumlah_tersedia, grade, kadar_minyak, harga_per_kg, status) VALUES
-(1, '2025-11-26', 50000.00, 50000.00, 'A', 22.50, 1800, 'available'),
-(1, '2025-11-27', 45000.00, 45000.00, 'A', 23.00, 1850, 'available'),
-(2, '2025-11-26', 60000.00, 60000.00, 'B', 20.00, 1600, 'available'),
-(2, '2025-11-27', 55000.00, 55000.00, 'A', 22.00, 1800, 'available'),
-(3, '2025-11-25', 40000.00, 40000.00, 'B', 19.50, 1550, 'available'),
-(3, '2025-11-26', 48000.00, 48000.00, 'A', 21.50, 1750, 'available');
-
 -- ============================================
 -- Views untuk Laporan
 -- ============================================
@@ -425,6 +392,3 @@ CREATE INDEX idx_stok_composite ON stok_tbs(status, grade, tanggal_panen);
 CREATE INDEX idx_po_composite ON purchase_orders(status, buyer_id, tanggal_pengambilan);
 CREATE INDEX idx_timbangan_composite ON timbangan(status, waktu_masuk);
 
--- ============================================
--- Selesai
--- ============================================
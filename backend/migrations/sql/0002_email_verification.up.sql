@@ -0,0 +1,18 @@
+-- Reset password dan verifikasi email
+
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP NULL AFTER status;
+
+-- Akun yang sudah ada sebelum fitur ini dianggap terverifikasi agar tidak terkunci saat login
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+CREATE TABLE auth_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose ENUM('password_reset', 'email_verify') NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL, -- SHA-256 dari token, token asli tidak disimpan
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_purpose (user_id, purpose)
+) ENGINE=InnoDB;
@@ -0,0 +1,19 @@
+-- Proteksi brute-force login dan penguncian akun
+
+ALTER TABLE users
+    ADD COLUMN failed_login_count INT NOT NULL DEFAULT 0 AFTER email_verified_at,
+    ADD COLUMN last_failed_login_at DATETIME NULL AFTER failed_login_count,
+    ADD COLUMN locked_until DATETIME NULL AFTER last_failed_login_at;
+
+CREATE TABLE login_attempts (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    email VARCHAR(100) NOT NULL,
+    user_id INT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    user_agent TEXT,
+    success BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_ip_created (ip_address, created_at),
+    INDEX idx_email_created (email, created_at)
+) ENGINE=InnoDB;
@@ -0,0 +1,16 @@
+-- Two-factor authentication (TOTP) dan recovery code
+
+ALTER TABLE users
+    ADD COLUMN totp_secret VARCHAR(64) NULL AFTER locked_until, -- Base32, diisi saat enrollment 2FA
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE AFTER totp_secret,
+    ADD COLUMN totp_last_step BIGINT NULL AFTER totp_enabled; -- Time step terakhir yang dipakai (cegah replay)
+
+CREATE TABLE recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at DATETIME NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user (user_id)
+) ENGINE=InnoDB;
@@ -0,0 +1,62 @@
+-- Registry hak akses menggantikan daftar role yang di-hard-code
+
+CREATE TABLE permissions (
+    code VARCHAR(100) PRIMARY KEY, -- Contoh: 'po.approve', 'dokumen.read.own'
+    description VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB;
+
+CREATE TABLE role_permissions (
+    role VARCHAR(50) NOT NULL,
+    permission_code VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (role, permission_code),
+    FOREIGN KEY (permission_code) REFERENCES permissions(code) ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+INSERT INTO permissions (code, description) VALUES
+('kebun.read', 'Melihat data kebun'),
+('stok.read', 'Melihat stok TBS'),
+('stok.create', 'Menambah stok TBS'),
+('stok.update', 'Mengubah stok TBS'),
+('po.read.all', 'Melihat semua purchase order'),
+('po.read.own', 'Melihat purchase order milik sendiri'),
+('po.create', 'Membuat purchase order'),
+('po.approve', 'Menyetujui/menolak purchase order'),
+('po.cancel.all', 'Membatalkan semua purchase order'),
+('po.cancel.own', 'Membatalkan purchase order milik sendiri'),
+('jadwal.read.all', 'Melihat semua jadwal pengambilan'),
+('jadwal.read.own', 'Melihat jadwal pengambilan milik sendiri'),
+('jadwal.create', 'Membuat jadwal pengambilan'),
+('timbangan.read.all', 'Melihat semua data timbangan'),
+('timbangan.read.own', 'Melihat data timbangan milik sendiri'),
+('timbangan.weigh', 'Mencatat timbang masuk/keluar'),
+('dokumen.read.all', 'Melihat semua dokumen penjualan'),
+('dokumen.read.own', 'Melihat dokumen penjualan milik sendiri'),
+('pembayaran.read.all', 'Melihat semua pembayaran'),
+('pembayaran.read.own', 'Melihat pembayaran milik sendiri'),
+('pembayaran.create', 'Membuat pembayaran'),
+('pembayaran.verify', 'Memverifikasi pembayaran'),
+('reports.sales', 'Melihat laporan penjualan'),
+('reports.dashboard', 'Melihat dashboard'),
+('logs.read', 'Melihat log aktivitas'),
+('users.manage', 'Mengelola akun pengguna (unlock, reset 2FA)'),
+('permissions.manage', 'Mengelola hak akses role');
+
+-- Admin memiliki semua hak akses
+INSERT INTO role_permissions (role, permission_code)
+SELECT 'admin', code FROM permissions;
+
+INSERT INTO role_permissions (role, permission_code) VALUES
+('staff', 'kebun.read'), ('staff', 'stok.read'), ('staff', 'stok.create'), ('staff', 'stok.update'),
+('staff', 'po.read.all'), ('staff', 'po.approve'), ('staff', 'po.cancel.all'),
+('staff', 'jadwal.read.all'), ('staff', 'jadwal.create'),
+('staff', 'timbangan.read.all'), ('staff', 'timbangan.weigh'),
+('staff', 'dokumen.read.all'), ('staff', 'pembayaran.read.all'), ('staff', 'pembayaran.verify'),
+('staff', 'reports.sales'), ('staff', 'reports.dashboard'),
+('buyer', 'kebun.read'), ('buyer', 'stok.read'),
+('buyer', 'po.read.own'), ('buyer', 'po.create'), ('buyer', 'po.cancel.own'),
+('buyer', 'jadwal.read.own'), ('buyer', 'timbangan.read.own'), ('buyer', 'dokumen.read.own'),
+('buyer', 'pembayaran.read.own'), ('buyer', 'pembayaran.create'), ('buyer', 'reports.dashboard'),
+('security', 'kebun.read'), ('security', 'stok.read'), ('security', 'po.read.all'),
+('security', 'jadwal.read.all'), ('security', 'timbangan.read.all'), ('security', 'reports.dashboard');
@@ -0,0 +1,6 @@
+DELETE FROM permissions WHERE code = 'apikeys.manage';
+DROP TABLE IF EXISTS api_keys;
+-- Service account dihapus dulu, role 'service' tidak ada lagi di ENUM
+DELETE FROM users WHERE role = 'service';
+ALTER TABLE users
+    MODIFY COLUMN role ENUM('buyer', 'admin', 'staff', 'security') DEFAULT 'buyer';
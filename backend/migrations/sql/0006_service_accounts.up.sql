@@ -0,0 +1,29 @@
+-- Service account dan API key untuk integrasi sistem
+
+ALTER TABLE users
+    MODIFY COLUMN role ENUM('buyer', 'admin', 'staff', 'security', 'service') DEFAULT 'buyer'; -- service: akun integrasi (API key)
+
+CREATE TABLE api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL, -- Service account (users.role = 'service')
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(20) NOT NULL, -- Bagian awal key untuk identifikasi
+    key_hash CHAR(64) UNIQUE NOT NULL, -- SHA-256, key asli tidak disimpan
+    permissions TEXT NOT NULL, -- JSON array kode permission
+    ip_allowlist TEXT, -- IP/CIDR dipisah koma, kosong = semua IP
+    expires_at DATETIME NULL,
+    last_used_at DATETIME NULL,
+    last_used_ip VARCHAR(45),
+    revoked_at DATETIME NULL,
+    created_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_user (user_id)
+) ENGINE=InnoDB;
+
+INSERT INTO permissions (code, description) VALUES
+('apikeys.manage', 'Mengelola service account dan API key')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES ('admin', 'apikeys.manage');
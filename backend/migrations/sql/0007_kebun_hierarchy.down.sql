@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE code = 'kebun.manage';
+ALTER TABLE stok_tbs DROP FOREIGN KEY fk_stok_blok;
+ALTER TABLE stok_tbs DROP COLUMN blok_id;
+DROP TABLE IF EXISTS blok;
+DROP TABLE IF EXISTS afdeling;
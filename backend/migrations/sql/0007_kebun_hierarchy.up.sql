@@ -0,0 +1,39 @@
+-- Hierarki kebun: afdeling dan blok, serta asal blok pada stok TBS
+
+CREATE TABLE afdeling (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    kebun_id INT NOT NULL,
+    kode_afdeling VARCHAR(20) NOT NULL,
+    nama_afdeling VARCHAR(100) NOT NULL,
+    luas_hektar DECIMAL(10,2),
+    status ENUM('active', 'inactive') DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (kebun_id) REFERENCES kebun(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_afdeling_kode (kebun_id, kode_afdeling)
+) ENGINE=InnoDB;
+
+CREATE TABLE blok (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    afdeling_id INT NOT NULL,
+    kode_blok VARCHAR(20) NOT NULL,
+    tahun_tanam YEAR NOT NULL,
+    varietas VARCHAR(100),
+    luas_hektar DECIMAL(10,2) NOT NULL,
+    jumlah_pokok INT, -- Jumlah pohon
+    status ENUM('active', 'inactive', 'replanting') DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (afdeling_id) REFERENCES afdeling(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_blok_kode (afdeling_id, kode_blok)
+) ENGINE=InnoDB;
+
+ALTER TABLE stok_tbs
+    ADD COLUMN blok_id INT NULL AFTER kebun_id, -- Asal blok panen (opsional)
+    ADD CONSTRAINT fk_stok_blok FOREIGN KEY (blok_id) REFERENCES blok(id) ON DELETE SET NULL;
+
+INSERT INTO permissions (code, description) VALUES
+('kebun.manage', 'Mengelola kebun, afdeling dan blok')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES ('admin', 'kebun.manage');
@@ -0,0 +1,8 @@
+ALTER TABLE blok
+    DROP INDEX idx_blok_bbox,
+    DROP COLUMN bbox_max_lat, DROP COLUMN bbox_max_lng, DROP COLUMN bbox_min_lat, DROP COLUMN bbox_min_lng,
+    DROP COLUMN area_hektar, DROP COLUMN boundary;
+
+ALTER TABLE kebun
+    DROP COLUMN bbox_max_lat, DROP COLUMN bbox_max_lng, DROP COLUMN bbox_min_lat, DROP COLUMN bbox_min_lng,
+    DROP COLUMN area_hektar, DROP COLUMN boundary;
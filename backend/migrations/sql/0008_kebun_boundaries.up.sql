@@ -0,0 +1,18 @@
+-- Batas GeoJSON kebun dan blok, dengan bounding box untuk pencarian titik
+
+ALTER TABLE kebun
+    ADD COLUMN boundary JSON NULL AFTER koordinat, -- GeoJSON Polygon/MultiPolygon batas kebun
+    ADD COLUMN area_hektar DECIMAL(10,2) NULL AFTER boundary, -- Luas dihitung dari boundary
+    ADD COLUMN bbox_min_lng DECIMAL(10,7) NULL AFTER area_hektar,
+    ADD COLUMN bbox_min_lat DECIMAL(10,7) NULL AFTER bbox_min_lng,
+    ADD COLUMN bbox_max_lng DECIMAL(10,7) NULL AFTER bbox_min_lat,
+    ADD COLUMN bbox_max_lat DECIMAL(10,7) NULL AFTER bbox_max_lng;
+
+ALTER TABLE blok
+    ADD COLUMN boundary JSON NULL AFTER jumlah_pokok, -- GeoJSON Polygon/MultiPolygon batas blok
+    ADD COLUMN area_hektar DECIMAL(10,2) NULL AFTER boundary, -- Luas dihitung dari boundary
+    ADD COLUMN bbox_min_lng DECIMAL(10,7) NULL AFTER area_hektar,
+    ADD COLUMN bbox_min_lat DECIMAL(10,7) NULL AFTER bbox_min_lng,
+    ADD COLUMN bbox_max_lng DECIMAL(10,7) NULL AFTER bbox_min_lat,
+    ADD COLUMN bbox_max_lat DECIMAL(10,7) NULL AFTER bbox_max_lng,
+    ADD INDEX idx_blok_bbox (bbox_min_lng, bbox_max_lng, bbox_min_lat, bbox_max_lat);
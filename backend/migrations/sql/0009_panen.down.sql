@@ -0,0 +1,4 @@
+DELETE FROM permissions WHERE code IN ('panen.read', 'panen.create', 'reports.yield');
+DROP TABLE IF EXISTS norma_produksi;
+DROP TABLE IF EXISTS panen;
+ALTER TABLE stok_tbs DROP COLUMN sumber;
@@ -0,0 +1,48 @@
+-- Pencatatan panen per blok dan norma produksi untuk analisis ton/ha
+
+ALTER TABLE stok_tbs
+    ADD COLUMN sumber ENUM('manual', 'panen') DEFAULT 'manual' AFTER status; -- panen: rekap otomatis dari tabel panen
+
+CREATE TABLE panen (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    blok_id INT NOT NULL,
+    kebun_id INT NOT NULL,
+    stok_id INT NULL, -- Batch stok_tbs hasil rekap
+    tanggal_panen DATE NOT NULL,
+    jumlah_janjang INT NOT NULL,
+    berat_kg DECIMAL(12,2) NOT NULL,
+    bjr DECIMAL(6,2) NOT NULL, -- Berat janjang rata-rata (kg)
+    grade ENUM('A', 'B', 'C') DEFAULT 'A',
+    tim_pemanen VARCHAR(100) NOT NULL,
+    catatan TEXT,
+    created_by INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (blok_id) REFERENCES blok(id),
+    FOREIGN KEY (kebun_id) REFERENCES kebun(id),
+    FOREIGN KEY (stok_id) REFERENCES stok_tbs(id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id),
+    INDEX idx_panen_blok_tanggal (blok_id, tanggal_panen),
+    INDEX idx_panen_tanggal (tanggal_panen)
+) ENGINE=InnoDB;
+
+CREATE TABLE norma_produksi (
+    umur_tahun INT PRIMARY KEY,
+    ton_per_ha_tahun DECIMAL(6,2) NOT NULL
+) ENGINE=InnoDB;
+
+-- Kurva potensi produksi TBS tipikal, ton/ha/tahun
+INSERT INTO norma_produksi (umur_tahun, ton_per_ha_tahun) VALUES
+(3, 6.00), (4, 12.00), (5, 16.00), (6, 19.00), (7, 22.00), (8, 24.00), (9, 25.00),
+(10, 26.00), (11, 26.00), (12, 26.00), (13, 26.00), (14, 25.50), (15, 25.00),
+(16, 24.00), (17, 23.50), (18, 23.00), (19, 22.00), (20, 21.00), (21, 20.00),
+(22, 19.00), (23, 18.00), (24, 17.00), (25, 16.00);
+
+INSERT INTO permissions (code, description) VALUES
+('panen.read', 'Melihat catatan panen per blok'),
+('panen.create', 'Mencatat dan menghapus panen per blok'),
+('reports.yield', 'Melihat analisis produktivitas (ton/ha)')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES
+('admin', 'panen.read'), ('admin', 'panen.create'), ('admin', 'reports.yield'),
+('staff', 'panen.read'), ('staff', 'panen.create'), ('staff', 'reports.yield');
@@ -0,0 +1,9 @@
+DELETE FROM permissions WHERE code IN ('pemanen.manage', 'payroll.read', 'payroll.run');
+DROP TABLE IF EXISTS payroll_items;
+DROP TABLE IF EXISTS payroll_periods;
+DROP TABLE IF EXISTS panen_pemanen;
+ALTER TABLE panen DROP FOREIGN KEY fk_panen_tim;
+ALTER TABLE panen DROP COLUMN tim_id;
+DROP TABLE IF EXISTS premi_rules;
+DROP TABLE IF EXISTS pemanen;
+DROP TABLE IF EXISTS tim_panen;
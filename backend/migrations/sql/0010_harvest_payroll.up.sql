@@ -0,0 +1,103 @@
+-- Tenaga kerja panen, aturan premi dan payroll
+
+CREATE TABLE tim_panen (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    kebun_id INT NOT NULL,
+    kode_tim VARCHAR(20) NOT NULL,
+    nama_tim VARCHAR(100) NOT NULL,
+    nama_mandor VARCHAR(100) NOT NULL,
+    status ENUM('active', 'inactive') DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (kebun_id) REFERENCES kebun(id),
+    UNIQUE KEY uk_tim_kode (kebun_id, kode_tim)
+) ENGINE=InnoDB;
+
+CREATE TABLE pemanen (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    nik VARCHAR(30) UNIQUE NOT NULL, -- Nomor induk karyawan
+    nama VARCHAR(100) NOT NULL,
+    tim_id INT NOT NULL,
+    tanggal_masuk DATE,
+    upah_harian DECIMAL(12,2) NOT NULL DEFAULT 0, -- Upah pokok per hari kerja
+    nomor_rekening VARCHAR(50),
+    status ENUM('active', 'inactive') DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (tim_id) REFERENCES tim_panen(id)
+) ENGINE=InnoDB;
+
+CREATE TABLE premi_rules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    nama VARCHAR(100) NOT NULL,
+    kebun_id INT NULL, -- NULL: berlaku untuk semua kebun
+    basis ENUM('kg', 'janjang') NOT NULL,
+    target_harian DECIMAL(12,2) NOT NULL, -- Basis tugas per hari
+    tarif DECIMAL(12,2) NOT NULL, -- Premi per kg/janjang di atas target
+    berlaku_mulai DATE NOT NULL,
+    berlaku_sampai DATE NULL,
+    status ENUM('active', 'inactive') DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (kebun_id) REFERENCES kebun(id)
+) ENGINE=InnoDB;
+
+ALTER TABLE panen
+    ADD COLUMN tim_id INT NULL AFTER tim_pemanen,
+    ADD CONSTRAINT fk_panen_tim FOREIGN KEY (tim_id) REFERENCES tim_panen(id);
+
+CREATE TABLE panen_pemanen (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    panen_id INT NOT NULL,
+    pemanen_id INT NOT NULL,
+    jumlah_janjang INT NOT NULL,
+    berat_kg DECIMAL(12,2) NOT NULL,
+    FOREIGN KEY (panen_id) REFERENCES panen(id) ON DELETE CASCADE,
+    FOREIGN KEY (pemanen_id) REFERENCES pemanen(id),
+    UNIQUE KEY uk_panen_pemanen (panen_id, pemanen_id),
+    INDEX idx_pemanen (pemanen_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE payroll_periods (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    kebun_id INT NULL, -- NULL: semua kebun
+    periode_mulai DATE NOT NULL,
+    periode_selesai DATE NOT NULL,
+    status ENUM('draft', 'finalized') DEFAULT 'draft',
+    jumlah_pemanen INT NOT NULL DEFAULT 0,
+    total_upah DECIMAL(15,2) NOT NULL DEFAULT 0,
+    total_premi DECIMAL(15,2) NOT NULL DEFAULT 0,
+    total_bayar DECIMAL(15,2) NOT NULL DEFAULT 0,
+    created_by INT NOT NULL,
+    finalized_by INT NULL,
+    finalized_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (kebun_id) REFERENCES kebun(id),
+    FOREIGN KEY (created_by) REFERENCES users(id),
+    FOREIGN KEY (finalized_by) REFERENCES users(id)
+) ENGINE=InnoDB;
+
+CREATE TABLE payroll_items (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    payroll_id INT NOT NULL,
+    pemanen_id INT NOT NULL,
+    hari_kerja INT NOT NULL,
+    total_kg DECIMAL(12,2) NOT NULL,
+    total_janjang INT NOT NULL,
+    upah_pokok DECIMAL(15,2) NOT NULL,
+    premi DECIMAL(15,2) NOT NULL,
+    total_bayar DECIMAL(15,2) NOT NULL,
+    FOREIGN KEY (payroll_id) REFERENCES payroll_periods(id) ON DELETE CASCADE,
+    FOREIGN KEY (pemanen_id) REFERENCES pemanen(id),
+    UNIQUE KEY uk_payroll_pemanen (payroll_id, pemanen_id)
+) ENGINE=InnoDB;
+
+INSERT INTO permissions (code, description) VALUES
+('pemanen.manage', 'Mengelola tim panen, pemanen dan aturan premi'),
+('payroll.read', 'Melihat dan mengekspor payroll panen'),
+('payroll.run', 'Menghitung dan memfinalisasi payroll panen')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES
+('admin', 'pemanen.manage'), ('admin', 'payroll.read'), ('admin', 'payroll.run'),
+('staff', 'pemanen.manage'), ('staff', 'payroll.read');
@@ -0,0 +1,28 @@
+DROP PROCEDURE IF EXISTS update_stok_after_po;
+
+DELIMITER //
+
+CREATE PROCEDURE update_stok_after_po(IN p_stok_id INT, IN p_jumlah DECIMAL(12,2))
+BEGIN
+    UPDATE stok_tbs 
+    SET jumlah_tersedia = jumlah_tersedia - p_jumlah,
+        status = CASE 
+            WHEN (jumlah_tersedia - p_jumlah) <= 0 THEN 'sold_out'
+            WHEN (jumlah_tersedia - p_jumlah) < jumlah_kg * 0.1 THEN 'reserved'
+            ELSE 'available'
+        END
+    WHERE id = p_stok_id;
+END //
+
+DELIMITER ;
+
+DELETE FROM permissions WHERE code IN ('reports.restan', 'stok.ageing');
+DROP TABLE IF EXISTS restan_harian;
+DROP TABLE IF EXISTS stok_ageing_log;
+DROP TABLE IF EXISTS stok_ageing_rules;
+
+-- Status hasil ageing tidak ada di skema lama
+UPDATE stok_tbs SET status = 'sold_out' WHERE status IN ('restan', 'expired');
+ALTER TABLE stok_tbs
+    DROP COLUMN aged_at, DROP COLUMN harga_awal, DROP COLUMN grade_awal,
+    MODIFY COLUMN status ENUM('available', 'reserved', 'sold_out') DEFAULT 'available';
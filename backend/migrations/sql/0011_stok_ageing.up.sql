@@ -0,0 +1,82 @@
+-- Ageing stok TBS berdasarkan umur panen dan rekap restan harian
+
+ALTER TABLE stok_tbs
+    MODIFY COLUMN status ENUM('available', 'reserved', 'sold_out', 'restan', 'expired') DEFAULT 'available', -- restan/expired: hasil ageing, tidak bisa dipesan
+    ADD COLUMN grade_awal ENUM('A', 'B', 'C') NULL AFTER sumber, -- Grade sebelum ageing
+    ADD COLUMN harga_awal DECIMAL(10,2) NULL AFTER grade_awal, -- Harga sebelum diskon ageing
+    ADD COLUMN aged_at TIMESTAMP NULL AFTER harga_awal; -- Terakhir diubah oleh ageing
+
+CREATE TABLE stok_ageing_rules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    nama VARCHAR(100) NOT NULL,
+    grade ENUM('A', 'B', 'C') NULL, -- NULL: berlaku untuk semua grade (dicocokkan dengan grade awal)
+    umur_jam INT NOT NULL, -- Umur sejak tanggal panen
+    aksi ENUM('discount', 'downgrade', 'restan', 'expired') NOT NULL,
+    diskon_persen DECIMAL(5,2) NULL, -- Untuk aksi discount, dari harga awal
+    status ENUM('active', 'inactive') DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_ageing_umur (status, umur_jam)
+) ENGINE=InnoDB;
+
+CREATE TABLE stok_ageing_log (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    stok_id INT NOT NULL,
+    rule_id INT NOT NULL,
+    aksi ENUM('discount', 'downgrade', 'restan', 'expired') NOT NULL,
+    umur_jam INT NOT NULL,
+    grade_sebelum ENUM('A', 'B', 'C') NOT NULL,
+    grade_sesudah ENUM('A', 'B', 'C') NOT NULL,
+    harga_sebelum DECIMAL(10,2) NOT NULL,
+    harga_sesudah DECIMAL(10,2) NOT NULL,
+    status_sebelum VARCHAR(20) NOT NULL,
+    status_sesudah VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (stok_id) REFERENCES stok_tbs(id) ON DELETE CASCADE,
+    FOREIGN KEY (rule_id) REFERENCES stok_ageing_rules(id),
+    UNIQUE KEY uk_ageing_stok_rule (stok_id, rule_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE restan_harian (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tanggal DATE NOT NULL,
+    kebun_id INT NOT NULL,
+    batch_restan INT NOT NULL DEFAULT 0,
+    restan_kg DECIMAL(12,2) NOT NULL DEFAULT 0,
+    nilai_restan DECIMAL(15,2) NOT NULL DEFAULT 0,
+    batch_expired INT NOT NULL DEFAULT 0,
+    expired_kg DECIMAL(12,2) NOT NULL DEFAULT 0,
+    panen_tertua DATE NULL, -- Tanggal panen restan tertua
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (kebun_id) REFERENCES kebun(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_restan_tanggal_kebun (tanggal, kebun_id)
+) ENGINE=InnoDB;
+
+INSERT INTO permissions (code, description) VALUES
+('reports.restan', 'Melihat laporan restan harian'),
+('stok.ageing', 'Mengelola aturan ageing stok TBS')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES
+('admin', 'reports.restan'), ('admin', 'stok.ageing'),
+('staff', 'reports.restan');
+
+-- Batch restan/expired tetap pada statusnya saat stok dipotong
+DROP PROCEDURE IF EXISTS update_stok_after_po;
+
+DELIMITER //
+
+CREATE PROCEDURE update_stok_after_po(IN p_stok_id INT, IN p_jumlah DECIMAL(12,2))
+BEGIN
+    UPDATE stok_tbs 
+    SET jumlah_tersedia = jumlah_tersedia - p_jumlah,
+        status = CASE 
+            WHEN (jumlah_tersedia - p_jumlah) <= 0 THEN 'sold_out'
+            WHEN status IN ('restan', 'expired') THEN status
+            WHEN (jumlah_tersedia - p_jumlah) < jumlah_kg * 0.1 THEN 'reserved'
+            ELSE 'available'
+        END
+    WHERE id = p_stok_id;
+END //
+
+DELIMITER ;
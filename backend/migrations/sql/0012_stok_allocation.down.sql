@@ -0,0 +1,19 @@
+DROP TRIGGER IF EXISTS after_po_approved;
+
+DELIMITER //
+
+CREATE TRIGGER after_po_approved
+AFTER UPDATE ON purchase_orders
+FOR EACH ROW
+BEGIN
+    IF NEW.status = 'approved' AND OLD.status != 'approved' THEN
+        CALL update_stok_after_po(NEW.stok_id, NEW.jumlah_kg);
+    END IF;
+END //
+
+DELIMITER ;
+
+DELETE FROM permissions WHERE code = 'stok.adjust.approve';
+UPDATE permissions SET description = 'Mengubah stok TBS' WHERE code = 'stok.update';
+DROP TABLE IF EXISTS stok_adjustments;
+DROP TABLE IF EXISTS po_allocations;
@@ -0,0 +1,60 @@
+-- Alokasi PO lintas batch (FIFO) dan penyesuaian stok yang harus disetujui
+
+CREATE TABLE po_allocations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    po_id INT NOT NULL,
+    stok_id INT NOT NULL,
+    jumlah_kg DECIMAL(12,2) NOT NULL,
+    harga_per_kg DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (po_id) REFERENCES purchase_orders(id) ON DELETE CASCADE,
+    FOREIGN KEY (stok_id) REFERENCES stok_tbs(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_po_stok (po_id, stok_id),
+    INDEX idx_alokasi_stok (stok_id)
+) ENGINE=InnoDB;
+
+CREATE TABLE stok_adjustments (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    stok_id INT NOT NULL,
+    alasan ENUM('shrinkage', 'reweigh', 'spoilage', 'correction') NOT NULL,
+    selisih_kg DECIMAL(12,2) NOT NULL, -- Negatif: stok berkurang
+    jumlah_sebelum DECIMAL(12,2) NULL, -- jumlah_tersedia saat disetujui
+    jumlah_sesudah DECIMAL(12,2) NULL,
+    catatan TEXT NOT NULL,
+    status ENUM('pending', 'approved', 'rejected') DEFAULT 'pending',
+    requested_by INT NOT NULL,
+    reviewed_by INT NULL,
+    reviewed_at TIMESTAMP NULL,
+    catatan_review TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (stok_id) REFERENCES stok_tbs(id) ON DELETE CASCADE,
+    FOREIGN KEY (requested_by) REFERENCES users(id),
+    FOREIGN KEY (reviewed_by) REFERENCES users(id),
+    INDEX idx_adjustment_status (status),
+    INDEX idx_adjustment_stok (stok_id)
+) ENGINE=InnoDB;
+
+INSERT INTO permissions (code, description) VALUES
+('stok.update', 'Mengubah stok TBS dan mengajukan penyesuaian'),
+('stok.adjust.approve', 'Menyetujui penyesuaian stok TBS')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES ('admin', 'stok.adjust.approve');
+
+-- PO dengan alokasi sudah memotong stok saat dibuat
+DROP TRIGGER IF EXISTS after_po_approved;
+
+DELIMITER //
+
+CREATE TRIGGER after_po_approved
+AFTER UPDATE ON purchase_orders
+FOR EACH ROW
+BEGIN
+    -- PO dengan alokasi sudah memotong stok saat dibuat
+    IF NEW.status = 'approved' AND OLD.status != 'approved'
+       AND NOT EXISTS (SELECT 1 FROM po_allocations WHERE po_id = NEW.id) THEN
+        CALL update_stok_after_po(NEW.stok_id, NEW.jumlah_kg);
+    END IF;
+END //
+
+DELIMITER ;
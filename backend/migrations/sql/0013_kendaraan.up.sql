@@ -0,0 +1,14 @@
+-- Armada pengangkut untuk import data kendaraan
+
+CREATE TABLE kendaraan (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    plat_nomor VARCHAR(20) UNIQUE NOT NULL,
+    jenis VARCHAR(50), -- Dump truck, colt diesel, dll
+    kapasitas_kg DECIMAL(10,2) NOT NULL DEFAULT 0,
+    nama_sopir VARCHAR(100),
+    buyer_id INT NULL, -- Pemilik armada (pembeli)
+    status ENUM('active', 'inactive') DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (buyer_id) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB;
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'reports.schedule';
+DROP TABLE IF EXISTS report_schedule_runs;
+DROP TABLE IF EXISTS report_schedules;
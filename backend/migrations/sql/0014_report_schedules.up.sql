@@ -0,0 +1,42 @@
+-- Pengiriman laporan terjadwal (cron) beserta riwayat eksekusi
+
+CREATE TABLE report_schedules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    nama VARCHAR(100) NOT NULL,
+    report_type VARCHAR(50) NOT NULL, -- 'daily_sales', 'receivables', 'stok', dll
+    filters JSON, -- parameter query laporan, mis. {"period": "yesterday"}
+    format ENUM('xlsx', 'csv', 'pdf') NOT NULL DEFAULT 'xlsx',
+    recipients TEXT NOT NULL, -- daftar email dipisah koma
+    cron_expr VARCHAR(100) NOT NULL, -- dievaluasi dalam zona waktu server
+    is_active BOOLEAN DEFAULT TRUE,
+    next_run_at DATETIME NULL,
+    last_run_at DATETIME NULL,
+    last_status ENUM('success', 'failed') NULL,
+    created_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_due (is_active, next_run_at)
+) ENGINE=InnoDB;
+
+CREATE TABLE report_schedule_runs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    schedule_id INT NOT NULL,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NULL,
+    status ENUM('running', 'success', 'failed') NOT NULL DEFAULT 'running',
+    row_count INT DEFAULT 0,
+    recipients TEXT,
+    file_name VARCHAR(255),
+    error_message TEXT,
+    triggered_by INT NULL, -- NULL = dijalankan scheduler
+    FOREIGN KEY (schedule_id) REFERENCES report_schedules(id) ON DELETE CASCADE,
+    FOREIGN KEY (triggered_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_schedule (schedule_id, started_at)
+) ENGINE=InnoDB;
+
+INSERT INTO permissions (code, description) VALUES
+('reports.schedule', 'Mengelola jadwal pengiriman laporan')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES ('admin', 'reports.schedule');
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE code = 'reports.weighbridge';
+ALTER TABLE timbangan DROP COLUMN jumlah_override, DROP COLUMN input_keluar, DROP COLUMN input_masuk;
@@ -0,0 +1,14 @@
+-- Sumber angka berat dan koreksi timbang masuk untuk laporan jembatan timbang
+
+ALTER TABLE timbangan
+    -- Sumber angka berat: 'scale' dari indikator timbangan, 'manual' diketik operator
+    ADD COLUMN input_masuk ENUM('scale', 'manual') AFTER tingkat_kematangan,
+    ADD COLUMN input_keluar ENUM('scale', 'manual') AFTER input_masuk,
+    ADD COLUMN jumlah_override INT DEFAULT 0 AFTER input_keluar; -- berapa kali timbang masuk dikoreksi
+
+INSERT INTO permissions (code, description) VALUES
+('reports.weighbridge', 'Melihat laporan operasional jembatan timbang')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES
+('admin', 'reports.weighbridge'), ('staff', 'reports.weighbridge'), ('security', 'reports.weighbridge');
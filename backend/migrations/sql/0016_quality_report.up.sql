@@ -0,0 +1,8 @@
+-- Hak akses analisis kualitas TBS
+
+INSERT INTO permissions (code, description) VALUES
+('reports.quality', 'Melihat analisis kualitas TBS (grade, kadar air dan sampah)')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES
+('admin', 'reports.quality'), ('staff', 'reports.quality');
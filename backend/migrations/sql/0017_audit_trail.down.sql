@@ -0,0 +1,17 @@
+DELIMITER //
+
+CREATE TRIGGER after_po_insert
+AFTER INSERT ON purchase_orders
+FOR EACH ROW
+BEGIN
+    INSERT INTO log_aktivitas (user_id, aktivitas, modul, reference_id)
+    VALUES (NEW.buyer_id, CONCAT('Membuat Purchase Order: ', NEW.po_number), 'po', NEW.id);
+END //
+
+DELIMITER ;
+
+DELETE FROM permissions WHERE code = 'audit.read';
+ALTER TABLE log_aktivitas
+    DROP INDEX idx_entitas,
+    DROP COLUMN request_id, DROP COLUMN data_sesudah, DROP COLUMN data_sebelum,
+    DROP COLUMN entitas, DROP COLUMN aksi;
@@ -0,0 +1,18 @@
+-- Audit trail terstruktur: snapshot sebelum/sesudah dan request ID
+
+ALTER TABLE log_aktivitas
+    ADD COLUMN aksi VARCHAR(30) AFTER reference_id, -- 'create', 'update', 'delete', 'approve', dll
+    ADD COLUMN entitas VARCHAR(50) AFTER aksi, -- Jenis record yang berubah, contoh 'po', 'jadwal', 'afdeling'
+    ADD COLUMN data_sebelum JSON AFTER entitas, -- Snapshot record sebelum perubahan
+    ADD COLUMN data_sesudah JSON AFTER data_sebelum, -- Snapshot record sesudah perubahan
+    ADD COLUMN request_id VARCHAR(64) AFTER data_sesudah, -- X-Request-ID, mengelompokkan entri dari satu request
+    ADD INDEX idx_entitas (entitas, reference_id);
+
+INSERT INTO permissions (code, description) VALUES
+('audit.read', 'Melihat riwayat perubahan (audit trail) dan memverifikasi hash chain audit')
+ON DUPLICATE KEY UPDATE description = VALUES(description);
+
+INSERT IGNORE INTO role_permissions (role, permission_code) VALUES ('admin', 'audit.read');
+
+-- Log pembuatan PO ditulis oleh backend (audit trail), bukan trigger
+DROP TRIGGER IF EXISTS after_po_insert;
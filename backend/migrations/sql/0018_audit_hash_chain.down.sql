@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP TABLE IF EXISTS audit_chain_state;
+
+ALTER TABLE log_aktivitas DROP FOREIGN KEY fk_log_user;
+ALTER TABLE log_aktivitas
+    ADD CONSTRAINT log_aktivitas_ibfk_1 FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE log_aktivitas
+    DROP INDEX uk_chain_seq,
+    DROP COLUMN hash, DROP COLUMN prev_hash, DROP COLUMN chain_seq;
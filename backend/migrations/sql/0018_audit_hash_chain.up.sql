@@ -0,0 +1,38 @@
+-- Hash chain audit log dan checkpoint bertanda tangan
+
+ALTER TABLE log_aktivitas
+    ADD COLUMN chain_seq BIGINT AFTER created_at, -- Urutan dalam hash chain, NULL sampai entri disegel
+    ADD COLUMN prev_hash CHAR(64) AFTER chain_seq, -- Hash entri sebelumnya dalam chain
+    ADD COLUMN hash CHAR(64) AFTER prev_hash, -- SHA-256 dari isi entri dan prev_hash
+    ADD UNIQUE KEY uk_chain_seq (chain_seq);
+
+-- Tanpa ON DELETE SET NULL: mengubah entri akan memutus hash chain.
+-- log_aktivitas_ibfk_1 adalah nama yang diberikan MySQL di skema awal.
+ALTER TABLE log_aktivitas DROP FOREIGN KEY log_aktivitas_ibfk_1;
+ALTER TABLE log_aktivitas ADD CONSTRAINT fk_log_user FOREIGN KEY (user_id) REFERENCES users(id);
+
+-- Satu baris: ujung chain terakhir, dikunci (FOR UPDATE) selama penyegelan.
+-- archived_seq/archived_hash: entri terakhir yang sudah dipindah ke arsip, awal verifikasi
+CREATE TABLE audit_chain_state (
+    id INT PRIMARY KEY,
+    last_seq BIGINT NOT NULL DEFAULT 0,
+    last_hash CHAR(64) NOT NULL,
+    archived_seq BIGINT NOT NULL DEFAULT 0,
+    archived_hash CHAR(64) NOT NULL
+) ENGINE=InnoDB;
+
+INSERT INTO audit_chain_state (id, last_seq, last_hash, archived_seq, archived_hash) VALUES
+(1, 0, REPEAT('0', 64), 0, REPEAT('0', 64));
+
+-- Checkpoint bertanda tangan (Ed25519) untuk disimpan offline
+CREATE TABLE audit_checkpoints (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    chain_seq BIGINT NOT NULL,
+    hash CHAR(64) NOT NULL,
+    jumlah_entri BIGINT NOT NULL,
+    public_key VARCHAR(64) NOT NULL,
+    signature VARCHAR(128) NOT NULL,
+    file_path VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_chain_seq (chain_seq)
+) ENGINE=InnoDB;
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS log_archives;
+
+ALTER TABLE log_aktivitas DROP INDEX ft_aktivitas;
+
+ALTER TABLE log_aktivitas
+    ADD INDEX idx_user (user_id),
+    ADD INDEX idx_modul (modul);
+
+ALTER TABLE log_aktivitas DROP INDEX idx_user_created, DROP INDEX idx_modul_created;
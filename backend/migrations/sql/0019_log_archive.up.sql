@@ -0,0 +1,27 @@
+-- Index daftar log per waktu, pencarian teks aktivitas, dan arsip log lama.
+-- Entri lama dipindah ke arsip (LOG_RETENTION_DAYS), jadi tabel ini tetap kecil.
+-- Tabel dengan foreign key tidak bisa dipartisi di MySQL; index komposit
+-- (filter, created_at) melayani daftar log yang diurutkan per waktu.
+
+-- Index baru dibuat dulu agar foreign key user_id tetap punya index saat idx_user dihapus
+ALTER TABLE log_aktivitas
+    ADD INDEX idx_user_created (user_id, created_at),
+    ADD INDEX idx_modul_created (modul, created_at);
+
+ALTER TABLE log_aktivitas DROP INDEX idx_user, DROP INDEX idx_modul;
+
+ALTER TABLE log_aktivitas ADD FULLTEXT INDEX ft_aktivitas (aktivitas);
+
+-- File arsip log_aktivitas (gzip JSONL) di LOG_ARCHIVE_PATH
+CREATE TABLE log_archives (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    file_path VARCHAR(255) NOT NULL,
+    chain_seq_awal BIGINT NOT NULL,
+    chain_seq_akhir BIGINT NOT NULL,
+    jumlah_entri INT NOT NULL,
+    waktu_awal TIMESTAMP NULL,
+    waktu_akhir TIMESTAMP NULL,
+    ukuran_byte BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_chain_seq (chain_seq_awal)
+) ENGINE=InnoDB;
@@ -0,0 +1,86 @@
+-- Mengembalikan trigger dan procedure seperti sebelum migrasi ini
+
+-- ============================================
+-- Stored Procedures
+-- ============================================
+
+DELIMITER //
+
+-- Procedure: Generate PO Number
+CREATE PROCEDURE generate_po_number(OUT new_po_number VARCHAR(50))
+BEGIN
+    DECLARE counter INT;
+    DECLARE today VARCHAR(8);
+    
+    SET today = DATE_FORMAT(NOW(), '%Y%m%d');
+    
+    SELECT COUNT(*) + 1 INTO counter
+    FROM purchase_orders
+    WHERE DATE(created_at) = CURDATE();
+    
+    SET new_po_number = CONCAT('PO-', today, '-', LPAD(counter, 4, '0'));
+END //
+
+-- Procedure: Update Stok setelah PO Approved
+CREATE PROCEDURE update_stok_after_po(IN p_stok_id INT, IN p_jumlah DECIMAL(12,2))
+BEGIN
+    UPDATE stok_tbs 
+    SET jumlah_tersedia = jumlah_tersedia - p_jumlah,
+        status = CASE 
+            WHEN (jumlah_tersedia - p_jumlah) <= 0 THEN 'sold_out'
+            WHEN status IN ('restan', 'expired') THEN status
+            WHEN (jumlah_tersedia - p_jumlah) < jumlah_kg * 0.1 THEN 'reserved'
+            ELSE 'available'
+        END
+    WHERE id = p_stok_id;
+END //
+
+-- Procedure: Hitung Berat Bersih Timbangan
+CREATE PROCEDURE hitung_berat_bersih(IN p_timbang_id INT)
+BEGIN
+    UPDATE timbangan
+    SET berat_bersih = berat_keluar - berat_masuk
+    WHERE id = p_timbang_id;
+END //
+
+DELIMITER ;
+
+-- ============================================
+-- Triggers
+-- ============================================
+
+DELIMITER //
+
+-- Log pembuatan PO ditulis oleh backend (audit trail), bukan trigger
+
+-- Trigger: Update stok saat PO approved
+CREATE TRIGGER after_po_approved
+AFTER UPDATE ON purchase_orders
+FOR EACH ROW
+BEGIN
+    -- PO dengan alokasi sudah memotong stok saat dibuat
+    IF NEW.status = 'approved' AND OLD.status != 'approved'
+       AND NOT EXISTS (SELECT 1 FROM po_allocations WHERE po_id = NEW.id) THEN
+        CALL update_stok_after_po(NEW.stok_id, NEW.jumlah_kg);
+    END IF;
+END //
+
+-- Trigger: Hitung total harga saat insert PO
+CREATE TRIGGER before_po_insert
+BEFORE INSERT ON purchase_orders
+FOR EACH ROW
+BEGIN
+    SET NEW.total_harga = NEW.jumlah_kg * NEW.harga_per_kg;
+END //
+
+-- Trigger: Hitung berat bersih saat timbang keluar
+CREATE TRIGGER after_timbang_keluar
+AFTER UPDATE ON timbangan
+FOR EACH ROW
+BEGIN
+    IF NEW.berat_keluar IS NOT NULL AND OLD.berat_keluar IS NULL THEN
+        CALL hitung_berat_bersih(NEW.id);
+    END IF;
+END //
+
+DELIMITER ;
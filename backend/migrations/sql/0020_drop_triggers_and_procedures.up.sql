@@ -0,0 +1,12 @@
+-- Total harga PO, potong stok, berat bersih, nomor PO dan log aktivitas kini
+-- dihitung di backend (package domain), tidak lagi oleh trigger dan procedure.
+-- after_po_insert sudah dihapus di 0017; DROP IF EXISTS di sini hanya berjaga-jaga.
+
+DROP TRIGGER IF EXISTS after_po_insert;
+DROP TRIGGER IF EXISTS after_po_approved;
+DROP TRIGGER IF EXISTS before_po_insert;
+DROP TRIGGER IF EXISTS after_timbang_keluar;
+
+DROP PROCEDURE IF EXISTS generate_po_number;
+DROP PROCEDURE IF EXISTS update_stok_after_po;
+DROP PROCEDURE IF EXISTS hitung_berat_bersih;
@@ -0,0 +1,14 @@
+-- Nomor PO harian diambil dari baris counter per tanggal, bukan dari PO terakhir
+-- dengan SELECT ... FOR UPDATE (gap lock-nya membuat order bersamaan deadlock)
+
+CREATE TABLE po_number_counters (
+    tanggal DATE PRIMARY KEY,
+    seq INT NOT NULL
+) ENGINE=InnoDB;
+
+-- Lanjutkan dari nomor tertinggi yang sudah terbit per hari (format PO-YYYYMMDD-NNNN)
+INSERT INTO po_number_counters (tanggal, seq)
+SELECT STR_TO_DATE(SUBSTRING(po_number, 4, 8), '%Y%m%d'), MAX(CAST(SUBSTRING(po_number, 13) AS UNSIGNED))
+FROM purchase_orders
+WHERE po_number REGEXP '^PO-[0-9]{8}-[0-9]+$'
+GROUP BY SUBSTRING(po_number, 4, 8);
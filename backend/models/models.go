@@ -45,6 +45,7 @@ type User struct {
 	NIB         *string   `json:"nib,omitempty"`
 	Phone       *string   `json:"phone,omitempty"`
 	Status      string    `json:"status"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -55,14 +56,48 @@ type Kebun struct {
 	Lokasi      string    `json:"lokasi"`
 	LuasHektar  float64   `json:"luas_hektar"`
 	Koordinat   string    `json:"koordinat"`
+	AreaHektar  *float64  `json:"area_hektar,omitempty"`
 	Status      string    `json:"status"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	// Nested
+	Afdeling    []Afdeling `json:"afdeling,omitempty"`
+}
+
+type Afdeling struct {
+	ID          int       `json:"id"`
+	KebunID     int       `json:"kebun_id"`
+	KodeAfdeling string   `json:"kode_afdeling"`
+	NamaAfdeling string   `json:"nama_afdeling"`
+	LuasHektar  float64   `json:"luas_hektar"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// Nested
+	Blok        []Blok    `json:"blok,omitempty"`
+}
+
+type Blok struct {
+	ID          int       `json:"id"`
+	AfdelingID  int       `json:"afdeling_id"`
+	KebunID     int       `json:"kebun_id"`
+	KodeBlok    string    `json:"kode_blok"`
+	TahunTanam  int       `json:"tahun_tanam"`
+	Varietas    string    `json:"varietas"`
+	LuasHektar  float64   `json:"luas_hektar"`
+	JumlahPokok *int      `json:"jumlah_pokok,omitempty"`
+	AreaHektar  *float64  `json:"area_hektar,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// Joined fields
+	KodeAfdeling string   `json:"kode_afdeling,omitempty"`
 }
 
 type StokTBS struct {
 	ID               int       `json:"id"`
 	KebunID          int       `json:"kebun_id"`
+	BlokID           *int      `json:"blok_id,omitempty"`
 	TanggalPanen     string    `json:"tanggal_panen"`
 	JumlahKg         float64   `json:"jumlah_kg"`
 	JumlahTersedia   float64   `json:"jumlah_tersedia"`
@@ -71,11 +106,163 @@ type StokTBS struct {
 	HargaPerKg       float64   `json:"harga_per_kg"`
 	Keterangan       *string   `json:"keterangan,omitempty"`
 	Status           string    `json:"status"`
+	GradeAwal        *string   `json:"grade_awal,omitempty"` // Set once ageing changed the batch
+	HargaAwal        *float64  `json:"harga_awal,omitempty"`
+	UmurJam          int       `json:"umur_jam"` // Hours since tanggal_panen
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
 	// Joined fields
 	NamaKebun        string    `json:"nama_kebun,omitempty"`
 	LokasiKebun      string    `json:"lokasi_kebun,omitempty"`
+	KodeBlok         string    `json:"kode_blok,omitempty"`
+}
+
+type Kendaraan struct {
+	ID          int       `json:"id"`
+	PlatNomor   string    `json:"plat_nomor"`
+	Jenis       string    `json:"jenis"`
+	KapasitasKg float64   `json:"kapasitas_kg"`
+	NamaSopir   string    `json:"nama_sopir"`
+	BuyerID     *int      `json:"buyer_id"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Joined fields
+	BuyerCompany string   `json:"buyer_company,omitempty"`
+}
+
+type StokAgeingRule struct {
+	ID           int       `json:"id"`
+	Nama         string    `json:"nama"`
+	Grade        *string   `json:"grade"`
+	UmurJam      int       `json:"umur_jam"`
+	Aksi         string    `json:"aksi"`
+	DiskonPersen *float64  `json:"diskon_persen,omitempty"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type StokAgeingLog struct {
+	ID            int       `json:"id"`
+	StokID        int       `json:"stok_id"`
+	RuleID        int       `json:"rule_id"`
+	NamaRule      string    `json:"nama_rule"`
+	Aksi          string    `json:"aksi"`
+	UmurJam       int       `json:"umur_jam"`
+	GradeSebelum  string    `json:"grade_sebelum"`
+	GradeSesudah  string    `json:"grade_sesudah"`
+	HargaSebelum  float64   `json:"harga_sebelum"`
+	HargaSesudah  float64   `json:"harga_sesudah"`
+	StatusSebelum string    `json:"status_sebelum"`
+	StatusSesudah string    `json:"status_sesudah"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type RestanHarian struct {
+	Tanggal      string   `json:"tanggal"`
+	KebunID      int      `json:"kebun_id"`
+	NamaKebun    string   `json:"nama_kebun"`
+	BatchRestan  int      `json:"batch_restan"`
+	RestanKg     float64  `json:"restan_kg"`
+	NilaiRestan  float64  `json:"nilai_restan"`
+	BatchExpired int      `json:"batch_expired"`
+	ExpiredKg    float64  `json:"expired_kg"`
+	PanenTertua  *string  `json:"panen_tertua"`
+}
+
+type Panen struct {
+	ID             int       `json:"id"`
+	BlokID         int       `json:"blok_id"`
+	KebunID        int       `json:"kebun_id"`
+	StokID         *int      `json:"stok_id,omitempty"`
+	TanggalPanen   string    `json:"tanggal_panen"`
+	JumlahJanjang  int       `json:"jumlah_janjang"`
+	BeratKg        float64   `json:"berat_kg"`
+	BJR            float64   `json:"bjr"` // Berat janjang rata-rata (kg)
+	Grade          string    `json:"grade"`
+	TimPemanen     string    `json:"tim_pemanen"`
+	TimID          *int      `json:"tim_id,omitempty"`
+	Catatan        string    `json:"catatan,omitempty"`
+	CreatedBy      int       `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Joined fields
+	KodeBlok       string    `json:"kode_blok,omitempty"`
+	KodeAfdeling   string    `json:"kode_afdeling,omitempty"`
+	NamaKebun      string    `json:"nama_kebun,omitempty"`
+}
+
+type TimPanen struct {
+	ID           int       `json:"id"`
+	KebunID      int       `json:"kebun_id"`
+	KodeTim      string    `json:"kode_tim"`
+	NamaTim      string    `json:"nama_tim"`
+	NamaMandor   string    `json:"nama_mandor"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	// Joined fields
+	NamaKebun    string    `json:"nama_kebun,omitempty"`
+	JumlahAnggota int      `json:"jumlah_anggota"`
+}
+
+type Pemanen struct {
+	ID            int       `json:"id"`
+	NIK           string    `json:"nik"`
+	Nama          string    `json:"nama"`
+	TimID         int       `json:"tim_id"`
+	TanggalMasuk  *string   `json:"tanggal_masuk,omitempty"`
+	UpahHarian    float64   `json:"upah_harian"`
+	NomorRekening string    `json:"nomor_rekening,omitempty"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	// Joined fields
+	NamaTim       string    `json:"nama_tim,omitempty"`
+	KebunID       int       `json:"kebun_id"`
+}
+
+type PremiRule struct {
+	ID           int       `json:"id"`
+	Nama         string    `json:"nama"`
+	KebunID      *int      `json:"kebun_id"`
+	Basis        string    `json:"basis"`
+	TargetHarian float64   `json:"target_harian"`
+	Tarif        float64   `json:"tarif"`
+	BerlakuMulai string    `json:"berlaku_mulai"`
+	BerlakuSampai *string  `json:"berlaku_sampai"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type PayrollPeriod struct {
+	ID             int           `json:"id"`
+	KebunID        *int          `json:"kebun_id"`
+	PeriodeMulai   string        `json:"periode_mulai"`
+	PeriodeSelesai string        `json:"periode_selesai"`
+	Status         string        `json:"status"`
+	JumlahPemanen  int           `json:"jumlah_pemanen"`
+	TotalUpah      float64       `json:"total_upah"`
+	TotalPremi     float64       `json:"total_premi"`
+	TotalBayar     float64       `json:"total_bayar"`
+	CreatedBy      int           `json:"created_by"`
+	FinalizedBy    *int          `json:"finalized_by,omitempty"`
+	FinalizedAt    *time.Time    `json:"finalized_at,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	// Nested
+	Items          []PayrollItem `json:"items,omitempty"`
+}
+
+type PayrollItem struct {
+	PemanenID    int     `json:"pemanen_id"`
+	NIK          string  `json:"nik"`
+	Nama         string  `json:"nama"`
+	NamaTim      string  `json:"nama_tim"`
+	NomorRekening string `json:"nomor_rekening,omitempty"`
+	HariKerja    int     `json:"hari_kerja"`
+	TotalKg      float64 `json:"total_kg"`
+	TotalJanjang int     `json:"total_janjang"`
+	UpahPokok    float64 `json:"upah_pokok"`
+	Premi        float64 `json:"premi"`
+	TotalBayar   float64 `json:"total_bayar"`
 }
 
 type PurchaseOrder struct {
@@ -101,6 +288,37 @@ type PurchaseOrder struct {
 	BuyerCompany        string    `json:"buyer_company,omitempty"`
 	NamaKebun           string    `json:"nama_kebun,omitempty"`
 	PaymentStatus       string    `json:"payment_status,omitempty"`
+	// Nested
+	Alokasi             []POAllocation `json:"alokasi,omitempty"`
+}
+
+type POAllocation struct {
+	StokID       int     `json:"stok_id"`
+	TanggalPanen string  `json:"tanggal_panen"`
+	JumlahKg     float64 `json:"jumlah_kg"`
+	HargaPerKg   float64 `json:"harga_per_kg"`
+}
+
+type StokAdjustment struct {
+	ID            int        `json:"id"`
+	StokID        int        `json:"stok_id"`
+	Alasan        string     `json:"alasan"`
+	SelisihKg     float64    `json:"selisih_kg"`
+	JumlahSebelum *float64   `json:"jumlah_sebelum,omitempty"`
+	JumlahSesudah *float64   `json:"jumlah_sesudah,omitempty"`
+	Catatan       string     `json:"catatan"`
+	Status        string     `json:"status"`
+	RequestedBy   int        `json:"requested_by"`
+	ReviewedBy    *int       `json:"reviewed_by,omitempty"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty"`
+	CatatanReview *string    `json:"catatan_review,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Joined fields
+	KebunID       int        `json:"kebun_id"`
+	NamaKebun     string     `json:"nama_kebun"`
+	Grade         string     `json:"grade"`
+	TanggalPanen  string     `json:"tanggal_panen"`
+	RequestedName string     `json:"requested_by_name"`
 }
 
 type JadwalPengambilan struct {
@@ -189,6 +407,53 @@ type LogAktivitas struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+type APIKey struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"service_account_id"`
+	Name        string     `json:"name"`
+	KeyPrefix   string     `json:"key_prefix"`
+	Permissions []string   `json:"permissions"`
+	IPAllowlist string     `json:"ip_allowlist"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedBy   *int       `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// Joined fields
+	ServiceAccount string  `json:"service_account,omitempty"`
+}
+
+type ReportSchedule struct {
+	ID         int               `json:"id"`
+	Nama       string            `json:"nama"`
+	ReportType string            `json:"report_type"`
+	Filters    map[string]string `json:"filters"`
+	Format     string            `json:"format"`
+	Recipients []string          `json:"recipients"`
+	CronExpr   string            `json:"cron_expr"`
+	IsActive   bool              `json:"is_active"`
+	NextRunAt  *time.Time        `json:"next_run_at"`
+	LastRunAt  *time.Time        `json:"last_run_at"`
+	LastStatus *string           `json:"last_status"`
+	CreatedBy  *int              `json:"created_by"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+type ReportScheduleRun struct {
+	ID           int        `json:"id"`
+	ScheduleID   int        `json:"schedule_id"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	Status       string     `json:"status"`
+	RowCount     int        `json:"row_count"`
+	Recipients   string     `json:"recipients"`
+	FileName     *string    `json:"file_name"`
+	ErrorMessage *string    `json:"error_message"`
+	TriggeredBy  *int       `json:"triggered_by"`
+}
+
 // DTOs (Data Transfer Objects)
 
 type LoginRequest struct {
@@ -199,20 +464,217 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Username    string `json:"username" binding:"required"`
 	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=6"`
+	Password    string `json:"password" binding:"required,min=8"`
 	CompanyName string `json:"company_name" binding:"required"`
 	Address     string `json:"address"`
 	NIB         string `json:"nib"`
 	Phone       string `json:"phone"`
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type VerifyMFARequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableMFARequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type CreateServiceAccountRequest struct {
+	Username    string `json:"username" binding:"required"`
+	Email       string `json:"email" binding:"required,email"`
+	CompanyName string `json:"company_name"`
+}
+
+type CreateAPIKeyRequest struct {
+	ServiceAccountID int      `json:"service_account_id" binding:"required"`
+	Name             string   `json:"name" binding:"required"`
+	Permissions      []string `json:"permissions" binding:"required,min=1"`
+	IPAllowlist      []string `json:"ip_allowlist"`
+	ExpiresAt        string   `json:"expires_at"` // RFC 3339 or YYYY-MM-DD, empty = never
+}
+
 type LoginResponse struct {
 	Token string `json:"token"`
 	User  User   `json:"user"`
 }
 
+type KebunRequest struct {
+	NamaKebun  string  `json:"nama_kebun" binding:"required"`
+	Lokasi     string  `json:"lokasi" binding:"required"`
+	LuasHektar float64 `json:"luas_hektar" binding:"required,gt=0"`
+	Koordinat  string  `json:"koordinat"`
+	Status     string  `json:"status" binding:"omitempty,oneof=active inactive"`
+}
+
+type AfdelingRequest struct {
+	KodeAfdeling string  `json:"kode_afdeling" binding:"required"`
+	NamaAfdeling string  `json:"nama_afdeling" binding:"required"`
+	LuasHektar   float64 `json:"luas_hektar" binding:"required,gt=0"`
+	Status       string  `json:"status" binding:"omitempty,oneof=active inactive"`
+}
+
+type BlokRequest struct {
+	KodeBlok    string  `json:"kode_blok" binding:"required"`
+	TahunTanam  int     `json:"tahun_tanam" binding:"required,gte=1900"`
+	Varietas    string  `json:"varietas"`
+	LuasHektar  float64 `json:"luas_hektar" binding:"required,gt=0"`
+	JumlahPokok *int    `json:"jumlah_pokok" binding:"omitempty,gte=0"`
+	Status      string  `json:"status" binding:"omitempty,oneof=active inactive replanting"`
+}
+
+type CreatePanenRequest struct {
+	BlokID        int     `json:"blok_id" binding:"required"`
+	TanggalPanen  string  `json:"tanggal_panen" binding:"required"`
+	JumlahJanjang int     `json:"jumlah_janjang" binding:"required,gt=0"`
+	BeratKg       float64 `json:"berat_kg" binding:"required,gt=0"`
+	Grade         string  `json:"grade" binding:"required,oneof=A B C"`
+	TimPemanen    string  `json:"tim_pemanen"` // Required when tim_id is not given
+	TimID         *int    `json:"tim_id"`
+	HargaPerKg    float64 `json:"harga_per_kg" binding:"omitempty,gt=0"`
+	Catatan       string  `json:"catatan"`
+	Pemanen       []PanenPemanenInput `json:"pemanen" binding:"omitempty,dive"`
+}
+
+// PanenPemanenInput is one harvester's share of a blok harvest.
+// berat_kg defaults to jumlah_janjang x BJR of the harvest.
+type PanenPemanenInput struct {
+	PemanenID     int     `json:"pemanen_id" binding:"required"`
+	JumlahJanjang int     `json:"jumlah_janjang" binding:"required,gt=0"`
+	BeratKg       float64 `json:"berat_kg" binding:"omitempty,gt=0"`
+}
+
+type PanenPemanenRequest struct {
+	Pemanen []PanenPemanenInput `json:"pemanen" binding:"required,dive"`
+}
+
+type TimPanenRequest struct {
+	KebunID    int    `json:"kebun_id" binding:"required"`
+	KodeTim    string `json:"kode_tim" binding:"required"`
+	NamaTim    string `json:"nama_tim" binding:"required"`
+	NamaMandor string `json:"nama_mandor" binding:"required"`
+	Status     string `json:"status" binding:"omitempty,oneof=active inactive"`
+}
+
+type PemanenRequest struct {
+	NIK           string  `json:"nik" binding:"required"`
+	Nama          string  `json:"nama" binding:"required"`
+	TimID         int     `json:"tim_id" binding:"required"`
+	TanggalMasuk  string  `json:"tanggal_masuk"`
+	UpahHarian    float64 `json:"upah_harian" binding:"gte=0"`
+	NomorRekening string  `json:"nomor_rekening"`
+	Status        string  `json:"status" binding:"omitempty,oneof=active inactive"`
+}
+
+type PremiRuleRequest struct {
+	Nama          string  `json:"nama" binding:"required"`
+	KebunID       *int    `json:"kebun_id"`
+	Basis         string  `json:"basis" binding:"required,oneof=kg janjang"`
+	TargetHarian  float64 `json:"target_harian" binding:"gte=0"`
+	Tarif         float64 `json:"tarif" binding:"required,gt=0"`
+	BerlakuMulai  string  `json:"berlaku_mulai" binding:"required"`
+	BerlakuSampai string  `json:"berlaku_sampai"`
+	Status        string  `json:"status" binding:"omitempty,oneof=active inactive"`
+}
+
+type CreateStokRequest struct {
+	KebunID      int     `json:"kebun_id" binding:"required"`
+	BlokID       *int    `json:"blok_id"`
+	TanggalPanen string  `json:"tanggal_panen" binding:"required"`
+	JumlahKg     float64 `json:"jumlah_kg" binding:"required,gt=0"`
+	Grade        string  `json:"grade" binding:"required,oneof=A B C"`
+	KadarMinyak  float64 `json:"kadar_minyak" binding:"gte=0,lte=100"`
+	HargaPerKg   float64 `json:"harga_per_kg" binding:"required,gt=0"`
+	Keterangan   string  `json:"keterangan"`
+}
+
+type KendaraanRequest struct {
+	PlatNomor   string  `json:"plat_nomor" binding:"required,max=20"`
+	Jenis       string  `json:"jenis"`
+	KapasitasKg float64 `json:"kapasitas_kg" binding:"gte=0"`
+	NamaSopir   string  `json:"nama_sopir"`
+	BuyerID     *int    `json:"buyer_id"`
+}
+
+type ImportBuyerRequest struct {
+	Username    string `json:"username" binding:"required"`
+	Email       string `json:"email" binding:"required,email"`
+	CompanyName string `json:"company_name" binding:"required"`
+	Address     string `json:"address"`
+	NIB         string `json:"nib"`
+	Phone       string `json:"phone"`
+}
+
+type StokAgeingRuleRequest struct {
+	Nama         string   `json:"nama" binding:"required"`
+	Grade        *string  `json:"grade" binding:"omitempty,oneof=A B C"`
+	UmurJam      int      `json:"umur_jam" binding:"required,gt=0"`
+	Aksi         string   `json:"aksi" binding:"required,oneof=discount downgrade restan expired"`
+	DiskonPersen *float64 `json:"diskon_persen" binding:"omitempty,gt=0,lt=100"`
+	Status       string   `json:"status" binding:"omitempty,oneof=active inactive"`
+}
+
+type StokAdjustmentRequest struct {
+	Alasan    string  `json:"alasan" binding:"required,oneof=shrinkage reweigh spoilage correction"`
+	SelisihKg float64 `json:"selisih_kg" binding:"required"`
+	Catatan   string  `json:"catatan" binding:"required"`
+}
+
+type ReviewStokAdjustmentRequest struct {
+	Status  string `json:"status" binding:"required,oneof=approved rejected"`
+	Catatan string `json:"catatan"`
+}
+
+// ReportScheduleRequest defines a report delivered by email on a cron schedule.
+// filters takes the report's query parameters; "period" (today, yesterday,
+// last_7_days, last_week, month_to_date, last_month) fills start_date/end_date
+// relative to each run.
+type ReportScheduleRequest struct {
+	Nama       string            `json:"nama" binding:"required,max=100"`
+	ReportType string            `json:"report_type" binding:"required"`
+	Filters    map[string]string `json:"filters"`
+	Format     string            `json:"format" binding:"required,oneof=xlsx csv pdf"`
+	Recipients []string          `json:"recipients" binding:"required,min=1,dive,email"`
+	CronExpr   string            `json:"cron_expr" binding:"required"`
+	IsActive   *bool             `json:"is_active"`
+}
+
+type CreatePayrollRequest struct {
+	PeriodeMulai   string `json:"periode_mulai" binding:"required"`
+	PeriodeSelesai string `json:"periode_selesai" binding:"required"`
+	KebunID        *int   `json:"kebun_id"`
+}
+
+// BoundaryRequest carries a plantation boundary as GeoJSON or KML text
+type BoundaryRequest struct {
+	GeoJSON json.RawMessage `json:"geojson"`
+	KML     string          `json:"kml"`
+}
+
 type CreatePORequest struct {
-	StokID             int     `json:"stok_id" binding:"required"`
+	// Either stok_id, or kebun_id + grade to allocate FIFO across batches
+	StokID             int     `json:"stok_id"`
+	KebunID            int     `json:"kebun_id"`
+	Grade              string  `json:"grade" binding:"omitempty,oneof=A B C"`
 	JumlahKg           float64 `json:"jumlah_kg" binding:"required,gt=0"`
 	TanggalPengambilan string  `json:"tanggal_pengambilan" binding:"required"`
 	MetodePembayaran   string  `json:"metode_pembayaran" binding:"required"`
@@ -220,7 +682,7 @@ type CreatePORequest struct {
 }
 
 type UpdatePOStatusRequest struct {
-	Status  string `json:"status" binding:"required"`
+	Status  string `json:"status" binding:"required,oneof=approved rejected completed"`
 	Catatan string `json:"catatan"`
 }
 
@@ -231,8 +693,13 @@ type CreateJadwalRequest struct {
 	NamaSopir    string `json:"nama_sopir" binding:"required"`
 }
 
+// WeighInRequest records the empty truck weight. input is "scale" when the
+// figure comes from the indicator and "manual" (default) when typed in.
+// Weighing a truck in again is an override and needs alasan_override.
 type WeighInRequest struct {
-	BeratMasuk float64 `json:"berat_masuk" binding:"required,gt=0"`
+	BeratMasuk     float64 `json:"berat_masuk" binding:"required,gt=0"`
+	Input          string  `json:"input" binding:"omitempty,oneof=scale manual"`
+	AlasanOverride string  `json:"alasan_override"`
 }
 
 type WeighOutRequest struct {
@@ -242,6 +709,7 @@ type WeighOutRequest struct {
 	KadarSampah        float64 `json:"kadar_sampah"`
 	TingkatKematangan  string  `json:"tingkat_kematangan"`
 	Catatan            string  `json:"catatan"`
+	Input              string  `json:"input" binding:"omitempty,oneof=scale manual"`
 }
 
 type CreatePembayaranRequest struct {
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoginAttempt is one login try, stored for throttling and the security log
+type LoginAttempt struct {
+	Email     string
+	UserID    *int
+	IPAddress string
+	UserAgent string
+	Success   bool
+}
+
+// LockedAccount is an account locked after repeated login failures
+type LockedAccount struct {
+	ID               int
+	Username         string
+	Email            string
+	Role             string
+	FailedLoginCount int
+	LockedUntil      time.Time
+}
+
+// UserMFA is the second factor state of an account
+type UserMFA struct {
+	PasswordHash string
+	// TOTPSecret is nil until 2FA setup has started
+	TOTPSecret  *string
+	TOTPEnabled bool
+	Status      string
+	LockedUntil *time.Time
+}
+
+// AuthRepository stores what login needs besides the account itself: the attempt
+// log, lockouts, single-use email tokens and the TOTP and recovery code factors
+type AuthRepository interface {
+	RecordAttempt(a LoginAttempt) error
+	// IPFailures counts the failed attempts from ip since a time and returns the latest
+	IPFailures(ip string, since time.Time) (failures int, last *time.Time, err error)
+	// IPTargets counts the distinct emails ip failed to log in to since a time
+	IPTargets(ip string, since time.Time) (int, error)
+
+	// AddFailure counts a failed login on the account and returns the failures so
+	// far. A failure after a quiet period longer than window starts the count again.
+	// The row stays locked until the transaction ends.
+	AddFailure(userID int, window time.Duration) (int, error)
+	LockUntil(userID int, until time.Time) error
+	// ResetFailures clears the failure counter and any lockout
+	ResetFailures(userID int) error
+	// Locked lists the accounts locked right now, latest lockout first
+	Locked() ([]LockedAccount, error)
+
+	// CreateToken stores the hash of a single-use token
+	CreateToken(userID int, purpose, tokenHash string, expiresAt time.Time) error
+	// FindToken returns an unused, unexpired token without using it
+	FindToken(tokenHash, purpose string) (tokenID, userID int, err error)
+	// UseToken marks a token as used; it returns false when it was already used
+	UseToken(tokenID int) (bool, error)
+	// UseTokens marks every outstanding token of the user with purpose as used
+	UseTokens(userID int, purpose string) error
+
+	MFA(userID int) (UserMFA, error)
+	// SetTOTPSecret starts enrollment with a new secret
+	SetTOTPSecret(userID int, secret string) error
+	// EnableTOTP finishes enrollment; step is the time step of the confirming code
+	EnableTOTP(userID int, step int64) error
+	// ClaimTOTPStep records step as used; it returns false when it or a later step
+	// was already used, so each code is accepted once
+	ClaimTOTPStep(userID int, step int64) (bool, error)
+	// ClearMFA removes the TOTP secret and recovery codes
+	ClearMFA(userID int) error
+	// ReplaceRecoveryCodes stores new recovery code hashes in place of the old ones
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	// UseRecoveryCode marks an unused code as used; it returns false when there is none
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	// RecoveryCodesLeft counts the unused recovery codes
+	RecoveryCodesLeft(userID int) (int, error)
+}
+
+type authRepo struct{ db DBTX }
+
+func (r *authRepo) RecordAttempt(a LoginAttempt) error {
+	_, err := r.db.Exec(`
+		INSERT INTO login_attempts (email, user_id, ip_address, user_agent, success)
+		VALUES (?, ?, ?, ?, ?)
+	`, a.Email, nullInt(a.UserID), a.IPAddress, a.UserAgent, a.Success)
+	return err
+}
+
+func (r *authRepo) IPFailures(ip string, since time.Time) (int, *time.Time, error) {
+	var failures int
+	var last sql.NullTime
+	err := r.db.QueryRow(`
+		SELECT COUNT(*), MAX(created_at) FROM login_attempts
+		WHERE ip_address = ? AND success = FALSE AND created_at > ?
+	`, ip, since).Scan(&failures, &last)
+	if err != nil || !last.Valid {
+		return failures, nil, err
+	}
+	return failures, &last.Time, nil
+}
+
+func (r *authRepo) IPTargets(ip string, since time.Time) (int, error) {
+	var accounts int
+	err := r.db.QueryRow(`
+		SELECT COUNT(DISTINCT email) FROM login_attempts
+		WHERE ip_address = ? AND success = FALSE AND created_at > ?
+	`, ip, since).Scan(&accounts)
+	return accounts, err
+}
+
+func (r *authRepo) AddFailure(userID int, window time.Duration) (int, error) {
+	// MySQL assigns left to right, so the CASE still sees the previous failure time
+	_, err := r.db.Exec(`
+		UPDATE users
+		SET failed_login_count = CASE
+		        WHEN last_failed_login_at > NOW() - INTERVAL ? MINUTE THEN failed_login_count + 1
+		        ELSE 1
+		    END,
+		    last_failed_login_at = NOW()
+		WHERE id = ?
+	`, int(window/time.Minute), userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// The row stays locked by the update, so concurrent failures each read their own count
+	var failures int
+	err = r.db.QueryRow("SELECT failed_login_count FROM users WHERE id = ?", userID).Scan(&failures)
+	return failures, notFound(err)
+}
+
+func (r *authRepo) LockUntil(userID int, until time.Time) error {
+	_, err := r.db.Exec("UPDATE users SET locked_until = ? WHERE id = ?", until, userID)
+	return err
+}
+
+func (r *authRepo) ResetFailures(userID int) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET failed_login_count = 0, last_failed_login_at = NULL, locked_until = NULL WHERE id = ?
+	`, userID)
+	return err
+}
+
+func (r *authRepo) Locked() ([]LockedAccount, error) {
+	rows, err := r.db.Query(`
+		SELECT id, username, email, role, failed_login_count, locked_until
+		FROM users
+		WHERE locked_until > NOW()
+		ORDER BY locked_until DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make([]LockedAccount, 0)
+	for rows.Next() {
+		var a LockedAccount
+		if err := rows.Scan(&a.ID, &a.Username, &a.Email, &a.Role, &a.FailedLoginCount, &a.LockedUntil); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+func (r *authRepo) CreateToken(userID int, purpose, tokenHash string, expiresAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO auth_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, userID, purpose, tokenHash, expiresAt)
+	return err
+}
+
+func (r *authRepo) FindToken(tokenHash, purpose string) (tokenID, userID int, err error) {
+	err = r.db.QueryRow(`
+		SELECT id, user_id FROM auth_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > NOW()
+	`, tokenHash, purpose).Scan(&tokenID, &userID)
+	return tokenID, userID, notFound(err)
+}
+
+func (r *authRepo) UseToken(tokenID int) (bool, error) {
+	// The used_at guard makes concurrent redemptions of the same token fail
+	result, err := r.db.Exec(`
+		UPDATE auth_tokens SET used_at = NOW() WHERE id = ? AND used_at IS NULL
+	`, tokenID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *authRepo) UseTokens(userID int, purpose string) error {
+	_, err := r.db.Exec(`
+		UPDATE auth_tokens SET used_at = NOW()
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL
+	`, userID, purpose)
+	return err
+}
+
+func (r *authRepo) MFA(userID int) (UserMFA, error) {
+	var m UserMFA
+	var secret sql.NullString
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRow(`
+		SELECT password, totp_secret, totp_enabled, status, locked_until FROM users WHERE id = ?
+	`, userID).Scan(&m.PasswordHash, &secret, &m.TOTPEnabled, &m.Status, &lockedUntil)
+	if err != nil {
+		return m, notFound(err)
+	}
+	m.TOTPSecret = optString(secret)
+	if lockedUntil.Valid {
+		m.LockedUntil = &lockedUntil.Time
+	}
+	return m, nil
+}
+
+func (r *authRepo) SetTOTPSecret(userID int, secret string) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET totp_secret = ?, totp_last_step = NULL WHERE id = ?
+	`, secret, userID)
+	return err
+}
+
+func (r *authRepo) EnableTOTP(userID int, step int64) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET totp_enabled = TRUE, totp_last_step = ? WHERE id = ?
+	`, step, userID)
+	return err
+}
+
+func (r *authRepo) ClaimTOTPStep(userID int, step int64) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE users SET totp_last_step = ?
+		WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)
+	`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *authRepo) ClearMFA(userID int) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL WHERE id = ?
+	`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	return err
+}
+
+func (r *authRepo) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	if _, err := r.db.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := r.db.Exec(`
+			INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)
+		`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *authRepo) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *authRepo) RecoveryCodesLeft(userID int) (int, error) {
+	var remaining int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL
+	`, userID).Scan(&remaining)
+	return remaining, err
+}
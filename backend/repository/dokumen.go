@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"database/sql"
+
+	"sawit-backend/models"
+)
+
+// DokumenFilter narrows the sales document list. BuyerID limits it to one buyer's orders.
+type DokumenFilter struct {
+	POID      string
+	StartDate string
+	EndDate   string
+	BuyerID   *int
+}
+
+// DokumenRow is a sales document with its order and buyer
+type DokumenRow struct {
+	models.DokumenPenjualan
+	PONumber   string
+	Grade      string
+	BuyerName  string
+	Perusahaan string
+}
+
+// SalesFilter narrows a sales report by document date
+type SalesFilter struct {
+	StartDate string
+	EndDate   string
+}
+
+// DailySales sums the sales documents of one day
+type DailySales struct {
+	Tanggal         string
+	JumlahTransaksi int
+	TotalKg         float64
+	TotalPendapatan float64
+	RataRataHarga   float64
+	GradeA          float64
+	GradeB          float64
+	GradeC          float64
+}
+
+// ReceivableFilter narrows the receivables report. BuyerID is the buyer_id query
+// parameter, not a scope: the report is only open to finance.
+type ReceivableFilter struct {
+	BuyerID   string
+	StartDate string
+	EndDate   string
+}
+
+// Receivable is an invoice that is not fully paid
+type Receivable struct {
+	DokumenID      int
+	NomorInvoice   string
+	PONumber       string
+	BuyerID        int
+	BuyerCompany   string
+	TanggalInvoice string
+	UmurHari       int
+	TotalTagihan   float64
+	Terbayar       float64
+}
+
+// DokumenRepository stores the sales documents issued after weigh-out
+type DokumenRepository interface {
+	// NextNumber returns the sequence for today's surat jalan, invoice and bukti timbang
+	NextNumber() (int, error)
+	// Create inserts a document dated today
+	Create(d models.DokumenPenjualan) (int64, error)
+	// FindOwner returns the order and buyer a document belongs to
+	FindOwner(id int) (poID, buyerID int, err error)
+	List(f DokumenFilter) ([]DokumenRow, error)
+	// DailySales sums the documents per day, newest day first
+	DailySales(f SalesFilter) ([]DailySales, error)
+	// Receivables lists the invoices not fully paid, oldest first. Only verified
+	// or completed payments count towards the paid amount.
+	Receivables(f ReceivableFilter) ([]Receivable, error)
+}
+
+type dokumenRepo struct{ db DBTX }
+
+func (r *dokumenRepo) NextNumber() (int, error) {
+	var counter int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) + 1 FROM dokumen_penjualan WHERE DATE(tanggal_dokumen) = CURDATE()
+	`).Scan(&counter)
+	return counter, err
+}
+
+func (r *dokumenRepo) Create(d models.DokumenPenjualan) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO dokumen_penjualan (
+			po_id, timbang_id, nomor_surat_jalan, nomor_invoice, nomor_bukti_timbang,
+			tanggal_dokumen, jumlah_kg, harga_per_kg, total_harga, penyesuaian_harga, total_akhir
+		) VALUES (?, ?, ?, ?, ?, CURDATE(), ?, ?, ?, ?, ?)
+	`, d.POID, d.TimbangID, d.NomorSuratJalan, d.NomorInvoice, d.NomorBuktiTimbang,
+		d.JumlahKg, d.HargaPerKg, d.TotalHarga, d.PenyesuaianHarga, d.TotalAkhir)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *dokumenRepo) FindOwner(id int) (poID, buyerID int, err error) {
+	err = r.db.QueryRow(`
+		SELECT dp.po_id, po.buyer_id
+		FROM dokumen_penjualan dp
+		JOIN purchase_orders po ON dp.po_id = po.id
+		WHERE dp.id = ?
+	`, id).Scan(&poID, &buyerID)
+	return poID, buyerID, notFound(err)
+}
+
+func (r *dokumenRepo) List(f DokumenFilter) ([]DokumenRow, error) {
+	query := `
+		SELECT dp.id, dp.po_id, dp.timbang_id, dp.nomor_surat_jalan, dp.nomor_invoice, dp.nomor_bukti_timbang,
+		       dp.tanggal_dokumen, dp.jumlah_kg, dp.harga_per_kg, dp.total_harga, dp.penyesuaian_harga, dp.total_akhir,
+		       dp.file_surat_jalan, dp.file_invoice, dp.file_bukti_timbang, dp.file_quality_report,
+		       dp.created_at, dp.updated_at,
+		       po.po_number, po.grade_diminta, u.username as buyer_name, u.company_name as perusahaan
+		FROM dokumen_penjualan dp
+		JOIN purchase_orders po ON dp.po_id = po.id
+		JOIN users u ON po.buyer_id = u.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if f.BuyerID != nil {
+		query += " AND po.buyer_id = ?"
+		args = append(args, *f.BuyerID)
+	}
+	if f.POID != "" {
+		query += " AND dp.po_id = ?"
+		args = append(args, f.POID)
+	}
+	if f.StartDate != "" {
+		query += " AND DATE(dp.tanggal_dokumen) >= ?"
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		query += " AND DATE(dp.tanggal_dokumen) <= ?"
+		args = append(args, f.EndDate)
+	}
+
+	query += " ORDER BY dp.created_at DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dokumenList := make([]DokumenRow, 0)
+	for rows.Next() {
+		var d DokumenRow
+		var fileSJ, fileInvoice, fileBukti, fileQuality, perusahaan sql.NullString
+		err := rows.Scan(
+			&d.ID, &d.POID, &d.TimbangID, &d.NomorSuratJalan, &d.NomorInvoice, &d.NomorBuktiTimbang,
+			&d.TanggalDokumen, &d.JumlahKg, &d.HargaPerKg, &d.TotalHarga, &d.PenyesuaianHarga, &d.TotalAkhir,
+			&fileSJ, &fileInvoice, &fileBukti, &fileQuality,
+			&d.CreatedAt, &d.UpdatedAt,
+			&d.PONumber, &d.Grade, &d.BuyerName, &perusahaan,
+		)
+		if err != nil {
+			return nil, err
+		}
+		d.FileSuratJalan, d.FileInvoice = fileSJ.String, fileInvoice.String
+		d.FileBuktiTimbang, d.FileQualityReport = fileBukti.String, fileQuality.String
+		d.Perusahaan = perusahaan.String
+		dokumenList = append(dokumenList, d)
+	}
+	return dokumenList, rows.Err()
+}
+
+func (r *dokumenRepo) DailySales(f SalesFilter) ([]DailySales, error) {
+	query := `
+		SELECT DATE(dp.tanggal_dokumen) as tanggal,
+		       COUNT(DISTINCT dp.id) as jumlah_transaksi,
+		       SUM(dp.jumlah_kg) as total_kg,
+		       SUM(total_akhir) as total_pendapatan,
+		       AVG(dp.harga_per_kg) as rata_rata_harga,
+		       SUM(CASE WHEN t.grade_aktual = 'A' THEN dp.jumlah_kg ELSE 0 END) as grade_a,
+		       SUM(CASE WHEN t.grade_aktual = 'B' THEN dp.jumlah_kg ELSE 0 END) as grade_b,
+		       SUM(CASE WHEN t.grade_aktual = 'C' THEN dp.jumlah_kg ELSE 0 END) as grade_c
+		FROM dokumen_penjualan dp
+		LEFT JOIN timbangan t ON dp.timbang_id = t.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if f.StartDate != "" {
+		query += " AND DATE(dp.tanggal_dokumen) >= ?"
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		query += " AND DATE(dp.tanggal_dokumen) <= ?"
+		args = append(args, f.EndDate)
+	}
+
+	query += " GROUP BY DATE(dp.tanggal_dokumen) ORDER BY tanggal DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sales := make([]DailySales, 0)
+	for rows.Next() {
+		var d DailySales
+		var gradeA, gradeB, gradeC sql.NullFloat64
+		err := rows.Scan(&d.Tanggal, &d.JumlahTransaksi, &d.TotalKg, &d.TotalPendapatan, &d.RataRataHarga,
+			&gradeA, &gradeB, &gradeC)
+		if err != nil {
+			return nil, err
+		}
+		d.GradeA, d.GradeB, d.GradeC = gradeA.Float64, gradeB.Float64, gradeC.Float64
+		sales = append(sales, d)
+	}
+	return sales, rows.Err()
+}
+
+func (r *dokumenRepo) Receivables(f ReceivableFilter) ([]Receivable, error) {
+	query := `
+		SELECT dp.id, dp.nomor_invoice, po.po_number, po.buyer_id, u.company_name,
+		       DATE_FORMAT(dp.tanggal_dokumen, '%Y-%m-%d'), DATEDIFF(CURDATE(), dp.tanggal_dokumen),
+		       dp.total_akhir, COALESCE(paid.total, 0)
+		FROM dokumen_penjualan dp
+		JOIN purchase_orders po ON dp.po_id = po.id
+		JOIN users u ON po.buyer_id = u.id
+		LEFT JOIN (
+			SELECT dokumen_id, SUM(jumlah_bayar) as total
+			FROM pembayaran
+			WHERE status IN ('verified', 'completed')
+			GROUP BY dokumen_id
+		) paid ON paid.dokumen_id = dp.id
+		WHERE dp.total_akhir - COALESCE(paid.total, 0) > 0
+	`
+	args := []interface{}{}
+
+	if f.BuyerID != "" {
+		query += " AND po.buyer_id = ?"
+		args = append(args, f.BuyerID)
+	}
+	if f.StartDate != "" {
+		query += " AND dp.tanggal_dokumen >= ?"
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		query += " AND dp.tanggal_dokumen <= ?"
+		args = append(args, f.EndDate)
+	}
+
+	query += " ORDER BY dp.tanggal_dokumen ASC, dp.id ASC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invoices := make([]Receivable, 0)
+	for rows.Next() {
+		var inv Receivable
+		var company sql.NullString
+		err := rows.Scan(&inv.DokumenID, &inv.NomorInvoice, &inv.PONumber, &inv.BuyerID, &company,
+			&inv.TanggalInvoice, &inv.UmurHari, &inv.TotalTagihan, &inv.Terbayar)
+		if err != nil {
+			return nil, err
+		}
+		inv.BuyerCompany = company.String
+		invoices = append(invoices, inv)
+	}
+	return invoices, rows.Err()
+}
@@ -0,0 +1,106 @@
+package repository
+
+import "sawit-backend/models"
+
+// JadwalFilter narrows the pickup schedule list. BuyerID limits it to one buyer's orders.
+type JadwalFilter struct {
+	Status  string
+	Date    string
+	BuyerID *int
+}
+
+// JadwalRepository stores pickup schedules
+type JadwalRepository interface {
+	// NextAntrian returns the next queue number on the day of waktuLoading
+	NextAntrian(waktuLoading string) (int, error)
+	Create(req models.CreateJadwalRequest, nomorAntrian int) (int64, error)
+	SetStatus(id int, status string) error
+	// SetStatusByTimbangan updates the schedule a weighing record belongs to
+	SetStatusByTimbangan(timbangID int, status string) error
+	List(f JadwalFilter) ([]models.JadwalPengambilan, error)
+}
+
+type jadwalRepo struct{ db DBTX }
+
+func (r *jadwalRepo) NextAntrian(waktuLoading string) (int, error) {
+	var nomor int
+	err := r.db.QueryRow(`
+		SELECT COALESCE(MAX(nomor_antrian), 0) + 1
+		FROM jadwal_pengambilan
+		WHERE DATE(waktu_loading) = DATE(?)
+	`, waktuLoading).Scan(&nomor)
+	return nomor, err
+}
+
+func (r *jadwalRepo) Create(req models.CreateJadwalRequest, nomorAntrian int) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO jadwal_pengambilan (po_id, nomor_antrian, waktu_loading, plat_nomor, nama_sopir, status)
+		VALUES (?, ?, ?, ?, ?, 'scheduled')
+	`, req.POID, nomorAntrian, req.WaktuLoading, req.PlatNomor, req.NamaSopir)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *jadwalRepo) SetStatus(id int, status string) error {
+	_, err := r.db.Exec("UPDATE jadwal_pengambilan SET status = ? WHERE id = ?", status, id)
+	return err
+}
+
+func (r *jadwalRepo) SetStatusByTimbangan(timbangID int, status string) error {
+	_, err := r.db.Exec(`
+		UPDATE jadwal_pengambilan j
+		JOIN timbangan t ON j.id = t.jadwal_id
+		SET j.status = ?
+		WHERE t.id = ?
+	`, status, timbangID)
+	return err
+}
+
+func (r *jadwalRepo) List(f JadwalFilter) ([]models.JadwalPengambilan, error) {
+	query := `
+		SELECT j.id, j.po_id, j.nomor_antrian, j.waktu_loading, j.plat_nomor,
+		       j.nama_sopir, j.status, j.created_at, j.updated_at
+		FROM jadwal_pengambilan j
+		JOIN purchase_orders po ON j.po_id = po.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if f.BuyerID != nil {
+		query += " AND po.buyer_id = ?"
+		args = append(args, *f.BuyerID)
+	}
+	if f.Status != "" {
+		query += " AND j.status = ?"
+		args = append(args, f.Status)
+	}
+	if f.Date != "" {
+		query += " AND DATE(j.waktu_loading) = ?"
+		args = append(args, f.Date)
+	}
+
+	query += " ORDER BY j.waktu_loading ASC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jadwalList := make([]models.JadwalPengambilan, 0)
+	for rows.Next() {
+		var jadwal models.JadwalPengambilan
+		err := rows.Scan(
+			&jadwal.ID, &jadwal.POID, &jadwal.NomorAntrian, &jadwal.WaktuLoading,
+			&jadwal.PlatNomor, &jadwal.NamaSopir, &jadwal.Status,
+			&jadwal.CreatedAt, &jadwal.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jadwalList = append(jadwalList, jadwal)
+	}
+	return jadwalList, rows.Err()
+}
@@ -0,0 +1,461 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// hiddenColumns are never copied into a snapshot
+var hiddenColumns = map[string]bool{
+	"password":       true,
+	"totp_secret":    true,
+	"totp_last_step": true,
+	"key_hash":       true,
+}
+
+// LogEntry is one row of the activity log and audit trail
+type LogEntry struct {
+	UserID      *int
+	Aksi        string
+	Modul       string
+	Entitas     string
+	ReferenceID int64
+	Aktivitas   string
+	DataSebelum map[string]interface{}
+	DataSesudah map[string]interface{}
+	RequestID   string
+	IPAddress   string
+	UserAgent   string
+}
+
+// LogFilter narrows the activity log. Aktivitas is a word search; Role "system"
+// matches the entries without a user, e.g. from the scheduler. EndDate includes the whole day.
+type LogFilter struct {
+	UserID      string
+	Aktivitas   string
+	Modul       string
+	ReferenceID string
+	Role        string
+	StartDate   string
+	EndDate     string
+}
+
+// LogPage selects one page of the log. With After set the page continues below that
+// entry and Offset is ignored; a Limit of 0 returns every entry.
+type LogPage struct {
+	After  *LogPosition
+	Limit  int
+	Offset int
+}
+
+// LogPosition is the place of an entry in the log order
+type LogPosition struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// LogRow is an activity log entry with its user. Entries without a user read as
+// user 0, username "System" and role "system".
+type LogRow struct {
+	ID             int
+	UserID         int
+	Username       string
+	Role           string
+	Aktivitas      string
+	Modul          string
+	ReferenceID    *int
+	Detail         string
+	IPAddress      string
+	UserAgent      string
+	WaktuAktivitas string
+}
+
+// LogStatistics summarises the entries matching a LogFilter
+type LogStatistics struct {
+	// Aktivitas counts the 50 most frequent activities
+	Aktivitas []LogCount
+	// TopUsers counts the 10 most active users
+	TopUsers []LogUserCount
+	PerModul []LogModulCount
+	// Heatmap counts entries by weekday (0 = Monday) and hour
+	Heatmap    [7][24]int
+	Gagal      int
+	GagalPerIP []LogIPCount
+}
+
+// LogCount counts the entries of one activity
+type LogCount struct {
+	Aktivitas string
+	Jumlah    int
+}
+
+// LogUserCount counts the entries of one user
+type LogUserCount struct {
+	Username string
+	Role     string
+	Jumlah   int
+}
+
+// LogModulCount counts the entries, failures and users of one module
+type LogModulCount struct {
+	Modul      string
+	Jumlah     int
+	Gagal      int
+	JumlahUser int
+}
+
+// LogIPCount counts the failed actions from one address
+type LogIPCount struct {
+	IPAddress string
+	Jumlah    int
+	Terakhir  time.Time
+}
+
+// LogRepository writes the activity log, reads the row snapshots stored with it and
+// lists the log for the activity log pages
+type LogRepository interface {
+	// Snapshot reads one row of table as column values, or nil when it does not exist
+	Snapshot(table string, id int64) (map[string]interface{}, error)
+	Record(e LogEntry) error
+	// List returns the entries matching f, newest first
+	List(f LogFilter, page LogPage) ([]LogRow, error)
+	Count(f LogFilter) (int, error)
+	Statistics(f LogFilter) (LogStatistics, error)
+}
+
+type logRepo struct{ db DBTX }
+
+// NewLogRepository writes the log through db, for code that works on a plain
+// connection or transaction instead of a Store
+func NewLogRepository(db DBTX) LogRepository {
+	return &logRepo{db}
+}
+
+func (r *logRepo) Snapshot(table string, id int64) (map[string]interface{}, error) {
+	rows, err := r.db.Query("SELECT * FROM "+table+" WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(types))
+	pointers := make([]interface{}, len(types))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	snapshot := map[string]interface{}{}
+	for i, t := range types {
+		if hiddenColumns[t.Name()] {
+			continue
+		}
+		value := values[i]
+		if raw, ok := value.([]byte); ok {
+			switch t.DatabaseTypeName() {
+			case "DECIMAL":
+				value, _ = strconv.ParseFloat(string(raw), 64)
+			case "JSON":
+				value = json.RawMessage(raw)
+			default:
+				value = string(raw)
+			}
+		}
+		snapshot[t.Name()] = value
+	}
+	return snapshot, nil
+}
+
+func (r *logRepo) Record(e LogEntry) error {
+	var referenceID interface{}
+	if e.ReferenceID != 0 {
+		referenceID = e.ReferenceID
+	}
+	_, err := r.db.Exec(`
+		INSERT INTO log_aktivitas (user_id, aktivitas, modul, reference_id, aksi, entitas,
+			data_sebelum, data_sesudah, request_id, ip_address, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, nullInt(e.UserID), e.Aktivitas, nullString(e.Modul), referenceID, e.Aksi, nullString(e.Entitas),
+		snapshotJSON(e.DataSebelum), snapshotJSON(e.DataSesudah),
+		nullString(e.RequestID), nullString(e.IPAddress), nullString(e.UserAgent))
+	return err
+}
+
+// snapshotJSON encodes a snapshot for a JSON column, keeping a missing snapshot NULL
+func snapshotJSON(snapshot map[string]interface{}) interface{} {
+	if snapshot == nil {
+		return nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+// where builds the WHERE clause shared by the log list, count and statistics.
+// Queries must alias log_aktivitas as la and LEFT JOIN users as u; joinUsers reports
+// whether the clause needs that join, so counts can skip it otherwise.
+func (f LogFilter) where() (where string, args []interface{}, joinUsers bool) {
+	where = " WHERE 1=1"
+	args = []interface{}{}
+
+	if f.UserID != "" {
+		where += " AND la.user_id = ?"
+		args = append(args, f.UserID)
+	}
+	if aktivitas := strings.TrimSpace(f.Aktivitas); aktivitas != "" {
+		// The full-text index matches words by prefix; shorter terms need a table scan
+		if terms := logFullTextTerms(aktivitas); terms != "" {
+			where += " AND MATCH(la.aktivitas) AGAINST (? IN BOOLEAN MODE)"
+			args = append(args, terms)
+		} else {
+			where += " AND la.aktivitas LIKE ?"
+			args = append(args, "%"+aktivitas+"%")
+		}
+	}
+	if f.Modul != "" {
+		where += " AND la.modul = ?"
+		args = append(args, f.Modul)
+	}
+	if f.ReferenceID != "" {
+		where += " AND la.reference_id = ?"
+		args = append(args, f.ReferenceID)
+	}
+	if f.Role != "" {
+		where += " AND COALESCE(u.role, 'system') = ?"
+		args = append(args, f.Role)
+		joinUsers = true
+	}
+	// Plain comparisons on created_at keep the index usable
+	if f.StartDate != "" {
+		where += " AND la.created_at >= ?"
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		where += " AND la.created_at < DATE_ADD(?, INTERVAL 1 DAY)"
+		args = append(args, f.EndDate)
+	}
+	return where, args, joinUsers
+}
+
+// logFullTextTerms turns a search into a boolean full-text query requiring every word
+// as a prefix. It returns "" when a word is shorter than the indexed minimum.
+func logFullTextTerms(search string) string {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if len([]rune(word)) < logFullTextMinLen {
+			return ""
+		}
+		terms = append(terms, "+"+word+"*")
+	}
+	return strings.Join(terms, " ")
+}
+
+// logFullTextMinLen is InnoDB's default innodb_ft_min_token_size
+const logFullTextMinLen = 3
+
+// logFailedCondition matches entries recording a failed action, e.g. "Login gagal (...)"
+const logFailedCondition = " AND la.aktivitas LIKE '%gagal%'"
+
+func (r *logRepo) List(f LogFilter, page LogPage) ([]LogRow, error) {
+	where, args, _ := f.where()
+	if page.After != nil {
+		where += " AND (la.created_at < ? OR (la.created_at = ? AND la.id < ?))"
+		args = append(args, page.After.CreatedAt, page.After.CreatedAt, page.After.ID)
+	}
+
+	query := `
+		SELECT 
+			la.id,
+			COALESCE(la.user_id, 0) as user_id,
+			COALESCE(u.username, 'System') as username,
+			COALESCE(u.role, 'system') as role,
+			COALESCE(la.aktivitas, '') as aktivitas,
+			COALESCE(la.modul, '') as modul,
+			la.reference_id,
+			CASE 
+				WHEN la.modul IS NOT NULL AND la.reference_id IS NOT NULL 
+					THEN CONCAT(la.modul, ' - Ref ID: ', la.reference_id)
+				WHEN la.modul IS NOT NULL 
+					THEN la.modul
+				ELSE la.aktivitas
+			END as detail,
+			COALESCE(la.ip_address, '') as ip_address,
+			COALESCE(la.user_agent, '') as user_agent,
+			la.created_at as waktu_aktivitas
+		FROM log_aktivitas la
+		LEFT JOIN users u ON la.user_id = u.id
+	` + where + " ORDER BY la.created_at DESC, la.id DESC"
+
+	switch {
+	case page.Limit > 0 && page.After != nil:
+		query += " LIMIT ?"
+		args = append(args, page.Limit)
+	case page.Limit > 0:
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, page.Limit, page.Offset)
+	}
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := make([]LogRow, 0)
+	for rows.Next() {
+		var entry LogRow
+		var referenceID sql.NullInt64
+		err := rows.Scan(
+			&entry.ID, &entry.UserID, &entry.Username, &entry.Role, &entry.Aktivitas, &entry.Modul,
+			&referenceID, &entry.Detail, &entry.IPAddress, &entry.UserAgent, &entry.WaktuAktivitas,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if referenceID.Valid {
+			id := int(referenceID.Int64)
+			entry.ReferenceID = &id
+		}
+		logs = append(logs, entry)
+	}
+	return logs, rows.Err()
+}
+
+func (r *logRepo) Count(f LogFilter) (int, error) {
+	where, args, joinUsers := f.where()
+	query := "SELECT COUNT(*) FROM log_aktivitas la"
+	if joinUsers {
+		query += " LEFT JOIN users u ON la.user_id = u.id"
+	}
+
+	var total int
+	err := r.db.QueryRow(query+where, args...).Scan(&total)
+	return total, err
+}
+
+func (r *logRepo) Statistics(f LogFilter) (LogStatistics, error) {
+	where, args, _ := f.where()
+	from := `
+		FROM log_aktivitas la
+		LEFT JOIN users u ON la.user_id = u.id
+	` + where
+
+	stats := LogStatistics{
+		Aktivitas: []LogCount{}, TopUsers: []LogUserCount{}, PerModul: []LogModulCount{}, GagalPerIP: []LogIPCount{},
+	}
+
+	err := r.each(`
+		SELECT la.aktivitas, COUNT(*) as jumlah
+	`+from+" GROUP BY la.aktivitas ORDER BY jumlah DESC LIMIT 50", args, func(rows *sql.Rows) error {
+		var c LogCount
+		if err := rows.Scan(&c.Aktivitas, &c.Jumlah); err != nil {
+			return err
+		}
+		stats.Aktivitas = append(stats.Aktivitas, c)
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	err = r.each(`
+		SELECT u.username, u.role, COUNT(*) as jumlah_aktivitas
+	`+from+" AND u.id IS NOT NULL GROUP BY u.id, u.username, u.role ORDER BY jumlah_aktivitas DESC LIMIT 10", args,
+		func(rows *sql.Rows) error {
+			var c LogUserCount
+			if err := rows.Scan(&c.Username, &c.Role, &c.Jumlah); err != nil {
+				return err
+			}
+			stats.TopUsers = append(stats.TopUsers, c)
+			return nil
+		})
+	if err != nil {
+		return stats, err
+	}
+
+	err = r.each(`
+		SELECT 
+			COALESCE(la.modul, '-') as modul,
+			COUNT(*) as jumlah,
+			SUM(la.aktivitas LIKE '%gagal%') as gagal,
+			COUNT(DISTINCT la.user_id) as jumlah_user
+	`+from+" GROUP BY la.modul ORDER BY jumlah DESC", args, func(rows *sql.Rows) error {
+		var c LogModulCount
+		if err := rows.Scan(&c.Modul, &c.Jumlah, &c.Gagal, &c.JumlahUser); err != nil {
+			return err
+		}
+		stats.PerModul = append(stats.PerModul, c)
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	err = r.each(`
+		SELECT WEEKDAY(la.created_at) as hari, HOUR(la.created_at) as jam, COUNT(*) as jumlah
+	`+from+" GROUP BY WEEKDAY(la.created_at), HOUR(la.created_at)", args, func(rows *sql.Rows) error {
+		var hari, jam, jumlah int
+		if err := rows.Scan(&hari, &jam, &jumlah); err != nil {
+			return err
+		}
+		if hari >= 0 && hari <= 6 && jam >= 0 && jam <= 23 {
+			stats.Heatmap[hari][jam] = jumlah
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	// Failed actions, with the addresses they came from
+	if err := r.db.QueryRow("SELECT COUNT(*)"+from+logFailedCondition, args...).Scan(&stats.Gagal); err != nil {
+		return stats, err
+	}
+	err = r.each(`
+		SELECT COALESCE(la.ip_address, '') as ip_address, COUNT(*) as jumlah, MAX(la.created_at) as terakhir
+	`+from+logFailedCondition+" GROUP BY la.ip_address ORDER BY jumlah DESC LIMIT 10", args, func(rows *sql.Rows) error {
+		var c LogIPCount
+		if err := rows.Scan(&c.IPAddress, &c.Jumlah, &c.Terakhir); err != nil {
+			return err
+		}
+		stats.GagalPerIP = append(stats.GagalPerIP, c)
+		return nil
+	})
+	return stats, err
+}
+
+// each runs query and calls fn for every row
+func (r *logRepo) each(query string, args []interface{}, fn func(rows *sql.Rows) error) error {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"database/sql"
+
+	"sawit-backend/models"
+)
+
+// PembayaranFilter narrows the payment list. BuyerID limits it to one buyer's orders.
+type PembayaranFilter struct {
+	POID      string
+	Status    string
+	StartDate string
+	EndDate   string
+	BuyerID   *int
+}
+
+// PembayaranRow is a payment with its invoice and buyer. Optional text columns
+// read as "", the other optional columns as nil.
+type PembayaranRow struct {
+	ID                int
+	DokumenID         int
+	POID              int
+	JumlahBayar       float64
+	MetodePembayaran  string
+	BankPengirim      string
+	NomorRekening     string
+	NamaPengirim      string
+	BuktiBayar        *string
+	TanggalJatuhTempo *string
+	TanggalBayar      string
+	Status            string // "pending" when not set
+	VerifiedBy        *int64
+	VerifiedAt        *string
+	Catatan           string
+	CreatedAt         string
+	UpdatedAt         string
+	NomorInvoice      *string
+	BuyerName         *string
+}
+
+// PembayaranRepository stores buyer payments against sales documents
+type PembayaranRepository interface {
+	// Create records a pending payment for the document's order
+	Create(req models.CreatePembayaranRequest, poID int) (int64, error)
+	Verify(id int, status, catatan string, verifiedBy int) error
+	// List returns the payments matching f, newest first
+	List(f PembayaranFilter) ([]PembayaranRow, error)
+}
+
+type pembayaranRepo struct{ db DBTX }
+
+func (r *pembayaranRepo) Create(req models.CreatePembayaranRequest, poID int) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO pembayaran (
+			dokumen_id, po_id, jumlah_bayar, metode_pembayaran,
+			bank_pengirim, nomor_rekening, nama_pengirim,
+			tanggal_pembayaran, tanggal_jatuh_tempo, status, catatan
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?)
+	`, req.DokumenID, poID, req.JumlahBayar, req.MetodePembayaran,
+		req.BankPengirim, req.NomorRekening, req.NamaPengirim,
+		req.TanggalPembayaran, nullString(req.TanggalJatuhTempo), req.Catatan)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *pembayaranRepo) Verify(id int, status, catatan string, verifiedBy int) error {
+	_, err := r.db.Exec(`
+		UPDATE pembayaran
+		SET status = ?, catatan = ?, verified_by = ?, verified_at = NOW()
+		WHERE id = ?
+	`, status, catatan, verifiedBy, id)
+	return err
+}
+
+func (r *pembayaranRepo) List(f PembayaranFilter) ([]PembayaranRow, error) {
+	query := `
+		SELECT p.id, p.dokumen_id, p.po_id, p.jumlah_bayar, p.metode_pembayaran,
+		       p.bank_pengirim, p.nomor_rekening, p.nama_pengirim, p.bukti_transfer,
+		       p.tanggal_jatuh_tempo, p.tanggal_pembayaran, p.status, p.verified_by,
+		       p.verified_at, p.catatan, p.created_at, p.updated_at,
+		       d.nomor_invoice, u.username
+		FROM pembayaran p
+		LEFT JOIN dokumen_penjualan d ON p.dokumen_id = d.id
+		LEFT JOIN purchase_orders po ON p.po_id = po.id
+		LEFT JOIN users u ON po.buyer_id = u.id
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if f.BuyerID != nil {
+		query += " AND po.buyer_id = ?"
+		args = append(args, *f.BuyerID)
+	}
+	if f.POID != "" {
+		query += " AND p.po_id = ?"
+		args = append(args, f.POID)
+	}
+	if f.Status != "" {
+		query += " AND p.status = ?"
+		args = append(args, f.Status)
+	}
+	if f.StartDate != "" {
+		query += " AND p.tanggal_pembayaran >= ?"
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		query += " AND p.tanggal_pembayaran <= ?"
+		args = append(args, f.EndDate)
+	}
+
+	query += " ORDER BY p.created_at DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pembayaranList := make([]PembayaranRow, 0)
+	for rows.Next() {
+		var p PembayaranRow
+		var bank, rekening, pengirim, catatan, status sql.NullString
+		var bukti, jatuhTempo, verifiedAt, nomorInvoice, buyerName sql.NullString
+		var verifiedBy sql.NullInt64
+		err := rows.Scan(
+			&p.ID, &p.DokumenID, &p.POID, &p.JumlahBayar, &p.MetodePembayaran,
+			&bank, &rekening, &pengirim, &bukti,
+			&jatuhTempo, &p.TanggalBayar, &status, &verifiedBy,
+			&verifiedAt, &catatan, &p.CreatedAt, &p.UpdatedAt,
+			&nomorInvoice, &buyerName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.BankPengirim, p.NomorRekening, p.NamaPengirim = bank.String, rekening.String, pengirim.String
+		p.Catatan = catatan.String
+		p.Status = "pending"
+		if status.Valid {
+			p.Status = status.String
+		}
+		p.BuktiBayar, p.TanggalJatuhTempo, p.VerifiedAt = optString(bukti), optString(jatuhTempo), optString(verifiedAt)
+		p.NomorInvoice, p.BuyerName = optString(nomorInvoice), optString(buyerName)
+		if verifiedBy.Valid {
+			p.VerifiedBy = &verifiedBy.Int64
+		}
+		pembayaranList = append(pembayaranList, p)
+	}
+	return pembayaranList, rows.Err()
+}
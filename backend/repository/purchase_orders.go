@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"time"
+
+	"sawit-backend/models"
+)
+
+// POFilter narrows the order list by status and creation date. BuyerID limits it
+// to one buyer's orders.
+type POFilter struct {
+	Status    string
+	StartDate string
+	EndDate   string
+	BuyerID   *int
+}
+
+// PORepository stores purchase orders and the stock batches they are allocated from
+type PORepository interface {
+	// Create inserts a pending order; lokasi_pengambilan is taken from the kebun
+	Create(po models.PurchaseOrder) (int64, error)
+	// FindByID returns an order with buyer, kebun and payment status
+	FindByID(id int) (models.PurchaseOrder, error)
+	// List returns the orders matching f, newest first
+	List(f POFilter) ([]models.PurchaseOrder, error)
+	// Lock locks an order for a status change
+	Lock(id int) (models.PurchaseOrder, error)
+	// NextSequence takes the next PO sequence number of day from its counter row.
+	// The row stays locked until the transaction ends.
+	NextSequence(day time.Time) (int, error)
+	UpdateStatus(id int, status, catatan string, approvedBy *int, approvedAt *time.Time) error
+	SetStatus(id int, status string) error
+	AddAllocation(poID int64, a models.POAllocation) error
+	Allocations(poID int) ([]models.POAllocation, error)
+}
+
+type poRepo struct{ db DBTX }
+
+func (r *poRepo) Create(po models.PurchaseOrder) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO purchase_orders (
+			po_number, buyer_id, stok_id, kebun_id, jumlah_kg, grade_diminta,
+			harga_per_kg, total_harga, tanggal_pengambilan, lokasi_pengambilan,
+			metode_pembayaran, status, catatan
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?,
+			COALESCE((SELECT nama_kebun FROM kebun WHERE id = ?), ''), ?, 'pending', ?)
+	`, po.PONumber, po.BuyerID, po.StokID, po.KebunID, po.JumlahKg, po.GradeDiminta,
+		po.HargaPerKg, po.TotalHarga, po.TanggalPengambilan,
+		po.KebunID, po.MetodePembayaran, po.Catatan)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// poSelect reads an order with its buyer, kebun and payment status
+const poSelect = `
+		SELECT po.id, po.po_number, po.buyer_id, po.stok_id, po.kebun_id,
+		       po.jumlah_kg, po.grade_diminta, po.harga_per_kg, po.total_harga,
+		       po.tanggal_pengambilan, po.lokasi_pengambilan, po.metode_pembayaran,
+		       po.status, po.catatan, po.approved_by, po.approved_at,
+		       po.created_at, po.updated_at, u.company_name, k.nama_kebun,
+		       COALESCE(pb.status, 'unpaid') as payment_status
+		FROM purchase_orders po
+		JOIN users u ON po.buyer_id = u.id
+		JOIN kebun k ON po.kebun_id = k.id
+		LEFT JOIN dokumen_penjualan dp ON po.id = dp.po_id
+		LEFT JOIN pembayaran pb ON dp.id = pb.dokumen_id
+`
+
+func scanPO(row rowScanner) (models.PurchaseOrder, error) {
+	var po models.PurchaseOrder
+	err := row.Scan(
+		&po.ID, &po.PONumber, &po.BuyerID, &po.StokID, &po.KebunID,
+		&po.JumlahKg, &po.GradeDiminta, &po.HargaPerKg, &po.TotalHarga,
+		&po.TanggalPengambilan, &po.LokasiPengambilan, &po.MetodePembayaran,
+		&po.Status, &po.Catatan, &po.ApprovedBy, &po.ApprovedAt,
+		&po.CreatedAt, &po.UpdatedAt, &po.BuyerCompany, &po.NamaKebun,
+		&po.PaymentStatus,
+	)
+	return po, err
+}
+
+func (r *poRepo) FindByID(id int) (models.PurchaseOrder, error) {
+	po, err := scanPO(r.db.QueryRow(poSelect+" WHERE po.id = ?", id))
+	return po, notFound(err)
+}
+
+func (r *poRepo) List(f POFilter) ([]models.PurchaseOrder, error) {
+	query := poSelect + " WHERE 1=1"
+	args := []interface{}{}
+
+	if f.BuyerID != nil {
+		query += " AND po.buyer_id = ?"
+		args = append(args, *f.BuyerID)
+	}
+	if f.Status != "" {
+		query += " AND po.status = ?"
+		args = append(args, f.Status)
+	}
+	if f.StartDate != "" {
+		query += " AND DATE(po.created_at) >= ?"
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		query += " AND DATE(po.created_at) <= ?"
+		args = append(args, f.EndDate)
+	}
+
+	query += " ORDER BY po.created_at DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	poList := make([]models.PurchaseOrder, 0)
+	for rows.Next() {
+		po, err := scanPO(rows)
+		if err != nil {
+			return nil, err
+		}
+		poList = append(poList, po)
+	}
+	return poList, rows.Err()
+}
+
+func (r *poRepo) Lock(id int) (models.PurchaseOrder, error) {
+	var po models.PurchaseOrder
+	err := r.db.QueryRow(`
+		SELECT id, buyer_id, stok_id, jumlah_kg, status
+		FROM purchase_orders WHERE id = ? FOR UPDATE
+	`, id).Scan(&po.ID, &po.BuyerID, &po.StokID, &po.JumlahKg, &po.Status)
+	return po, notFound(err)
+}
+
+func (r *poRepo) NextSequence(day time.Time) (int, error) {
+	// LAST_INSERT_ID(expr) hands the new seq back in the insert ID of this statement
+	result, err := r.db.Exec(`
+		INSERT INTO po_number_counters (tanggal, seq) VALUES (?, LAST_INSERT_ID(1))
+		ON DUPLICATE KEY UPDATE seq = LAST_INSERT_ID(seq + 1)
+	`, day.Format("2006-01-02"))
+	if err != nil {
+		return 0, err
+	}
+	seq, err := result.LastInsertId()
+	return int(seq), err
+}
+
+func (r *poRepo) UpdateStatus(id int, status, catatan string, approvedBy *int, approvedAt *time.Time) error {
+	if approvedBy != nil {
+		_, err := r.db.Exec(`
+			UPDATE purchase_orders 
+			SET status = ?, catatan = ?, approved_by = ?, approved_at = ?
+			WHERE id = ?
+		`, status, catatan, *approvedBy, approvedAt, id)
+		return err
+	}
+	_, err := r.db.Exec(`
+		UPDATE purchase_orders 
+		SET status = ?, catatan = ?
+		WHERE id = ?
+	`, status, catatan, id)
+	return err
+}
+
+func (r *poRepo) SetStatus(id int, status string) error {
+	_, err := r.db.Exec("UPDATE purchase_orders SET status = ? WHERE id = ?", status, id)
+	return err
+}
+
+func (r *poRepo) AddAllocation(poID int64, a models.POAllocation) error {
+	_, err := r.db.Exec(`
+		INSERT INTO po_allocations (po_id, stok_id, jumlah_kg, harga_per_kg) VALUES (?, ?, ?, ?)
+	`, poID, a.StokID, a.JumlahKg, a.HargaPerKg)
+	return err
+}
+
+func (r *poRepo) Allocations(poID int) ([]models.POAllocation, error) {
+	rows, err := r.db.Query(`
+		SELECT a.stok_id, DATE_FORMAT(s.tanggal_panen, '%Y-%m-%d'), a.jumlah_kg, a.harga_per_kg
+		FROM po_allocations a
+		JOIN stok_tbs s ON a.stok_id = s.id
+		WHERE a.po_id = ?
+		ORDER BY s.tanggal_panen, a.stok_id
+	`, poID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allocs := make([]models.POAllocation, 0)
+	for rows.Next() {
+		var a models.POAllocation
+		if err := rows.Scan(&a.StokID, &a.TanggalPanen, &a.JumlahKg, &a.HargaPerKg); err != nil {
+			return nil, err
+		}
+		allocs = append(allocs, a)
+	}
+	return allocs, rows.Err()
+}
@@ -0,0 +1,116 @@
+// Package repository holds the SQL for each aggregate behind an interface, so
+// handlers get their data access injected instead of reaching for config.DB.
+// Filtered lists take a filter struct per aggregate; a nil BuyerID in a filter
+// means the caller may read every buyer's records.
+package repository
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ErrNotFound is returned when the requested row does not exist
+var ErrNotFound = errors.New("not found")
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx, so every repository can run
+// inside or outside a transaction
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Store hands out the repositories of every aggregate. Repositories from the Store
+// passed to a WithTx callback share that transaction.
+type Store interface {
+	Users() UserRepository
+	Auth() AuthRepository
+	Stok() StokRepository
+	StokAdjustments() StokAdjustmentRepository
+	StokAgeing() StokAgeingRepository
+	PurchaseOrders() PORepository
+	Jadwal() JadwalRepository
+	Timbangan() TimbanganRepository
+	Dokumen() DokumenRepository
+	Pembayaran() PembayaranRepository
+	Logs() LogRepository
+
+	// WithTx runs fn in a transaction that commits when fn returns nil
+	WithTx(fn func(tx Store) error) error
+}
+
+type mysqlStore struct {
+	db   *sql.DB
+	conn DBTX
+}
+
+// NewStore returns the MySQL implementation of every repository
+func NewStore(db *sql.DB) Store {
+	return &mysqlStore{db: db, conn: db}
+}
+
+func (s *mysqlStore) Users() UserRepository                     { return &userRepo{s.conn} }
+func (s *mysqlStore) Auth() AuthRepository                      { return &authRepo{s.conn} }
+func (s *mysqlStore) Stok() StokRepository                      { return &stokRepo{s.conn} }
+func (s *mysqlStore) StokAdjustments() StokAdjustmentRepository { return &stokAdjustmentRepo{s.conn} }
+func (s *mysqlStore) StokAgeing() StokAgeingRepository          { return &stokAgeingRepo{s.conn} }
+func (s *mysqlStore) PurchaseOrders() PORepository              { return &poRepo{s.conn} }
+func (s *mysqlStore) Jadwal() JadwalRepository                  { return &jadwalRepo{s.conn} }
+func (s *mysqlStore) Timbangan() TimbanganRepository            { return &timbanganRepo{s.conn} }
+func (s *mysqlStore) Dokumen() DokumenRepository                { return &dokumenRepo{s.conn} }
+func (s *mysqlStore) Pembayaran() PembayaranRepository          { return &pembayaranRepo{s.conn} }
+func (s *mysqlStore) Logs() LogRepository                       { return &logRepo{s.conn} }
+
+func (s *mysqlStore) WithTx(fn func(tx Store) error) error {
+	if s.db == nil {
+		// Already inside a transaction; nested calls join it
+		return fn(s)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&mysqlStore{conn: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows, so one scan serves a lookup and a list
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// nullString stores an empty string as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// optString reads a nullable column as nil when it is NULL
+func optString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// nullInt stores a missing ID as NULL
+func nullInt(id *int) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+
+	"sawit-backend/domain"
+	"sawit-backend/models"
+)
+
+// StokBatch is a stok_tbs row as seen by order allocation
+type StokBatch struct {
+	ID           int
+	TanggalPanen string
+	Tersedia     float64
+	HargaPerKg   float64
+	KebunID      int
+	Grade        string
+	Status       string
+}
+
+// StokUpdate holds the batch fields an update may change; nil fields are kept
+type StokUpdate struct {
+	HargaPerKg *float64
+	Keterangan *string
+}
+
+// StokFilter narrows the stock list by status, origin and harvest date. An empty
+// Status lists batches in every status.
+type StokFilter struct {
+	Status    string
+	Grade     string
+	KebunID   string
+	BlokID    string
+	StartDate string
+	EndDate   string
+}
+
+// StokRepository reads, creates and updates stock batches. The Lock methods use
+// SELECT ... FOR UPDATE and are meant to run inside WithTx.
+type StokRepository interface {
+	FindByID(id int) (models.StokTBS, error)
+	// List returns the batches matching f, newest harvest first
+	List(f StokFilter) ([]models.StokTBS, error)
+	// Status returns the sale status of a batch
+	Status(id int) (string, error)
+	Create(req models.CreateStokRequest) (int64, error)
+	Update(id int, u StokUpdate) error
+	// KebunStatus returns the status of the kebun a new batch is harvested from
+	KebunStatus(kebunID int) (string, error)
+	// BlokOrigin returns the kebun a blok belongs to and the blok status
+	BlokOrigin(blokID int) (kebunID int, status string, err error)
+
+	// LockBatch locks one batch
+	LockBatch(id int) (StokBatch, error)
+	// LockOpenBatches locks the orderable batches of a kebun and grade, oldest harvest first
+	LockOpenBatches(kebunID int, grade string) ([]StokBatch, error)
+	// Lock locks the quantity and status the stock rules change
+	Lock(id int) (domain.Stok, error)
+	// Save writes back the quantity and status read by Lock
+	Save(id int, stok domain.Stok) error
+}
+
+type stokRepo struct{ db DBTX }
+
+// NewStokRepository works on db, for code that runs on its own transaction
+// instead of a Store, such as the bulk import
+func NewStokRepository(db DBTX) StokRepository {
+	return &stokRepo{db}
+}
+
+// stokSelect reads a batch with its kebun, blok and age in hours
+const stokSelect = `
+		SELECT s.id, s.kebun_id, s.blok_id, s.tanggal_panen, s.jumlah_kg, s.jumlah_tersedia,
+		       s.grade, s.kadar_minyak, s.harga_per_kg, s.keterangan, s.status,
+		       s.grade_awal, s.harga_awal, TIMESTAMPDIFF(HOUR, s.tanggal_panen, NOW()),
+		       s.created_at, s.updated_at, k.nama_kebun, k.lokasi, b.kode_blok
+		FROM stok_tbs s
+		JOIN kebun k ON s.kebun_id = k.id
+		LEFT JOIN blok b ON s.blok_id = b.id
+`
+
+func scanStok(row rowScanner) (models.StokTBS, error) {
+	var stok models.StokTBS
+	var kadarMinyak, hargaAwal sql.NullFloat64
+	var keterangan, kodeBlok, gradeAwal sql.NullString
+	var blokID sql.NullInt64
+	err := row.Scan(
+		&stok.ID, &stok.KebunID, &blokID, &stok.TanggalPanen, &stok.JumlahKg, &stok.JumlahTersedia,
+		&stok.Grade, &kadarMinyak, &stok.HargaPerKg, &keterangan, &stok.Status,
+		&gradeAwal, &hargaAwal, &stok.UmurJam,
+		&stok.CreatedAt, &stok.UpdatedAt, &stok.NamaKebun, &stok.LokasiKebun, &kodeBlok,
+	)
+	if err != nil {
+		return stok, err
+	}
+
+	if kadarMinyak.Valid {
+		stok.KadarMinyak = &kadarMinyak.Float64
+	}
+	if keterangan.Valid {
+		stok.Keterangan = &keterangan.String
+	}
+	if blokID.Valid {
+		blok := int(blokID.Int64)
+		stok.BlokID = &blok
+	}
+	if gradeAwal.Valid {
+		stok.GradeAwal = &gradeAwal.String
+		stok.HargaAwal = &hargaAwal.Float64
+	}
+	stok.KodeBlok = kodeBlok.String
+	return stok, nil
+}
+
+func (r *stokRepo) FindByID(id int) (models.StokTBS, error) {
+	stok, err := scanStok(r.db.QueryRow(stokSelect+" WHERE s.id = ?", id))
+	return stok, notFound(err)
+}
+
+func (r *stokRepo) List(f StokFilter) ([]models.StokTBS, error) {
+	query := stokSelect + " WHERE 1=1"
+	args := []interface{}{}
+
+	if f.Status != "" {
+		query += " AND s.status = ?"
+		args = append(args, f.Status)
+	}
+	if f.Grade != "" {
+		query += " AND s.grade = ?"
+		args = append(args, f.Grade)
+	}
+	if f.KebunID != "" {
+		query += " AND s.kebun_id = ?"
+		args = append(args, f.KebunID)
+	}
+	if f.BlokID != "" {
+		query += " AND s.blok_id = ?"
+		args = append(args, f.BlokID)
+	}
+	if f.StartDate != "" {
+		query += " AND s.tanggal_panen >= ?"
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		query += " AND s.tanggal_panen <= ?"
+		args = append(args, f.EndDate)
+	}
+
+	query += " ORDER BY s.tanggal_panen DESC, s.grade ASC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stokList := make([]models.StokTBS, 0)
+	for rows.Next() {
+		stok, err := scanStok(rows)
+		if err != nil {
+			return nil, err
+		}
+		stokList = append(stokList, stok)
+	}
+	return stokList, rows.Err()
+}
+
+func (r *stokRepo) Status(id int) (string, error) {
+	var status string
+	err := r.db.QueryRow("SELECT status FROM stok_tbs WHERE id = ?", id).Scan(&status)
+	return status, notFound(err)
+}
+
+func (r *stokRepo) Create(req models.CreateStokRequest) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO stok_tbs (kebun_id, blok_id, tanggal_panen, jumlah_kg, jumlah_tersedia,
+		                      grade, kadar_minyak, harga_per_kg, keterangan, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'available')
+	`, req.KebunID, req.BlokID, req.TanggalPanen, req.JumlahKg, req.JumlahKg, req.Grade,
+		req.KadarMinyak, req.HargaPerKg, req.Keterangan)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *stokRepo) Update(id int, u StokUpdate) error {
+	_, err := r.db.Exec(`
+		UPDATE stok_tbs
+		SET harga_per_kg = COALESCE(?, harga_per_kg), keterangan = COALESCE(?, keterangan)
+		WHERE id = ?
+	`, u.HargaPerKg, u.Keterangan, id)
+	return err
+}
+
+func (r *stokRepo) KebunStatus(kebunID int) (string, error) {
+	var status string
+	err := r.db.QueryRow("SELECT status FROM kebun WHERE id = ?", kebunID).Scan(&status)
+	return status, notFound(err)
+}
+
+func (r *stokRepo) BlokOrigin(blokID int) (kebunID int, status string, err error) {
+	err = r.db.QueryRow(`
+		SELECT a.kebun_id, b.status FROM blok b
+		JOIN afdeling a ON b.afdeling_id = a.id
+		WHERE b.id = ?
+	`, blokID).Scan(&kebunID, &status)
+	return kebunID, status, notFound(err)
+}
+
+func (r *stokRepo) LockBatch(id int) (StokBatch, error) {
+	var b StokBatch
+	err := r.db.QueryRow(`
+		SELECT id, DATE_FORMAT(tanggal_panen, '%Y-%m-%d'), jumlah_tersedia, harga_per_kg, kebun_id, grade, status
+		FROM stok_tbs WHERE id = ? FOR UPDATE
+	`, id).Scan(&b.ID, &b.TanggalPanen, &b.Tersedia, &b.HargaPerKg, &b.KebunID, &b.Grade, &b.Status)
+	return b, notFound(err)
+}
+
+func (r *stokRepo) LockOpenBatches(kebunID int, grade string) ([]StokBatch, error) {
+	args := []interface{}{kebunID, grade}
+	for _, status := range domain.OrderableStokStatuses {
+		args = append(args, status)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(domain.OrderableStokStatuses)), ", ")
+
+	rows, err := r.db.Query(`
+		SELECT id, DATE_FORMAT(tanggal_panen, '%Y-%m-%d'), jumlah_tersedia, harga_per_kg, kebun_id, grade, status
+		FROM stok_tbs
+		WHERE kebun_id = ? AND grade = ? AND status IN (`+placeholders+`) AND jumlah_tersedia > 0
+		ORDER BY tanggal_panen, id
+		FOR UPDATE
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := make([]StokBatch, 0)
+	for rows.Next() {
+		var b StokBatch
+		if err := rows.Scan(&b.ID, &b.TanggalPanen, &b.Tersedia, &b.HargaPerKg, &b.KebunID, &b.Grade, &b.Status); err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+func (r *stokRepo) Lock(id int) (domain.Stok, error) {
+	var stok domain.Stok
+	err := r.db.QueryRow(`
+		SELECT jumlah_kg, jumlah_tersedia, status FROM stok_tbs WHERE id = ? FOR UPDATE
+	`, id).Scan(&stok.JumlahKg, &stok.Tersedia, &stok.Status)
+	return stok, notFound(err)
+}
+
+func (r *stokRepo) Save(id int, stok domain.Stok) error {
+	_, err := r.db.Exec(`
+		UPDATE stok_tbs SET jumlah_kg = ?, jumlah_tersedia = ?, status = ? WHERE id = ?
+	`, stok.JumlahKg, stok.Tersedia, stok.Status, id)
+	return err
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"database/sql"
+
+	"sawit-backend/models"
+)
+
+// AdjustmentFilter narrows the stock adjustment list
+type AdjustmentFilter struct {
+	Status  string
+	StokID  string
+	KebunID string
+	Alasan  string
+}
+
+// PendingAdjustment is the part of an adjustment a review checks and applies
+type PendingAdjustment struct {
+	StokID      int
+	SelisihKg   float64
+	Status      string
+	RequestedBy int
+}
+
+// AdjustmentReview records the outcome of a review. Sebelum and Sesudah hold the
+// available kg around an approved change and stay nil on a rejection.
+type AdjustmentReview struct {
+	Status     string
+	ReviewedBy int
+	Catatan    string
+	Sebelum    *float64
+	Sesudah    *float64
+}
+
+// StokAdjustmentRepository stores requested quantity changes on stock batches.
+// Lock uses SELECT ... FOR UPDATE and is meant to run inside WithTx.
+type StokAdjustmentRepository interface {
+	Create(stokID, requestedBy int, req models.StokAdjustmentRequest) (int64, error)
+	// List returns the adjustments matching f with their batch, newest first
+	List(f AdjustmentFilter) ([]models.StokAdjustment, error)
+	Lock(id int) (PendingAdjustment, error)
+	Review(id int, r AdjustmentReview) error
+}
+
+type stokAdjustmentRepo struct{ db DBTX }
+
+// adjustmentSelect lists adjustments with the batch they belong to
+const adjustmentSelect = `
+	SELECT a.id, a.stok_id, a.alasan, a.selisih_kg, a.jumlah_sebelum, a.jumlah_sesudah, a.catatan,
+	       a.status, a.requested_by, a.reviewed_by, a.reviewed_at, a.catatan_review, a.created_at,
+	       s.kebun_id, k.nama_kebun, s.grade, DATE_FORMAT(s.tanggal_panen, '%Y-%m-%d'), u.username
+	FROM stok_adjustments a
+	JOIN stok_tbs s ON a.stok_id = s.id
+	JOIN kebun k ON s.kebun_id = k.id
+	JOIN users u ON a.requested_by = u.id
+`
+
+func scanAdjustment(row rowScanner) (models.StokAdjustment, error) {
+	var a models.StokAdjustment
+	var sebelum, sesudah sql.NullFloat64
+	var reviewedBy sql.NullInt64
+	var reviewedAt sql.NullTime
+	var catatanReview sql.NullString
+	err := row.Scan(&a.ID, &a.StokID, &a.Alasan, &a.SelisihKg, &sebelum, &sesudah, &a.Catatan,
+		&a.Status, &a.RequestedBy, &reviewedBy, &reviewedAt, &catatanReview, &a.CreatedAt,
+		&a.KebunID, &a.NamaKebun, &a.Grade, &a.TanggalPanen, &a.RequestedName)
+	if err != nil {
+		return a, err
+	}
+
+	if sebelum.Valid {
+		a.JumlahSebelum = &sebelum.Float64
+	}
+	if sesudah.Valid {
+		a.JumlahSesudah = &sesudah.Float64
+	}
+	if reviewedBy.Valid {
+		id := int(reviewedBy.Int64)
+		a.ReviewedBy = &id
+	}
+	if reviewedAt.Valid {
+		a.ReviewedAt = &reviewedAt.Time
+	}
+	a.CatatanReview = optString(catatanReview)
+	return a, nil
+}
+
+func (r *stokAdjustmentRepo) Create(stokID, requestedBy int, req models.StokAdjustmentRequest) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO stok_adjustments (stok_id, alasan, selisih_kg, catatan, status, requested_by)
+		VALUES (?, ?, ?, ?, 'pending', ?)
+	`, stokID, req.Alasan, req.SelisihKg, req.Catatan, requestedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *stokAdjustmentRepo) List(f AdjustmentFilter) ([]models.StokAdjustment, error) {
+	query := adjustmentSelect + " WHERE 1=1"
+	args := []interface{}{}
+
+	if f.Status != "" {
+		query += " AND a.status = ?"
+		args = append(args, f.Status)
+	}
+	if f.StokID != "" {
+		query += " AND a.stok_id = ?"
+		args = append(args, f.StokID)
+	}
+	if f.KebunID != "" {
+		query += " AND s.kebun_id = ?"
+		args = append(args, f.KebunID)
+	}
+	if f.Alasan != "" {
+		query += " AND a.alasan = ?"
+		args = append(args, f.Alasan)
+	}
+
+	query += " ORDER BY a.created_at DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adjustments := make([]models.StokAdjustment, 0)
+	for rows.Next() {
+		a, err := scanAdjustment(rows)
+		if err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, a)
+	}
+	return adjustments, rows.Err()
+}
+
+func (r *stokAdjustmentRepo) Lock(id int) (PendingAdjustment, error) {
+	var a PendingAdjustment
+	err := r.db.QueryRow(`
+		SELECT stok_id, selisih_kg, status, requested_by FROM stok_adjustments WHERE id = ? FOR UPDATE
+	`, id).Scan(&a.StokID, &a.SelisihKg, &a.Status, &a.RequestedBy)
+	return a, notFound(err)
+}
+
+func (r *stokAdjustmentRepo) Review(id int, rv AdjustmentReview) error {
+	_, err := r.db.Exec(`
+		UPDATE stok_adjustments
+		SET status = ?, reviewed_by = ?, reviewed_at = NOW(), catatan_review = NULLIF(?, ''),
+		    jumlah_sebelum = ?, jumlah_sesudah = ?
+		WHERE id = ?
+	`, rv.Status, rv.ReviewedBy, rv.Catatan, rv.Sebelum, rv.Sesudah, id)
+	return err
+}
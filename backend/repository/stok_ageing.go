@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"database/sql"
+
+	"sawit-backend/models"
+)
+
+// AgeingBatch is the part of a batch the ageing rules read and change. GradeAwal
+// and HargaAwal are the grade and price before the first rule was applied.
+type AgeingBatch struct {
+	Grade      string
+	GradeAwal  string
+	HargaPerKg float64
+	HargaAwal  float64
+	Status     string
+	UmurJam    int
+}
+
+// AgeingStep records one rule applied to a batch
+type AgeingStep struct {
+	StokID        int
+	RuleID        int
+	Aksi          string
+	UmurJam       int
+	GradeSebelum  string
+	GradeSesudah  string
+	HargaSebelum  float64
+	HargaSesudah  float64
+	StatusSebelum string
+	StatusSesudah string
+}
+
+// StokAgeingRepository stores the ageing rules, what they did to each batch and the
+// daily restan snapshot. LockBatch uses SELECT ... FOR UPDATE and is meant to run
+// inside WithTx.
+type StokAgeingRepository interface {
+	// Rules returns every rule, active ones first
+	Rules() ([]models.StokAgeingRule, error)
+	// ActiveRules returns the active rules in the order they are applied
+	ActiveRules() ([]models.StokAgeingRule, error)
+	CreateRule(req models.StokAgeingRuleRequest) (int64, error)
+	UpdateRule(id int, req models.StokAgeingRuleRequest) error
+
+	// DueBatches returns the unsold batches at least umurJam hours old, oldest first
+	DueBatches(umurJam int) ([]int, error)
+	LockBatch(id int) (AgeingBatch, error)
+	// AppliedRules returns the IDs of the rules already applied to a batch
+	AppliedRules(stokID int) (map[int]bool, error)
+	RecordStep(s AgeingStep) error
+	// SaveBatch writes the aged grade, price and status, keeping the first
+	// GradeAwal and HargaAwal ever saved
+	SaveBatch(id int, b AgeingBatch) error
+	// History returns the rules applied to a batch in order
+	History(stokID int) ([]models.StokAgeingLog, error)
+
+	// SnapshotRestan stores today's unsold restan and expired stock per kebun
+	SnapshotRestan() error
+	// Restan returns the daily snapshots between two dates; kebunID is optional
+	Restan(startDate, endDate, kebunID string) ([]models.RestanHarian, error)
+}
+
+type stokAgeingRepo struct{ db DBTX }
+
+const ageingRuleSelect = `
+	SELECT id, nama, grade, umur_jam, aksi, diskon_persen, status, created_at
+	FROM stok_ageing_rules
+`
+
+func scanAgeingRule(row rowScanner) (models.StokAgeingRule, error) {
+	var rule models.StokAgeingRule
+	var grade sql.NullString
+	var diskon sql.NullFloat64
+	err := row.Scan(&rule.ID, &rule.Nama, &grade, &rule.UmurJam, &rule.Aksi, &diskon,
+		&rule.Status, &rule.CreatedAt)
+	if err != nil {
+		return rule, err
+	}
+
+	rule.Grade = optString(grade)
+	if diskon.Valid {
+		rule.DiskonPersen = &diskon.Float64
+	}
+	return rule, nil
+}
+
+func (r *stokAgeingRepo) rules(query string) ([]models.StokAgeingRule, error) {
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]models.StokAgeingRule, 0)
+	for rows.Next() {
+		rule, err := scanAgeingRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *stokAgeingRepo) Rules() ([]models.StokAgeingRule, error) {
+	return r.rules(ageingRuleSelect + " ORDER BY status, umur_jam, id")
+}
+
+func (r *stokAgeingRepo) ActiveRules() ([]models.StokAgeingRule, error) {
+	return r.rules(ageingRuleSelect + " WHERE status = 'active' ORDER BY umur_jam, id")
+}
+
+func (r *stokAgeingRepo) CreateRule(req models.StokAgeingRuleRequest) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO stok_ageing_rules (nama, grade, umur_jam, aksi, diskon_persen, status)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, req.Nama, req.Grade, req.UmurJam, req.Aksi, req.DiskonPersen, req.Status)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *stokAgeingRepo) UpdateRule(id int, req models.StokAgeingRuleRequest) error {
+	result, err := r.db.Exec(`
+		UPDATE stok_ageing_rules SET nama = ?, grade = ?, umur_jam = ?, aksi = ?, diskon_persen = ?, status = ?
+		WHERE id = ?
+	`, req.Nama, req.Grade, req.UmurJam, req.Aksi, req.DiskonPersen, req.Status, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return nil
+	}
+
+	// An update that changes nothing affects no rows either
+	var exists int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM stok_ageing_rules WHERE id = ?", id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *stokAgeingRepo) DueBatches(umurJam int) ([]int, error) {
+	rows, err := r.db.Query(`
+		SELECT id FROM stok_tbs
+		WHERE status IN ('available', 'reserved', 'restan') AND jumlah_tersedia > 0
+		  AND tanggal_panen <= NOW() - INTERVAL ? HOUR
+		ORDER BY tanggal_panen
+	`, umurJam)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *stokAgeingRepo) LockBatch(id int) (AgeingBatch, error) {
+	var b AgeingBatch
+	err := r.db.QueryRow(`
+		SELECT grade, COALESCE(grade_awal, grade), harga_per_kg, COALESCE(harga_awal, harga_per_kg), status,
+		       TIMESTAMPDIFF(HOUR, tanggal_panen, NOW())
+		FROM stok_tbs WHERE id = ? FOR UPDATE
+	`, id).Scan(&b.Grade, &b.GradeAwal, &b.HargaPerKg, &b.HargaAwal, &b.Status, &b.UmurJam)
+	return b, notFound(err)
+}
+
+func (r *stokAgeingRepo) AppliedRules(stokID int) (map[int]bool, error) {
+	rows, err := r.db.Query("SELECT rule_id FROM stok_ageing_log WHERE stok_id = ?", stokID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var ruleID int
+		if err := rows.Scan(&ruleID); err != nil {
+			return nil, err
+		}
+		applied[ruleID] = true
+	}
+	return applied, rows.Err()
+}
+
+func (r *stokAgeingRepo) RecordStep(s AgeingStep) error {
+	_, err := r.db.Exec(`
+		INSERT INTO stok_ageing_log (stok_id, rule_id, aksi, umur_jam, grade_sebelum, grade_sesudah,
+		                             harga_sebelum, harga_sesudah, status_sebelum, status_sesudah)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.StokID, s.RuleID, s.Aksi, s.UmurJam, s.GradeSebelum, s.GradeSesudah,
+		s.HargaSebelum, s.HargaSesudah, s.StatusSebelum, s.StatusSesudah)
+	return err
+}
+
+func (r *stokAgeingRepo) SaveBatch(id int, b AgeingBatch) error {
+	_, err := r.db.Exec(`
+		UPDATE stok_tbs
+		SET grade = ?, harga_per_kg = ?, status = ?,
+		    grade_awal = COALESCE(grade_awal, ?), harga_awal = COALESCE(harga_awal, ?), aged_at = NOW()
+		WHERE id = ?
+	`, b.Grade, b.HargaPerKg, b.Status, b.GradeAwal, b.HargaAwal, id)
+	return err
+}
+
+func (r *stokAgeingRepo) History(stokID int) ([]models.StokAgeingLog, error) {
+	rows, err := r.db.Query(`
+		SELECT l.id, l.stok_id, l.rule_id, r.nama, l.aksi, l.umur_jam, l.grade_sebelum, l.grade_sesudah,
+		       l.harga_sebelum, l.harga_sesudah, l.status_sebelum, l.status_sesudah, l.created_at
+		FROM stok_ageing_log l
+		JOIN stok_ageing_rules r ON l.rule_id = r.id
+		WHERE l.stok_id = ?
+		ORDER BY l.id
+	`, stokID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]models.StokAgeingLog, 0)
+	for rows.Next() {
+		var l models.StokAgeingLog
+		err := rows.Scan(&l.ID, &l.StokID, &l.RuleID, &l.NamaRule, &l.Aksi, &l.UmurJam, &l.GradeSebelum,
+			&l.GradeSesudah, &l.HargaSebelum, &l.HargaSesudah, &l.StatusSebelum, &l.StatusSesudah, &l.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, l)
+	}
+	return history, rows.Err()
+}
+
+func (r *stokAgeingRepo) SnapshotRestan() error {
+	_, err := r.db.Exec(`
+		INSERT INTO restan_harian (tanggal, kebun_id, batch_restan, restan_kg, nilai_restan,
+		                           batch_expired, expired_kg, panen_tertua)
+		SELECT CURDATE(), k.id,
+		       COUNT(CASE WHEN s.status = 'restan' THEN 1 END),
+		       COALESCE(SUM(CASE WHEN s.status = 'restan' THEN s.jumlah_tersedia END), 0),
+		       COALESCE(SUM(CASE WHEN s.status = 'restan' THEN s.jumlah_tersedia * s.harga_per_kg END), 0),
+		       COUNT(CASE WHEN s.status = 'expired' THEN 1 END),
+		       COALESCE(SUM(CASE WHEN s.status = 'expired' THEN s.jumlah_tersedia END), 0),
+		       MIN(CASE WHEN s.status = 'restan' THEN s.tanggal_panen END)
+		FROM kebun k
+		LEFT JOIN stok_tbs s ON s.kebun_id = k.id AND s.status IN ('restan', 'expired') AND s.jumlah_tersedia > 0
+		WHERE k.status = 'active'
+		GROUP BY k.id
+		ON DUPLICATE KEY UPDATE
+			batch_restan = VALUES(batch_restan), restan_kg = VALUES(restan_kg),
+			nilai_restan = VALUES(nilai_restan), batch_expired = VALUES(batch_expired),
+			expired_kg = VALUES(expired_kg), panen_tertua = VALUES(panen_tertua)
+	`)
+	return err
+}
+
+func (r *stokAgeingRepo) Restan(startDate, endDate, kebunID string) ([]models.RestanHarian, error) {
+	query := `
+		SELECT DATE_FORMAT(r.tanggal, '%Y-%m-%d'), r.kebun_id, k.nama_kebun, r.batch_restan, r.restan_kg,
+		       r.nilai_restan, r.batch_expired, r.expired_kg, DATE_FORMAT(r.panen_tertua, '%Y-%m-%d')
+		FROM restan_harian r
+		JOIN kebun k ON r.kebun_id = k.id
+		WHERE r.tanggal BETWEEN ? AND ?
+	`
+	args := []interface{}{startDate, endDate}
+	if kebunID != "" {
+		query += " AND r.kebun_id = ?"
+		args = append(args, kebunID)
+	}
+	query += " ORDER BY r.tanggal, k.nama_kebun"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]models.RestanHarian, 0)
+	for rows.Next() {
+		var h models.RestanHarian
+		var tertua sql.NullString
+		err := rows.Scan(&h.Tanggal, &h.KebunID, &h.NamaKebun, &h.BatchRestan, &h.RestanKg,
+			&h.NilaiRestan, &h.BatchExpired, &h.ExpiredKg, &tertua)
+		if err != nil {
+			return nil, err
+		}
+		h.PanenTertua = optString(tertua)
+		result = append(result, h)
+	}
+	return result, rows.Err()
+}
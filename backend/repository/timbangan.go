@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"time"
+
+	"sawit-backend/models"
+)
+
+// TimbanganFilter narrows the weighing list. Dates match the weigh-in, or the
+// creation of records not weighed in yet. BuyerID limits it to one buyer's orders.
+type TimbanganFilter struct {
+	POID      string
+	Status    string
+	Grade     string
+	StartDate string
+	EndDate   string
+	BuyerID   *int
+}
+
+// TimbanganRepository stores weighbridge records
+type TimbanganRepository interface {
+	// Create opens the weighing record for a scheduled truck
+	Create(poID int, jadwalID int64, platNomor string) (int64, error)
+	FindByID(id int) (models.Timbangan, error)
+	// List returns the records matching f, newest first
+	List(f TimbanganFilter) ([]models.Timbangan, error)
+	RecordWeighIn(id int, beratMasuk float64, at time.Time, petugas int, input string) error
+	// CorrectWeighIn overrides the weigh-in weight and keeps the first arrival time
+	CorrectWeighIn(id int, beratMasuk float64, at time.Time, petugas int, input string) error
+	RecordWeighOut(id int, req models.WeighOutRequest, beratBersih float64, at time.Time, petugas int) error
+}
+
+type timbanganRepo struct{ db DBTX }
+
+func (r *timbanganRepo) Create(poID int, jadwalID int64, platNomor string) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO timbangan (po_id, jadwal_id, plat_nomor, status)
+		VALUES (?, ?, ?, 'weigh_in')
+	`, poID, jadwalID, platNomor)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const timbanganSelect = `
+		SELECT id, po_id, jadwal_id, plat_nomor, berat_masuk, waktu_masuk, petugas_masuk,
+		       berat_keluar, waktu_keluar, petugas_keluar, berat_bersih, grade_aktual,
+		       kadar_air, kadar_sampah, tingkat_kematangan, status, catatan, created_at, updated_at
+		FROM timbangan
+`
+
+func scanTimbangan(row rowScanner) (models.Timbangan, error) {
+	var t models.Timbangan
+	err := row.Scan(
+		&t.ID, &t.POID, &t.JadwalID, &t.PlatNomor, &t.BeratMasuk, &t.WaktuMasuk, &t.PetugasMasuk,
+		&t.BeratKeluar, &t.WaktuKeluar, &t.PetugasKeluar, &t.BeratBersih, &t.GradeAktual,
+		&t.KadarAir, &t.KadarSampah, &t.TingkatKematangan, &t.Status, &t.Catatan, &t.CreatedAt, &t.UpdatedAt,
+	)
+	return t, err
+}
+
+func (r *timbanganRepo) FindByID(id int) (models.Timbangan, error) {
+	t, err := scanTimbangan(r.db.QueryRow(timbanganSelect+" WHERE id = ?", id))
+	return t, notFound(err)
+}
+
+func (r *timbanganRepo) List(f TimbanganFilter) ([]models.Timbangan, error) {
+	query := timbanganSelect + " WHERE 1=1"
+	args := []interface{}{}
+
+	if f.BuyerID != nil {
+		query += " AND po_id IN (SELECT id FROM purchase_orders WHERE buyer_id = ?)"
+		args = append(args, *f.BuyerID)
+	}
+	if f.POID != "" {
+		query += " AND po_id = ?"
+		args = append(args, f.POID)
+	}
+	if f.Status != "" {
+		query += " AND status = ?"
+		args = append(args, f.Status)
+	}
+	if f.Grade != "" {
+		query += " AND grade_aktual = ?"
+		args = append(args, f.Grade)
+	}
+	if f.StartDate != "" {
+		query += " AND DATE(COALESCE(waktu_masuk, created_at)) >= ?"
+		args = append(args, f.StartDate)
+	}
+	if f.EndDate != "" {
+		query += " AND DATE(COALESCE(waktu_masuk, created_at)) <= ?"
+		args = append(args, f.EndDate)
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	timbangList := make([]models.Timbangan, 0)
+	for rows.Next() {
+		t, err := scanTimbangan(rows)
+		if err != nil {
+			return nil, err
+		}
+		timbangList = append(timbangList, t)
+	}
+	return timbangList, rows.Err()
+}
+
+func (r *timbanganRepo) RecordWeighIn(id int, beratMasuk float64, at time.Time, petugas int, input string) error {
+	_, err := r.db.Exec(`
+		UPDATE timbangan
+		SET berat_masuk = ?, waktu_masuk = ?, petugas_masuk = ?, input_masuk = ?, status = 'loading'
+		WHERE id = ?
+	`, beratMasuk, at, petugas, input, id)
+	return err
+}
+
+func (r *timbanganRepo) CorrectWeighIn(id int, beratMasuk float64, at time.Time, petugas int, input string) error {
+	_, err := r.db.Exec(`
+		UPDATE timbangan
+		SET berat_masuk = ?, waktu_masuk = COALESCE(waktu_masuk, ?), petugas_masuk = ?, input_masuk = ?,
+		    jumlah_override = jumlah_override + 1
+		WHERE id = ?
+	`, beratMasuk, at, petugas, input, id)
+	return err
+}
+
+func (r *timbanganRepo) RecordWeighOut(id int, req models.WeighOutRequest, beratBersih float64, at time.Time, petugas int) error {
+	_, err := r.db.Exec(`
+		UPDATE timbangan
+		SET berat_keluar = ?, waktu_keluar = ?, petugas_keluar = ?,
+		    berat_bersih = ?, grade_aktual = ?, kadar_air = ?, kadar_sampah = ?,
+		    tingkat_kematangan = ?, catatan = ?, input_keluar = ?, status = 'completed'
+		WHERE id = ?
+	`, req.BeratKeluar, at, petugas, beratBersih, req.GradeAktual,
+		req.KadarAir, req.KadarSampah, req.TingkatKematangan, req.Catatan, req.Input, id)
+	return err
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"sawit-backend/models"
+)
+
+// NewUser is an account to insert. PasswordHash is already bcrypt-hashed.
+type NewUser struct {
+	Username     string
+	Email        string
+	PasswordHash string
+	Role         string
+	CompanyName  string
+	Address      string
+	NIB          string
+	Phone        string
+	// Verified marks the email as verified, for accounts created by an operator
+	Verified bool
+}
+
+// LoginUser is an account with the state login checks besides the password
+type LoginUser struct {
+	models.User
+	LockedUntil *time.Time
+	TOTPEnabled bool
+}
+
+// UserRepository reads, creates and updates user accounts
+type UserRepository interface {
+	FindByID(id int) (models.User, error)
+	FindByEmail(email string) (models.User, error)
+	// FindForLogin looks an account up by email with its password hash
+	FindForLogin(email string) (LoginUser, error)
+	// Exists reports whether the email or the username is taken
+	Exists(email, username string) (bool, error)
+	Create(u NewUser) (int64, error)
+	UpdateProfile(id int, companyName, address, phone string) error
+	// SetPassword stores a new bcrypt hash. Only the owner of the email can set a
+	// password this way, so it also verifies the email.
+	SetPassword(id int, passwordHash string) error
+	VerifyEmail(id int) error
+}
+
+type userRepo struct{ db DBTX }
+
+// NewUserRepository works on db, for code that runs on its own transaction
+// instead of a Store, such as the bulk import
+func NewUserRepository(db DBTX) UserRepository {
+	return &userRepo{db}
+}
+
+const userSelect = `
+	SELECT id, username, email, role, company_name, address, nib, phone, status,
+	       email_verified_at, created_at, updated_at
+	FROM users`
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	var companyName, address, nib, phone sql.NullString
+	var emailVerifiedAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Username, &user.Email, &user.Role, &companyName,
+		&address, &nib, &phone, &user.Status, &emailVerifiedAt, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return user, notFound(err)
+	}
+
+	user.CompanyName = optString(companyName)
+	user.Address = optString(address)
+	user.NIB = optString(nib)
+	user.Phone = optString(phone)
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	return user, nil
+}
+
+func (r *userRepo) FindByID(id int) (models.User, error) {
+	return scanUser(r.db.QueryRow(userSelect+" WHERE id = ?", id))
+}
+
+func (r *userRepo) FindByEmail(email string) (models.User, error) {
+	return scanUser(r.db.QueryRow(userSelect+" WHERE email = ?", email))
+}
+
+func (r *userRepo) FindForLogin(email string) (LoginUser, error) {
+	var user LoginUser
+	var companyName, address, nib, phone sql.NullString
+	var emailVerifiedAt, lockedUntil sql.NullTime
+	err := r.db.QueryRow(`
+		SELECT id, username, email, password, role, company_name, address, nib, phone, status,
+		       email_verified_at, locked_until, totp_enabled
+		FROM users WHERE email = ?
+	`, email).Scan(
+		&user.ID, &user.Username, &user.Email, &user.Password, &user.Role,
+		&companyName, &address, &nib, &phone, &user.Status, &emailVerifiedAt, &lockedUntil, &user.TOTPEnabled,
+	)
+	if err != nil {
+		return user, notFound(err)
+	}
+
+	if companyName.Valid {
+		user.CompanyName = &companyName.String
+	}
+	if address.Valid {
+		user.Address = &address.String
+	}
+	if nib.Valid {
+		user.NIB = &nib.String
+	}
+	if phone.Valid {
+		user.Phone = &phone.String
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if lockedUntil.Valid {
+		user.LockedUntil = &lockedUntil.Time
+	}
+	return user, nil
+}
+
+func (r *userRepo) Exists(email, username string) (bool, error) {
+	var exists int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? OR username = ?", email, username).Scan(&exists)
+	return exists > 0, err
+}
+
+func (r *userRepo) Create(u NewUser) (int64, error) {
+	result, err := r.db.Exec(`
+		INSERT INTO users (username, email, password, role, company_name, address, nib, phone, status, email_verified_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'active', IF(?, NOW(), NULL))
+	`, u.Username, u.Email, u.PasswordHash, u.Role, u.CompanyName, u.Address, u.NIB, u.Phone, u.Verified)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *userRepo) UpdateProfile(id int, companyName, address, phone string) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET company_name = ?, address = ?, phone = ?
+		WHERE id = ?
+	`, companyName, address, phone, id)
+	return err
+}
+
+func (r *userRepo) SetPassword(id int, passwordHash string) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET password = ?, email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE id = ?
+	`, passwordHash, id)
+	return err
+}
+
+func (r *userRepo) VerifyEmail(id int) error {
+	_, err := r.db.Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = ?
+	`, id)
+	return err
+}
@@ -4,98 +4,292 @@ import (
 	"fmt"
 	"sawit-backend/controllers"
 	"sawit-backend/middleware"
+	"sawit-backend/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SetupRoutes configures all application routes
-func SetupRoutes(router *gin.Engine) {
+// SetupRoutes configures all application routes. Handlers of stock with its
+// adjustments and ageing, the order-to-payment flow, accounts (login, 2FA, password
+// and email tokens) and the activity log read and write through store; kebun,
+// kendaraan, panen, payroll, admin and the import still use config.DB.
+func SetupRoutes(router *gin.Engine, store repository.Store) {
+	users := controllers.NewUserHandler(store)
+	stock := controllers.NewStokHandler(store)
+	orders := controllers.NewPOHandler(store)
+	weighing := controllers.NewTimbangHandler(store)
+	payments := controllers.NewPembayaranHandler(store)
+	activity := controllers.NewLogHandler(store)
+
 	// Public routes
 	api := router.Group("/api")
 	{
 		// Auth routes
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", controllers.Register)
-			auth.POST("/login", controllers.Login)
+			auth.POST("/register", users.Register)
+			auth.POST("/login", users.Login)
+			auth.POST("/forgot-password", users.ForgotPassword)
+			auth.POST("/reset-password", users.ResetPassword)
+			auth.POST("/verify-email", users.VerifyEmail)
+			auth.POST("/resend-verification", users.ResendVerification)
 		}
 	}
 
+	// Two-factor authentication
+	twoFA := api.Group("/auth/2fa")
+	{
+		twoFA.POST("/verify", users.VerifyMFALogin)
+
+		// Also reachable with the enrollment token issued during login
+		twoFA.POST("/setup", middleware.EnrollmentAuthMiddleware(), users.SetupMFA)
+		twoFA.POST("/enable", middleware.EnrollmentAuthMiddleware(), users.EnableMFA)
+
+		twoFA.GET("/status", middleware.AuthMiddleware(), users.GetMFAStatus)
+		twoFA.POST("/disable", middleware.AuthMiddleware(), users.DisableMFA)
+		twoFA.POST("/recovery-codes", middleware.AuthMiddleware(), users.RegenerateRecoveryCodes)
+	}
+
 	// Protected routes (require authentication)
 	protected := api.Group("")
 	protected.Use(middleware.AuthMiddleware())
 	{
 		// Profile
-		protected.GET("/profile", controllers.GetProfile)
-		protected.PUT("/profile", controllers.UpdateProfile)
+		protected.GET("/profile", users.GetProfile)
+		protected.PUT("/profile", users.UpdateProfile)
+
+		// Kebun
+		kebun := protected.Group("/kebun")
+		{
+			kebun.GET("", middleware.PermissionMiddleware(middleware.PermKebunRead), controllers.GetKebunList)
+			kebun.GET("/:id", middleware.PermissionMiddleware(middleware.PermKebunRead), controllers.GetKebunDetail)
+			kebun.POST("", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.CreateKebun)
+			kebun.PUT("/:id", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.UpdateKebun)
+			kebun.DELETE("/:id", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.DeleteKebun)
+			kebun.PUT("/:id/boundary", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.UpdateKebunBoundary)
+			kebun.DELETE("/:id/boundary", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.DeleteKebunBoundary)
+			kebun.GET("/:id/afdeling", middleware.PermissionMiddleware(middleware.PermKebunRead), controllers.GetAfdelingList)
+			kebun.POST("/:id/afdeling", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.CreateAfdeling)
+		}
+
+		// Afdeling
+		afdeling := protected.Group("/afdeling")
+		{
+			afdeling.PUT("/:id", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.UpdateAfdeling)
+			afdeling.DELETE("/:id", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.DeleteAfdeling)
+			afdeling.GET("/:id/blok", middleware.PermissionMiddleware(middleware.PermKebunRead), controllers.GetBlokList)
+			afdeling.POST("/:id/blok", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.CreateBlok)
+		}
+
+		// Blok
+		blok := protected.Group("/blok")
+		{
+			blok.GET("", middleware.PermissionMiddleware(middleware.PermKebunRead), controllers.GetBlokList)
+			blok.GET("/:id", middleware.PermissionMiddleware(middleware.PermKebunRead), controllers.GetBlokDetail)
+			blok.PUT("/:id", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.UpdateBlok)
+			blok.DELETE("/:id", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.DeleteBlok)
+			blok.PUT("/:id/boundary", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.UpdateBlokBoundary)
+			blok.DELETE("/:id/boundary", middleware.PermissionMiddleware(middleware.PermKebunManage), controllers.DeleteBlokBoundary)
+		}
 
-		// Kebun (all authenticated users)
-		protected.GET("/kebun", controllers.GetKebunList)
+		// Peta (GeoJSON)
+		peta := protected.Group("/map")
+		{
+			peta.GET("/features", middleware.PermissionMiddleware(middleware.PermKebunRead), controllers.GetMapFeatures)
+			peta.GET("/locate", middleware.PermissionMiddleware(middleware.PermKebunRead), controllers.LocatePoint)
+		}
 
 		// Stok TBS
 		stok := protected.Group("/stok")
 		{
-			stok.GET("", controllers.GetStokList)
-			stok.GET("/:id", controllers.GetStokDetail)
-			
-			// Admin only
-			stok.POST("", middleware.RoleMiddleware("admin", "staff"), controllers.CreateStok)
-			stok.PUT("/:id", middleware.RoleMiddleware("admin", "staff"), controllers.UpdateStok)
+			stok.GET("", middleware.PermissionMiddleware(middleware.PermStokRead), stock.GetStokList)
+			stok.GET("/:id", middleware.PermissionMiddleware(middleware.PermStokRead), stock.GetStokDetail)
+			stok.POST("", middleware.PermissionMiddleware(middleware.PermStokCreate), stock.CreateStok)
+			stok.PUT("/:id", middleware.PermissionMiddleware(middleware.PermStokUpdate), stock.UpdateStok)
+			stok.GET("/:id/ageing", middleware.PermissionMiddleware(middleware.PermStokRead), stock.GetStokAgeingLog)
+			stok.POST("/:id/adjustments", middleware.PermissionMiddleware(middleware.PermStokUpdate), stock.CreateStokAdjustment)
+		}
+
+		// Penyesuaian Stok
+		adjustments := protected.Group("/stok-adjustments")
+		{
+			adjustments.GET("", middleware.PermissionMiddleware(middleware.PermStokUpdate), stock.GetStokAdjustments)
+			adjustments.PUT("/:id/review", middleware.PermissionMiddleware(middleware.PermStokAdjustApprove), stock.ReviewStokAdjustment)
+		}
+
+		// Ageing Stok TBS
+		ageing := protected.Group("/stok-ageing")
+		{
+			ageing.GET("/rules", middleware.PermissionMiddleware(middleware.PermStokRead), stock.GetStokAgeingRules)
+			ageing.POST("/rules", middleware.PermissionMiddleware(middleware.PermStokAgeing), stock.CreateStokAgeingRule)
+			ageing.PUT("/rules/:id", middleware.PermissionMiddleware(middleware.PermStokAgeing), stock.UpdateStokAgeingRule)
+			ageing.POST("/run", middleware.PermissionMiddleware(middleware.PermStokAgeing), stock.RunStokAgeingNow)
+		}
+
+		// Panen per Blok
+		panen := protected.Group("/panen")
+		{
+			panen.GET("", middleware.PermissionMiddleware(middleware.PermPanenRead), controllers.GetPanenList)
+			panen.POST("", middleware.PermissionMiddleware(middleware.PermPanenCreate), controllers.CreatePanen)
+			panen.DELETE("/:id", middleware.PermissionMiddleware(middleware.PermPanenCreate), controllers.DeletePanen)
+			panen.GET("/:id/pemanen", middleware.PermissionMiddleware(middleware.PermPanenRead), controllers.GetPanenPemanen)
+			panen.PUT("/:id/pemanen", middleware.PermissionMiddleware(middleware.PermPanenCreate), controllers.UpdatePanenPemanen)
+		}
+
+		// Tim Panen & Pemanen
+		tim := protected.Group("/tim-panen")
+		{
+			tim.GET("", middleware.PermissionMiddleware(middleware.PermPanenRead), controllers.GetTimPanenList)
+			tim.POST("", middleware.PermissionMiddleware(middleware.PermPemanenManage), controllers.CreateTimPanen)
+			tim.PUT("/:id", middleware.PermissionMiddleware(middleware.PermPemanenManage), controllers.UpdateTimPanen)
+		}
+
+		pemanen := protected.Group("/pemanen")
+		{
+			pemanen.GET("", middleware.PermissionMiddleware(middleware.PermPanenRead), controllers.GetPemanenList)
+			pemanen.GET("/:id/output", middleware.PermissionMiddleware(middleware.PermPanenRead), controllers.GetPemanenOutput)
+			pemanen.POST("", middleware.PermissionMiddleware(middleware.PermPemanenManage), controllers.CreatePemanen)
+			pemanen.PUT("/:id", middleware.PermissionMiddleware(middleware.PermPemanenManage), controllers.UpdatePemanen)
+		}
+
+		premi := protected.Group("/premi-rules")
+		{
+			premi.GET("", middleware.PermissionMiddleware(middleware.PermPanenRead), controllers.GetPremiRules)
+			premi.POST("", middleware.PermissionMiddleware(middleware.PermPemanenManage), controllers.CreatePremiRule)
+			premi.PUT("/:id", middleware.PermissionMiddleware(middleware.PermPemanenManage), controllers.UpdatePremiRule)
+		}
+
+		// Payroll Pemanen
+		payroll := protected.Group("/payroll")
+		{
+			payroll.GET("", middleware.PermissionMiddleware(middleware.PermPayrollRead), controllers.GetPayrollList)
+			payroll.GET("/:id", middleware.PermissionMiddleware(middleware.PermPayrollRead), controllers.GetPayrollDetail)
+			payroll.GET("/:id/export", middleware.PermissionMiddleware(middleware.PermPayrollRead), controllers.ExportPayroll)
+			payroll.POST("", middleware.PermissionMiddleware(middleware.PermPayrollRun), controllers.CreatePayroll)
+			payroll.POST("/:id/recalculate", middleware.PermissionMiddleware(middleware.PermPayrollRun), controllers.RecalculatePayroll)
+			payroll.POST("/:id/finalize", middleware.PermissionMiddleware(middleware.PermPayrollRun), controllers.FinalizePayroll)
+			payroll.DELETE("/:id", middleware.PermissionMiddleware(middleware.PermPayrollRun), controllers.DeletePayroll)
 		}
 
 		// Purchase Orders
 		po := protected.Group("/purchase-orders")
 		{
-			po.GET("", controllers.GetPurchaseOrders)
-			po.GET("/:id", controllers.GetPurchaseOrderDetail)
-			po.POST("", middleware.RoleMiddleware("buyer"), controllers.CreatePurchaseOrder)
-			po.DELETE("/:id", controllers.CancelPurchaseOrder)
-			
-			// Admin only
-			po.PUT("/:id/status", middleware.RoleMiddleware("admin", "staff"), controllers.UpdatePOStatus)
+			// Row-level scoping (read.all / read.own) is applied in the handlers
+			po.GET("", orders.GetPurchaseOrders)
+			po.GET("/:id", orders.GetPurchaseOrderDetail)
+			po.POST("", middleware.PermissionMiddleware(middleware.PermPOCreate), orders.CreatePurchaseOrder)
+			po.DELETE("/:id", middleware.PermissionMiddleware(middleware.PermPOCancel, middleware.PermPOCancelOwn), orders.CancelPurchaseOrder)
+			po.PUT("/:id/status", middleware.PermissionMiddleware(middleware.PermPOApprove), orders.UpdatePOStatus)
 		}
 
 		// Jadwal Pengambilan
 		jadwal := protected.Group("/jadwal")
 		{
-			jadwal.GET("", controllers.GetJadwalList)
-			jadwal.POST("", middleware.RoleMiddleware("admin", "staff"), controllers.CreateJadwal)
+			jadwal.GET("", weighing.GetJadwalList)
+			jadwal.POST("", middleware.PermissionMiddleware(middleware.PermJadwalCreate), weighing.CreateJadwal)
+		}
+
+		// Kendaraan
+		kendaraan := protected.Group("/kendaraan")
+		{
+			kendaraan.GET("", middleware.PermissionMiddleware(middleware.PermJadwalRead), controllers.GetKendaraanList)
+			kendaraan.POST("", middleware.PermissionMiddleware(middleware.PermJadwalCreate), controllers.CreateKendaraan)
 		}
 
 		// Timbangan
 		timbang := protected.Group("/timbangan")
 		{
-			timbang.GET("", controllers.GetTimbangan)
-			timbang.POST("/:id/weigh-in", middleware.RoleMiddleware("staff", "admin"), controllers.WeighIn)
-			timbang.POST("/:id/weigh-out", middleware.RoleMiddleware("staff", "admin"), controllers.WeighOut)
+			timbang.GET("", weighing.GetTimbangan)
+			timbang.POST("/:id/weigh-in", middleware.PermissionMiddleware(middleware.PermTimbanganWeigh), weighing.WeighIn)
+			timbang.POST("/:id/weigh-out", middleware.PermissionMiddleware(middleware.PermTimbanganWeigh), weighing.WeighOut)
 		}
 
 		// Dokumen Penjualan
 		dokumen := protected.Group("/dokumen")
 		{
-			dokumen.GET("", controllers.GetDokumen)
+			dokumen.GET("", weighing.GetDokumen)
 		}
 
 		// Pembayaran
 		pembayaran := protected.Group("/pembayaran")
 		{
-			pembayaran.GET("", controllers.GetPembayaran)
-			pembayaran.POST("", middleware.RoleMiddleware("buyer"), controllers.CreatePembayaran)
-			pembayaran.PUT("/:id/verify", middleware.RoleMiddleware("admin", "staff"), controllers.VerifyPembayaran)
+			pembayaran.GET("", payments.GetPembayaran)
+			pembayaran.POST("", middleware.PermissionMiddleware(middleware.PermPembayaranCreate), payments.CreatePembayaran)
+			pembayaran.PUT("/:id/verify", middleware.PermissionMiddleware(middleware.PermPembayaranVerify), payments.VerifyPembayaran)
+		}
+
+		// Bulk Import (permission depends on the entity and is checked in the handler)
+		importGroup := protected.Group("/import")
+		{
+			importGroup.GET("/:entity/template", controllers.GetImportTemplate)
+			importGroup.POST("/:entity", controllers.ImportData)
 		}
 
 		// Reports & Dashboard
 		reports := protected.Group("/reports")
 		{
-			reports.GET("/daily-sales", middleware.RoleMiddleware("admin", "staff"), controllers.GetDailySales)
-			reports.GET("/dashboard", controllers.GetDashboardStats)
+			reports.GET("/daily-sales", middleware.PermissionMiddleware(middleware.PermReportSales), payments.GetDailySales)
+			reports.GET("/sales-analytics", middleware.PermissionMiddleware(middleware.PermReportSales), controllers.GetSalesAnalytics)
+			reports.GET("/dashboard", middleware.PermissionMiddleware(middleware.PermReportDashboard), controllers.GetDashboardStats)
+			reports.GET("/yield", middleware.PermissionMiddleware(middleware.PermReportYield), controllers.GetYieldReport)
+			reports.GET("/yield/underperforming", middleware.PermissionMiddleware(middleware.PermReportYield), controllers.GetUnderperformingBlok)
+			reports.GET("/restan", middleware.PermissionMiddleware(middleware.PermReportRestan), stock.GetRestanReport)
+			reports.GET("/restan/history", middleware.PermissionMiddleware(middleware.PermReportRestan), stock.GetRestanHistory)
+			reports.GET("/receivables", middleware.PermissionMiddleware(middleware.PermReportSales), payments.GetReceivables)
+			reports.GET("/weighbridge", middleware.PermissionMiddleware(middleware.PermReportWeighbridge), controllers.GetWeighbridgeReport)
+			reports.GET("/quality", middleware.PermissionMiddleware(middleware.PermReportQuality), controllers.GetQualityReport)
 		}
 
-		// Log Aktivitas (Admin only)
+		// Jadwal Pengiriman Laporan
+		schedules := protected.Group("/report-schedules")
+		schedules.Use(middleware.PermissionMiddleware(middleware.PermReportSchedule))
+		{
+			schedules.GET("", controllers.GetReportSchedules)
+			schedules.GET("/types", controllers.GetReportScheduleTypes)
+			schedules.POST("", controllers.CreateReportSchedule)
+			schedules.PUT("/:id", controllers.UpdateReportSchedule)
+			schedules.DELETE("/:id", controllers.DeleteReportSchedule)
+			schedules.POST("/:id/run", controllers.RunReportScheduleNow)
+			schedules.GET("/:id/runs", controllers.GetReportScheduleRuns)
+		}
+
+		// Administration
+		admin := protected.Group("/admin")
+		{
+			admin.GET("/locked-accounts", middleware.PermissionMiddleware(middleware.PermUserManage), users.GetLockedAccounts)
+			admin.POST("/users/:id/unlock", middleware.PermissionMiddleware(middleware.PermUserManage), users.UnlockAccount)
+			admin.POST("/users/:id/reset-2fa", middleware.PermissionMiddleware(middleware.PermUserManage), users.ResetUserMFA)
+
+			admin.GET("/permissions", middleware.PermissionMiddleware(middleware.PermPermissionManage), controllers.GetPermissions)
+			admin.GET("/roles/permissions", middleware.PermissionMiddleware(middleware.PermPermissionManage), controllers.GetRolePermissions)
+			admin.PUT("/roles/:role/permissions", middleware.PermissionMiddleware(middleware.PermPermissionManage), controllers.UpdateRolePermissions)
+
+			admin.GET("/service-accounts", middleware.PermissionMiddleware(middleware.PermAPIKeyManage), controllers.GetServiceAccounts)
+			admin.POST("/service-accounts", middleware.PermissionMiddleware(middleware.PermAPIKeyManage), controllers.CreateServiceAccount)
+			admin.GET("/api-keys", middleware.PermissionMiddleware(middleware.PermAPIKeyManage), controllers.GetAPIKeys)
+			admin.POST("/api-keys", middleware.PermissionMiddleware(middleware.PermAPIKeyManage), controllers.CreateAPIKey)
+			admin.DELETE("/api-keys/:id", middleware.PermissionMiddleware(middleware.PermAPIKeyManage), controllers.RevokeAPIKey)
+		}
+
+		// Log Aktivitas
 		logs := protected.Group("/logs")
-		logs.Use(middleware.RoleMiddleware("admin"))
+		logs.Use(middleware.PermissionMiddleware(middleware.PermLogRead))
+		{
+			logs.GET("", activity.GetLogAktivitas)
+			logs.GET("/statistics", activity.GetLogStatistics)
+			logs.GET("/archives", controllers.GetLogArchives)
+			logs.GET("/archives/:id/download", controllers.DownloadLogArchive)
+		}
+
+		// Audit Trail
+		audit := protected.Group("/audit")
+		audit.Use(middleware.PermissionMiddleware(middleware.PermAuditRead))
 		{
-			logs.GET("", controllers.GetLogAktivitas)
+			audit.GET("/verify", controllers.VerifyAuditLog)
+			audit.GET("/checkpoints", controllers.GetAuditCheckpoints)
+			audit.POST("/checkpoints", controllers.CreateAuditCheckpointNow)
+			audit.GET("/checkpoints/:id/download", controllers.DownloadAuditCheckpoint)
+			audit.GET("/:entity/:id", controllers.GetAuditTimeline)
 		}
 	}
 
@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890", in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Appendix B lists 8-digit codes; the package issues 6 digits, which are their last six
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},          // 94287082
+	{1111111109, "081804"},  // 07081804
+	{1111111111, "050471"},  // 14050471
+	{1234567890, "005924"},  // 89005924
+	{2000000000, "279037"},  // 69279037
+	{20000000000, "353130"}, // 65353130
+}
+
+func TestCodeAtRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		got, err := CodeAt(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.code {
+			t.Errorf("CodeAt(T=%d) = %s, want %s", v.unix, got, v.code)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := Validate(rfcSecret, v.code, now)
+		if !ok {
+			t.Errorf("Validate(T=%d, %s) rejected", v.unix, v.code)
+			continue
+		}
+		if step != Step(now) {
+			t.Errorf("Validate(T=%d) matched step %d, want %d", v.unix, step, Step(now))
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code := "050471"
+
+	// One step of clock drift either way is accepted, two is not
+	if _, ok := Validate(rfcSecret, code, now.Add(Period*time.Second)); !ok {
+		t.Error("code from the previous step rejected")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(-Period*time.Second)); !ok {
+		t.Error("code from the next step rejected")
+	}
+	if _, ok := Validate(rfcSecret, code, now.Add(2*Period*time.Second)); ok {
+		t.Error("code two steps old accepted")
+	}
+
+	if _, ok := Validate(rfcSecret, "050 471", now); !ok {
+		t.Error("code with a space rejected")
+	}
+	for _, bad := range []string{"", "05047", "0504710", "050472"} {
+		if _, ok := Validate(rfcSecret, bad, now); ok {
+			t.Errorf("Validate(%q) accepted", bad)
+		}
+	}
+}
@@ -107,11 +107,9 @@ const ManageStok = () => {
 
     try {
       if (editMode) {
-        // Update only sends partial data
+        // Quantity and status change only through stock adjustments
         const updateData = {
-          jumlah_tersedia: parseFloat(formData.jumlah_kg),
           harga_per_kg: parseFloat(formData.harga_per_kg),
-          status: 'available',
           keterangan: formData.keterangan
         };
         await stokAPI.update(currentStok.id, updateData);
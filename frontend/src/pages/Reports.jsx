@@ -1,8 +1,7 @@
 import React, { useEffect, useState } from 'react';
-import { reportsAPI } from '../services/api';
+import { reportsAPI, exportAPI } from '../services/api';
 import Navbar from '../components/Navbar';
 import './Dashboard.css';
-import * as XLSX from 'xlsx';
 import {
   Chart as ChartJS,
   CategoryScale,
@@ -173,153 +172,40 @@ const Reports = () => {
     });
   };
 
-  const exportToExcel = () => {
-    const data = getFilteredData();
-    if (data.length === 0) {
-      alert('Tidak ada data untuk diekspor');
-      return;
-    }
-
-    let worksheetData = [];
-    let filename = '';
-
-    if (reportType === 'penjualan') {
-      filename = 'Laporan_Penjualan.xlsx';
-      // Create header row
-      worksheetData.push(['Tanggal', 'Jumlah Transaksi', 'Total KG', 'Total Pendapatan', 'Rata-rata Harga']);
-      // Add data rows
-      data.forEach(item => {
-        worksheetData.push([
-          formatDate(item.tanggal),
-          item.jumlah_transaksi,
-          item.total_kg,
-          item.total_pendapatan,
-          item.rata_rata_harga
-        ]);
-      });
-    } else if (reportType === 'timbangan') {
-      filename = 'Laporan_Timbangan.xlsx';
-      worksheetData.push(['ID Timbangan', 'PO ID', 'Plat Nomor', 'Berat Bersih (kg)', 'Grade', 'Status', 'Waktu']);
-      data.forEach(item => {
-        worksheetData.push([
-          item.id,
-          `PO-${item.po_id}`,
-          item.plat_nomor || '-',
-          item.berat_bersih || '-',
-          item.grade_aktual || 'Belum',
-          item.status === 'completed' ? 'Selesai' : item.status === 'loading' ? 'Loading' : 'Timbang Masuk',
-          item.waktu_keluar ? new Date(item.waktu_keluar).toLocaleString('id-ID') : item.waktu_masuk ? new Date(item.waktu_masuk).toLocaleString('id-ID') : '-'
-        ]);
-      });
-    } else if (reportType === 'stok') {
-      filename = 'Laporan_Stok.xlsx';
-      worksheetData.push(['Nomor Lot', 'Nama Kebun', 'Jumlah (kg)', 'Grade', 'Status', 'Tanggal Panen']);
-      data.forEach(item => {
-        worksheetData.push([
-          item.nomor_lot,
-          item.nama_kebun || '-',
-          item.jumlah_kg,
-          item.grade,
-          item.status === 'available' ? 'Tersedia' : item.status === 'reserved' ? 'Dialokasikan' : 'Terjual',
-          formatDate(item.tanggal_panen)
-        ]);
-      });
-    }
+  // Exports are generated on the server from the same filters, so every matching
+  // row is included without loading it all into the browser
+  const downloadReport = async (format) => {
+    const endpoints = {
+      penjualan: { path: '/reports/daily-sales', name: 'Laporan_Penjualan' },
+      timbangan: { path: '/timbangan', name: 'Laporan_Timbangan' },
+      stok: { path: '/stok', name: 'Laporan_Stok' },
+    };
+    const { path, name } = endpoints[reportType];
 
-    // Create workbook and worksheet
-    const wb = XLSX.utils.book_new();
-    const ws = XLSX.utils.aoa_to_sheet(worksheetData);
-    
-    // Set column widths
-    const colWidths = worksheetData[0].map(() => ({ wch: 20 }));
-    ws['!cols'] = colWidths;
-    
-    // Add worksheet to workbook
-    XLSX.utils.book_append_sheet(wb, ws, getReportTitle());
-    
-    // Generate Excel file and trigger download
-    XLSX.writeFile(wb, filename);
-  };
+    const params = { format };
+    if (filters.startDate) params.start_date = filters.startDate;
+    if (filters.endDate) params.end_date = filters.endDate;
+    if (reportType === 'timbangan' && filters.grade) params.grade = filters.grade;
+    if (reportType === 'stok') params.status = filters.status || 'all';
 
-  const generatePDF = () => {
-    const printWindow = window.open('', '_blank');
-    const data = getFilteredData();
-    
-    let tableRows = '';
-    let tableHeaders = '';
-    
-    if (reportType === 'penjualan') {
-      tableHeaders = '<tr><th>Tanggal</th><th>Jumlah Transaksi</th><th>Total KG</th><th>Total Pendapatan</th><th>Rata-rata Harga</th></tr>';
-      tableRows = data.map(item => `
-        <tr>
-          <td>${formatDate(item.tanggal)}</td>
-          <td>${item.jumlah_transaksi}</td>
-          <td>${item.total_kg.toLocaleString('id-ID')} kg</td>
-          <td>${formatCurrency(item.total_pendapatan)}</td>
-          <td>${formatCurrency(item.rata_rata_harga)}/kg</td>
-        </tr>
-      `).join('');
-    } else if (reportType === 'timbangan') {
-      tableHeaders = '<tr><th>PO Number</th><th>Berat Masuk</th><th>Berat Keluar</th><th>Berat Bersih</th><th>Grade</th><th>Waktu</th></tr>';
-      tableRows = data.map(item => `
-        <tr>
-          <td>${item.po_number || '-'}</td>
-          <td>${item.berat_masuk || 0} kg</td>
-          <td>${item.berat_keluar || 0} kg</td>
-          <td>${item.berat_bersih || 0} kg</td>
-          <td>${item.grade_aktual || '-'}</td>
-          <td>${item.waktu_masuk ? new Date(item.waktu_masuk).toLocaleString('id-ID') : '-'}</td>
-        </tr>
-      `).join('');
-    } else if (reportType === 'stok') {
-      tableHeaders = '<tr><th>Nomor Lot</th><th>Kebun</th><th>Jumlah</th><th>Grade</th><th>Status</th><th>Tanggal Panen</th></tr>';
-      tableRows = data.map(item => `
-        <tr>
-          <td>${item.nomor_lot}</td>
-          <td>${item.nama_kebun || '-'}</td>
-          <td>${item.jumlah_kg} kg</td>
-          <td>${item.grade}</td>
-          <td>${item.status}</td>
-          <td>${formatDate(item.tanggal_panen)}</td>
-        </tr>
-      `).join('');
+    try {
+      const response = await exportAPI.download(path, params);
+      const url = window.URL.createObjectURL(response.data);
+      const link = document.createElement('a');
+      link.href = url;
+      link.download = `${name}.${format}`;
+      document.body.appendChild(link);
+      link.click();
+      link.remove();
+      window.URL.revokeObjectURL(url);
+    } catch (error) {
+      let message = 'Gagal mengekspor laporan';
+      if (error.response?.data instanceof Blob) {
+        const body = JSON.parse(await error.response.data.text());
+        message = body.error || message;
+      }
+      alert(message);
     }
-    
-    const htmlContent = `
-      <!DOCTYPE html>
-      <html>
-      <head>
-        <title>${getReportTitle()}</title>
-        <style>
-          body { font-family: Arial, sans-serif; padding: 20px; }
-          h1 { color: #2e7d32; text-align: center; }
-          table { width: 100%; border-collapse: collapse; margin: 20px 0; }
-          th, td { border: 1px solid #ddd; padding: 12px; text-align: left; }
-          th { background-color: #2e7d32; color: white; }
-          tr:nth-child(even) { background-color: #f5f5f5; }
-          @media print { .no-print { display: none; } }
-        </style>
-      </head>
-      <body>
-        <h1>📊 ${getReportTitle()}</h1>
-        <p style="text-align: center; color: #666;">Tanggal Generate: ${new Date().toLocaleDateString('id-ID', { day: 'numeric', month: 'long', year: 'numeric', hour: '2-digit', minute: '2-digit' })}</p>
-        
-        <table>
-          <thead>${tableHeaders}</thead>
-          <tbody>${tableRows}</tbody>
-        </table>
-        
-        <button class="no-print" onclick="window.print()" style="
-          background: #2e7d32; color: white; padding: 12px 24px; 
-          border: none; border-radius: 6px; cursor: pointer; font-size: 16px;
-          display: block; margin: 20px auto;
-        ">🖨️ Cetak Dokumen</button>
-      </body>
-      </html>
-    `;
-    
-    printWindow.document.write(htmlContent);
-    printWindow.document.close();
   };
 
   return (
@@ -334,14 +220,21 @@ const Reports = () => {
             </div>
             <div style={{ display: 'flex', gap: '10px' }}>
               <button 
-                onClick={exportToExcel}
+                onClick={() => downloadReport('xlsx')}
                 className="btn btn-primary"
                 style={{ height: 'fit-content' }}
               >
                 📊 Export Excel
               </button>
               <button 
-                onClick={generatePDF}
+                onClick={() => downloadReport('csv')}
+                className="btn btn-primary"
+                style={{ height: 'fit-content' }}
+              >
+                📑 Export CSV
+              </button>
+              <button 
+                onClick={() => downloadReport('pdf')}
                 className="btn btn-primary"
                 style={{ height: 'fit-content' }}
               >
@@ -103,4 +103,9 @@ export const reportsAPI = {
   getDashboard: () => api.get('/reports/dashboard'),
 };
 
+// Report exports (format: xlsx, csv or pdf)
+export const exportAPI = {
+  download: (path, params) => api.get(path, { params, responseType: 'blob' }),
+};
+
 export default api;